@@ -0,0 +1,713 @@
+package miniredis
+
+// ACL users, and the permission checks for them.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+const aclLogMaxLen = 128 // "acllog-max-len" default
+
+var (
+	errACLSyntax         = errors.New("Syntax error")
+	errACLUnknownCommand = errors.New("Unknown command or category name in ACL")
+	errACLBadHash        = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	errACLNoSuchPassword = errors.New("The password you are trying to remove from the user does not exist")
+	errACLKeyAfterAll    = errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	errACLChanAfterAll   = errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+)
+
+// aclUser is a user, as made by ACL SETUSER.
+type aclUser struct {
+	name      string
+	enabled   bool
+	nopass    bool
+	passwords []string // SHA256 hashes, hex encoded
+	commands  []string // rules such as "+@all" or "-flushall", in order
+	keys      []string // key patterns
+	channels  []string // pub/sub channel patterns
+}
+
+// aclRuleError is an invalid ACL SETUSER rule.
+type aclRuleError struct {
+	rule string
+	err  error
+}
+
+func (e aclRuleError) Error() string {
+	return fmt.Sprintf("Error in ACL SETUSER modifier '%s': %s", e.rule, e.err)
+}
+
+// aclLogEntry is a single ACL LOG entry.
+type aclLogEntry struct {
+	count      int
+	reason     string // "command", "key", "channel", or "auth"
+	context    string // "toplevel", "multi", or "lua"
+	object     string
+	username   string
+	created    time.Time
+	clientInfo string
+}
+
+// aclCategories are the ACL categories, in the order ACL CAT lists them, with
+// their commands. Subcommands, such as "ACL|WHOAMI", have their own categories
+// if they are listed separately. Every command not in @fast is in @slow.
+var aclCategories = []struct {
+	name     string
+	commands []string
+}{
+	{"keyspace", []string{
+		"DBSIZE", "DEL", "DUMP", "EXISTS", "EXPIRE", "EXPIREAT", "FLUSHALL",
+		"FLUSHDB", "KEYS", "MOVE", "OBJECT", "PERSIST", "PEXPIRE", "PEXPIREAT",
+		"PTTL", "RANDOMKEY", "RENAME", "RENAMENX", "RESTORE", "SCAN", "SWAPDB",
+		"TTL", "TYPE", "UNLINK",
+	}},
+	{"read", []string{
+		"BITCOUNT", "BITPOS", "DBSIZE", "DUMP", "EXISTS", "GEOPOS",
+		"GEORADIUS_RO", "GET", "GETBIT", "GETRANGE", "HEXISTS", "HGET",
+		"HGETALL", "HKEYS", "HLEN", "HMGET", "HSCAN", "HVALS", "KEYS", "LINDEX",
+		"LLEN", "LRANGE", "MEMORY", "MGET", "OBJECT", "PFCOUNT", "PTTL",
+		"RANDOMKEY", "SCAN", "SCARD", "SDIFF", "SINTER", "SISMEMBER",
+		"SMEMBERS", "SRANDMEMBER", "SSCAN", "STRLEN", "SUNION", "TTL", "TYPE",
+		"XINFO", "XLEN", "XPENDING", "XRANGE", "XREAD", "XREVRANGE", "ZCARD",
+		"ZCOUNT", "ZLEXCOUNT", "ZRANGE", "ZRANGEBYLEX", "ZRANGEBYSCORE",
+		"ZRANK", "ZREVRANGE", "ZREVRANGEBYLEX", "ZREVRANGEBYSCORE", "ZREVRANK",
+		"ZSCAN", "ZSCORE",
+	}},
+	{"write", nil}, // writeCommands
+	{"set", []string{
+		"SADD", "SCARD", "SDIFF", "SDIFFSTORE", "SINTER", "SINTERSTORE",
+		"SISMEMBER", "SMEMBERS", "SMOVE", "SPOP", "SRANDMEMBER", "SREM",
+		"SSCAN", "SUNION", "SUNIONSTORE",
+	}},
+	{"sortedset", []string{
+		"ZADD", "ZCARD", "ZCOUNT", "ZINCRBY", "ZINTERSTORE", "ZLEXCOUNT",
+		"ZPOPMAX", "ZPOPMIN", "ZRANGE", "ZRANGEBYLEX", "ZRANGEBYSCORE",
+		"ZRANK", "ZREM", "ZREMRANGEBYLEX", "ZREMRANGEBYRANK",
+		"ZREMRANGEBYSCORE", "ZREVRANGE", "ZREVRANGEBYLEX", "ZREVRANGEBYSCORE",
+		"ZREVRANK", "ZSCAN", "ZSCORE", "ZUNIONSTORE",
+	}},
+	{"list", []string{
+		"BLPOP", "BRPOP", "BRPOPLPUSH", "LINDEX", "LINSERT", "LLEN", "LPOP",
+		"LPUSH", "LPUSHX", "LRANGE", "LREM", "LSET", "LTRIM", "RPOP",
+		"RPOPLPUSH", "RPUSH", "RPUSHX",
+	}},
+	{"hash", []string{
+		"HDEL", "HEXISTS", "HGET", "HGETALL", "HINCRBY", "HINCRBYFLOAT",
+		"HKEYS", "HLEN", "HMGET", "HMSET", "HSCAN", "HSET", "HSETNX", "HVALS",
+	}},
+	{"string", []string{
+		"APPEND", "DECR", "DECRBY", "GET", "GETRANGE", "GETSET", "INCR",
+		"INCRBY", "INCRBYFLOAT", "MGET", "MSET", "MSETNX", "PSETEX", "SET",
+		"SETEX", "SETNX", "SETRANGE", "STRLEN",
+	}},
+	{"bitmap", []string{"BITCOUNT", "BITOP", "BITPOS", "GETBIT", "SETBIT"}},
+	{"hyperloglog", []string{"PFADD", "PFCOUNT", "PFMERGE"}},
+	{"geo", []string{"GEOADD", "GEOPOS", "GEORADIUS", "GEORADIUS_RO"}},
+	{"stream", []string{
+		"XACK", "XADD", "XAUTOCLAIM", "XCLAIM", "XDEL", "XGROUP", "XINFO",
+		"XLEN", "XPENDING", "XRANGE", "XREAD", "XREADGROUP", "XREVRANGE",
+		"XTRIM",
+	}},
+	{"pubsub", []string{
+		"PSUBSCRIBE", "PUBLISH", "PUBSUB", "PUNSUBSCRIBE", "SUBSCRIBE",
+		"UNSUBSCRIBE",
+	}},
+	{"admin", []string{
+		"ACL", "BGREWRITEAOF", "BGSAVE", "CLIENT|KILL", "CLIENT|LIST",
+		"CLIENT|PAUSE", "CLIENT|UNBLOCK", "CLIENT|UNPAUSE", "CONFIG",
+		"LASTSAVE", "MONITOR", "PSYNC", "REPLCONF", "REPLICAOF", "ROLE", "SAVE",
+		"SENTINEL", "SLAVEOF", "SYNC",
+	}},
+	{"fast", []string{
+		"APPEND", "ASKING", "AUTH", "DBSIZE", "DECR", "DECRBY", "ECHO",
+		"EXISTS", "EXPIRE", "EXPIREAT", "GET", "GETBIT", "GETSET", "HDEL",
+		"HELLO", "HEXISTS", "HGET", "HINCRBY", "HINCRBYFLOAT", "HLEN", "HMGET",
+		"HMSET", "HSET", "HSETNX", "INCR", "INCRBY", "INCRBYFLOAT", "LASTSAVE",
+		"LLEN", "LPOP", "LPUSH", "LPUSHX", "MGET", "MSETNX", "MULTI", "PERSIST",
+		"PEXPIRE", "PEXPIREAT", "PFADD", "PING", "PSETEX", "PTTL", "RANDOMKEY",
+		"READONLY", "READWRITE", "ROLE", "RPOP", "RPUSH", "RPUSHX", "SADD",
+		"SCARD", "SELECT", "SETEX", "SETNX", "SISMEMBER", "SMOVE", "SPOP",
+		"SREM", "STRLEN", "SWAPDB", "TIME", "TTL", "TYPE", "UNLINK", "UNWATCH",
+		"WATCH", "XACK", "XADD", "XLEN", "ZADD", "ZCARD", "ZCOUNT", "ZINCRBY",
+		"ZLEXCOUNT", "ZRANK", "ZREM", "ZREVRANK", "ZSCORE",
+	}},
+	{"slow", nil}, // everything not fast
+	{"blocking", []string{"BLPOP", "BRPOP", "BRPOPLPUSH", "XREAD", "XREADGROUP"}},
+	{"dangerous", []string{
+		"ACL", "BGREWRITEAOF", "BGSAVE", "CLIENT|KILL", "CLIENT|LIST",
+		"CLIENT|PAUSE", "CLIENT|UNBLOCK", "CLIENT|UNPAUSE", "CONFIG",
+		"FLUSHALL", "FLUSHDB", "INFO", "KEYS", "LASTSAVE", "MONITOR", "PSYNC",
+		"REPLCONF", "REPLICAOF", "RESTORE", "ROLE", "SAVE", "SENTINEL",
+		"SLAVEOF", "SWAPDB", "SYNC",
+	}},
+	{"connection", []string{
+		"ASKING", "AUTH", "CLIENT", "CLIENT|KILL", "CLIENT|LIST",
+		"CLIENT|PAUSE", "CLIENT|UNBLOCK", "CLIENT|UNPAUSE", "ECHO", "HELLO",
+		"PING", "QUIT", "READONLY", "READWRITE", "SELECT", "WAIT",
+	}},
+	{"transaction", []string{"DISCARD", "EXEC", "MULTI", "UNWATCH", "WATCH"}},
+	{"scripting", []string{"EVAL", "EVALSHA", "SCRIPT"}},
+}
+
+var (
+	aclCommandCategoriesOnce sync.Once
+	aclCommandCategoriesMap  map[string]map[string]bool
+)
+
+// aclCommandCategories has the categories of every command, and of the
+// subcommands with their own categories. It's made on first use, since it
+// needs writeCommands.
+func aclCommandCategories() map[string]map[string]bool {
+	aclCommandCategoriesOnce.Do(func() {
+		cmds := map[string]map[string]bool{}
+		add := func(cmd, cat string) {
+			if cmds[cmd] == nil {
+				cmds[cmd] = map[string]bool{}
+			}
+			cmds[cmd][cat] = true
+		}
+		for c := range writeCommands {
+			add(c, "write")
+		}
+		for _, cat := range aclCategories {
+			for _, c := range cat.commands {
+				add(c, cat.name)
+			}
+		}
+		// these have other categories than their parent command
+		for _, c := range []string{"ACL|CAT", "ACL|WHOAMI"} {
+			cmds[c] = map[string]bool{}
+		}
+		for c, cats := range cmds {
+			if !cats["fast"] {
+				add(c, "slow")
+			}
+		}
+		aclCommandCategoriesMap = cmds
+	})
+	return aclCommandCategoriesMap
+}
+
+// newACLUser is a user as ACL SETUSER makes it: disabled, and without any
+// permissions.
+func newACLUser(name string) *aclUser {
+	return &aclUser{name: name}
+}
+
+// defaultACLUser is the "default" user, which can do everything.
+func defaultACLUser() *aclUser {
+	return &aclUser{
+		name:     "default",
+		enabled:  true,
+		nopass:   true,
+		commands: []string{"+@all"},
+		keys:     []string{"*"},
+		channels: []string{"*"},
+	}
+}
+
+func (u *aclUser) copy() *aclUser {
+	cp := *u
+	cp.passwords = append([]string(nil), u.passwords...)
+	cp.commands = append([]string(nil), u.commands...)
+	cp.keys = append([]string(nil), u.keys...)
+	cp.channels = append([]string(nil), u.channels...)
+	return &cp
+}
+
+// setPassword makes pw the only password, or allows any password if pw is
+// empty. This is what requirepass does to the default user.
+func (u *aclUser) setPassword(pw string) {
+	u.passwords = nil
+	u.nopass = pw == ""
+	if pw != "" {
+		u.passwords = []string{hashPassword(pw)}
+	}
+}
+
+// checkPassword is true if the user is enabled and pw is valid.
+func (u *aclUser) checkPassword(pw string) bool {
+	if !u.enabled {
+		return false
+	}
+	if u.nopass {
+		return true
+	}
+	h := hashPassword(pw)
+	for _, p := range u.passwords {
+		if p == h {
+			return true
+		}
+	}
+	return false
+}
+
+// apply changes the user with a single ACL SETUSER rule.
+func (u *aclUser) apply(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.keys = []string{"*"}
+		return nil
+	case "resetkeys":
+		u.keys = nil
+		return nil
+	case "allchannels":
+		u.channels = []string{"*"}
+		return nil
+	case "resetchannels":
+		u.channels = nil
+		return nil
+	case "allcommands":
+		u.commands = []string{"+@all"}
+		return nil
+	case "nocommands":
+		u.commands = nil
+		return nil
+	case "reset":
+		*u = *newACLUser(u.name)
+		return nil
+	}
+
+	if rule == "" {
+		return errACLSyntax
+	}
+	switch arg := rule[1:]; rule[0] {
+	case '>':
+		u.addPassword(hashPassword(arg))
+	case '#':
+		if !validPasswordHash(arg) {
+			return errACLBadHash
+		}
+		u.addPassword(arg)
+	case '<':
+		return u.removePassword(hashPassword(arg))
+	case '!':
+		if !validPasswordHash(arg) {
+			return errACLBadHash
+		}
+		return u.removePassword(arg)
+	case '~':
+		if len(u.keys) > 0 && u.keys[0] == "*" {
+			return errACLKeyAfterAll
+		}
+		u.keys = addPattern(u.keys, arg)
+	case '&':
+		if len(u.channels) > 0 && u.channels[0] == "*" {
+			return errACLChanAfterAll
+		}
+		u.channels = addPattern(u.channels, arg)
+	case '+', '-':
+		arg = strings.ToLower(arg)
+		if !validCommandRule(arg) {
+			return errACLUnknownCommand
+		}
+		if arg == "@all" {
+			u.commands = nil
+			if rule[0] == '+' {
+				u.commands = []string{"+@all"}
+			}
+			return nil
+		}
+		u.commands = append(u.commands, rule[:1]+arg)
+	default:
+		return errACLSyntax
+	}
+	return nil
+}
+
+func (u *aclUser) addPassword(h string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == h {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, h)
+}
+
+func (u *aclUser) removePassword(h string) error {
+	for i, p := range u.passwords {
+		if p == h {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errACLNoSuchPassword
+}
+
+func addPattern(ps []string, p string) []string {
+	if p == "*" {
+		return []string{"*"}
+	}
+	for _, e := range ps {
+		if e == p {
+			return ps
+		}
+	}
+	return append(ps, p)
+}
+
+// validCommandRule checks the argument of a "+" or "-" rule, such as "get",
+// "config|get", or "@read".
+func validCommandRule(r string) bool {
+	if strings.HasPrefix(r, "@") {
+		return r == "@all" || aclCategory(r[1:]) >= 0
+	}
+	cmd := strings.ToUpper(r)
+	if i := strings.Index(cmd, "|"); i >= 0 {
+		if !containerCommands[cmd[:i]] || i == len(cmd)-1 {
+			return false
+		}
+		cmd = cmd[:i]
+	}
+	_, ok := aclCommandCategories()[cmd]
+	return ok
+}
+
+// aclCategory gives the index of a category in aclCategories, or -1.
+func aclCategory(name string) int {
+	for i, c := range aclCategories {
+		if c.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// categoryCommands are the commands in a category, in lowercase, sorted.
+func categoryCommands(cat string) []string {
+	var cmds []string
+	for c, cats := range aclCommandCategories() {
+		if cats[cat] {
+			cmds = append(cmds, strings.ToLower(c))
+		}
+	}
+	sort.Strings(cmds)
+	return cmds
+}
+
+// canRun is true if the user may run the command. cmd is uppercase, sub is
+// the uppercase subcommand, or "".
+func (u *aclUser) canRun(cmd, sub string) bool {
+	full := cmd
+	if sub != "" {
+		full = cmd + "|" + sub
+	}
+	table := aclCommandCategories()
+	cats, ok := table[full]
+	if !ok {
+		cats = table[cmd]
+	}
+	var (
+		lcmd  = strings.ToLower(cmd)
+		lfull = strings.ToLower(full)
+		may   = false
+	)
+	for _, r := range u.commands {
+		switch arg := r[1:]; {
+		case arg == "@all",
+			strings.HasPrefix(arg, "@") && cats[arg[1:]],
+			arg == lcmd,
+			arg == lfull:
+			may = r[0] == '+'
+		}
+	}
+	return may
+}
+
+// canKey is true if the user may access the key.
+func (u *aclUser) canKey(key string) bool {
+	return matchAny(u.keys, key)
+}
+
+// canChannel is true if the user may use the channel.
+func (u *aclUser) canChannel(ch string) bool {
+	return matchAny(u.channels, ch)
+}
+
+// canPattern is true if the user may PSUBSCRIBE to the pattern. Patterns are
+// compared literally.
+func (u *aclUser) canPattern(p string) bool {
+	for _, c := range u.channels {
+		if c == "*" || c == p {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if p == "*" {
+			return true
+		}
+		if re := patternRE(p); re != nil && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// flags are the flags as ACL GETUSER shows them.
+func (u *aclUser) flags() []string {
+	fs := []string{"off"}
+	if u.enabled {
+		fs[0] = "on"
+	}
+	if u.nopass {
+		fs = append(fs, "nopass")
+	}
+	return fs
+}
+
+// commandRules describes the command permissions, such as "-@all +get".
+func (u *aclUser) commandRules() string {
+	rs := u.commands
+	if len(rs) == 0 || rs[0] != "+@all" {
+		rs = append([]string{"-@all"}, rs...)
+	}
+	return strings.Join(rs, " ")
+}
+
+func (u *aclUser) keyRules() string {
+	var rs []string
+	for _, k := range u.keys {
+		rs = append(rs, "~"+k)
+	}
+	return strings.Join(rs, " ")
+}
+
+func (u *aclUser) channelRules() string {
+	if len(u.channels) == 0 {
+		return "resetchannels"
+	}
+	var rs []string
+	for _, c := range u.channels {
+		rs = append(rs, "&"+c)
+	}
+	return strings.Join(rs, " ")
+}
+
+// String describes the user the way ACL LIST does.
+func (u *aclUser) String() string {
+	parts := append([]string{"user", u.name}, u.flags()...)
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	if k := u.keyRules(); k != "" {
+		parts = append(parts, k)
+	}
+	parts = append(parts, u.channelRules(), u.commandRules())
+	return strings.Join(parts, " ")
+}
+
+func hashPassword(pw string) string {
+	h := sha256.Sum256([]byte(pw))
+	return hex.EncodeToString(h[:])
+}
+
+func validPasswordHash(h string) bool {
+	if len(h) != 64 {
+		return false
+	}
+	for _, c := range h {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// SetUser creates or changes an ACL user, with the same rules as ACL SETUSER.
+// For example:
+//
+//	m.SetUser("alice", "on", ">secret", "~cache:*", "&events", "+@read")
+//
+// Connections can log in with AUTH alice secret. The "default" user is the one
+// RequireAuth() sets the password for.
+func (m *Miniredis) SetUser(name string, rules ...string) error {
+	m.Lock()
+	defer m.Unlock()
+	return m.setUser(name, rules)
+}
+
+// DelUser removes an ACL user, and disconnects its connections. It's fine if
+// the user doesn't exist. The "default" user can't be removed.
+func (m *Miniredis) DelUser(name string) error {
+	m.Lock()
+	defer m.Unlock()
+	if name == "default" {
+		return errors.New("the 'default' user cannot be removed")
+	}
+	m.delUser(name)
+	return nil
+}
+
+// setUser applies all rules, or none if one is invalid. Needs the lock.
+func (m *Miniredis) setUser(name string, rules []string) error {
+	u, ok := m.users[name]
+	if ok {
+		u = u.copy()
+	} else {
+		u = newACLUser(name)
+	}
+	for _, r := range rules {
+		if err := u.apply(r); err != nil {
+			return aclRuleError{rule: r, err: err}
+		}
+	}
+	m.users[name] = u
+	return nil
+}
+
+// delUser removes a user, and disconnects its clients. Returns whether the
+// user existed. Needs the lock.
+func (m *Miniredis) delUser(name string) bool {
+	if _, ok := m.users[name]; !ok {
+		return false
+	}
+	delete(m.users, name)
+	if m.srv != nil {
+		for _, p := range m.srv.Peers() {
+			if ctx := getCtx(p); ctx.authenticated && ctx.user == name {
+				p.Kill()
+			}
+		}
+	}
+	return true
+}
+
+// connUser is the user of a connection, or nil if it still needs to AUTH.
+// Needs the lock.
+func (m *Miniredis) connUser(ctx *connCtx) *aclUser {
+	if ctx.authenticated {
+		return m.users[ctx.user]
+	}
+	if u := m.users["default"]; u.enabled && u.nopass {
+		return u
+	}
+	return nil
+}
+
+// connUserName is the name of the user of a connection, as CLIENT LIST shows
+// it. Needs the lock.
+func connUserName(ctx *connCtx) string {
+	if ctx.authenticated && ctx.user != "" {
+		return ctx.user
+	}
+	return "default"
+}
+
+// authUser checks a username and password. Failed attempts go in the ACL
+// log. Needs the lock.
+func (m *Miniredis) authUser(c *server.Peer, name, pw string) bool {
+	if u, ok := m.users[name]; ok && u.checkPassword(pw) {
+		return true
+	}
+	m.aclLogAdd(c, "auth", "AUTH", name)
+	return false
+}
+
+// aclCheck gives the NOPERM error if the user can't run the current command of
+// the connection, or "". Needs the lock.
+func (m *Miniredis) aclCheck(c *server.Peer, ctx *connCtx, u *aclUser) string {
+	cmd, args := ctx.cmd, ctx.args
+	sub := ""
+	if containerCommands[cmd] && len(args) > 0 {
+		sub = strings.ToUpper(args[0])
+	}
+	if !u.canRun(cmd, sub) {
+		object := strings.ToLower(cmd)
+		if sub != "" {
+			object += "|" + strings.ToLower(sub)
+		}
+		m.aclLogAdd(c, "command", object, u.name)
+		return fmt.Sprintf(msgFNoPermCommand, object)
+	}
+	for _, k := range commandKeys(cmd, args) {
+		if !u.canKey(k) {
+			m.aclLogAdd(c, "key", k, u.name)
+			return msgNoPermKey
+		}
+	}
+	var channels []string
+	can := u.canChannel
+	switch cmd {
+	case "PUBLISH":
+		if len(args) > 0 {
+			channels = args[:1]
+		}
+	case "SUBSCRIBE":
+		channels = args
+	case "PSUBSCRIBE":
+		channels = args
+		can = u.canPattern
+	}
+	for _, ch := range channels {
+		if !can(ch) {
+			m.aclLogAdd(c, "channel", ch, u.name)
+			return msgNoPermChannel
+		}
+	}
+	return ""
+}
+
+// aclLogAdd adds an ACL LOG entry, or counts a repeated one. Needs the lock.
+func (m *Miniredis) aclLogAdd(c *server.Peer, reason, object, username string) {
+	ctx := getCtx(c)
+	context := "toplevel"
+	switch {
+	case ctx.origin == "lua":
+		context = "lua"
+	case inTx(ctx):
+		context = "multi"
+	}
+	now := time.Now()
+	for i, e := range m.aclLog {
+		if e.reason == reason && e.context == context && e.object == object && e.username == username && now.Sub(e.created) < time.Minute {
+			e.count++
+			e.created = now
+			copy(m.aclLog[1:i+1], m.aclLog[:i])
+			m.aclLog[0] = e
+			return
+		}
+	}
+	ci := clientInfo(c)
+	e := &aclLogEntry{
+		count:      1,
+		reason:     reason,
+		context:    context,
+		object:     object,
+		username:   username,
+		created:    now,
+		clientInfo: ci.String(),
+	}
+	m.aclLog = append([]*aclLogEntry{e}, m.aclLog...)
+	if len(m.aclLog) > aclLogMaxLen {
+		m.aclLog = m.aclLog[:aclLogMaxLen]
+	}
+}
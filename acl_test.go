@@ -0,0 +1,278 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestACL(t *testing.T) {
+	m, err := Run()
+	ok(t, err)
+	defer m.Close()
+	c, err := redis.Dial("tcp", m.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("users", func(t *testing.T) {
+		v, err := redis.String(c.Do("ACL", "SETUSER", "alice", "on", ">secret", "~cache:*", "+get", "+@hash"))
+		ok(t, err)
+		equals(t, "OK", v)
+
+		users, err := redis.Strings(c.Do("ACL", "USERS"))
+		ok(t, err)
+		equals(t, []string{"alice", "default"}, users)
+
+		list, err := redis.Strings(c.Do("ACL", "LIST"))
+		ok(t, err)
+		equals(t, []string{
+			"user alice on #" + hashPassword("secret") + " ~cache:* resetchannels -@all +get +@hash",
+			"user default on nopass ~* &* +@all",
+		}, list)
+
+		u, err := redis.Values(c.Do("ACL", "GETUSER", "alice"))
+		ok(t, err)
+		equals(t, 12, len(u))
+		flags, err := redis.Strings(u[1], nil)
+		ok(t, err)
+		equals(t, []string{"on"}, flags)
+		pws, err := redis.Strings(u[3], nil)
+		ok(t, err)
+		equals(t, []string{hashPassword("secret")}, pws)
+		cmds, err := redis.String(u[5], nil)
+		ok(t, err)
+		equals(t, "-@all +get +@hash", cmds)
+
+		v2, err := c.Do("ACL", "GETUSER", "nosuch")
+		ok(t, err)
+		equals(t, nil, v2)
+
+		_, err = c.Do("ACL", "SETUSER", "bob", "on", "+nosuch")
+		mustFail(t, err, "ERR Error in ACL SETUSER modifier '+nosuch': Unknown command or category name in ACL")
+		_, err = c.Do("ACL", "SETUSER", "bob", "foo")
+		mustFail(t, err, "ERR Error in ACL SETUSER modifier 'foo': Syntax error")
+		_, err = c.Do("ACL", "SETUSER", "bob", "allkeys", "~foo")
+		mustFail(t, err, "ERR Error in ACL SETUSER modifier '~foo': "+errACLKeyAfterAll.Error())
+		_, err = c.Do("ACL", "SETUSER", "bob", "#abc")
+		mustFail(t, err, "ERR Error in ACL SETUSER modifier '#abc': "+errACLBadHash.Error())
+		_, err = c.Do("ACL", "SETUSER", "bob", "<nosuch")
+		mustFail(t, err, "ERR Error in ACL SETUSER modifier '<nosuch': "+errACLNoSuchPassword.Error())
+		// nothing is changed on errors
+		v2, err = c.Do("ACL", "GETUSER", "bob")
+		ok(t, err)
+		equals(t, nil, v2)
+
+		n, err := redis.Int(c.Do("ACL", "DELUSER", "alice", "nosuch"))
+		ok(t, err)
+		equals(t, 1, n)
+		_, err = c.Do("ACL", "DELUSER", "default")
+		mustFail(t, err, msgDelDefaultUser)
+
+		_, err = c.Do("ACL")
+		mustFail(t, err, "ERR wrong number of arguments for 'acl' command")
+		_, err = c.Do("ACL", "GETUSER")
+		mustFail(t, err, "ERR wrong number of arguments for 'acl|getuser' command")
+		_, err = c.Do("ACL", "FOO")
+		mustFail(t, err, "ERR unknown subcommand 'FOO'. Try ACL HELP.")
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		ok(t, m.SetUser("carol", "on", ">pw1", ">pw2", "allkeys", "+@all"))
+		defer m.DelUser("carol")
+
+		c2, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		_, err = c2.Do("AUTH", "carol", "wrong")
+		mustFail(t, err, msgWrongPass)
+		v, err := redis.String(c2.Do("AUTH", "carol", "pw2"))
+		ok(t, err)
+		equals(t, "OK", v)
+		v, err = redis.String(c2.Do("ACL", "WHOAMI"))
+		ok(t, err)
+		equals(t, "carol", v)
+		cl, err := redis.String(c2.Do("CLIENT", "LIST"))
+		ok(t, err)
+		assert(t, strings.Contains(cl, " user=carol "), "CLIENT LIST user")
+
+		// disabled users can't log in
+		ok(t, m.SetUser("carol", "off"))
+		c3, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer c3.Close()
+		_, err = c3.Do("AUTH", "carol", "pw1")
+		mustFail(t, err, msgWrongPass)
+		_, err = c3.Do("HELLO", "3", "AUTH", "carol", "pw1")
+		mustFail(t, err, msgWrongPass)
+
+		// deleting a user disconnects it
+		ok(t, m.DelUser("carol"))
+		_, err = c2.Do("PING")
+		assert(t, err != nil, "disconnected")
+		mustFail(t, m.DelUser("default"), "the 'default' user cannot be removed")
+
+		// the default user, with a password
+		m.RequireAuth("pass")
+		defer m.RequireAuth("")
+		c4, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer c4.Close()
+		_, err = c4.Do("ACL", "WHOAMI")
+		mustFail(t, err, "NOAUTH Authentication required.")
+		_, err = redis.String(c4.Do("AUTH", "default", "pass"))
+		ok(t, err)
+		v, err = redis.String(c4.Do("ACL", "WHOAMI"))
+		ok(t, err)
+		equals(t, "default", v)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		ok(t, m.SetUser("dave", "on", "nopass", "~cache:*", "&news.*", "+@read", "-hgetall", "+config|get", "+publish", "+psubscribe", "+multi", "+exec", "+eval"))
+		defer m.DelUser("dave")
+		m.Set("cache:foo", "bar")
+		m.Set("secret", "bar")
+
+		c2, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("AUTH", "dave", "any")
+		ok(t, err)
+
+		v, err := redis.String(c2.Do("GET", "cache:foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+		_, err = c2.Do("GET", "secret")
+		mustFail(t, err, msgNoPermKey)
+		_, err = c2.Do("MGET", "cache:foo", "secret")
+		mustFail(t, err, msgNoPermKey)
+		_, err = c2.Do("SET", "cache:foo", "baz")
+		mustFail(t, err, "NOPERM this user has no permissions to run the 'set' command")
+		_, err = c2.Do("HGETALL", "cache:hash")
+		mustFail(t, err, "NOPERM this user has no permissions to run the 'hgetall' command")
+		_, err = c2.Do("HGET", "cache:hash", "f")
+		ok(t, err)
+
+		_, err = c2.Do("CONFIG", "GET", "maxmemory")
+		ok(t, err)
+		_, err = c2.Do("CONFIG", "SET", "maxmemory", "1")
+		mustFail(t, err, "NOPERM this user has no permissions to run the 'config|set' command")
+
+		_, err = c2.Do("PUBLISH", "news.tech", "hi")
+		ok(t, err)
+		_, err = c2.Do("PUBLISH", "gossip", "hi")
+		mustFail(t, err, msgNoPermChannel)
+
+		// transactions fail when a command is denied
+		_, err = c2.Do("MULTI")
+		ok(t, err)
+		_, err = c2.Do("GET", "secret")
+		mustFail(t, err, msgNoPermKey)
+		_, err = c2.Do("EXEC")
+		mustFail(t, err, "EXECABORT Transaction discarded because of previous errors.")
+
+		// scripts have the permissions of the user
+		_, err = c2.Do("EVAL", "return redis.call('GET', 'secret')", 0)
+		assert(t, err != nil && strings.Contains(err.Error(), msgNoPermKey), "NOPERM in script")
+		v, err = redis.String(c2.Do("EVAL", "return redis.call('GET', KEYS[1])", 1, "cache:foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+		_, err = c2.Do("EVAL", "return redis.call('GET', KEYS[1])", 1, "secret")
+		mustFail(t, err, msgNoPermKey)
+
+		// patterns are compared literally
+		_, err = c2.Do("PSUBSCRIBE", "news.[a-z]*")
+		mustFail(t, err, msgNoPermChannel)
+		_, err = c2.Do("PSUBSCRIBE", "news.*")
+		ok(t, err)
+	})
+
+	t.Run("log", func(t *testing.T) {
+		_, err := c.Do("ACL", "LOG", "RESET")
+		ok(t, err)
+		ok(t, m.SetUser("erin", "on", "nopass", "+get"))
+		defer m.DelUser("erin")
+
+		c2, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("AUTH", "erin", "x")
+		ok(t, err)
+		_, err = c2.Do("GET", "foo")
+		mustFail(t, err, msgNoPermKey)
+		_, err = c2.Do("GET", "foo")
+		mustFail(t, err, msgNoPermKey)
+		_, err = c2.Do("SET", "foo", "bar")
+		assert(t, err != nil, "SET")
+		_, err = c2.Do("AUTH", "nosuch", "x")
+		mustFail(t, err, msgWrongPass)
+
+		log, err := redis.Values(c.Do("ACL", "LOG"))
+		ok(t, err)
+		equals(t, 3, len(log))
+		fields := func(v interface{}) map[string]string {
+			kv, err := redis.Values(v, nil)
+			ok(t, err)
+			f := map[string]string{}
+			for i := 0; i+1 < len(kv); i += 2 {
+				k := string(kv[i].([]byte))
+				switch v := kv[i+1].(type) {
+				case []byte:
+					f[k] = string(v)
+				default:
+					f[k] = fmt.Sprint(v)
+				}
+			}
+			return f
+		}
+		entry := fields(log[0])
+		equals(t, "auth", entry["reason"])
+		equals(t, "AUTH", entry["object"])
+		equals(t, "nosuch", entry["username"])
+		entry = fields(log[2])
+		equals(t, "2", entry["count"])
+		equals(t, "key", entry["reason"])
+		equals(t, "toplevel", entry["context"])
+		equals(t, "foo", entry["object"])
+		equals(t, "erin", entry["username"])
+
+		log, err = redis.Values(c.Do("ACL", "LOG", "1"))
+		ok(t, err)
+		equals(t, 1, len(log))
+		_, err = c.Do("ACL", "LOG", "foo")
+		mustFail(t, err, msgInvalidInt)
+	})
+
+	t.Run("cat", func(t *testing.T) {
+		cats, err := redis.Strings(c.Do("ACL", "CAT"))
+		ok(t, err)
+		equals(t, len(aclCategories), len(cats))
+		equals(t, "keyspace", cats[0])
+
+		cmds, err := redis.Strings(c.Do("ACL", "CAT", "hyperloglog"))
+		ok(t, err)
+		equals(t, []string{"pfadd", "pfcount", "pfmerge"}, cmds)
+
+		cmds, err = redis.Strings(c.Do("ACL", "CAT", "write"))
+		ok(t, err)
+		equals(t, len(writeCommands), len(cmds))
+
+		_, err = c.Do("ACL", "CAT", "nosuch")
+		mustFail(t, err, "ERR Unknown category 'nosuch'")
+	})
+
+	t.Run("go", func(t *testing.T) {
+		mustFail(t, m.SetUser("frank", "+nosuch"), "Error in ACL SETUSER modifier '+nosuch': Unknown command or category name in ACL")
+		ok(t, m.SetUser("frank", "on", ">pw", "allkeys", "allchannels", "+@all", "-@dangerous"))
+		defer m.DelUser("frank")
+		u := m.users["frank"]
+		assert(t, u.canRun("GET", ""), "get")
+		assert(t, !u.canRun("FLUSHALL", ""), "flushall")
+		assert(t, !u.canRun("CLIENT", "KILL"), "client kill")
+		assert(t, u.canRun("CLIENT", "SETNAME"), "client setname")
+		assert(t, !u.canRun("ACL", "SETUSER"), "acl setuser")
+		assert(t, u.canRun("ACL", "WHOAMI"), "acl whoami")
+	})
+}
@@ -0,0 +1,493 @@
+package miniredis
+
+// Append-only file support. Successful write commands are appended to the AOF,
+// in RESP, in a form which gives the same data when it's replayed later.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// aofRewriteItems is the max number of elements in a single command in a
+// rewritten AOF, the same as Redis.
+const aofRewriteItems = 64
+
+var errInvalidAOF = errors.New("invalid AOF data")
+
+// writeCommands are the commands which can change data. Only those get
+// appended to the AOF.
+var writeCommands = map[string]bool{}
+
+func init() {
+	for _, c := range []string{
+		"APPEND", "BITOP", "BLPOP", "BRPOP", "BRPOPLPUSH", "DECR", "DECRBY",
+		"DEL", "EXPIRE", "EXPIREAT", "FLUSHALL", "FLUSHDB", "GEOADD",
+		"GEORADIUS", "GETSET", "HDEL", "HINCRBY", "HINCRBYFLOAT", "HMSET",
+		"HSET", "HSETNX", "INCR", "INCRBY", "INCRBYFLOAT", "LINSERT", "LPOP",
+		"LPUSH", "LPUSHX", "LREM", "LSET", "LTRIM", "MOVE", "MSET", "MSETNX",
+		"PERSIST", "PEXPIRE", "PEXPIREAT", "PFADD", "PFMERGE", "PSETEX",
+		"RENAME", "RENAMENX", "RESTORE", "RPOP", "RPOPLPUSH", "RPUSH", "RPUSHX", "SADD",
+		"SDIFFSTORE", "SET", "SETBIT", "SETEX", "SETNX", "SETRANGE",
+		"SINTERSTORE", "SMOVE", "SPOP", "SREM", "SUNIONSTORE", "SWAPDB",
+		"UNLINK", "XACK", "XADD", "XAUTOCLAIM", "XCLAIM", "XDEL", "XGROUP",
+		"XREADGROUP", "XTRIM", "ZADD", "ZINCRBY", "ZINTERSTORE", "ZPOPMAX",
+		"ZPOPMIN", "ZREM", "ZREMRANGEBYLEX", "ZREMRANGEBYRANK",
+		"ZREMRANGEBYSCORE", "ZUNIONSTORE",
+	} {
+		writeCommands[c] = true
+	}
+}
+
+// isWrite is true for the commands which can change data: the built-in ones
+// from writeCommands, and custom commands registered as a write command.
+// Needs the lock.
+func (m *Miniredis) isWrite(cmd string) bool {
+	if cc, ok := m.customCommands[cmd]; ok {
+		return cc.write
+	}
+	return writeCommands[cmd]
+}
+
+// SetAOF makes miniredis append every successful write command to w, in RESP.
+// Use nil to stop.
+func (m *Miniredis) SetAOF(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+	m.closeAOF()
+	m.aof = w
+}
+
+// SetAOFFile makes miniredis append every successful write command to a file,
+// in RESP. BGREWRITEAOF only works with an AOF file.
+func (m *Miniredis) SetAOFFile(filename string) error {
+	m.Lock()
+	defer m.Unlock()
+	return m.openAOFFile(filename)
+}
+
+// openAOFFile opens a file to append to. No locks!
+func (m *Miniredis) openAOFFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	m.closeAOF()
+	m.aof = f
+	m.aofFile = f
+	return nil
+}
+
+// closeAOF closes the AOF file, if we opened it. No locks!
+func (m *Miniredis) closeAOF() {
+	if m.aofFile != nil {
+		m.aofFile.Close()
+	}
+	m.aof = nil
+	m.aofFile = nil
+	m.aofDB = -1
+}
+
+// LoadAOF executes all commands from an AOF. The server needs to be running.
+// Stops at the first command which fails. Replayed commands are not appended to
+// the AOF again.
+func (m *Miniredis) LoadAOF(r io.Reader) error {
+	m.Lock()
+	if m.srv == nil {
+		m.Unlock()
+		return errors.New("miniredis is not running")
+	}
+	conn := m.internalConn("aof")
+	m.aofLoading = true
+	m.Unlock()
+	defer func() {
+		conn.Close()
+		m.Lock()
+		m.aofLoading = false
+		m.Unlock()
+	}()
+
+	br := bufio.NewReader(r)
+	for {
+		args, err := readAOFCommand(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cargs := make([]interface{}, 0, len(args)-1)
+		for _, a := range args[1:] {
+			cargs = append(cargs, a)
+		}
+		if _, err := conn.Do(args[0], cargs...); err != nil {
+			return fmt.Errorf("AOF %s: %s", args[0], err)
+		}
+	}
+}
+
+// RewriteAOF writes the commands needed to recreate the current data to w,
+// the same as BGREWRITEAOF does.
+func (m *Miniredis) RewriteAOF(w io.Writer) error {
+	m.Lock()
+	b, _ := m.rewriteAOF()
+	m.Unlock()
+	_, err := w.Write(b)
+	return err
+}
+
+// writeCmd wraps a command callback to keep track of successful write
+// commands: they are counted for INFO, appended to the AOF, and sent to the
+// replicas.
+func (m *Miniredis) writeCmd(cmd string, args []string, cb txCmd) txCmd {
+	return func(c *server.Peer, ctx *connCtx) {
+		if !m.isWrite(cmd) {
+			cb(c, ctx)
+			return
+		}
+		db, errs := ctx.selectedDB, c.Errors()
+		before := m.spopMembers(db, cmd, args)
+		cb(c, ctx)
+		if c.Errors() == errs {
+			m.written(db, cmd, args, before)
+		}
+	}
+}
+
+// writeBlockCmd is writeCmd() for blocking commands. They count once they
+// return true.
+func (m *Miniredis) writeBlockCmd(cmd string, args []string, cb blockCmd) blockCmd {
+	return func(c *server.Peer, ctx *connCtx) bool {
+		if !m.isWrite(cmd) {
+			return cb(c, ctx)
+		}
+		db, errs := ctx.selectedDB, c.Errors()
+		done := cb(c, ctx)
+		if done && c.Errors() == errs {
+			m.written(db, cmd, args, nil)
+		}
+		return done
+	}
+}
+
+// written is called after every successful write command. before are the
+// members of the set an SPOP took from, see spopMembers(). Needs the lock.
+func (m *Miniredis) written(db int, cmd string, args []string, before []string) {
+	m.dirty++
+	for _, w := range m.replayable(db, cmd, args, before) {
+		m.appendAOF(db, w[0], w[1:])
+		m.propagate(db, w[0], w[1:])
+	}
+}
+
+// replayable gives the commands which have the same effect as a write command
+// which just ran, also when they are replayed later from the AOF or on a
+// replica: XADD gets the ID it used, SPOP becomes an SREM of the members it
+// took, and relative TTLs become PEXPIREAT. Needs the lock.
+func (m *Miniredis) replayable(db int, cmd string, args []string, before []string) [][]string {
+	switch cmd {
+	case "XADD":
+		return [][]string{append([]string{cmd}, m.xaddFixID(db, args)...)}
+	case "SPOP":
+		srem := []string{"SREM", args[0]}
+		left := m.db(db).setKeys[args[0]]
+		for _, e := range before {
+			if _, ok := left[e]; !ok {
+				srem = append(srem, e)
+			}
+		}
+		if len(srem) == 2 {
+			return nil
+		}
+		return [][]string{srem}
+	case "SET":
+		set := []string{cmd, args[0], args[1]}
+		ttl := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "EX", "PX":
+				ttl = true
+				i++
+			default:
+				set = append(set, args[i])
+			}
+		}
+		if !ttl {
+			break
+		}
+		return append([][]string{set}, m.absoluteTTL(db, args[0])...)
+	case "SETEX", "PSETEX":
+		return append([][]string{{"SET", args[0], args[2]}}, m.absoluteTTL(db, args[0])...)
+	case "EXPIRE", "PEXPIRE", "EXPIREAT":
+		return m.absoluteTTL(db, args[0])
+	case "RESTORE":
+		if args[1] == "0" {
+			break
+		}
+		for _, a := range args[3:] {
+			if strings.ToUpper(a) == "ABSTTL" {
+				return [][]string{append([]string{cmd}, args...)}
+			}
+		}
+		ttl := m.absoluteTTL(db, args[0])
+		if len(ttl) == 0 || ttl[0][0] != "PEXPIREAT" {
+			return ttl
+		}
+		restore := []string{cmd, args[0], ttl[0][2]}
+		restore = append(restore, args[2:]...)
+		return [][]string{append(restore, "ABSTTL")}
+	}
+	return [][]string{append([]string{cmd}, args...)}
+}
+
+// absoluteTTL is the TTL of a key as a PEXPIREAT, a DEL if the key is gone,
+// or nothing if the key has no TTL. Needs the lock.
+func (m *Miniredis) absoluteTTL(db int, k string) [][]string {
+	d := m.db(db)
+	if !d.exists(k) {
+		return [][]string{{"DEL", k}}
+	}
+	ttl, ok := d.ttlLeft(k)
+	if !ok {
+		return nil
+	}
+	ms := m.effectiveNow().Add(ttl).UnixNano() / 1000000
+	return [][]string{{"PEXPIREAT", k, strconv.FormatInt(ms, 10)}}
+}
+
+// spopMembers are the members of the set an SPOP is about to take from,
+// sorted. Nil for other commands. Needs the lock.
+func (m *Miniredis) spopMembers(db int, cmd string, args []string) []string {
+	if cmd != "SPOP" || len(args) == 0 {
+		return nil
+	}
+	d := m.db(db)
+	if d.t(args[0]) != "set" {
+		return nil
+	}
+	return d.setMembers(args[0])
+}
+
+// appendAOF writes a command to the AOF, if there is one. Needs the lock.
+func (m *Miniredis) appendAOF(db int, cmd string, args []string) {
+	if m.aof == nil || m.aofLoading {
+		return
+	}
+	var buf bytes.Buffer
+	if db != m.aofDB {
+		writeAOFCommand(&buf, "SELECT", strconv.Itoa(db))
+		m.aofDB = db
+	}
+	writeAOFCommand(&buf, cmd, args...)
+	m.aof.Write(buf.Bytes())
+}
+
+// xaddFixID replaces an automatic ID ("*" or "<ms>-*") in XADD arguments
+// with the ID which was used, so replaying gives the same stream.
+func (m *Miniredis) xaddFixID(db int, args []string) []string {
+	i := 1
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			i++
+			continue
+		case "MAXLEN", "MINID":
+			i += 2
+			if i-1 < len(args) && (args[i-1] == "=" || args[i-1] == "~") {
+				i++
+			}
+			if i < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+				i += 2
+			}
+			continue
+		}
+		break
+	}
+	s, ok := m.db(db).streamKeys[args[0]]
+	if i >= len(args) || !strings.HasSuffix(args[i], "*") || !ok {
+		return args
+	}
+	fixed := append([]string{}, args...)
+	fixed[i] = s.lastID.String()
+	return fixed
+}
+
+// rewriteAOF makes the commands which recreate all data. Returns the DB
+// selected at the end. No locks!
+func (m *Miniredis) rewriteAOF() ([]byte, int) {
+	var (
+		buf      bytes.Buffer
+		ids      []int
+		selected = -1
+	)
+	for id := range m.dbs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		db := m.dbs[id]
+		if len(db.keys) == 0 {
+			continue
+		}
+		writeAOFCommand(&buf, "SELECT", strconv.Itoa(id))
+		selected = id
+		for _, k := range db.allKeys() {
+			rewriteAOFKey(&buf, db, k)
+			if ttl, ok := db.ttlLeft(k); ok {
+				ms := m.effectiveNow().Add(ttl).UnixNano() / 1000000
+				writeAOFCommand(&buf, "PEXPIREAT", k, strconv.FormatInt(ms, 10))
+			}
+		}
+	}
+	return buf.Bytes(), selected
+}
+
+// rewriteAOFKey writes the commands to recreate a single key.
+func rewriteAOFKey(buf *bytes.Buffer, db *RedisDB, k string) {
+	// chunked writes cmd with the key and the values, in batches
+	chunked := func(cmd string, values []string, per int) {
+		for len(values) > 0 {
+			n := aofRewriteItems * per
+			if n > len(values) {
+				n = len(values)
+			}
+			writeAOFCommand(buf, cmd, append([]string{k}, values[:n]...)...)
+			values = values[n:]
+		}
+	}
+
+	switch db.t(k) {
+	case "string":
+		writeAOFCommand(buf, "SET", k, db.stringKeys[k])
+	case "list":
+		chunked("RPUSH", db.listKeys[k], 1)
+	case "set":
+		chunked("SADD", db.setMembers(k), 1)
+	case "zset":
+		var vs []string
+		for _, el := range db.ssetElements(k) {
+			vs = append(vs, rdbFormatScore(el.score), el.member)
+		}
+		chunked("ZADD", vs, 2)
+	case "hash":
+		var vs []string
+		for _, f := range db.hashFields(k) {
+			vs = append(vs, f, db.hashGet(k, f))
+		}
+		chunked("HMSET", vs, 2)
+	case "stream":
+		s := db.streamKeys[k]
+		for _, e := range s.entries {
+			writeAOFCommand(buf, "XADD", append([]string{k, e.ID}, e.Values...)...)
+		}
+		if s.lastID.cmp(s.lastEntryID()) > 0 || len(s.entries) == 0 {
+			// only way to set the last ID without XSETID
+			last := s.lastID.String()
+			writeAOFCommand(buf, "XADD", k, last, "x", "y")
+			writeAOFCommand(buf, "XDEL", k, last)
+		}
+		var groups []string
+		for name := range s.groups {
+			groups = append(groups, name)
+		}
+		sort.Strings(groups)
+		for _, name := range groups {
+			g := s.groups[name]
+			writeAOFCommand(buf, "XGROUP", "CREATE", k, name, g.lastID.String(), "ENTRIESREAD", strconv.FormatUint(g.entriesRead, 10))
+			for _, c := range g.consumerNames() {
+				writeAOFCommand(buf, "XGROUP", "CREATECONSUMER", k, name, c)
+			}
+			for _, p := range g.pending {
+				if _, ok := s.get(p.id); !ok {
+					continue
+				}
+				writeAOFCommand(buf, "XCLAIM", k, name, p.consumer, "0", p.id.String(),
+					"TIME", strconv.FormatInt(p.lastDelivery.UnixNano()/1000000, 10),
+					"RETRYCOUNT", strconv.Itoa(p.deliveryCount),
+					"FORCE", "JUSTID",
+				)
+			}
+		}
+	}
+}
+
+// saveAOFRewrite replaces the AOF file with a rewritten one. No locks!
+func (m *Miniredis) saveAOFRewrite() error {
+	if m.aofFile == nil {
+		return errors.New("no AOF file")
+	}
+	b, selected := m.rewriteAOF()
+	filename := m.aofFile.Name()
+	tmp := filepath.Join(filepath.Dir(filename), fmt.Sprintf("temp-rewriteaof-%d.aof", os.Getpid()))
+	m.aofRewriteFailed = true
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	m.aofRewriteFailed = false
+	m.aofFile.Close()
+	m.aof = f
+	m.aofFile = f
+	m.aofDB = selected
+	return nil
+}
+
+// writeAOFCommand writes a command as a RESP array.
+func writeAOFCommand(w *bytes.Buffer, cmd string, args ...string) {
+	fmt.Fprintf(w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+}
+
+// readAOFCommand reads a single RESP array command.
+func readAOFCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line == "" {
+			return nil, io.EOF
+		}
+		return nil, errInvalidAOF
+	}
+	if !strings.HasPrefix(line, "*") || !strings.HasSuffix(line, "\r\n") {
+		return nil, errInvalidAOF
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil || n < 1 {
+		return nil, errInvalidAOF
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "$") || !strings.HasSuffix(line, "\r\n") {
+			return nil, errInvalidAOF
+		}
+		l, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil || l < 0 {
+			return nil, errInvalidAOF
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(r, b); err != nil || string(b[l:]) != "\r\n" {
+			return nil, errInvalidAOF
+		}
+		args = append(args, string(b[:l]))
+	}
+	return args, nil
+}
@@ -0,0 +1,211 @@
+package miniredis
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestAOF(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	var buf bytes.Buffer
+	s.SetAOF(&buf)
+
+	_, err = c.Do("SET", "aap", "noot")
+	ok(t, err)
+	_, err = c.Do("GET", "aap")
+	ok(t, err)
+	_, err = c.Do("LPUSH", "aap", "noot")
+	mustFail(t, err, msgWrongType)
+	_, err = c.Do("SELECT", 2)
+	ok(t, err)
+	_, err = c.Do("RPUSH", "list", "a", "b")
+	ok(t, err)
+	_, err = c.Do("MULTI")
+	ok(t, err)
+	_, err = c.Do("INCR", "counter")
+	ok(t, err)
+	_, err = c.Do("EXEC")
+	ok(t, err)
+
+	equals(t,
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n"+
+			"*3\r\n$3\r\nSET\r\n$3\r\naap\r\n$4\r\nnoot\r\n"+
+			"*2\r\n$6\r\nSELECT\r\n$1\r\n2\r\n"+
+			"*4\r\n$5\r\nRPUSH\r\n$4\r\nlist\r\n$1\r\na\r\n$1\r\nb\r\n"+
+			"*2\r\n$4\r\nINCR\r\n$7\r\ncounter\r\n",
+		buf.String(),
+	)
+
+	t.Run("xadd", func(t *testing.T) {
+		n := buf.Len()
+		s.SetTime(time.Unix(100, 0))
+		_, err = c.Do("XADD", "planets", "MAXLEN", "~", 10, "*", "name", "Mercury")
+		ok(t, err)
+		equals(t,
+			"*8\r\n$4\r\nXADD\r\n$7\r\nplanets\r\n$6\r\nMAXLEN\r\n$1\r\n~\r\n$2\r\n10\r\n$8\r\n100000-0\r\n$4\r\nname\r\n$7\r\nMercury\r\n",
+			buf.String()[n:],
+		)
+	})
+
+	t.Run("load", func(t *testing.T) {
+		s2, err := Run()
+		ok(t, err)
+		defer s2.Close()
+		s2.SetTime(time.Unix(100, 0))
+		ok(t, s2.LoadAOF(bytes.NewReader(buf.Bytes())))
+		s2.Select(2)
+		s.Select(2)
+		equals(t, s.Dump(), s2.Dump())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s2, err := Run()
+		ok(t, err)
+		defer s2.Close()
+		err = s2.LoadAOF(strings.NewReader("*1\r\n$4\r\nPING"))
+		equals(t, errInvalidAOF, err)
+
+		err = s2.LoadAOF(strings.NewReader("*2\r\n$4\r\nINCR\r\n$1\r\nx\r\n*1\r\n$7\r\nNOSUCHC\r\n"))
+		assert(t, err != nil, "unknown command")
+		v, _ := s2.Get("x")
+		equals(t, "1", v)
+	})
+}
+
+// Commands which depend on the time or on chance are logged so replaying
+// them later gives the same data.
+func TestAOFReplay(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	clock := NewFakeClock(time.Unix(1000, 0))
+	s.SetClock(clock)
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+
+	var buf bytes.Buffer
+	s.SetAOF(&buf)
+
+	_, err = c.Do("SET", "str", "value", "EX", 10)
+	ok(t, err)
+	_, err = c.Do("SETEX", "setex", 20, "value")
+	ok(t, err)
+	_, err = c.Do("SET", "gone", "value", "PX", 100)
+	ok(t, err)
+	_, err = c.Do("SADD", "set", "a", "b", "c", "d", "e")
+	ok(t, err)
+	_, err = c.Do("SPOP", "set", 2)
+	ok(t, err)
+	_, err = c.Do("SPOP", "set")
+	ok(t, err)
+	_, err = c.Do("EXPIRE", "set", 30)
+	ok(t, err)
+	dump, err := redis.String(c.Do("DUMP", "str"))
+	ok(t, err)
+	_, err = c.Do("RESTORE", "restored", 40000, dump)
+	ok(t, err)
+	clock.Add(time.Second)
+	c.Close()
+
+	aof := buf.String()
+	for _, want := range []string{
+		"*3\r\n$3\r\nSET\r\n$3\r\nstr\r\n$5\r\nvalue\r\n*3\r\n$9\r\nPEXPIREAT\r\n$3\r\nstr\r\n$7\r\n1010000\r\n",
+		"*2\r\n$3\r\nDEL\r\n$4\r\ngone\r\n",
+	} {
+		assert(t, strings.Contains(aof, want), "AOF has %q", want)
+	}
+	for _, cmd := range []string{"SPOP", "SETEX", "EXPIRE"} {
+		assert(t, !strings.Contains(aof, "$"+strconv.Itoa(len(cmd))+"\r\n"+cmd+"\r\n"), "no %s in the AOF", cmd)
+	}
+
+	members, err := s.Members("set")
+	ok(t, err)
+	equals(t, 2, len(members))
+
+	s.Close()
+	clock.Add(4 * time.Second)
+	s.SetAOF(nil)
+	ok(t, s.Restart())
+	s.FlushAll()
+	ok(t, s.LoadAOF(strings.NewReader(aof)))
+
+	equals(t, []string{"restored", "set", "setex", "str"}, s.Keys())
+	equals(t, 5*time.Second, s.TTL("str"))
+	equals(t, 15*time.Second, s.TTL("setex"))
+	equals(t, 25*time.Second, s.TTL("set"))
+	equals(t, 35*time.Second, s.TTL("restored"))
+	replayed, err := s.Members("set")
+	ok(t, err)
+	equals(t, members, replayed)
+}
+
+func TestAOFRewrite(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.SetTime(time.Unix(1000, 0))
+	s.Set("str", "value")
+	s.SetTTL("str", time.Hour)
+	for i := 0; i < 100; i++ {
+		s.RPush("list", "x")
+	}
+	s.SAdd("set", "aap", "noot")
+	s.HSet("hash", "aap", "noot")
+	s.ZAdd("zset", 1.5, "one and a half")
+	s.DB(3).Set("other", "db")
+	_, err = c.Do("XADD", "stream", "1-1", "name", "x")
+	ok(t, err)
+	_, err = c.Do("XADD", "stream", "2-1", "name", "y")
+	ok(t, err)
+	_, err = c.Do("XDEL", "stream", "2-1")
+	ok(t, err)
+	_, err = c.Do("XGROUP", "CREATE", "stream", "group", "0")
+	ok(t, err)
+	_, err = c.Do("XREADGROUP", "GROUP", "group", "alice", "STREAMS", "stream", ">")
+	ok(t, err)
+
+	var buf bytes.Buffer
+	ok(t, s.RewriteAOF(&buf))
+	assert(t, strings.Contains(buf.String(), "PEXPIREAT"), "has TTL")
+
+	s2, err := Run()
+	ok(t, err)
+	defer s2.Close()
+	s2.SetTime(time.Unix(1000, 0))
+	ok(t, s2.LoadAOF(&buf))
+	equals(t, s.Dump(), s2.Dump())
+	equals(t, time.Hour, s2.TTL("str"))
+	v, err := s2.DB(3).Get("other")
+	ok(t, err)
+	equals(t, "db", v)
+
+	c2, err := redis.Dial("tcp", s2.Addr())
+	ok(t, err)
+	defer c2.Close()
+	for _, cmd := range [][]interface{}{
+		{"XINFO", "STREAM", "stream"},
+		{"XPENDING", "stream", "group"},
+		{"XINFO", "CONSUMERS", "stream", "group"},
+	} {
+		want, err := c.Do(cmd[0].(string), cmd[1:]...)
+		ok(t, err)
+		have, err := c2.Do(cmd[0].(string), cmd[1:]...)
+		ok(t, err)
+		equals(t, want, have)
+	}
+}
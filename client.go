@@ -0,0 +1,161 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// ClientInfo describes a connected client, the same fields as CLIENT LIST.
+type ClientInfo struct {
+	ID        int
+	Addr      string
+	LocalAddr string
+	Name      string
+	Age       time.Duration
+	Idle      time.Duration
+	Flags     string // "N" for a normal client, "O" for MONITOR
+	DB        int
+	Sub       int    // subscribed channels
+	Psub      int    // subscribed patterns
+	Multi     int    // queued commands in MULTI, or -1
+	Cmd       string // last command, such as "get" or "client|list"
+	User      string // ACL user
+	Resp      int    // protocol version
+}
+
+// String formats a client the same way CLIENT LIST does, without the newline.
+func (ci ClientInfo) String() string {
+	return fmt.Sprintf(
+		"id=%d addr=%s laddr=%s fd=0 name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d ssub=0 multi=%d qbuf=0 qbuf-free=0 argv-mem=0 multi-mem=0 rbs=0 rbp=0 obl=0 oll=0 omem=0 tot-mem=0 events=r cmd=%s user=%s redir=-1 resp=%d",
+		ci.ID,
+		ci.Addr,
+		ci.LocalAddr,
+		ci.Name,
+		int(ci.Age/time.Second),
+		int(ci.Idle/time.Second),
+		ci.Flags,
+		ci.DB,
+		ci.Sub,
+		ci.Psub,
+		ci.Multi,
+		ci.Cmd,
+		ci.User,
+		ci.Resp,
+	)
+}
+
+// Clients returns all connected clients, ordered by ID.
+func (m *Miniredis) Clients() []ClientInfo {
+	m.Lock()
+	defer m.Unlock()
+	if m.srv == nil {
+		return nil
+	}
+	var cs []ClientInfo
+	for _, p := range m.srv.Peers() {
+		cs = append(cs, clientInfo(p))
+	}
+	return cs
+}
+
+// containerCommands have subcommands, which CLIENT LIST shows as "cmd|sub".
+var containerCommands = map[string]bool{
+	"ACL":     true,
+	"CLIENT":  true,
+	"CLUSTER": true,
+	"COMMAND": true,
+	"CONFIG":  true,
+	"MEMORY":  true,
+	"OBJECT":  true,
+	"PUBSUB":  true,
+	"SCRIPT":  true,
+	"XGROUP":  true,
+	"XINFO":   true,
+}
+
+// clientInfo collects the data of a peer. Needs the lock.
+func clientInfo(p *server.Peer) ClientInfo {
+	ctx := getCtx(p)
+	ci := ClientInfo{
+		ID:        p.ID(),
+		Addr:      p.Addr(),
+		LocalAddr: p.LocalAddr(),
+		Name:      ctx.clientName,
+		Age:       p.Age(),
+		Idle:      p.Idle(),
+		DB:        ctx.selectedDB,
+		Multi:     -1,
+		Cmd:       "NULL",
+		User:      connUserName(ctx),
+		Resp:      2,
+	}
+	if p.Resp3() {
+		ci.Resp = 3
+	}
+	if ctx.monitor {
+		ci.Flags += "O"
+	}
+	if sub := ctx.subscriber; sub != nil {
+		sub.mu.Lock()
+		ci.Sub, ci.Psub = len(sub.channels), len(sub.patterns)
+		sub.mu.Unlock()
+		ci.Flags += "P"
+	}
+	if inTx(ctx) {
+		ci.Multi = len(ctx.transaction)
+		ci.Flags += "x"
+	}
+	if ctx.blocked {
+		ci.Flags += "b"
+	}
+	if ci.Flags == "" {
+		ci.Flags = "N"
+	}
+	if ctx.cmd != "" {
+		ci.Cmd = strings.ToLower(ctx.cmd)
+		if containerCommands[ctx.cmd] && len(ctx.args) > 0 {
+			ci.Cmd += "|" + strings.ToLower(ctx.args[0])
+		}
+	}
+	return ci
+}
+
+// pause makes all commands (all), or only write commands, wait until d is
+// over, or until unpause(). CLIENT commands are never paused. Needs the lock.
+func (m *Miniredis) pause(d time.Duration, all bool) {
+	m.unpause()
+	done := make(chan struct{})
+	m.pauseDone, m.pauseAll = done, all
+	after, stop := m.after(d)
+	go func() {
+		select {
+		case <-after:
+		case <-done:
+		}
+		stop()
+		m.Lock()
+		defer m.Unlock()
+		if m.pauseDone == done {
+			m.unpause()
+		}
+	}()
+}
+
+// unpause ends CLIENT PAUSE. Needs the lock.
+func (m *Miniredis) unpause() {
+	if m.pauseDone != nil {
+		close(m.pauseDone)
+		m.pauseDone = nil
+	}
+}
+
+// pausedFor is true if cmd has to wait for CLIENT PAUSE. Needs the lock.
+func (m *Miniredis) pausedFor(cmd string) bool {
+	if m.pauseDone == nil || cmd == "CLIENT" {
+		return false
+	}
+	return m.pauseAll || m.isWrite(cmd)
+}
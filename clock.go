@@ -0,0 +1,330 @@
+package miniredis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// Clock is the source of time for TTLs, EXPIREAT, TIME, blocking timeouts,
+// stream IDs, and client ages. See Miniredis.SetClock().
+type Clock interface {
+	Now() time.Time
+}
+
+// NewWallClock gives a Clock with the real time.
+func NewWallClock() Clock {
+	return wallClock{}
+}
+
+// wallClock is the real time, moved by offset. See SetTime().
+type wallClock struct {
+	offset time.Duration
+}
+
+func (c wallClock) Now() time.Time {
+	return time.Now().Add(c.offset).UTC()
+}
+
+// FakeClock is a Clock which only moves when told to. Moving it behaves the
+// same as time passing: keys expire right away, and blocking commands time
+// out.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	users   map[*Miniredis]struct{} // miniredis instances using this clock
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewFakeClock makes a FakeClock, set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+	c.moved(c.set(t), nil)
+}
+
+// Add moves the clock forward by d.
+func (c *FakeClock) Add(d time.Duration) {
+	c.moved(c.add(d), nil)
+}
+
+// set sets the clock, and returns the miniredis instances which need to know.
+func (c *FakeClock) set(t time.Time) []*Miniredis {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	c.fire()
+	return c.userList()
+}
+
+// add moves the clock, and returns the miniredis instances which need to
+// know.
+func (c *FakeClock) add(d time.Duration) []*Miniredis {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fire()
+	return c.userList()
+}
+
+// moved expires the keys of all users, other than skip. skip is the miniredis
+// which moved the clock itself, and has its lock. Call this without the clock
+// lock.
+func (c *FakeClock) moved(users []*Miniredis, skip *Miniredis) {
+	for _, m := range users {
+		if m == skip {
+			continue
+		}
+		m.Lock()
+		if m.clock == Clock(c) {
+			m.expireKeys()
+		}
+		m.Unlock()
+	}
+}
+
+// use registers a miniredis which uses this clock, or forgets it.
+func (c *FakeClock) use(m *Miniredis, on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !on {
+		delete(c.users, m)
+		return
+	}
+	if c.users == nil {
+		c.users = map[*Miniredis]struct{}{}
+	}
+	c.users[m] = struct{}{}
+}
+
+// userList gives all users. Needs the lock.
+func (c *FakeClock) userList() []*Miniredis {
+	users := make([]*Miniredis, 0, len(c.users))
+	for m := range c.users {
+		users = append(users, m)
+	}
+	return users
+}
+
+// after is time.After(), but against the clock. Call stop() when the channel is
+// no longer needed.
+func (c *FakeClock) after(d time.Duration) (<-chan time.Time, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{
+		at: c.now.Add(d),
+		c:  make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, w)
+	c.fire()
+	return w.c, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.remove(w)
+	}
+}
+
+// fire signals all waiters whose time has come. Needs the lock.
+func (c *FakeClock) fire() {
+	var ws []*fakeWaiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			ws = append(ws, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = ws
+}
+
+// remove forgets a waiter. Needs the lock.
+func (c *FakeClock) remove(w *fakeWaiter) {
+	for i, o := range c.waiters {
+		if o == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetClock makes miniredis use c for TTLs, TIME, (P)EXPIREAT, blocking
+// timeouts, stream IDs, and client age and idle times. The time left of
+// existing TTLs is kept. Use a FakeClock to control time, in which case
+// FastForward() and SetTime() move the clock. Set to nil to go back to the
+// default, where TTLs only change with FastForward().
+func (m *Miniredis) SetClock(c Clock) {
+	m.Lock()
+	defer m.Unlock()
+	m.setClock(c)
+}
+
+// EnableActiveExpire makes TTLs count down in real time, the way a real Redis
+// does. Keys are expired when they are accessed, and every interval by a
+// background sweeper. An interval <= 0 only stops the sweeper. The sweeper is
+// stopped by Close(), and started again by Restart().
+// FastForward() keeps working, and TIME and (P)EXPIREAT will use the real
+// time as well.
+func (m *Miniredis) EnableActiveExpire(interval time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.clock == nil {
+		m.setClock(wallClock{})
+	}
+	m.stopActiveExpire()
+	m.expireInterval = interval
+	m.startActiveExpire()
+}
+
+// setClock changes the clock, keeping the time left of all TTLs. No locks!
+func (m *Miniredis) setClock(c Clock) {
+	if fc, ok := m.clock.(*FakeClock); ok {
+		fc.use(m, false)
+	}
+	if fc, ok := c.(*FakeClock); ok {
+		fc.use(m, true)
+	}
+	oldNow := m.ttlNow()
+	m.clock = c
+	if m.srv != nil {
+		m.srv.SetNow(clockNow(c))
+	}
+	newNow := m.ttlNow()
+	for _, db := range m.dbs {
+		for k, dl := range db.ttl {
+			db.ttl[k] = newNow.Add(dl.Sub(oldNow))
+		}
+		for _, a := range db.access {
+			a.at = newNow.Add(a.at.Sub(oldNow))
+			a.decay = newNow.Add(a.decay.Sub(oldNow))
+		}
+	}
+}
+
+// clockNow is the time source for the server, nil for the real time.
+func clockNow(c Clock) func() time.Time {
+	if c == nil {
+		return nil
+	}
+	return c.Now
+}
+
+// ttlNow is the time TTL deadlines are relative to. Without a clock that's a
+// fixed moment, which only moves with FastForward(). No locks!
+func (m *Miniredis) ttlNow() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+	return m.frozenNow
+}
+
+// after is time.After(), against the clock. Call stop() when the channel is no
+// longer needed. No locks!
+func (m *Miniredis) after(d time.Duration) (<-chan time.Time, func()) {
+	if fc, ok := m.clock.(*FakeClock); ok {
+		return fc.after(d)
+	}
+	t := time.NewTimer(d)
+	return t.C, func() { t.Stop() }
+}
+
+// expireKeys removes all expired keys in all DBs. No locks!
+func (m *Miniredis) expireKeys() {
+	for _, db := range m.dbs {
+		db.expireKeys()
+	}
+}
+
+// scanCommands look at all keys of a DB, so all expired keys are removed
+// before they run.
+var scanCommands = map[string]bool{
+	"DBSIZE":    true,
+	"KEYS":      true,
+	"RANDOMKEY": true,
+	"SCAN":      true,
+}
+
+// expireCommandKeys removes the expired keys a command is about to use, the
+// same as Redis expires keys when they are accessed. TTLs only run out by
+// themselves with a clock. No locks!
+func (m *Miniredis) expireCommandKeys(db int, cmd string, args []string) {
+	d, ok := m.dbs[db]
+	if !ok {
+		return
+	}
+	if scanCommands[cmd] {
+		if m.clock != nil {
+			d.expireKeys()
+		}
+		return
+	}
+	for _, k := range commandKeys(cmd, args) {
+		d.expireKey(k)
+	}
+}
+
+// expireCmd makes a command expire the keys it uses before it runs.
+func (m *Miniredis) expireCmd(cmd string, args []string, cb txCmd) txCmd {
+	return func(c *server.Peer, ctx *connCtx) {
+		m.expireCommandKeys(ctx.selectedDB, cmd, args)
+		cb(c, ctx)
+	}
+}
+
+// expireBlockCmd is expireCmd() for blocking commands.
+func (m *Miniredis) expireBlockCmd(cmd string, args []string, cb blockCmd) blockCmd {
+	return func(c *server.Peer, ctx *connCtx) bool {
+		m.expireCommandKeys(ctx.selectedDB, cmd, args)
+		return cb(c, ctx)
+	}
+}
+
+// startActiveExpire starts the background sweeper, if enabled. No locks!
+func (m *Miniredis) startActiveExpire() {
+	if m.expireInterval <= 0 || m.expireStop != nil {
+		return
+	}
+	var (
+		stop     = make(chan struct{})
+		interval = m.expireInterval
+	)
+	m.expireStop = stop
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				m.Lock()
+				m.expireKeys()
+				m.Unlock()
+			}
+		}
+	}()
+}
+
+// stopActiveExpire stops the background sweeper, if running. No locks!
+func (m *Miniredis) stopActiveExpire() {
+	if m.expireStop != nil {
+		close(m.expireStop)
+		m.expireStop = nil
+	}
+}
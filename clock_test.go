@@ -0,0 +1,175 @@
+package miniredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestFakeClock(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("aap", "noot")
+	s.SetTTL("aap", 10*time.Second)
+	clock := NewFakeClock(time.Unix(1000, 0))
+	s.SetClock(clock)
+	equals(t, 10*time.Second, s.TTL("aap"))
+
+	now := func() string {
+		t.Helper()
+		v, err := redis.Strings(c.Do("TIME"))
+		ok(t, err)
+		return v[0]
+	}
+	equals(t, "1000", now())
+
+	t.Run("ttl", func(t *testing.T) {
+		clock.Add(4 * time.Second)
+		equals(t, "1004", now())
+		v, err := redis.Int(c.Do("TTL", "aap"))
+		ok(t, err)
+		equals(t, 6, v)
+		v, err = redis.Int(c.Do("PTTL", "aap"))
+		ok(t, err)
+		equals(t, 6000, v)
+
+		s.FastForward(6 * time.Second)
+		equals(t, "1010", now())
+		equals(t, false, s.Exists("aap"))
+	})
+
+	t.Run("expireat", func(t *testing.T) {
+		s.Set("noot", "mies")
+		_, err := c.Do("EXPIREAT", "noot", 1020)
+		ok(t, err)
+		equals(t, 10*time.Second, s.TTL("noot"))
+		_, err = c.Do("PEXPIREAT", "noot", 1015500)
+		ok(t, err)
+		equals(t, 5500*time.Millisecond, s.TTL("noot"))
+
+		// moving the clock directly also expires keys
+		clock.Add(6 * time.Second)
+		v, err := redis.Int(c.Do("EXISTS", "noot"))
+		ok(t, err)
+		equals(t, 0, v)
+	})
+
+	t.Run("expire right away", func(t *testing.T) {
+		sub, err := redis.Dial("tcp", s.Addr(), redis.DialReadTimeout(time.Second))
+		ok(t, err)
+		defer sub.Close()
+		ok(t, s.SetNotifyKeyspaceEvents("Ex"))
+		defer s.SetNotifyKeyspaceEvents("")
+		_, err = sub.Do("SUBSCRIBE", "__keyevent@0__:expired")
+		ok(t, err)
+
+		s.Set("wim", "zus")
+		s.SetTTL("wim", time.Second)
+		clock.Add(time.Second)
+		// no command needed
+		msg, err := redis.Strings(sub.Receive())
+		ok(t, err)
+		equals(t, []string{"message", "__keyevent@0__:expired", "wim"}, msg)
+		s.Lock()
+		_, found := s.dbs[0].keys["wim"]
+		s.Unlock()
+		assert(t, !found, "wim expired")
+	})
+
+	t.Run("client age", func(t *testing.T) {
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("PING")
+		ok(t, err)
+
+		clock.Add(100 * time.Second)
+		var found bool
+		for _, ci := range s.Clients() {
+			if ci.Cmd == "ping" {
+				found = true
+				equals(t, 100*time.Second, ci.Age)
+				equals(t, 100*time.Second, ci.Idle)
+			}
+		}
+		assert(t, found, "client found")
+	})
+
+	t.Run("settime", func(t *testing.T) {
+		s.SetTime(time.Unix(2000, 0))
+		equals(t, time.Unix(2000, 0), clock.Now())
+		equals(t, "2000", now())
+	})
+
+	t.Run("blocking", func(t *testing.T) {
+		done := make(chan error, 1)
+		go func() {
+			c2, err := redis.Dial("tcp", s.Addr())
+			if err != nil {
+				done <- err
+				return
+			}
+			defer c2.Close()
+			_, err = redis.Strings(c2.Do("BLPOP", "list", 10))
+			done <- err
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("BLPOP returned early")
+		default:
+		}
+		clock.Add(10 * time.Second)
+		select {
+		case err := <-done:
+			equals(t, redis.ErrNil, err)
+		case <-time.After(time.Second):
+			t.Fatal("BLPOP didn't time out")
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		clock.Set(time.Unix(3000, 0))
+		v, err := redis.String(c.Do("XADD", "planets", "*", "name", "Mercury"))
+		ok(t, err)
+		equals(t, "3000000-0", v)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		s2, err := Run()
+		ok(t, err)
+		s2.SetClock(clock)
+		clock.mu.Lock()
+		_, found := clock.users[s2]
+		clock.mu.Unlock()
+		assert(t, found, "registered")
+
+		s2.Close()
+		clock.mu.Lock()
+		_, found = clock.users[s2]
+		clock.mu.Unlock()
+		assert(t, !found, "forgotten after Close()")
+
+		ok(t, s2.Restart())
+		defer s2.Close()
+		clock.mu.Lock()
+		_, found = clock.users[s2]
+		clock.mu.Unlock()
+		assert(t, found, "registered again after Restart()")
+	})
+
+	t.Run("default", func(t *testing.T) {
+		s.Set("aap", "noot")
+		s.SetTTL("aap", time.Minute)
+		s.SetClock(nil)
+		clock.Add(time.Hour)
+		equals(t, time.Minute, s.TTL("aap"))
+	})
+}
@@ -0,0 +1,403 @@
+package miniredis
+
+// Redis Cluster emulation. Every node is a normal Miniredis, which checks the
+// hash slot of the keys of every command.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const clusterSlots = 16384
+
+// Cluster is a group of Miniredis nodes which act as a Redis Cluster, see
+// RunCluster(). There are no replicas.
+type Cluster struct {
+	mu        sync.Mutex
+	nodes     []*Miniredis
+	addrs     []*net.TCPAddr
+	owner     [clusterSlots]int // node per slot
+	migrating map[int]int       // slot -> node the slot is migrating to
+}
+
+// RunCluster starts a cluster with n nodes, with the 16384 hash slots divided
+// the same way redis-cli does it. Clients can connect to any node, and get
+// MOVED redirects for keys on other nodes.
+func RunCluster(n int) (*Cluster, error) {
+	if n < 1 {
+		return nil, errors.New("a cluster needs at least one node")
+	}
+	c := &Cluster{
+		migrating: map[int]int{},
+	}
+	var (
+		perNode = float64(clusterSlots) / float64(n)
+		cursor  = 0.0
+		first   = 0
+	)
+	for i := 0; i < n; i++ {
+		last := int(math.Round(cursor + perNode - 1))
+		if last >= clusterSlots || i == n-1 {
+			last = clusterSlots - 1
+		}
+		for s := first; s <= last; s++ {
+			c.owner[s] = i
+		}
+		first = last + 1
+		cursor += perNode
+	}
+
+	for i := 0; i < n; i++ {
+		m := NewMiniRedis()
+		m.cluster = c
+		m.clusterNode = i
+		if err := m.Start(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, m)
+		c.addrs = append(c.addrs, m.srv.Addr())
+	}
+	return c, nil
+}
+
+// Close stops all nodes.
+func (c *Cluster) Close() {
+	for _, m := range c.nodes {
+		m.Close()
+	}
+}
+
+// Nodes returns all nodes.
+func (c *Cluster) Nodes() []*Miniredis {
+	return c.nodes
+}
+
+// Addrs returns the addresses of all nodes, such as "127.0.0.1:32323".
+func (c *Cluster) Addrs() []string {
+	var as []string
+	for _, a := range c.addrs {
+		as = append(as, a.String())
+	}
+	return as
+}
+
+// Node returns the node which has the slot of a key.
+func (c *Cluster) Node(key string) *Miniredis {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nodes[c.owner[KeySlot(key)]]
+}
+
+// MoveSlot moves a slot, with all its keys, to another node. Clients get
+// MOVED redirects to the new node after this.
+func (c *Cluster) MoveSlot(slot, to int) error {
+	if err := c.StartMigration(slot, to); err != nil {
+		return err
+	}
+	return c.FinishMigration(slot)
+}
+
+// StartMigration marks a slot as migrating to another node, the same as
+// CLUSTER SETSLOT MIGRATING and IMPORTING do. Keys in the slot which are not
+// on the old node anymore get an ASK redirect. Move keys with MigrateKey(),
+// and assign the slot to the new node with FinishMigration().
+func (c *Cluster) StartMigration(slot, to int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkSlot(slot); err != nil {
+		return err
+	}
+	if to < 0 || to >= len(c.nodes) {
+		return fmt.Errorf("no such node: %d", to)
+	}
+	if _, ok := c.migrating[slot]; ok {
+		return fmt.Errorf("slot %d is already migrating", slot)
+	}
+	if c.owner[slot] == to {
+		return fmt.Errorf("slot %d is already on node %d", slot, to)
+	}
+	c.migrating[slot] = to
+	return nil
+}
+
+// MigrateKey moves a key of a migrating slot to its new node, the same as
+// MIGRATE does. The TTL is kept.
+func (c *Cluster) MigrateKey(key string) error {
+	slot := KeySlot(key)
+	c.mu.Lock()
+	from := c.owner[slot]
+	to, ok := c.migrating[slot]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("slot %d is not migrating", slot)
+	}
+	moveKey(c.nodes[from], c.nodes[to], key)
+	return nil
+}
+
+// FinishMigration moves all keys which are left in a migrating slot, and
+// assigns the slot to the new node, the same as CLUSTER SETSLOT NODE does.
+func (c *Cluster) FinishMigration(slot int) error {
+	c.mu.Lock()
+	if err := c.checkSlot(slot); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	from := c.owner[slot]
+	to, ok := c.migrating[slot]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("slot %d is not migrating", slot)
+	}
+
+	src := c.nodes[from]
+	src.Lock()
+	keys := src.db(0).slotKeys(slot)
+	src.Unlock()
+	for _, k := range keys {
+		moveKey(src, c.nodes[to], k)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.owner[slot] = to
+	delete(c.migrating, slot)
+	return nil
+}
+
+func (c *Cluster) checkSlot(slot int) error {
+	if slot < 0 || slot >= clusterSlots {
+		return fmt.Errorf("invalid slot: %d", slot)
+	}
+	return nil
+}
+
+// moveKey moves a key, with its TTL, from DB 0 of one node to another.
+func moveKey(from, to *Miniredis, key string) {
+	from.Lock()
+	db := from.db(0)
+	if !db.exists(key) {
+		from.Unlock()
+		return
+	}
+	payload := dumpValue(db, key)
+	ttl, hasTTL := db.ttlLeft(key)
+	db.del(key, true)
+	from.Unlock()
+
+	to.Lock()
+	defer to.Unlock()
+	tdb := to.db(0)
+	tdb.del(key, true)
+	if err := restoreValue(tdb, key, payload); err != nil {
+		panic(err)
+	}
+	if hasTTL {
+		tdb.setTTL(key, ttl)
+	}
+	tdb.modified(key)
+}
+
+// slotKeys returns all keys in a hash slot, sorted.
+func (db *RedisDB) slotKeys(slot int) []string {
+	var keys []string
+	for _, k := range db.allKeys() {
+		if KeySlot(k) == slot {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// KeySlot is the Redis Cluster hash slot of a key. Only the part between the
+// first "{" and the next "}" is used, if that's not empty, so "{user1}.name"
+// and "{user1}.email" have the same slot.
+func KeySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 is the CRC16-CCITT (XModem) Redis uses for hash slots.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// clusterRedirect gives the MOVED, ASK, CROSSSLOT, or TRYAGAIN error for a
+// command, or "" if this node can run it. Needs the lock.
+func (m *Miniredis) clusterRedirect(ctx *connCtx, cmd string, args []string) string {
+	cl := m.cluster
+	if cl == nil {
+		return ""
+	}
+	asking := ctx.asking
+	ctx.asking = false // only for the command after ASKING
+
+	keys := commandKeys(strings.ToUpper(cmd), args)
+	if len(keys) == 0 {
+		return ""
+	}
+	slot := KeySlot(keys[0])
+	for _, k := range keys[1:] {
+		if KeySlot(k) != slot {
+			return msgCrossSlot
+		}
+	}
+
+	cl.mu.Lock()
+	owner := cl.owner[slot]
+	to, migrating := cl.migrating[slot]
+	cl.mu.Unlock()
+	switch {
+	case owner == m.clusterNode:
+		if !migrating {
+			return ""
+		}
+		db := m.db(ctx.selectedDB)
+		missing := 0
+		for _, k := range keys {
+			if !db.exists(k) {
+				missing++
+			}
+		}
+		switch missing {
+		case 0:
+			return ""
+		case len(keys):
+			return fmt.Sprintf("ASK %d %s", slot, cl.addrs[to])
+		default:
+			return msgTryAgain
+		}
+	case migrating && to == m.clusterNode && asking:
+		return ""
+	default:
+		return fmt.Sprintf("MOVED %d %s", slot, cl.addrs[owner])
+	}
+}
+
+// keylessCommands have no key arguments. For all other commands the first
+// argument is a key, unless commandKeys() knows better.
+var keylessCommands = map[string]bool{}
+
+// allKeysCommands have only keys as arguments.
+var allKeysCommands = map[string]bool{}
+
+func init() {
+	for _, c := range []string{
+		"ACL", "ASKING", "AUTH", "BGREWRITEAOF", "BGSAVE", "CLIENT", "CLUSTER",
+		"CONFIG", "DBSIZE", "DISCARD", "ECHO", "EXEC", "FLUSHALL", "FLUSHDB",
+		"HELLO", "INFO", "KEYS", "LASTSAVE", "MONITOR", "MULTI", "PING",
+		"PSUBSCRIBE", "PSYNC", "PUBLISH", "PUBSUB", "PUNSUBSCRIBE", "QUIT",
+		"RANDOMKEY", "READONLY", "READWRITE", "REPLCONF", "REPLICAOF", "ROLE",
+		"SAVE", "SCAN", "SCRIPT", "SELECT", "SENTINEL", "SLAVEOF", "SUBSCRIBE",
+		"SWAPDB", "SYNC", "TIME", "UNSUBSCRIBE", "UNWATCH", "WAIT",
+	} {
+		keylessCommands[c] = true
+	}
+	for _, c := range []string{
+		"DEL", "EXISTS", "MGET", "PFCOUNT", "PFMERGE", "SDIFF", "SDIFFSTORE",
+		"SINTER", "SINTERSTORE", "SUNION", "SUNIONSTORE", "UNLINK", "WATCH",
+	} {
+		allKeysCommands[c] = true
+	}
+}
+
+// commandKeys gives the keys of a command, such as the keys after STREAMS in
+// XREAD. cmd is uppercase.
+func commandKeys(cmd string, args []string) []string {
+	switch {
+	case keylessCommands[cmd]:
+		return nil
+	case allKeysCommands[cmd]:
+		return args
+	}
+
+	switch cmd {
+	case "BRPOPLPUSH", "RENAME", "RENAMENX", "RPOPLPUSH", "SMOVE":
+		if len(args) >= 2 {
+			return args[:2]
+		}
+	case "BLPOP", "BRPOP":
+		if len(args) >= 1 {
+			return args[:len(args)-1]
+		}
+		return nil
+	case "MSET", "MSETNX":
+		var keys []string
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "BITOP":
+		if len(args) >= 1 {
+			return args[1:]
+		}
+		return nil
+	case "EVAL", "EVALSHA":
+		if len(args) >= 2 {
+			return numKeys(args[1], args[2:])
+		}
+		return nil
+	case "ZINTERSTORE", "ZUNIONSTORE":
+		if len(args) >= 2 {
+			return append([]string{args[0]}, numKeys(args[1], args[2:])...)
+		}
+	case "XREAD", "XREADGROUP":
+		for i, a := range args {
+			if strings.ToUpper(a) == "STREAMS" {
+				rest := args[i+1:]
+				return rest[:len(rest)/2]
+			}
+		}
+		return nil
+	case "GEORADIUS":
+		if len(args) == 0 {
+			return nil
+		}
+		keys := args[:1]
+		for i, a := range args {
+			if u := strings.ToUpper(a); (u == "STORE" || u == "STOREDIST") && i+1 < len(args) {
+				keys = append(keys, args[i+1])
+			}
+		}
+		return keys
+	case "MEMORY", "OBJECT", "XGROUP", "XINFO":
+		if len(args) >= 2 {
+			return args[1:2]
+		}
+		return nil
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args[:1]
+}
+
+// numKeys gives the first n args, with n a number as given to EVAL.
+func numKeys(n string, args []string) []string {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 || i > len(args) {
+		return nil
+	}
+	return args[:i]
+}
@@ -0,0 +1,165 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestKeySlot(t *testing.T) {
+	equals(t, 12182, KeySlot("foo"))
+	equals(t, 5061, KeySlot("bar"))
+	equals(t, 12739, KeySlot("123456789"))
+	equals(t, KeySlot("user1000"), KeySlot("{user1000}.following"))
+	equals(t, KeySlot("user1000"), KeySlot("{user1000}.followers"))
+	equals(t, KeySlot("bar"), KeySlot("foo{bar}{zap}"))
+	equals(t, KeySlot("foo{}{bar}"), KeySlot("foo{}{bar}"))
+	equals(t, KeySlot("{bar"), KeySlot("foo{{bar}}zap"))
+}
+
+func TestCluster(t *testing.T) {
+	cl, err := RunCluster(3)
+	ok(t, err)
+	defer cl.Close()
+	addrs := cl.Addrs()
+	equals(t, 3, len(addrs))
+
+	var conns []redis.Conn
+	for _, a := range addrs {
+		c, err := redis.Dial("tcp", a)
+		ok(t, err)
+		defer c.Close()
+		conns = append(conns, c)
+	}
+	c0, c2 := conns[0], conns[2]
+
+	t.Run("slots", func(t *testing.T) {
+		v, err := redis.Values(c0.Do("CLUSTER", "SLOTS"))
+		ok(t, err)
+		equals(t, 3, len(v))
+		for i, want := range [][2]int64{{0, 5460}, {5461, 10922}, {10923, 16383}} {
+			r := v[i].([]interface{})
+			equals(t, want[0], r[0])
+			equals(t, want[1], r[1])
+			node := r[2].([]interface{})
+			equals(t, addrs[i], fmt.Sprintf("%s:%d", node[0], node[1]))
+			equals(t, cl.Nodes()[i].runID, string(node[2].([]byte)))
+		}
+
+		n, err := redis.Int(c0.Do("CLUSTER", "KEYSLOT", "foo"))
+		ok(t, err)
+		equals(t, 12182, n)
+		_, err = c0.Do("CLUSTER", "KEYSLOT")
+		mustFail(t, err, "ERR wrong number of arguments for 'cluster|keyslot' command")
+		_, err = c0.Do("CLUSTER", "FOO")
+		mustFail(t, err, "ERR unknown subcommand 'FOO'. Try CLUSTER HELP.")
+
+		shards, err := redis.Values(c0.Do("CLUSTER", "SHARDS"))
+		ok(t, err)
+		equals(t, 3, len(shards))
+	})
+
+	t.Run("moved", func(t *testing.T) {
+		_, err := c0.Do("SET", "foo", "bar")
+		mustFail(t, err, "MOVED 12182 "+addrs[2])
+		_, err = c2.Do("SET", "foo", "bar")
+		ok(t, err)
+		equals(t, cl.Nodes()[2], cl.Node("foo"))
+		cl.Node("foo").CheckGet(t, "foo", "bar")
+
+		_, err = c2.Do("MGET", "foo", "bar")
+		mustFail(t, err, msgCrossSlot)
+		_, err = c2.Do("MSET", "{foo}a", "1", "{foo}b", "2")
+		ok(t, err)
+		_, err = c0.Do("PING")
+		ok(t, err)
+
+		// redirects come before any other check
+		n0 := cl.Nodes()[0]
+		ok(t, n0.SetMaxMemory(1, "noeviction"))
+		n0.Set("full", "yes")
+		_, err = c0.Do("SET", "foo", "bar")
+		mustFail(t, err, "MOVED 12182 "+addrs[2])
+		ok(t, n0.SetMaxMemory(0, "noeviction"))
+		n0.Del("full")
+
+		n, err := redis.Int(c2.Do("CLUSTER", "COUNTKEYSINSLOT", 12182))
+		ok(t, err)
+		equals(t, 3, n)
+		keys, err := redis.Strings(c2.Do("CLUSTER", "GETKEYSINSLOT", 12182, 2))
+		ok(t, err)
+		equals(t, []string{"foo", "{foo}a"}, keys)
+		_, err = c2.Do("CLUSTER", "COUNTKEYSINSLOT", 16384)
+		mustFail(t, err, msgInvalidSlot)
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		cl.Nodes()[2].SetTTL("foo", time.Minute)
+		ok(t, cl.StartMigration(12182, 0))
+		mustFail(t, cl.StartMigration(12182, 1), "slot 12182 is already migrating")
+
+		v, err := redis.String(c2.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+
+		nodes, err := redis.String(c2.Do("CLUSTER", "NODES"))
+		ok(t, err)
+		assert(t, strings.Contains(nodes, "myself,master"), "myself")
+		assert(t, strings.Contains(nodes, "[12182->-"+cl.Nodes()[0].runID+"]"), "migrating")
+
+		ok(t, cl.MigrateKey("foo"))
+		_, err = c2.Do("GET", "foo")
+		mustFail(t, err, "ASK 12182 "+addrs[0])
+		_, err = c2.Do("MGET", "foo", "{foo}a")
+		mustFail(t, err, msgTryAgain)
+		_, err = c0.Do("GET", "foo")
+		mustFail(t, err, "MOVED 12182 "+addrs[2])
+
+		_, err = c0.Do("ASKING")
+		ok(t, err)
+		v, err = redis.String(c0.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+		equals(t, time.Minute, cl.Nodes()[0].TTL("foo"))
+		// only for a single command
+		_, err = c0.Do("GET", "foo")
+		mustFail(t, err, "MOVED 12182 "+addrs[2])
+
+		ok(t, cl.FinishMigration(12182))
+		_, err = c2.Do("GET", "foo")
+		mustFail(t, err, "MOVED 12182 "+addrs[0])
+		v, err = redis.String(c0.Do("GET", "{foo}a"))
+		ok(t, err)
+		equals(t, "1", v)
+		equals(t, 0, len(cl.Nodes()[2].Keys()))
+
+		mustFail(t, cl.FinishMigration(12182), "slot 12182 is not migrating")
+		ok(t, cl.MoveSlot(12182, 2))
+		v, err = redis.String(c2.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+	})
+
+	t.Run("misc", func(t *testing.T) {
+		_, err := c0.Do("READONLY")
+		ok(t, err)
+		_, err = c0.Do("READWRITE")
+		ok(t, err)
+		_, err = c0.Do("SELECT", 1)
+		mustFail(t, err, msgSelectCluster)
+
+		s, err := Run()
+		ok(t, err)
+		defer s.Close()
+		c, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c.Close()
+		_, err = c.Do("CLUSTER", "SLOTS")
+		mustFail(t, err, msgClusterDisabled)
+		_, err = c.Do("READONLY")
+		mustFail(t, err, msgClusterDisabled)
+	})
+}
@@ -0,0 +1,188 @@
+// Commands from https://redis.io/commands#server
+
+package miniredis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func commandsACL(m *Miniredis) {
+	m.srv.Register("ACL", m.cmdACL)
+}
+
+// ACL
+func (m *Miniredis) cmdACL(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+	nargs := map[string][2]int{ // min and max, -1 for no max
+		"CAT":     {0, 1},
+		"DELUSER": {1, -1},
+		"GETUSER": {1, 1},
+		"LIST":    {0, 0},
+		"LOG":     {0, 1},
+		"SETUSER": {1, -1},
+		"USERS":   {0, 0},
+		"WHOAMI":  {0, 0},
+	}
+	if n, ok := nargs[subcmd]; ok && (len(args) < n[0] || (n[1] >= 0 && len(args) > n[1])) {
+		setDirty(c)
+		c.WriteError(errWrongNumber("acl|" + strings.ToLower(subcmd)))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		switch subcmd {
+		case "CAT":
+			if len(args) == 0 {
+				c.WriteLen(len(aclCategories))
+				for _, cat := range aclCategories {
+					c.WriteBulk(cat.name)
+				}
+				return
+			}
+			cat := strings.ToLower(args[0])
+			if aclCategory(cat) < 0 {
+				c.WriteError(fmt.Sprintf(msgFUnknownCategory, args[0]))
+				return
+			}
+			cmds := categoryCommands(cat)
+			c.WriteLen(len(cmds))
+			for _, cmd := range cmds {
+				c.WriteBulk(cmd)
+			}
+
+		case "DELUSER":
+			for _, name := range args {
+				if name == "default" {
+					c.WriteError(msgDelDefaultUser)
+					return
+				}
+			}
+			n := 0
+			for _, name := range args {
+				if m.delUser(name) {
+					n++
+				}
+			}
+			c.WriteInt(n)
+
+		case "GETUSER":
+			u, ok := m.users[args[0]]
+			if !ok {
+				c.WriteNull()
+				return
+			}
+			c.WriteMapLen(6)
+			c.WriteBulk("flags")
+			writeStrings(c, u.flags())
+			c.WriteBulk("passwords")
+			writeStrings(c, u.passwords)
+			c.WriteBulk("commands")
+			c.WriteBulk(u.commandRules())
+			c.WriteBulk("keys")
+			c.WriteBulk(u.keyRules())
+			c.WriteBulk("channels")
+			chans := u.channelRules()
+			if len(u.channels) == 0 {
+				chans = ""
+			}
+			c.WriteBulk(chans)
+			c.WriteBulk("selectors")
+			c.WriteLen(0)
+
+		case "LIST":
+			names := m.userNames()
+			c.WriteLen(len(names))
+			for _, name := range names {
+				c.WriteBulk(m.users[name].String())
+			}
+
+		case "LOG":
+			n := len(m.aclLog)
+			if len(args) == 1 {
+				if strings.ToUpper(args[0]) == "RESET" {
+					m.aclLog = nil
+					c.WriteOK()
+					return
+				}
+				i, err := strconv.Atoi(args[0])
+				if err != nil || i < 0 {
+					c.WriteError(msgInvalidInt)
+					return
+				}
+				if i < n {
+					n = i
+				}
+			}
+			now := time.Now()
+			c.WriteLen(n)
+			for _, e := range m.aclLog[:n] {
+				c.WriteMapLen(7)
+				c.WriteBulk("count")
+				c.WriteInt(e.count)
+				c.WriteBulk("reason")
+				c.WriteBulk(e.reason)
+				c.WriteBulk("context")
+				c.WriteBulk(e.context)
+				c.WriteBulk("object")
+				c.WriteBulk(e.object)
+				c.WriteBulk("username")
+				c.WriteBulk(e.username)
+				c.WriteBulk("age-seconds")
+				c.WriteFloat(now.Sub(e.created).Seconds())
+				c.WriteBulk("client-info")
+				c.WriteBulk(e.clientInfo)
+			}
+
+		case "SETUSER":
+			if err := m.setUser(args[0], args[1:]); err != nil {
+				c.WriteError("ERR " + err.Error())
+				return
+			}
+			c.WriteOK()
+
+		case "USERS":
+			writeStrings(c, m.userNames())
+
+		case "WHOAMI":
+			c.WriteBulk(connUserName(ctx))
+
+		default:
+			c.WriteError(fmt.Sprintf(msgFACLUsage, subcmd))
+		}
+	})
+}
+
+// userNames are all ACL users, sorted. Needs the lock.
+func (m *Miniredis) userNames() []string {
+	var names []string
+	for name := range m.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeStrings(c *server.Peer, ss []string) {
+	c.WriteLen(len(ss))
+	for _, s := range ss {
+		c.WriteBulk(s)
+	}
+}
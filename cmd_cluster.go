@@ -0,0 +1,306 @@
+// Commands from https://redis.io/commands#cluster
+
+package miniredis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func commandsCluster(m *Miniredis) {
+	m.srv.Register("ASKING", m.cmdAsking)
+	m.srv.Register("CLUSTER", m.cmdCluster)
+	m.srv.Register("READONLY", m.cmdReadonly)
+	m.srv.Register("READWRITE", m.cmdReadwrite)
+}
+
+// slotRange is a range of hash slots on a single node.
+type slotRange struct {
+	start, end int
+	node       int
+}
+
+// slotRanges gives all ranges of slots, ordered by slot.
+func (c *Cluster) slotRanges() []slotRange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var rs []slotRange
+	for s, n := range c.owner {
+		if l := len(rs); l > 0 && rs[l-1].node == n {
+			rs[l-1].end = s
+			continue
+		}
+		rs = append(rs, slotRange{start: s, end: s, node: n})
+	}
+	return rs
+}
+
+// CLUSTER
+func (m *Miniredis) cmdCluster(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		cl := m.cluster
+		if cl == nil {
+			c.WriteError(msgClusterDisabled)
+			return
+		}
+
+		switch subcmd {
+		case "COUNTKEYSINSLOT":
+			if len(args) != 1 {
+				c.WriteError(errWrongNumber("cluster|countkeysinslot"))
+				return
+			}
+			slot, err := strconv.Atoi(args[0])
+			if err != nil || slot < 0 || slot >= clusterSlots {
+				c.WriteError(msgInvalidSlot)
+				return
+			}
+			c.WriteInt(len(m.db(0).slotKeys(slot)))
+
+		case "GETKEYSINSLOT":
+			if len(args) != 2 {
+				c.WriteError(errWrongNumber("cluster|getkeysinslot"))
+				return
+			}
+			slot, err := strconv.Atoi(args[0])
+			n, nerr := strconv.Atoi(args[1])
+			if err != nil || nerr != nil || slot < 0 || slot >= clusterSlots || n < 0 {
+				c.WriteError(msgInvalidSlot)
+				return
+			}
+			keys := m.db(0).slotKeys(slot)
+			if len(keys) > n {
+				keys = keys[:n]
+			}
+			c.WriteLen(len(keys))
+			for _, k := range keys {
+				c.WriteBulk(k)
+			}
+
+		case "INFO":
+			if len(args) != 0 {
+				c.WriteError(errWrongNumber("cluster|info"))
+				return
+			}
+			n := len(cl.nodes)
+			c.WriteVerbatim("txt", strings.Join([]string{
+				"cluster_state:ok",
+				"cluster_slots_assigned:16384",
+				"cluster_slots_ok:16384",
+				"cluster_slots_pfail:0",
+				"cluster_slots_fail:0",
+				fmt.Sprintf("cluster_known_nodes:%d", n),
+				fmt.Sprintf("cluster_size:%d", n),
+				fmt.Sprintf("cluster_current_epoch:%d", n),
+				fmt.Sprintf("cluster_my_epoch:%d", m.clusterNode+1),
+				"cluster_stats_messages_sent:0",
+				"cluster_stats_messages_received:0",
+				"total_cluster_links_buffer_limit_exceeded:0",
+				"",
+			}, "\r\n"))
+
+		case "KEYSLOT":
+			if len(args) != 1 {
+				c.WriteError(errWrongNumber("cluster|keyslot"))
+				return
+			}
+			c.WriteInt(KeySlot(args[0]))
+
+		case "MYID":
+			if len(args) != 0 {
+				c.WriteError(errWrongNumber("cluster|myid"))
+				return
+			}
+			c.WriteBulk(m.runID)
+
+		case "NODES":
+			if len(args) != 0 {
+				c.WriteError(errWrongNumber("cluster|nodes"))
+				return
+			}
+			c.WriteVerbatim("txt", m.clusterNodes())
+
+		case "SHARDS":
+			if len(args) != 0 {
+				c.WriteError(errWrongNumber("cluster|shards"))
+				return
+			}
+			ranges := cl.slotRanges()
+			c.WriteLen(len(cl.nodes))
+			for i, node := range cl.nodes {
+				var slots []int
+				for _, r := range ranges {
+					if r.node == i {
+						slots = append(slots, r.start, r.end)
+					}
+				}
+				c.WriteMapLen(2)
+				c.WriteBulk("slots")
+				c.WriteLen(len(slots))
+				for _, s := range slots {
+					c.WriteInt(s)
+				}
+				c.WriteBulk("nodes")
+				c.WriteLen(1)
+				addr := cl.addrs[i]
+				c.WriteMapLen(7)
+				c.WriteBulk("id")
+				c.WriteBulk(node.runID)
+				c.WriteBulk("port")
+				c.WriteInt(addr.Port)
+				c.WriteBulk("ip")
+				c.WriteBulk(addr.IP.String())
+				c.WriteBulk("endpoint")
+				c.WriteBulk(addr.IP.String())
+				c.WriteBulk("role")
+				c.WriteBulk("master")
+				c.WriteBulk("replication-offset")
+				c.WriteInt(0)
+				c.WriteBulk("health")
+				c.WriteBulk("online")
+			}
+
+		case "SLOTS":
+			if len(args) != 0 {
+				c.WriteError(errWrongNumber("cluster|slots"))
+				return
+			}
+			ranges := cl.slotRanges()
+			c.WriteLen(len(ranges))
+			for _, r := range ranges {
+				addr := cl.addrs[r.node]
+				c.WriteLen(3)
+				c.WriteInt(r.start)
+				c.WriteInt(r.end)
+				c.WriteLen(4)
+				c.WriteBulk(addr.IP.String())
+				c.WriteInt(addr.Port)
+				c.WriteBulk(cl.nodes[r.node].runID)
+				c.WriteMapLen(0)
+			}
+
+		default:
+			c.WriteError(fmt.Sprintf(msgFClusterUsage, subcmd))
+		}
+	})
+}
+
+// clusterNodes gives the CLUSTER NODES description. Needs the lock.
+func (m *Miniredis) clusterNodes() string {
+	var (
+		cl     = m.cluster
+		ranges = cl.slotRanges()
+		b      strings.Builder
+	)
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for i, node := range cl.nodes {
+		addr := cl.addrs[i]
+		flags := "master"
+		if i == m.clusterNode {
+			flags = "myself,master"
+		}
+		fmt.Fprintf(&b, "%s %s:%d@%d %s - 0 0 %d connected",
+			node.runID, addr.IP, addr.Port, addr.Port+10000, flags, i+1)
+		for _, r := range ranges {
+			if r.node != i {
+				continue
+			}
+			if r.start == r.end {
+				fmt.Fprintf(&b, " %d", r.start)
+			} else {
+				fmt.Fprintf(&b, " %d-%d", r.start, r.end)
+			}
+		}
+		if i == m.clusterNode {
+			for s := 0; s < clusterSlots; s++ {
+				to, ok := cl.migrating[s]
+				switch {
+				case !ok:
+				case cl.owner[s] == i:
+					fmt.Fprintf(&b, " [%d->-%s]", s, cl.nodes[to].runID)
+				case to == i:
+					fmt.Fprintf(&b, " [%d-<-%s]", s, cl.nodes[cl.owner[s]].runID)
+				}
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ASKING
+func (m *Miniredis) cmdAsking(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.cluster == nil {
+		c.WriteError(msgClusterDisabled)
+		return
+	}
+	getCtx(c).asking = true
+	c.WriteOK()
+}
+
+// READONLY
+func (m *Miniredis) cmdReadonly(c *server.Peer, cmd string, args []string) {
+	m.readonlyMode(c, cmd, args, true)
+}
+
+// READWRITE
+func (m *Miniredis) cmdReadwrite(c *server.Peer, cmd string, args []string) {
+	m.readonlyMode(c, cmd, args, false)
+}
+
+// readonlyMode handles READONLY and READWRITE. There are no replicas, so it
+// makes no difference.
+func (m *Miniredis) readonlyMode(c *server.Peer, cmd string, args []string, readonly bool) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.cluster == nil {
+		c.WriteError(msgClusterDisabled)
+		return
+	}
+	getCtx(c).readonly = readonly
+	c.WriteOK()
+}
@@ -3,14 +3,19 @@
 package miniredis
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
 )
 
 func commandsConnection(m *Miniredis) {
 	m.srv.Register("AUTH", m.cmdAuth)
+	m.srv.Register("CLIENT", m.cmdClient)
 	m.srv.Register("ECHO", m.cmdEcho)
+	m.srv.Register("HELLO", m.cmdHello)
 	m.srv.Register("PING", m.cmdPing)
 	m.srv.Register("SELECT", m.cmdSelect)
 	m.srv.Register("SWAPDB", m.cmdSwapdb)
@@ -35,7 +40,7 @@ func (m *Miniredis) cmdPing(c *server.Peer, cmd string, args []string) {
 	}
 
 	// PING is allowed in subscribed state
-	if sub := getCtx(c).subscriber; sub != nil {
+	if sub := getCtx(c).subscriber; sub != nil && !c.Resp3() {
 		c.Block(func(c *server.Writer) {
 			c.WriteLen(2)
 			c.WriteBulk("pong")
@@ -53,7 +58,7 @@ func (m *Miniredis) cmdPing(c *server.Peer, cmd string, args []string) {
 
 // AUTH
 func (m *Miniredis) cmdAuth(c *server.Peer, cmd string, args []string) {
-	if len(args) != 1 {
+	if len(args) < 1 || len(args) > 2 {
 		setDirty(c)
 		c.WriteError(errWrongNumber(cmd))
 		return
@@ -62,23 +67,130 @@ func (m *Miniredis) cmdAuth(c *server.Peer, cmd string, args []string) {
 		return
 	}
 
-	pw := args[0]
-
 	m.Lock()
 	defer m.Unlock()
-	if m.password == "" {
+
+	if len(args) == 2 {
+		user, pw := args[0], args[1]
+		if !m.authUser(c, user, pw) {
+			c.WriteError(msgWrongPass)
+			return
+		}
+		setAuthenticated(c, user)
+		c.WriteOK()
+		return
+	}
+
+	pw := args[0]
+	if m.users["default"].nopass {
 		c.WriteError("ERR Client sent AUTH, but no password is set")
 		return
 	}
-	if m.password != pw {
+	if !m.authUser(c, "default", pw) {
 		c.WriteError("ERR invalid password")
 		return
 	}
 
-	setAuthenticated(c)
+	setAuthenticated(c, "default")
 	c.WriteOK()
 }
 
+// HELLO
+func (m *Miniredis) cmdHello(c *server.Peer, cmd string, args []string) {
+	if m.checkPubsub(c) {
+		return
+	}
+
+	var (
+		resp3    = c.Resp3()
+		auth     = false
+		user, pw string
+		setName  = false
+		name     string
+	)
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			setDirty(c)
+			c.WriteError(msgProtoVersion)
+			return
+		}
+		switch v {
+		case 2:
+			resp3 = false
+		case 3:
+			resp3 = true
+		default:
+			setDirty(c)
+			c.WriteError(msgNoProto)
+			return
+		}
+		args = args[1:]
+	}
+	for len(args) > 0 {
+		switch opt := strings.ToUpper(args[0]); {
+		case opt == "AUTH" && len(args) >= 3:
+			auth = true
+			user, pw = args[1], args[2]
+			args = args[3:]
+		case opt == "SETNAME" && len(args) >= 2:
+			setName = true
+			name = args[1]
+			args = args[2:]
+		default:
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFHelloSyntax, args[0]))
+			return
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	ctx := getCtx(c)
+	if auth {
+		if !m.authUser(c, user, pw) {
+			c.WriteError(msgWrongPass)
+			return
+		}
+		setAuthenticated(c, user)
+	}
+	if m.connUser(ctx) == nil {
+		c.WriteError(msgHelloNoAuth)
+		return
+	}
+	if setName {
+		if !validClientName(name) {
+			c.WriteError(msgInvalidClientName)
+			return
+		}
+		ctx.clientName = name
+	}
+
+	c.SetResp3(resp3)
+	proto := 2
+	if resp3 {
+		proto = 3
+	}
+	c.Block(func(w *server.Writer) {
+		w.WriteMapLen(7)
+		w.WriteBulk("server")
+		w.WriteBulk("redis")
+		w.WriteBulk("version")
+		w.WriteBulk(redisVersion)
+		w.WriteBulk("proto")
+		w.WriteInt(proto)
+		w.WriteBulk("id")
+		w.WriteInt(c.ID())
+		w.WriteBulk("mode")
+		w.WriteBulk("standalone")
+		w.WriteBulk("role")
+		w.WriteBulk("master")
+		w.WriteBulk("modules")
+		w.WriteLen(0)
+	})
+}
+
 // ECHO
 func (m *Miniredis) cmdEcho(c *server.Peer, cmd string, args []string) {
 	if len(args) != 1 {
@@ -119,6 +231,15 @@ func (m *Miniredis) cmdSelect(c *server.Peer, cmd string, args []string) {
 	m.Lock()
 	defer m.Unlock()
 
+	if !m.validDB(id) {
+		c.WriteError(msgDBIndexOutOfRange)
+		return
+	}
+	if m.cluster != nil && id != 0 {
+		c.WriteError(msgSelectCluster)
+		return
+	}
+
 	ctx := getCtx(c)
 	ctx.selectedDB = id
 
@@ -149,8 +270,8 @@ func (m *Miniredis) cmdSwapdb(c *server.Peer, cmd string, args []string) {
 			setDirty(c)
 			return
 		}
-		if id1 < 0 || id2 < 0 {
-			c.WriteError("ERR DB index is out of range")
+		if !m.validDB(id1) || !m.validDB(id2) {
+			c.WriteError(msgDBIndexOutOfRange)
 			setDirty(c)
 			return
 		}
@@ -167,3 +288,410 @@ func (m *Miniredis) cmdQuit(c *server.Peer, cmd string, args []string) {
 	c.WriteOK()
 	c.Close()
 }
+
+// CLIENT
+func (m *Miniredis) cmdClient(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subcmd {
+	case "GETNAME":
+		m.cmdClientGetname(c, subcmd, args)
+	case "ID":
+		m.cmdClientID(c, subcmd, args)
+	case "INFO":
+		m.cmdClientInfo(c, subcmd, args)
+	case "KILL":
+		m.cmdClientKill(c, subcmd, args)
+	case "LIST":
+		m.cmdClientList(c, subcmd, args)
+	case "PAUSE":
+		m.cmdClientPause(c, subcmd, args)
+	case "REPLY":
+		m.cmdClientReply(c, subcmd, args)
+	case "SETNAME":
+		m.cmdClientSetname(c, subcmd, args)
+	case "UNBLOCK":
+		m.cmdClientUnblock(c, subcmd, args)
+	case "UNPAUSE":
+		m.cmdClientUnpause(c, subcmd, args)
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFClientUsage, strings.ToLower(subcmd)))
+	}
+}
+
+// CLIENT SETNAME
+func (m *Miniredis) cmdClientSetname(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|setname"))
+		return
+	}
+	name := args[0]
+	if !validClientName(name) {
+		setDirty(c)
+		c.WriteError(msgInvalidClientName)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		ctx.clientName = name
+		c.WriteOK()
+	})
+}
+
+// CLIENT GETNAME
+func (m *Miniredis) cmdClientGetname(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|getname"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if ctx.clientName == "" {
+			c.WriteNull()
+			return
+		}
+		c.WriteBulk(ctx.clientName)
+	})
+}
+
+// CLIENT ID
+func (m *Miniredis) cmdClientID(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|id"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteInt(c.ID())
+	})
+}
+
+// CLIENT INFO
+func (m *Miniredis) cmdClientInfo(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|info"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteBulk(clientInfo(c).String() + "\n")
+	})
+}
+
+// CLIENT LIST [TYPE type] [ID id ...]
+func (m *Miniredis) cmdClientList(c *server.Peer, cmd string, args []string) {
+	var (
+		typ string
+		ids map[int]bool
+	)
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && strings.ToUpper(args[0]) == "TYPE":
+		typ = strings.ToLower(args[1])
+		if !validClientType(typ) {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFClientType, args[1]))
+			return
+		}
+	case len(args) >= 2 && strings.ToUpper(args[0]) == "ID":
+		ids = map[int]bool{}
+		for _, a := range args[1:] {
+			id, err := strconv.Atoi(a)
+			if err != nil || id <= 0 {
+				setDirty(c)
+				c.WriteError(msgInvalidClientID)
+				return
+			}
+			ids[id] = true
+		}
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		var b strings.Builder
+		for _, p := range m.srv.Peers() {
+			if ids != nil && !ids[p.ID()] {
+				continue
+			}
+			if typ != "" && clientType(p) != typ {
+				continue
+			}
+			b.WriteString(clientInfo(p).String())
+			b.WriteString("\n")
+		}
+		c.WriteBulk(b.String())
+	})
+}
+
+// CLIENT KILL ip:port, or CLIENT KILL [ID id] [TYPE type] [ADDR ip:port]
+// [LADDR ip:port] [USER username] [SKIPME yes/no]
+func (m *Miniredis) cmdClientKill(c *server.Peer, cmd string, args []string) {
+	if len(args) == 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|kill"))
+		return
+	}
+
+	var (
+		oldStyle = len(args) == 1
+		id       int
+		typ      string
+		addr     string
+		laddr    string
+		user     string
+		skipme   = true
+	)
+	if oldStyle {
+		addr = args[0]
+		skipme = false
+	}
+	for !oldStyle && len(args) > 0 {
+		if len(args) < 2 {
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+		opt, v := strings.ToUpper(args[0]), args[1]
+		args = args[2:]
+		switch opt {
+		case "ID":
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				setDirty(c)
+				c.WriteError(msgClientID)
+				return
+			}
+			id = n
+		case "TYPE":
+			typ = strings.ToLower(v)
+			if !validClientType(typ) {
+				setDirty(c)
+				c.WriteError(fmt.Sprintf(msgFClientType, v))
+				return
+			}
+		case "ADDR":
+			addr = v
+		case "LADDR":
+			laddr = v
+		case "USER":
+			user = v
+		case "SKIPME":
+			switch strings.ToLower(v) {
+			case "yes":
+				skipme = true
+			case "no":
+				skipme = false
+			default:
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		killed := 0
+		for _, p := range m.srv.Peers() {
+			switch {
+			case id != 0 && p.ID() != id,
+				typ != "" && clientType(p) != typ,
+				addr != "" && p.Addr() != addr,
+				laddr != "" && p.LocalAddr() != laddr,
+				user != "" && user != "default",
+				skipme && p == c:
+				continue
+			}
+			m.killClient(c, p)
+			killed++
+		}
+		if oldStyle {
+			if killed == 0 {
+				c.WriteError(msgNoSuchClient)
+				return
+			}
+			c.WriteOK()
+			return
+		}
+		c.WriteInt(killed)
+	})
+}
+
+// killClient closes a client connection. The current client is closed after
+// the reply. Needs the lock.
+func (m *Miniredis) killClient(self, p *server.Peer) {
+	if p == self {
+		p.Close()
+		return
+	}
+	p.Kill()
+	if ctx := getCtx(p); ctx.blocked {
+		ctx.unblock = "KILL"
+		m.signal.Broadcast()
+	}
+}
+
+// CLIENT PAUSE timeout [WRITE|ALL]
+func (m *Miniredis) cmdClientPause(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 && len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|pause"))
+		return
+	}
+	ms, err := strconv.Atoi(args[0])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidTimeout)
+		return
+	}
+	if ms < 0 {
+		setDirty(c)
+		c.WriteError(msgNegTimeout)
+		return
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "ALL":
+		case "WRITE":
+			all = false
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		m.pause(time.Duration(ms)*time.Millisecond, all)
+		c.WriteOK()
+	})
+}
+
+// CLIENT UNPAUSE
+func (m *Miniredis) cmdClientUnpause(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|unpause"))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		m.unpause()
+		c.WriteOK()
+	})
+}
+
+// CLIENT UNBLOCK id [TIMEOUT|ERROR]
+func (m *Miniredis) cmdClientUnblock(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 && len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|unblock"))
+		return
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return
+	}
+	reason := "TIMEOUT"
+	if len(args) == 2 {
+		reason = strings.ToUpper(args[1])
+		if reason != "TIMEOUT" && reason != "ERROR" {
+			setDirty(c)
+			c.WriteError(msgUnblockReason)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		for _, p := range m.srv.Peers() {
+			if p.ID() != id {
+				continue
+			}
+			pctx := getCtx(p)
+			if !pctx.blocked {
+				break
+			}
+			pctx.unblock = reason
+			m.signal.Broadcast()
+			c.WriteInt(1)
+			return
+		}
+		c.WriteInt(0)
+	})
+}
+
+// CLIENT REPLY ON|OFF|SKIP
+func (m *Miniredis) cmdClientReply(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber("client|reply"))
+		return
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		c.SetReplyMode(server.ReplyOn)
+		c.WriteOK()
+	case "OFF":
+		c.SetReplyMode(server.ReplyOff)
+	case "SKIP":
+		c.SetReplyMode(server.ReplySkip)
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+	}
+}
+
+// clientType is the type CLIENT LIST and CLIENT KILL filter on. Needs the
+// lock.
+func clientType(p *server.Peer) string {
+	if getCtx(p).subscriber != nil {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+func validClientType(t string) bool {
+	switch t {
+	case "normal", "master", "replica", "slave", "pubsub":
+		return true
+	default:
+		return false
+	}
+}
+
+// validClientName is true if the name is valid for HELLO SETNAME (and CLIENT
+// SETNAME). Only non-space printable ASCII characters are allowed.
+func validClientName(name string) bool {
+	for _, r := range name {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,7 +1,10 @@
 package miniredis
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -14,6 +17,9 @@ func TestAuth(t *testing.T) {
 	ok(t, err)
 
 	_, err = c.Do("AUTH", "foo", "bar")
+	mustFail(t, err, msgWrongPass)
+
+	_, err = c.Do("AUTH", "foo", "bar", "baz")
 	mustFail(t, err, "ERR wrong number of arguments for 'auth' command")
 
 	s.RequireAuth("nocomment")
@@ -170,3 +176,332 @@ func TestQuit(t *testing.T) {
 	assert(t, err != nil, "QUIT closed the client")
 	equals(t, "", v)
 }
+
+// Test the inline protocol, and protocol errors
+func TestInline(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+
+	c := newRawConn(t, s.Addr())
+	defer c.Close()
+	fmt.Fprintf(c.conn, "PING\r\n")
+	equals(t, "+PONG\r\n", c.Read())
+	fmt.Fprintf(c.conn, "SET foo \"bar baz\"\n")
+	equals(t, "+OK\r\n", c.Read())
+	fmt.Fprintf(c.conn, "\r\nGET 'foo'\r\n")
+	equals(t, "$7\r\nbar baz\r\n", c.Read())
+
+	fmt.Fprintf(c.conn, "SET foo \"bar\r\n")
+	equals(t, "-ERR Protocol error: unbalanced quotes in request\r\n", c.Read())
+	equals(t, "", c.Read()) // disconnected
+
+	c2 := newRawConn(t, s.Addr())
+	defer c2.Close()
+	_, err = c2.conn.Write([]byte("*1\r\n$600000000\r\n"))
+	ok(t, err)
+	equals(t, "-ERR Protocol error: invalid bulk length\r\n", c2.Read())
+}
+
+func TestHello(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c := newRawConn(t, s.Addr())
+	defer c.Close()
+
+	t.Run("resp3", func(t *testing.T) {
+		equals(t,
+			"%7\r\n"+
+				"$6\r\nserver\r\n$5\r\nredis\r\n"+
+				"$7\r\nversion\r\n$5\r\n7.0.0\r\n"+
+				"$5\r\nproto\r\n:3\r\n"+
+				"$2\r\nid\r\n:1\r\n"+
+				"$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+				"$4\r\nrole\r\n$6\r\nmaster\r\n"+
+				"$7\r\nmodules\r\n*0\r\n",
+			c.Do("HELLO", "3"),
+		)
+		equals(t, "_\r\n", c.Do("GET", "nosuch"))
+	})
+
+	t.Run("resp2", func(t *testing.T) {
+		equals(t, "*14\r\n", c.Do("HELLO", "2")[:5])
+		equals(t, "$-1\r\n", c.Do("GET", "nosuch"))
+	})
+
+	t.Run("setname", func(t *testing.T) {
+		equals(t, "*14\r\n", c.Do("HELLO", "2", "SETNAME", "foo")[:5])
+		equals(t, "-ERR Client names cannot contain spaces, newlines or special characters.\r\n", c.Do("HELLO", "2", "SETNAME", "foo bar"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		equals(t, "-ERR Protocol version is not an integer or out of range\r\n", c.Do("HELLO", "foo"))
+		equals(t, "-NOPROTO unsupported protocol version\r\n", c.Do("HELLO", "4"))
+		equals(t, "-ERR Syntax error in HELLO option 'foo'\r\n", c.Do("HELLO", "3", "foo"))
+		equals(t, "-ERR Syntax error in HELLO option 'AUTH'\r\n", c.Do("HELLO", "3", "AUTH", "default"))
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		s.RequireAuth("secret")
+		c := newRawConn(t, s.Addr())
+		defer c.Close()
+
+		equals(t, "-"+msgHelloNoAuth+"\r\n", c.Do("HELLO", "3"))
+		equals(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n", c.Do("HELLO", "3", "AUTH", "default", "wrong"))
+		equals(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n", c.Do("HELLO", "3", "AUTH", "foo", "secret"))
+		equals(t, "%7\r\n", c.Do("HELLO", "3", "AUTH", "default", "secret")[:4])
+		equals(t, "+PONG\r\n", c.Do("PING"))
+	})
+}
+
+func TestResp3(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c := newRawConn(t, s.Addr())
+	defer c.Close()
+	c.Do("HELLO", "3")
+
+	s.HSet("hash", "aap", "noot")
+	s.SetAdd("set", "mies")
+	s.ZAdd("zset", 1.5, "vuur")
+
+	equals(t, "%1\r\n$3\r\naap\r\n$4\r\nnoot\r\n", c.Do("HGETALL", "hash"))
+	equals(t, "%0\r\n", c.Do("HGETALL", "nosuch"))
+	equals(t, "~1\r\n$4\r\nmies\r\n", c.Do("SMEMBERS", "set"))
+	equals(t, "~1\r\n$4\r\nmies\r\n", c.Do("SUNION", "set", "nosuch"))
+	equals(t, ",1.5\r\n", c.Do("ZSCORE", "zset", "vuur"))
+	equals(t, "_\r\n", c.Do("ZSCORE", "zset", "nosuch"))
+	equals(t, ",3\r\n", c.Do("ZINCRBY", "zset", "1.5", "vuur"))
+
+	// back to RESP2
+	c.Do("HELLO", "2")
+	equals(t, "$1\r\n3\r\n", c.Do("ZSCORE", "zset", "vuur"))
+}
+
+func TestClient(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("name", func(t *testing.T) {
+		_, err := redis.String(c.Do("CLIENT", "GETNAME"))
+		equals(t, redis.ErrNil, err)
+
+		v, err := redis.String(c.Do("CLIENT", "SETNAME", "aap"))
+		ok(t, err)
+		equals(t, "OK", v)
+
+		v, err = redis.String(c.Do("CLIENT", "GETNAME"))
+		ok(t, err)
+		equals(t, "aap", v)
+
+		_, err = c.Do("CLIENT", "SETNAME", "aap noot")
+		mustFail(t, err, msgInvalidClientName)
+		_, err = c.Do("CLIENT", "SETNAME")
+		mustFail(t, err, "ERR wrong number of arguments for 'client|setname' command")
+		_, err = c.Do("CLIENT", "FOO")
+		mustFail(t, err, "ERR unknown subcommand 'foo'. Try CLIENT HELP.")
+		_, err = c.Do("CLIENT")
+		mustFail(t, err, "ERR wrong number of arguments for 'client' command")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		id, err := redis.Int(c.Do("CLIENT", "ID"))
+		ok(t, err)
+
+		v, err := redis.String(c.Do("CLIENT", "INFO"))
+		ok(t, err)
+		assert(t, strings.HasPrefix(v, fmt.Sprintf("id=%d addr=%s ", id, c2addr(t, s, id))), "client info")
+		assert(t, strings.Contains(v, " name=aap "), "name")
+		assert(t, strings.Contains(v, " flags=N db=0 "), "flags")
+		assert(t, strings.HasSuffix(v, " cmd=client|info user=default redir=-1 resp=2\n"), "cmd")
+
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("SELECT", 3)
+		ok(t, err)
+
+		v, err = redis.String(c.Do("CLIENT", "LIST"))
+		ok(t, err)
+		lines := strings.Split(v, "\n")
+		equals(t, 3, len(lines))
+		assert(t, strings.Contains(lines[1], " db=3 "), "db")
+		assert(t, strings.Contains(lines[1], " cmd=select "), "cmd")
+
+		v, err = redis.String(c.Do("CLIENT", "LIST", "ID", id))
+		ok(t, err)
+		equals(t, 1, strings.Count(v, "\n"))
+
+		v, err = redis.String(c.Do("CLIENT", "LIST", "TYPE", "pubsub"))
+		ok(t, err)
+		equals(t, "", v)
+
+		_, err = c.Do("CLIENT", "LIST", "TYPE", "foo")
+		mustFail(t, err, "ERR Unknown client type 'foo'")
+		_, err = c.Do("CLIENT", "LIST", "ID", "foo")
+		mustFail(t, err, msgInvalidClientID)
+
+		cs := s.Clients()
+		equals(t, 2, len(cs))
+		equals(t, "aap", cs[0].Name)
+		equals(t, 3, cs[1].DB)
+		equals(t, -1, cs[1].Multi)
+	})
+
+	t.Run("kill", func(t *testing.T) {
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		id2, err := redis.Int(c2.Do("CLIENT", "ID"))
+		ok(t, err)
+		addr2 := s.Clients()[len(s.Clients())-1].Addr
+
+		n, err := redis.Int(c.Do("CLIENT", "KILL", "ID", id2))
+		ok(t, err)
+		equals(t, 1, n)
+		_, err = c2.Do("PING")
+		assert(t, err != nil, "killed")
+
+		_, err = c.Do("CLIENT", "KILL", addr2)
+		mustFail(t, err, msgNoSuchClient)
+		n, err = redis.Int(c.Do("CLIENT", "KILL", "TYPE", "normal"))
+		ok(t, err)
+		equals(t, 0, n) // SKIPME yes
+
+		_, err = c.Do("CLIENT", "KILL", "ID", "foo")
+		mustFail(t, err, msgClientID)
+		_, err = c.Do("CLIENT", "KILL", "TYPE", "foo")
+		mustFail(t, err, "ERR Unknown client type 'foo'")
+		_, err = c.Do("CLIENT", "KILL", "SKIPME", "foo")
+		mustFail(t, err, msgSyntaxError)
+		_, err = c.Do("CLIENT", "KILL", "ID", 1, "TYPE")
+		mustFail(t, err, msgSyntaxError)
+	})
+
+	t.Run("unblock", func(t *testing.T) {
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		id2, err := redis.Int(c2.Do("CLIENT", "ID"))
+		ok(t, err)
+
+		n, err := redis.Int(c.Do("CLIENT", "UNBLOCK", id2))
+		ok(t, err)
+		equals(t, 0, n)
+
+		res := make(chan error, 1)
+		go func() {
+			_, err := c2.Do("BLPOP", "nosuch", 0)
+			res <- err
+		}()
+		for s.Info("clients").Clients.BlockedClients == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		equals(t, "b", s.Clients()[1].Flags)
+		n, err = redis.Int(c.Do("CLIENT", "UNBLOCK", id2, "ERROR"))
+		ok(t, err)
+		equals(t, 1, n)
+		mustFail(t, <-res, msgUnblocked)
+
+		go func() {
+			_, err := redis.Strings(c2.Do("BLPOP", "nosuch", 0))
+			res <- err
+		}()
+		for s.Info("clients").Clients.BlockedClients == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_, err = c.Do("CLIENT", "UNBLOCK", id2, "TIMEOUT")
+		ok(t, err)
+		equals(t, redis.ErrNil, <-res)
+
+		_, err = c.Do("CLIENT", "UNBLOCK", id2, "FOO")
+		mustFail(t, err, msgUnblockReason)
+		_, err = c.Do("CLIENT", "UNBLOCK", "foo")
+		mustFail(t, err, msgInvalidInt)
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		_, err = c.Do("CLIENT", "PAUSE", 100000, "WRITE")
+		ok(t, err)
+		// reads still work
+		_, err = c2.Do("GET", "foo")
+		ok(t, err)
+
+		res := make(chan error, 1)
+		go func() {
+			_, err := c2.Do("SET", "foo", "bar")
+			res <- err
+		}()
+		select {
+		case <-res:
+			t.Fatal("SET wasn't paused")
+		case <-time.After(10 * time.Millisecond):
+		}
+		_, err = c.Do("CLIENT", "UNPAUSE")
+		ok(t, err)
+		ok(t, <-res)
+
+		_, err = c.Do("CLIENT", "PAUSE", 10)
+		ok(t, err)
+		_, err = c2.Do("GET", "foo") // waits for 10ms
+		ok(t, err)
+
+		_, err = c.Do("CLIENT", "PAUSE", "foo")
+		mustFail(t, err, msgInvalidTimeout)
+		_, err = c.Do("CLIENT", "PAUSE", -1)
+		mustFail(t, err, msgNegTimeout)
+		_, err = c.Do("CLIENT", "PAUSE", 1, "FOO")
+		mustFail(t, err, msgSyntaxError)
+	})
+
+	t.Run("reply", func(t *testing.T) {
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+
+		// redigo expects a reply for every command, so use Receive()
+		c2.Send("CLIENT", "REPLY", "OFF")
+		c2.Send("SET", "foo", "off")
+		c2.Send("CLIENT", "REPLY", "ON")
+		ok(t, c2.Flush())
+		v, err := redis.String(c2.Receive())
+		ok(t, err)
+		equals(t, "OK", v)
+		v, err = s.Get("foo")
+		ok(t, err)
+		equals(t, "off", v)
+
+		c2.Send("CLIENT", "REPLY", "SKIP")
+		c2.Send("SET", "foo", "skip")
+		c2.Send("GET", "foo")
+		ok(t, c2.Flush())
+		v, err = redis.String(c2.Receive())
+		ok(t, err)
+		equals(t, "skip", v)
+
+		_, err = c.Do("CLIENT", "REPLY", "FOO")
+		mustFail(t, err, msgSyntaxError)
+	})
+}
+
+// c2addr finds the address of a client.
+func c2addr(t *testing.T, s *Miniredis, id int) string {
+	t.Helper()
+	for _, c := range s.Clients() {
+		if c.ID == id {
+			return c.Addr
+		}
+	}
+	t.Fatalf("no client %d", id)
+	return ""
+}
@@ -3,6 +3,7 @@
 package miniredis
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -14,14 +15,14 @@ import (
 func commandsGeneric(m *Miniredis) {
 	m.srv.Register("DEL", m.cmdDel)
 	m.srv.Register("UNLINK", m.cmdDel)
-	// DUMP
+	m.srv.Register("DUMP", m.cmdDump)
 	m.srv.Register("EXISTS", m.cmdExists)
 	m.srv.Register("EXPIRE", makeCmdExpire(m, false, time.Second))
 	m.srv.Register("EXPIREAT", makeCmdExpire(m, true, time.Second))
 	m.srv.Register("KEYS", m.cmdKeys)
 	// MIGRATE
 	m.srv.Register("MOVE", m.cmdMove)
-	// OBJECT
+	m.srv.Register("OBJECT", m.cmdObject)
 	m.srv.Register("PERSIST", m.cmdPersist)
 	m.srv.Register("PEXPIRE", makeCmdExpire(m, false, time.Millisecond))
 	m.srv.Register("PEXPIREAT", makeCmdExpire(m, true, time.Millisecond))
@@ -29,7 +30,7 @@ func commandsGeneric(m *Miniredis) {
 	m.srv.Register("RANDOMKEY", m.cmdRandomkey)
 	m.srv.Register("RENAME", m.cmdRename)
 	m.srv.Register("RENAMENX", m.cmdRenamenx)
-	// RESTORE
+	m.srv.Register("RESTORE", m.cmdRestore)
 	// SORT
 	m.srv.Register("TTL", m.cmdTTL)
 	m.srv.Register("TYPE", m.cmdType)
@@ -70,6 +71,7 @@ func makeCmdExpire(m *Miniredis, unix bool, d time.Duration) func(*server.Peer,
 				c.WriteInt(0)
 				return
 			}
+			var ttl time.Duration
 			if unix {
 				var ts time.Time
 				switch d {
@@ -80,16 +82,19 @@ func makeCmdExpire(m *Miniredis, unix bool, d time.Duration) func(*server.Peer,
 				default:
 					panic("invalid time unit (d). Fixme!")
 				}
-				now := m.now
-				if now.IsZero() {
-					now = time.Now().UTC()
-				}
-				db.ttl[key] = ts.Sub(now)
+				ttl = ts.Sub(m.effectiveNow())
+			} else {
+				ttl = time.Duration(i) * d
+			}
+			db.setTTL(key, ttl)
+			db.modified(key)
+			if ttl <= 0 {
+				// an expire in the past deletes the key
+				db.del(key, true)
+				db.notify(notifyGeneric, "del", key)
 			} else {
-				db.ttl[key] = time.Duration(i) * d
+				db.notify(notifyGeneric, "expire", key)
 			}
-			db.keyVersion[key]++
-			db.checkTTL(key)
 			c.WriteInt(1)
 		})
 	}
@@ -120,7 +125,7 @@ func (m *Miniredis) cmdTTL(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		v, ok := db.ttl[key]
+		v, ok := db.ttlLeft(key)
 		if !ok {
 			// no expire value
 			c.WriteInt(-1)
@@ -155,7 +160,7 @@ func (m *Miniredis) cmdPTTL(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		v, ok := db.ttl[key]
+		v, ok := db.ttlLeft(key)
 		if !ok {
 			// no expire value
 			c.WriteInt(-1)
@@ -165,6 +170,64 @@ func (m *Miniredis) cmdPTTL(c *server.Peer, cmd string, args []string) {
 	})
 }
 
+// OBJECT
+func (m *Miniredis) cmdObject(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	name, args := args[0], args[1:]
+	subcmd := strings.ToUpper(name)
+	switch subcmd {
+	case "ENCODING", "FREQ", "IDLETIME", "REFCOUNT":
+		if len(args) != 1 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("object|" + strings.ToLower(subcmd)))
+			return
+		}
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFObjectUsage, name))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+		key := args[0]
+		if !db.exists(key) {
+			c.WriteNull()
+			return
+		}
+
+		switch subcmd {
+		case "ENCODING":
+			c.WriteBulk(db.encoding(key))
+		case "FREQ":
+			if !strings.HasSuffix(m.maxmemoryPolicy, "-lfu") {
+				c.WriteError(msgFreqNotLFU)
+				return
+			}
+			c.WriteInt(m.lfuDecay(db.access[key]))
+		case "IDLETIME":
+			if strings.HasSuffix(m.maxmemoryPolicy, "-lfu") {
+				c.WriteError(msgIdletimeLFU)
+				return
+			}
+			c.WriteInt(int(db.idletime(key) / time.Second))
+		case "REFCOUNT":
+			c.WriteInt(db.refcount(key))
+		}
+	})
+}
+
 // PERSIST
 func (m *Miniredis) cmdPersist(c *server.Peer, cmd string, args []string) {
 	if len(args) != 1 {
@@ -196,7 +259,8 @@ func (m *Miniredis) cmdPersist(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		delete(db.ttl, key)
-		db.keyVersion[key]++
+		db.modified(key)
+		db.notify(notifyGeneric, "persist", key)
 		c.WriteInt(1)
 	})
 }
@@ -223,6 +287,7 @@ func (m *Miniredis) cmdDel(c *server.Peer, cmd string, args []string) {
 		for _, key := range args {
 			if db.exists(key) {
 				count++
+				db.notify(notifyGeneric, "del", key)
 			}
 			db.del(key, true) // delete expire
 		}
@@ -307,6 +372,10 @@ func (m *Miniredis) cmdMove(c *server.Peer, cmd string, args []string) {
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if !m.validDB(targetDB) {
+			c.WriteError(msgDBIndexOutOfRange)
+			return
+		}
 		if ctx.selectedDB == targetDB {
 			c.WriteError("ERR source and destination objects are the same")
 			return
@@ -318,6 +387,8 @@ func (m *Miniredis) cmdMove(c *server.Peer, cmd string, args []string) {
 			c.WriteInt(0)
 			return
 		}
+		db.notify(notifyGeneric, "move_from", key)
+		targetDB.notify(notifyGeneric, "move_to", key)
 		c.WriteInt(1)
 	})
 }
@@ -406,6 +477,8 @@ func (m *Miniredis) cmdRename(c *server.Peer, cmd string, args []string) {
 		}
 
 		db.rename(from, to)
+		db.notify(notifyGeneric, "rename_from", from)
+		db.notify(notifyGeneric, "rename_to", to)
 		c.WriteOK()
 	})
 }
@@ -440,6 +513,8 @@ func (m *Miniredis) cmdRenamenx(c *server.Peer, cmd string, args []string) {
 		}
 
 		db.rename(from, to)
+		db.notify(notifyGeneric, "rename_from", from)
+		db.notify(notifyGeneric, "rename_to", to)
 		c.WriteInt(1)
 	})
 }
@@ -525,3 +600,165 @@ func (m *Miniredis) cmdScan(c *server.Peer, cmd string, args []string) {
 		}
 	})
 }
+
+// DUMP
+func (m *Miniredis) cmdDump(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key := args[0]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if !db.exists(key) {
+			c.WriteNull()
+			return
+		}
+		c.WriteBulk(dumpValue(db, key))
+	})
+}
+
+// RESTORE
+func (m *Miniredis) cmdRestore(c *server.Peer, cmd string, args []string) {
+	if len(args) < 3 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	var opts struct {
+		key      string
+		ttl      int
+		payload  string
+		replace  bool
+		absttl   bool
+		idletime int
+		freq     int
+	}
+	opts.key, opts.payload = args[0], args[2]
+	opts.idletime, opts.freq = -1, -1
+	for args := args[3:]; len(args) > 0; args = args[1:] {
+		switch strings.ToUpper(args[0]) {
+		case "REPLACE":
+			opts.replace = true
+		case "ABSTTL":
+			opts.absttl = true
+		case "IDLETIME":
+			if len(args) < 2 || opts.freq != -1 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			if n < 0 {
+				setDirty(c)
+				c.WriteError(msgInvalidIdletime)
+				return
+			}
+			opts.idletime = n
+			args = args[1:]
+		case "FREQ":
+			if len(args) < 2 || opts.idletime != -1 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			if n < 0 || n > 255 {
+				setDirty(c)
+				c.WriteError(msgInvalidFreq)
+				return
+			}
+			opts.freq = n
+			args = args[1:]
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+	ttl, err := strconv.Atoi(args[1])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return
+	}
+	if ttl < 0 {
+		setDirty(c)
+		c.WriteError(msgInvalidTTL)
+		return
+	}
+	opts.ttl = ttl
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if !opts.replace && db.exists(opts.key) {
+			c.WriteError(msgBusyKey)
+			return
+		}
+
+		tmp := newRedisDB(db.id, m)
+		switch err := restoreValue(&tmp, opts.key, opts.payload); err {
+		case nil:
+		case errDumpPayload:
+			c.WriteError(msgDumpPayload)
+			return
+		default:
+			c.WriteError(msgBadDataFormat)
+			return
+		}
+
+		var expire time.Duration
+		if opts.ttl > 0 {
+			expire = time.Duration(opts.ttl) * time.Millisecond
+			if opts.absttl {
+				expire = time.Unix(0, int64(opts.ttl)*int64(time.Millisecond)).Sub(m.effectiveNow())
+			}
+			if expire <= 0 {
+				// already expired. Redis still removes the old key.
+				if opts.replace && db.exists(opts.key) {
+					db.del(opts.key, true)
+					db.notify(notifyGeneric, "del", opts.key)
+				}
+				c.WriteOK()
+				return
+			}
+		}
+
+		db.del(opts.key, true)
+		tmp.move(opts.key, db)
+		db.restoreAccess(opts.key, opts.idletime, opts.freq)
+		if expire > 0 {
+			db.setTTL(opts.key, expire)
+		}
+		db.notify(notifyGeneric, "restore", opts.key)
+		c.WriteOK()
+	})
+}
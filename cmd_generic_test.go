@@ -1,6 +1,8 @@
 package miniredis
 
 import (
+	"encoding/binary"
+	"strings"
 	"testing"
 	"time"
 
@@ -738,3 +740,253 @@ func TestRenamenx(t *testing.T) {
 		assert(t, err != nil, "do RENAMENX error")
 	}
 }
+
+func TestDumpRestore(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("str", "value")
+	s.RPush("list", "aap", "noot", "12")
+	s.SAdd("set", "aap", "noot")
+	s.HSet("hash", "aap", "noot")
+	s.ZAdd("zset", 1.5, "one and a half")
+	_, err = c.Do("XADD", "stream", "1-1", "name", "x")
+	ok(t, err)
+
+	{
+		v, err := redis.String(c.Do("DUMP", "str"))
+		ok(t, err)
+		equals(t, "\x00\x05value\n\x00\x81\xf6\xc18\xc1\xaa\x9bn", v)
+
+		_, err = redis.String(c.Do("DUMP", "nosuch"))
+		equals(t, redis.ErrNil, err)
+	}
+
+	// round trip all types
+	for _, k := range []string{"str", "list", "set", "hash", "zset", "stream"} {
+		v, err := redis.String(c.Do("DUMP", k))
+		ok(t, err)
+		_, err = c.Do("RESTORE", k, 0, v)
+		mustFail(t, err, msgBusyKey)
+
+		_, err = c.Do("RESTORE", k+"-copy", 0, v)
+		ok(t, err)
+		v2, err := redis.String(c.Do("DUMP", k+"-copy"))
+		ok(t, err)
+		equals(t, v, v2)
+	}
+	l, err := s.List("list-copy")
+	ok(t, err)
+	equals(t, []string{"aap", "noot", "12"}, l)
+
+	payload, err := redis.String(c.Do("DUMP", "str"))
+	ok(t, err)
+
+	t.Run("replace", func(t *testing.T) {
+		s.Set("other", "foo")
+		_, err := c.Do("RESTORE", "other", 0, payload, "REPLACE")
+		ok(t, err)
+		v, err := s.Get("other")
+		ok(t, err)
+		equals(t, "value", v)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		_, err := c.Do("RESTORE", "ttl", 3000, payload)
+		ok(t, err)
+		equals(t, 3*time.Second, s.TTL("ttl"))
+
+		s.SetTime(time.Unix(1000, 0))
+		_, err = c.Do("RESTORE", "abs", 1010000, payload, "ABSTTL")
+		ok(t, err)
+		equals(t, 10*time.Second, s.TTL("abs"))
+
+		_, err = c.Do("RESTORE", "abs", 10000, payload, "ABSTTL", "REPLACE")
+		ok(t, err)
+		equals(t, false, s.Exists("abs"))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		_, err := c.Do("RESTORE", "idle", 0, payload, "IDLETIME", 100)
+		ok(t, err)
+		_, err = c.Do("RESTORE", "freq", 0, payload, "FREQ", 100)
+		ok(t, err)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("RESTORE", "bad", 0, payload[:len(payload)-1]+"o")
+		mustFail(t, err, msgDumpPayload)
+		_, err = c.Do("RESTORE", "bad", 0, "foo")
+		mustFail(t, err, msgDumpPayload)
+		// valid checksum, invalid value
+		v := []byte("\x00\x09value\n\x00")
+		v = append(v, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(v[len(v)-8:], crc64Update(0, v[:len(v)-8]))
+		_, err = c.Do("RESTORE", "bad", 0, v)
+		mustFail(t, err, msgBadDataFormat)
+
+		_, err = c.Do("RESTORE", "bad", -1, payload)
+		mustFail(t, err, msgInvalidTTL)
+		_, err = c.Do("RESTORE", "bad", "foo", payload)
+		mustFail(t, err, msgInvalidInt)
+		_, err = c.Do("RESTORE", "bad", 0, payload, "FREQ", 300)
+		mustFail(t, err, msgInvalidFreq)
+		_, err = c.Do("RESTORE", "bad", 0, payload, "IDLETIME", -1)
+		mustFail(t, err, msgInvalidIdletime)
+		_, err = c.Do("RESTORE", "bad", 0, payload, "IDLETIME", 1, "FREQ", 1)
+		mustFail(t, err, msgSyntaxError)
+		_, err = c.Do("RESTORE", "bad", 0, payload, "FOO")
+		mustFail(t, err, msgSyntaxError)
+		_, err = c.Do("RESTORE", "bad", 0)
+		mustFail(t, err, "ERR wrong number of arguments for 'restore' command")
+		_, err = c.Do("DUMP")
+		mustFail(t, err, "ERR wrong number of arguments for 'dump' command")
+		equals(t, false, s.Exists("bad"))
+	})
+}
+
+func TestObject(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	encoding := func(t *testing.T, key, want string) {
+		t.Helper()
+		v, err := redis.String(c.Do("OBJECT", "ENCODING", key))
+		ok(t, err)
+		equals(t, want, v)
+	}
+
+	t.Run("encoding", func(t *testing.T) {
+		s.Set("int", "12345")
+		encoding(t, "int", "int")
+		s.Set("zero", "012")
+		encoding(t, "zero", "embstr")
+		s.Set("short", "hello")
+		encoding(t, "short", "embstr")
+		s.Set("long", strings.Repeat("x", 45))
+		encoding(t, "long", "raw")
+
+		// changed in place
+		_, err := c.Do("SET", "e", "hello")
+		ok(t, err)
+		_, err = c.Do("APPEND", "e", "x")
+		ok(t, err)
+		encoding(t, "e", "raw")
+		_, err = c.Do("SET", "e", "hello")
+		ok(t, err)
+		encoding(t, "e", "embstr")
+		_, err = c.Do("APPEND", "new", "1")
+		ok(t, err)
+		encoding(t, "new", "int")
+		_, err = c.Do("APPEND", "new", "2")
+		ok(t, err)
+		encoding(t, "new", "raw")
+		_, err = c.Do("SETRANGE", "new", "0", "3")
+		ok(t, err)
+		_, err = c.Do("RENAME", "new", "renamed")
+		ok(t, err)
+		encoding(t, "renamed", "raw")
+
+		s.RPush("list", "a", "b", "c")
+		encoding(t, "list", "listpack")
+		s.RPush("biglist", strings.Repeat("x", 9000))
+		encoding(t, "biglist", "quicklist")
+		_, err = c.Do("CONFIG", "SET", "list-max-listpack-size", "2")
+		ok(t, err)
+		encoding(t, "list", "quicklist")
+
+		s.SAdd("set", "1", "2", "3")
+		encoding(t, "set", "intset")
+		s.SAdd("set", "a")
+		encoding(t, "set", "listpack")
+		s.SAdd("set", strings.Repeat("x", 65))
+		encoding(t, "set", "hashtable")
+		s.SAdd("intset", "1", "2", "3")
+		_, err = c.Do("CONFIG", "SET", "set-max-intset-entries", "2")
+		ok(t, err)
+		encoding(t, "intset", "listpack")
+
+		s.HSet("hash", "f", "v")
+		encoding(t, "hash", "listpack")
+		s.HSet("hash", "long", strings.Repeat("x", 65))
+		encoding(t, "hash", "hashtable")
+		s.HSet("hash2", "f1", "v")
+		s.HSet("hash2", "f2", "v")
+		_, err = c.Do("CONFIG", "SET", "hash-max-listpack-entries", "1")
+		ok(t, err)
+		encoding(t, "hash2", "hashtable")
+
+		s.ZAdd("zset", 1, "long")
+		encoding(t, "zset", "listpack")
+		_, err = c.Do("CONFIG", "SET", "zset-max-listpack-value", "3")
+		ok(t, err)
+		encoding(t, "zset", "skiplist")
+
+		_, err = c.Do("XADD", "stream", "*", "k", "v")
+		ok(t, err)
+		encoding(t, "stream", "stream")
+
+		v, err := c.Do("OBJECT", "ENCODING", "nosuch")
+		ok(t, err)
+		equals(t, nil, v)
+	})
+
+	t.Run("refcount", func(t *testing.T) {
+		s.Set("int", "12")
+		n, err := redis.Int(c.Do("OBJECT", "REFCOUNT", "int"))
+		ok(t, err)
+		equals(t, 2147483647, n)
+		n, err = redis.Int(c.Do("OBJECT", "REFCOUNT", "short"))
+		ok(t, err)
+		equals(t, 1, n)
+	})
+
+	t.Run("idletime and freq", func(t *testing.T) {
+		_, err := c.Do("SET", "foo", "bar")
+		ok(t, err)
+		s.FastForward(10 * time.Second)
+		n, err := redis.Int(c.Do("OBJECT", "IDLETIME", "foo"))
+		ok(t, err)
+		equals(t, 10, n)
+		// OBJECT doesn't count as a use
+		n, err = redis.Int(c.Do("OBJECT", "IDLETIME", "foo"))
+		ok(t, err)
+		equals(t, 10, n)
+		_, err = c.Do("GET", "foo")
+		ok(t, err)
+		n, err = redis.Int(c.Do("OBJECT", "IDLETIME", "foo"))
+		ok(t, err)
+		equals(t, 0, n)
+
+		_, err = c.Do("OBJECT", "FREQ", "foo")
+		mustFail(t, err, msgFreqNotLFU)
+		ok(t, s.SetMaxMemory(0, "allkeys-lfu"))
+		_, err = c.Do("SET", "new", "bar")
+		ok(t, err)
+		n, err = redis.Int(c.Do("OBJECT", "FREQ", "new"))
+		ok(t, err)
+		equals(t, 5, n)
+		_, err = c.Do("OBJECT", "IDLETIME", "new")
+		mustFail(t, err, msgIdletimeLFU)
+		ok(t, s.SetMaxMemory(0, "noeviction"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("OBJECT")
+		mustFail(t, err, "ERR wrong number of arguments for 'object' command")
+		_, err = c.Do("OBJECT", "ENCODING")
+		mustFail(t, err, "ERR wrong number of arguments for 'object|encoding' command")
+		_, err = c.Do("OBJECT", "foo", "bar")
+		mustFail(t, err, "ERR unknown subcommand 'foo'. Try OBJECT HELP.")
+		_, err = c.Do("CONFIG", "SET", "hash-max-listpack-entries", "-1")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'hash-max-listpack-entries') - argument must be between 0 and 2147483647 inclusive")
+	})
+}
@@ -74,6 +74,7 @@ func (m *Miniredis) cmdGeoadd(c *server.Peer, cmd string, args []string) {
 				set++
 			}
 		}
+		db.notify(notifyZset, "zadd", key)
 		c.WriteInt(set)
 	})
 }
@@ -278,6 +279,9 @@ func (m *Miniredis) cmdGeoradius(c *server.Peer, cmd string, args []string) {
 			for _, member := range matches {
 				db.ssetAdd(storeKey, member.Score, member.Name)
 			}
+			if len(matches) > 0 {
+				db.notify(notifyZset, "georadiusstore", storeKey)
+			}
 			c.WriteInt(len(matches))
 			return
 		}
@@ -288,6 +292,9 @@ func (m *Miniredis) cmdGeoradius(c *server.Peer, cmd string, args []string) {
 			for _, member := range matches {
 				db.ssetAdd(storedistKey, member.Distance/toMeter, member.Name)
 			}
+			if len(matches) > 0 {
+				db.notify(notifyZset, "georadiusstore", storedistKey)
+			}
 			c.WriteInt(len(matches))
 			return
 		}
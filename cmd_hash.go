@@ -51,7 +51,9 @@ func (m *Miniredis) cmdHset(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		if db.hashSet(key, field, value) {
+		existed := db.hashSet(key, field, value)
+		db.notify(notifyHash, "hset", key)
+		if existed {
 			c.WriteInt(0)
 		} else {
 			c.WriteInt(1)
@@ -93,7 +95,8 @@ func (m *Miniredis) cmdHsetnx(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		db.hashKeys[key][field] = value
-		db.keyVersion[key]++
+		db.modified(key)
+		db.notify(notifyHash, "hset", key)
 		c.WriteInt(1)
 	})
 }
@@ -133,6 +136,7 @@ func (m *Miniredis) cmdHmset(c *server.Peer, cmd string, args []string) {
 			args = args[2:]
 			db.hashSet(key, field, value)
 		}
+		db.notify(notifyHash, "hset", key)
 		c.WriteOK()
 	})
 }
@@ -213,11 +217,18 @@ func (m *Miniredis) cmdHdel(c *server.Peer, cmd string, args []string) {
 			delete(db.hashKeys[key], f)
 			deleted++
 		}
+		if deleted > 0 {
+			db.modified(key)
+		}
 		c.WriteInt(deleted)
+		if deleted > 0 {
+			db.notify(notifyHash, "hdel", key)
+		}
 
 		// Nothing left. Remove the whole key.
 		if len(db.hashKeys[key]) == 0 {
 			db.del(key, true)
+			db.notify(notifyGeneric, "del", key)
 		}
 	})
 }
@@ -280,7 +291,7 @@ func (m *Miniredis) cmdHgetall(c *server.Peer, cmd string, args []string) {
 
 		t, ok := db.keys[key]
 		if !ok {
-			c.WriteLen(0)
+			c.WriteMapLen(0)
 			return
 		}
 		if t != "hash" {
@@ -288,7 +299,7 @@ func (m *Miniredis) cmdHgetall(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(db.hashKeys[key]) * 2)
+		c.WriteMapLen(len(db.hashKeys[key]))
 		for _, k := range db.hashFields(key) {
 			c.WriteBulk(k)
 			c.WriteBulk(db.hashGet(key, k))
@@ -478,6 +489,7 @@ func (m *Miniredis) cmdHincrby(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyHash, "hincrby", key)
 		c.WriteInt(v)
 	})
 }
@@ -518,6 +530,7 @@ func (m *Miniredis) cmdHincrbyfloat(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyHash, "hincrbyfloat", key)
 		c.WriteBulk(formatFloat(v))
 	})
 }
@@ -0,0 +1,201 @@
+package miniredis
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Test PFADD
+func TestPfadd(t *testing.T) {
+	s, c, done := setup(t)
+	defer done()
+
+	t.Run("basic", func(t *testing.T) {
+		n, err := redis.Int(c.Do("PFADD", "hll", "a", "b", "c"))
+		ok(t, err)
+		equals(t, 1, n)
+
+		n, err = redis.Int(c.Do("PFADD", "hll", "a", "b"))
+		ok(t, err)
+		equals(t, 0, n)
+
+		n, err = redis.Int(c.Do("PFADD", "hll", "a", "d"))
+		ok(t, err)
+		equals(t, 1, n)
+
+		typ, err := redis.String(c.Do("TYPE", "hll"))
+		ok(t, err)
+		equals(t, "string", typ)
+
+		n, err = s.PfCount("hll")
+		ok(t, err)
+		equals(t, 4, n)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		n, err := redis.Int(c.Do("PFADD", "empty"))
+		ok(t, err)
+		equals(t, 1, n)
+
+		v, err := s.Get("empty")
+		ok(t, err)
+		equals(t, "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xff", v)
+
+		n, err = redis.Int(c.Do("PFADD", "empty"))
+		ok(t, err)
+		equals(t, 0, n)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		n, err := s.PfAdd("direct", "foo", "bar")
+		ok(t, err)
+		equals(t, 1, n)
+
+		n, err = redis.Int(c.Do("PFCOUNT", "direct"))
+		ok(t, err)
+		equals(t, 2, n)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("PFADD")
+		mustFail(t, err, "ERR wrong number of arguments for 'pfadd' command")
+
+		s.Set("str", "value")
+		_, err = c.Do("PFADD", "str", "a")
+		mustFail(t, err, msgNotValidHll)
+
+		s.HSet("hash", "aap", "noot")
+		_, err = c.Do("PFADD", "hash", "a")
+		mustFail(t, err, msgWrongType)
+
+		s.Set("corrupt", "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f")
+		_, err = c.Do("PFADD", "corrupt", "a")
+		mustFail(t, err, msgInvalidHll)
+	})
+}
+
+// Test PFCOUNT
+func TestPfcount(t *testing.T) {
+	s, c, done := setup(t)
+	defer done()
+
+	t.Run("basic", func(t *testing.T) {
+		_, err := c.Do("PFADD", "hll", "foo", "bar", "zap")
+		ok(t, err)
+		_, err = c.Do("PFADD", "hll", "zap", "zap", "zap")
+		ok(t, err)
+		_, err = c.Do("PFADD", "hll", "foo", "bar")
+		ok(t, err)
+
+		n, err := redis.Int(c.Do("PFCOUNT", "hll"))
+		ok(t, err)
+		equals(t, 3, n)
+
+		_, err = c.Do("PFADD", "some-other-hll", "1", "2", "3")
+		ok(t, err)
+		n, err = redis.Int(c.Do("PFCOUNT", "hll", "some-other-hll"))
+		ok(t, err)
+		equals(t, 6, n)
+
+		n, err = redis.Int(c.Do("PFCOUNT", "nosuch"))
+		ok(t, err)
+		equals(t, 0, n)
+
+		n, err = redis.Int(c.Do("PFCOUNT", "hll", "nosuch"))
+		ok(t, err)
+		equals(t, 3, n)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		_, err := c.Do("PFADD", "cached", "a", "b", "c")
+		ok(t, err)
+		v, err := s.Get("cached")
+		ok(t, err)
+		equals(t, byte(0x80), v[15])
+
+		_, err = c.Do("PFCOUNT", "cached")
+		ok(t, err)
+		v, err = s.Get("cached")
+		ok(t, err)
+		equals(t, "\x03\x00\x00\x00\x00\x00\x00\x00", v[8:16])
+
+		n, err := redis.Int(c.Do("PFCOUNT", "cached"))
+		ok(t, err)
+		equals(t, 3, n)
+	})
+
+	t.Run("dense", func(t *testing.T) {
+		for i := 0; i < 5000; i++ {
+			_, err := s.PfAdd("large", strconv.Itoa(i))
+			ok(t, err)
+		}
+		v, err := s.Get("large")
+		ok(t, err)
+		equals(t, byte(hllDense), v[4])
+		equals(t, hllDenseSize, len(v))
+
+		n, err := redis.Int(c.Do("PFCOUNT", "large"))
+		ok(t, err)
+		assert(t, n > 4900 && n < 5100, "estimate %d", n)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("PFCOUNT")
+		mustFail(t, err, "ERR wrong number of arguments for 'pfcount' command")
+
+		s.Set("str", "value")
+		_, err = c.Do("PFCOUNT", "str")
+		mustFail(t, err, msgNotValidHll)
+		_, err = c.Do("PFCOUNT", "hll", "str")
+		mustFail(t, err, msgNotValidHll)
+	})
+}
+
+// Test PFMERGE
+func TestPfmerge(t *testing.T) {
+	s, c, done := setup(t)
+	defer done()
+
+	t.Run("basic", func(t *testing.T) {
+		_, err := c.Do("PFADD", "hll1", "foo", "bar", "zap", "a")
+		ok(t, err)
+		_, err = c.Do("PFADD", "hll2", "a", "b", "c", "foo")
+		ok(t, err)
+
+		v, err := redis.String(c.Do("PFMERGE", "hll3", "hll1", "hll2"))
+		ok(t, err)
+		equals(t, "OK", v)
+
+		n, err := redis.Int(c.Do("PFCOUNT", "hll3"))
+		ok(t, err)
+		equals(t, 6, n)
+
+		// the destination is a source as well
+		v, err = redis.String(c.Do("PFMERGE", "hll1", "hll2"))
+		ok(t, err)
+		equals(t, "OK", v)
+		n, err = s.PfCount("hll1")
+		ok(t, err)
+		equals(t, 6, n)
+
+		v, err = redis.String(c.Do("PFMERGE", "new"))
+		ok(t, err)
+		equals(t, "OK", v)
+		n, err = s.PfCount("new")
+		ok(t, err)
+		equals(t, 0, n)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("PFMERGE")
+		mustFail(t, err, "ERR wrong number of arguments for 'pfmerge' command")
+
+		s.Set("str", "value")
+		_, err = c.Do("PFMERGE", "hll1", "str")
+		mustFail(t, err, msgNotValidHll)
+		_, err = c.Do("PFMERGE", "str", "hll1")
+		mustFail(t, err, msgNotValidHll)
+	})
+}
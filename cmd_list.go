@@ -100,8 +100,10 @@ func (m *Miniredis) cmdBXpop(c *server.Peer, cmd string, args []string, lr leftr
 				switch lr {
 				case left:
 					v = db.listLpop(key)
+					notifyListPop(db, "lpop", key)
 				case right:
 					v = db.listPop(key)
+					notifyListPop(db, "rpop", key)
 				}
 				c.WriteBulk(v)
 				return true
@@ -223,7 +225,8 @@ func (m *Miniredis) cmdLinsert(c *server.Peer, cmd string, args []string) {
 				}
 			}
 			db.listKeys[key] = l
-			db.keyVersion[key]++
+			db.modified(key)
+			db.notify(notifyList, "linsert", key)
 			c.WriteInt(len(l))
 			return
 		}
@@ -307,8 +310,10 @@ func (m *Miniredis) cmdXpop(c *server.Peer, cmd string, args []string, lr leftri
 		switch lr {
 		case left:
 			elem = db.listLpop(key)
+			notifyListPop(db, "lpop", key)
 		case right:
 			elem = db.listPop(key)
+			notifyListPop(db, "rpop", key)
 		}
 		c.WriteBulk(elem)
 	})
@@ -356,6 +361,7 @@ func (m *Miniredis) cmdXpush(c *server.Peer, cmd string, args []string, lr leftr
 				newLen = db.listPush(key, value)
 			}
 		}
+		notifyListPush(db, lr, key)
 		c.WriteInt(newLen)
 	})
 }
@@ -406,6 +412,7 @@ func (m *Miniredis) cmdXpushx(c *server.Peer, cmd string, args []string, lr left
 				newLen = db.listPush(key, value)
 			}
 		}
+		notifyListPush(db, lr, key)
 		c.WriteInt(newLen)
 	})
 }
@@ -525,7 +532,13 @@ func (m *Miniredis) cmdLrem(c *server.Peer, cmd string, args []string) {
 			db.del(key, true)
 		} else {
 			db.listKeys[key] = newL
-			db.keyVersion[key]++
+			db.modified(key)
+		}
+		if deleted > 0 {
+			db.notify(notifyList, "lrem", key)
+			if len(newL) == 0 {
+				db.notify(notifyGeneric, "del", key)
+			}
 		}
 
 		c.WriteInt(deleted)
@@ -576,7 +589,8 @@ func (m *Miniredis) cmdLset(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		l[index] = value
-		db.keyVersion[key]++
+		db.modified(key)
+		db.notify(notifyList, "lset", key)
 
 		c.WriteOK()
 	})
@@ -630,7 +644,11 @@ func (m *Miniredis) cmdLtrim(c *server.Peer, cmd string, args []string) {
 			db.del(key, true)
 		} else {
 			db.listKeys[key] = l
-			db.keyVersion[key]++
+			db.modified(key)
+		}
+		db.notify(notifyList, "ltrim", key)
+		if len(l) == 0 {
+			db.notify(notifyGeneric, "del", key)
 		}
 		c.WriteOK()
 	})
@@ -664,7 +682,9 @@ func (m *Miniredis) cmdRpoplpush(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		elem := db.listPop(src)
+		notifyListPop(db, "rpop", src)
 		db.listLpush(dst, elem)
+		db.notify(notifyList, "lpush", dst)
 		c.WriteBulk(elem)
 	})
 }
@@ -715,7 +735,9 @@ func (m *Miniredis) cmdBrpoplpush(c *server.Peer, cmd string, args []string) {
 				return false
 			}
 			elem := db.listPop(src)
+			notifyListPop(db, "rpop", src)
 			db.listLpush(dst, elem)
+			db.notify(notifyList, "lpush", dst)
 			c.WriteBulk(elem)
 			return true
 		},
@@ -725,3 +747,22 @@ func (m *Miniredis) cmdBrpoplpush(c *server.Peer, cmd string, args []string) {
 		},
 	)
 }
+
+// notifyListPush sends the keyspace event for a LPUSH or RPUSH.
+func notifyListPush(db *RedisDB, lr leftright, key string) {
+	switch lr {
+	case left:
+		db.notify(notifyList, "lpush", key)
+	case right:
+		db.notify(notifyList, "rpush", key)
+	}
+}
+
+// notifyListPop sends the keyspace events for a pop, including a "del" when
+// the list is gone.
+func notifyListPop(db *RedisDB, event, key string) {
+	db.notify(notifyList, event, key)
+	if !db.exists(key) {
+		db.notify(notifyGeneric, "del", key)
+	}
+}
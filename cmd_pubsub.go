@@ -35,7 +35,7 @@ func (m *Miniredis) cmdSubscribe(c *server.Peer, cmd string, args []string) {
 		for _, channel := range args {
 			n := sub.Subscribe(channel)
 			c.Block(func(w *server.Writer) {
-				w.WriteLen(3)
+				w.WritePushLen(3)
 				w.WriteBulk("subscribe")
 				w.WriteBulk(channel)
 				w.WriteInt(n)
@@ -63,7 +63,7 @@ func (m *Miniredis) cmdUnsubscribe(c *server.Peer, cmd string, args []string) {
 		for _, channel := range channels {
 			n := sub.Unsubscribe(channel)
 			c.Block(func(w *server.Writer) {
-				w.WriteLen(3)
+				w.WritePushLen(3)
 				w.WriteBulk("unsubscribe")
 				w.WriteBulk(channel)
 				w.WriteInt(n)
@@ -92,7 +92,7 @@ func (m *Miniredis) cmdPsubscribe(c *server.Peer, cmd string, args []string) {
 		for _, pat := range args {
 			n := sub.Psubscribe(pat)
 			c.Block(func(w *server.Writer) {
-				w.WriteLen(3)
+				w.WritePushLen(3)
 				w.WriteBulk("psubscribe")
 				w.WriteBulk(pat)
 				w.WriteInt(n)
@@ -120,7 +120,7 @@ func (m *Miniredis) cmdPunsubscribe(c *server.Peer, cmd string, args []string) {
 		for _, pat := range patterns {
 			n := sub.Punsubscribe(pat)
 			c.Block(func(w *server.Writer) {
-				w.WriteLen(3)
+				w.WritePushLen(3)
 				w.WriteBulk("punsubscribe")
 				w.WriteBulk(pat)
 				w.WriteInt(n)
@@ -1,6 +1,7 @@
 package miniredis
 
 import (
+	"sort"
 	"testing"
 
 	"github.com/gomodule/redigo/redis"
@@ -381,3 +382,31 @@ func TestPubSubBadArgs(t *testing.T) {
 		done()
 	}
 }
+
+func TestPubsubResp3(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c := newRawConn(t, s.Addr())
+	defer c.Close()
+	c.Do("HELLO", "3")
+
+	equals(t, ">3\r\n$9\r\nsubscribe\r\n$6\r\nevent1\r\n:1\r\n", c.Do("SUBSCRIBE", "event1"))
+
+	// RESP3 connections can mix commands and subscriptions
+	equals(t, "+OK\r\n", c.Do("SET", "foo", "bar"))
+	equals(t, "+PONG\r\n", c.Do("PING"))
+
+	equals(t, 1, s.Publish("event1", "message1"))
+	equals(t, ">3\r\n$7\r\nmessage\r\n$6\r\nevent1\r\n$8\r\nmessage1\r\n", c.Read())
+
+	equals(t, ">3\r\n$10\r\npsubscribe\r\n$3\r\nev*\r\n:2\r\n", c.Do("PSUBSCRIBE", "ev*"))
+	equals(t, 2, s.Publish("event1", "message2"))
+	// messages and pmessages are sent in no particular order
+	msgs := []string{c.Read(), c.Read()}
+	sort.Strings(msgs)
+	equals(t, []string{
+		">3\r\n$7\r\nmessage\r\n$6\r\nevent1\r\n$8\r\nmessage2\r\n",
+		">4\r\n$8\r\npmessage\r\n$3\r\nev*\r\n$6\r\nevent1\r\n$8\r\nmessage2\r\n",
+	}, msgs)
+}
@@ -0,0 +1,289 @@
+// Commands from https://redis.io/commands#replication
+
+package miniredis
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func commandsReplication(m *Miniredis) {
+	m.srv.Register("PSYNC", m.cmdPsync)
+	m.srv.Register("REPLCONF", m.cmdReplconf)
+	m.srv.Register("REPLICAOF", m.cmdReplicaof)
+	m.srv.Register("ROLE", m.cmdRole)
+	m.srv.Register("SLAVEOF", m.cmdReplicaof)
+	m.srv.Register("SYNC", m.cmdSync)
+	m.srv.Register("WAIT", m.cmdWait)
+}
+
+// REPLICAOF and SLAVEOF
+func (m *Miniredis) cmdReplicaof(c *server.Peer, cmd string, args []string) {
+	if len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	host, portS := args[0], args[1]
+	noOne := strings.ToUpper(host) == "NO" && strings.ToUpper(portS) == "ONE"
+	port, err := strconv.Atoi(portS)
+	if !noOne && (err != nil || port < 0 || port > 65535) {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if m.cluster != nil {
+			c.WriteError(msgReplicaofCluster)
+			return
+		}
+		if noOne {
+			m.stopReplication()
+			c.WriteOK()
+			return
+		}
+		if m.masterHost == host && m.masterPort == port {
+			c.WriteInline("OK Already connected to specified master")
+			return
+		}
+		m.startReplication(host, port)
+		c.WriteOK()
+	})
+}
+
+// ROLE
+func (m *Miniredis) cmdRole(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if s := m.sentinel; s != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			c.WriteLen(2)
+			c.WriteBulk("sentinel")
+			c.WriteLen(len(s.masters))
+			for _, sm := range s.masters {
+				c.WriteBulk(sm.name)
+			}
+			return
+		}
+		if l := m.masterLink; l != nil {
+			c.WriteLen(5)
+			c.WriteBulk("slave")
+			c.WriteBulk(l.host)
+			c.WriteInt(l.port)
+			c.WriteBulk(l.state)
+			c.WriteInt(l.offset)
+			return
+		}
+
+		peers := m.replicaPeers()
+		c.WriteLen(3)
+		c.WriteBulk("master")
+		c.WriteInt(m.replOffset)
+		c.WriteLen(len(peers))
+		for _, p := range peers {
+			r := m.replicas[p]
+			c.WriteLen(3)
+			c.WriteBulk(peerIP(p))
+			c.WriteBulk(strconv.Itoa(r.port))
+			c.WriteBulk(strconv.Itoa(r.ack))
+		}
+	})
+}
+
+// WAIT
+func (m *Miniredis) cmdWait(c *server.Peer, cmd string, args []string) {
+	if len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return
+	}
+	timeout, err := strconv.Atoi(args[1])
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidInt)
+		return
+	}
+	if timeout < 0 {
+		setDirty(c)
+		c.WriteError(msgNegTimeout)
+		return
+	}
+
+	offset := -1
+	blocking(
+		m,
+		c,
+		time.Duration(timeout)*time.Millisecond,
+		func(c *server.Peer, ctx *connCtx) bool {
+			if m.masterLink != nil {
+				c.WriteError(msgWaitReplica)
+				return true
+			}
+			if offset < 0 {
+				offset = m.replOffset
+				if len(m.replicas) > 0 {
+					var buf bytes.Buffer
+					writeAOFCommand(&buf, "REPLCONF", "GETACK", "*")
+					m.sendReplicas(buf.String())
+				}
+			}
+			acked := m.ackedReplicas(offset)
+			if acked < n {
+				return false
+			}
+			c.WriteInt(acked)
+			return true
+		},
+		func(c *server.Peer) {
+			c.WriteInt(m.ackedReplicas(offset))
+		},
+	)
+}
+
+// SYNC
+func (m *Miniredis) cmdSync(c *server.Peer, cmd string, args []string) {
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	m.syncReplica(c, false)
+}
+
+// PSYNC. We always do a full resync.
+func (m *Miniredis) cmdPsync(c *server.Peer, cmd string, args []string) {
+	if len(args) != 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	m.syncReplica(c, true)
+}
+
+func (m *Miniredis) syncReplica(c *server.Peer, psync bool) {
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.replicas[c]; ok {
+		return
+	}
+	if l := m.masterLink; l != nil && l.state != "connected" {
+		c.WriteError(msgNoMasterLink)
+		return
+	}
+	m.fullSync(c, psync)
+}
+
+// REPLCONF
+func (m *Miniredis) cmdReplconf(c *server.Peer, cmd string, args []string) {
+	if len(args)%2 != 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	ctx := getCtx(c)
+	for i := 0; i < len(args); i += 2 {
+		opt, value := strings.ToLower(args[i]), args[i+1]
+		switch opt {
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			ctx.replPort = port
+		case "ip-address", "capa":
+		case "ack":
+			// replicas don't get a reply to ACKs
+			if r, ok := m.replicas[c]; ok {
+				if off, err := strconv.Atoi(value); err == nil && off > r.ack {
+					r.ack = off
+					m.signal.Broadcast()
+				}
+			}
+			return
+		case "getack":
+			// only for replicas, from their master
+			return
+		default:
+			c.WriteError(fmt.Sprintf(msgFReplconfOption, args[i]))
+			return
+		}
+	}
+	c.WriteOK()
+}
+
+// replicaPeers gives the connections of all replicas, in connection order.
+// Needs the lock.
+func (m *Miniredis) replicaPeers() []*server.Peer {
+	var ps []*server.Peer
+	for p := range m.replicas {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].ID() < ps[j].ID() })
+	return ps
+}
+
+// peerIP is the IP of a client.
+func peerIP(c *server.Peer) string {
+	host, _, err := net.SplitHostPort(c.Addr())
+	if err != nil {
+		return c.Addr()
+	}
+	return host
+}
@@ -50,9 +50,12 @@ func (m *Miniredis) runLuaScript(c *server.Peer, script string, args []string) {
 	luajson.Preload(l)
 	requireGlobal(l, "cjson", "json")
 
-	m.Unlock()
-	conn := m.redigo()
-	m.Lock()
+	// scripts have the permissions of the user running them
+	user := ""
+	if u := m.connUser(getCtx(c)); u != nil {
+		user = u.name
+	}
+	conn := m.internalUserConn("lua", user)
 	defer conn.Close()
 
 	// set global variable KEYS
@@ -0,0 +1,186 @@
+// Commands from https://redis.io/docs/management/sentinel/
+
+package miniredis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// commandsSentinel only registers SENTINEL for a Sentinel.
+func commandsSentinel(m *Miniredis) {
+	if m.sentinel != nil {
+		m.srv.Register("SENTINEL", m.cmdSentinel)
+	}
+}
+
+// SENTINEL
+func (m *Miniredis) cmdSentinel(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+	nargs := map[string]int{
+		"FAILOVER":                1,
+		"GET-MASTER-ADDR-BY-NAME": 1,
+		"MASTER":                  1,
+		"MASTERS":                 0,
+		"MYID":                    0,
+		"REPLICAS":                1,
+		"SENTINELS":               1,
+		"SLAVES":                  1,
+	}
+	if n, ok := nargs[subcmd]; ok && len(args) != n {
+		setDirty(c)
+		c.WriteError(errWrongNumber("sentinel|" + strings.ToLower(subcmd)))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		s := m.sentinel
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch subcmd {
+		case "GET-MASTER-ADDR-BY-NAME":
+			sm := s.master(args[0])
+			if sm == nil {
+				c.WriteLen(-1)
+				return
+			}
+			host, port := instanceAddr(sm.master)
+			c.WriteLen(2)
+			c.WriteBulk(host)
+			c.WriteBulk(strconv.Itoa(port))
+
+		case "MASTERS":
+			c.WriteLen(len(s.masters))
+			for _, sm := range s.masters {
+				writeFields(c, sm.fields())
+			}
+
+		case "MASTER":
+			sm := s.master(args[0])
+			if sm == nil {
+				c.WriteError(msgNoSuchMaster)
+				return
+			}
+			writeFields(c, sm.fields())
+
+		case "REPLICAS", "SLAVES":
+			sm := s.master(args[0])
+			if sm == nil {
+				c.WriteError(msgNoSuchMaster)
+				return
+			}
+			c.WriteLen(len(sm.replicas))
+			for _, r := range sm.replicas {
+				writeFields(c, replicaFields(r))
+			}
+
+		case "SENTINELS":
+			if s.master(args[0]) == nil {
+				c.WriteError(msgNoSuchMaster)
+				return
+			}
+			// we're the only one
+			c.WriteLen(0)
+
+		case "MYID":
+			c.WriteBulk(m.runID)
+
+		case "FAILOVER":
+			msg, err := s.failover(args[0])
+			switch err {
+			case nil:
+			case errNoSuchMaster:
+				c.WriteError(msgNoSuchMaster)
+				return
+			case errNoGoodReplica:
+				c.WriteError(msgNoGoodReplica)
+				return
+			default:
+				c.WriteError("ERR " + err.Error())
+				return
+			}
+			m.publish("+switch-master", msg)
+			c.WriteOK()
+
+		default:
+			c.WriteError(fmt.Sprintf(msgFSentinelUsage, subcmd))
+		}
+	})
+}
+
+// fields are the fields of SENTINEL MASTER.
+func (sm *sentinelMaster) fields() [][2]string {
+	host, port := instanceAddr(sm.master)
+	flags := "master"
+	if !instanceRunning(sm.master) {
+		flags = "master,s_down,o_down"
+	}
+	return [][2]string{
+		{"name", sm.name},
+		{"ip", host},
+		{"port", strconv.Itoa(port)},
+		{"runid", sm.master.runID},
+		{"flags", flags},
+		{"role-reported", "master"},
+		{"config-epoch", strconv.Itoa(sm.epoch)},
+		{"num-slaves", strconv.Itoa(len(sm.replicas))},
+		{"num-other-sentinels", "0"},
+		{"quorum", "1"},
+	}
+}
+
+// replicaFields are the fields of a single replica in SENTINEL REPLICAS.
+func replicaFields(r *Miniredis) [][2]string {
+	host, port := instanceAddr(r)
+	r.Lock()
+	defer r.Unlock()
+	var (
+		flags      = "slave"
+		linkStatus = "err"
+		offset     = 0
+	)
+	if r.srv == nil {
+		flags = "slave,s_down"
+	}
+	if l := r.masterLink; l != nil && l.state == "connected" {
+		linkStatus = "ok"
+		offset = l.offset
+	}
+	return [][2]string{
+		{"name", fmt.Sprintf("%s:%d", host, port)},
+		{"ip", host},
+		{"port", strconv.Itoa(port)},
+		{"runid", r.runID},
+		{"flags", flags},
+		{"role-reported", "slave"},
+		{"master-link-status", linkStatus},
+		{"master-host", r.masterHost},
+		{"master-port", strconv.Itoa(r.masterPort)},
+		{"slave-repl-offset", strconv.Itoa(offset)},
+	}
+}
+
+// writeFields writes key/value pairs as a map.
+func writeFields(c *server.Peer, fields [][2]string) {
+	c.WriteMapLen(len(fields))
+	for _, f := range fields {
+		c.WriteBulk(f[0])
+		c.WriteBulk(f[1])
+	}
+}
@@ -3,17 +3,25 @@
 package miniredis
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/alicebob/miniredis/v2/server"
 )
 
 func commandsServer(m *Miniredis) {
+	m.srv.Register("BGREWRITEAOF", m.cmdBgrewriteaof)
+	m.srv.Register("BGSAVE", m.cmdBgsave)
+	m.srv.Register("CONFIG", m.cmdConfig)
 	m.srv.Register("DBSIZE", m.cmdDbsize)
 	m.srv.Register("FLUSHALL", m.cmdFlushall)
 	m.srv.Register("FLUSHDB", m.cmdFlushdb)
+	m.srv.Register("INFO", m.cmdInfo)
+	m.srv.Register("LASTSAVE", m.cmdLastsave)
+	m.srv.Register("MEMORY", m.cmdMemory)
+	m.srv.Register("MONITOR", m.cmdMonitor)
+	m.srv.Register("SAVE", m.cmdSave)
 	m.srv.Register("TIME", m.cmdTime)
 }
 
@@ -84,6 +92,263 @@ func (m *Miniredis) cmdFlushdb(c *server.Peer, cmd string, args []string) {
 	})
 }
 
+// SAVE
+func (m *Miniredis) cmdSave(c *server.Peer, cmd string, args []string) {
+	if len(args) > 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if err := m.saveRDBFile(); err != nil {
+			c.WriteError(fmt.Sprintf(msgFSaveFailed, err.Error()))
+			return
+		}
+		c.WriteOK()
+	})
+}
+
+// BGSAVE. We save in the foreground, which makes tests deterministic.
+func (m *Miniredis) cmdBgsave(c *server.Peer, cmd string, args []string) {
+	if len(args) > 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if len(args) == 1 && strings.ToLower(args[0]) != "schedule" {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if err := m.saveRDBFile(); err != nil {
+			c.WriteError(fmt.Sprintf(msgFSaveFailed, err.Error()))
+			return
+		}
+		c.WriteInline("Background saving started")
+	})
+}
+
+// BGREWRITEAOF. Also done in the foreground.
+func (m *Miniredis) cmdBgrewriteaof(c *server.Peer, cmd string, args []string) {
+	if len(args) > 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if m.aofFile == nil {
+			c.WriteError(msgAOFNoFile)
+			return
+		}
+		if err := m.saveAOFRewrite(); err != nil {
+			c.WriteError(fmt.Sprintf(msgFAOFRewriteFailed, err.Error()))
+			return
+		}
+		c.WriteInline("Background append only file rewriting started")
+	})
+}
+
+// INFO
+func (m *Miniredis) cmdInfo(c *server.Peer, cmd string, args []string) {
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteBulk(m.info(args).String())
+	})
+}
+
+// LASTSAVE
+func (m *Miniredis) cmdLastsave(c *server.Peer, cmd string, args []string) {
+	if len(args) > 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		c.WriteInt(int(m.lastSave.Unix()))
+	})
+}
+
+// MEMORY
+func (m *Miniredis) cmdMemory(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	name, args := args[0], args[1:]
+	subcmd := strings.ToUpper(name)
+	switch subcmd {
+	case "STATS":
+		if len(args) != 0 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("memory|stats"))
+			return
+		}
+	case "USAGE":
+		if len(args) < 1 {
+			setDirty(c)
+			c.WriteError(errWrongNumber("memory|usage"))
+			return
+		}
+		// SAMPLES is accepted, but sizes are always exact
+		for i := 1; i < len(args); i += 2 {
+			if strings.ToUpper(args[i]) != "SAMPLES" || i+1 >= len(args) {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			if _, err := strconv.Atoi(args[i+1]); err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+		}
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFMemoryUsage, name))
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		switch subcmd {
+		case "STATS":
+			m.writeMemoryStats(c)
+		case "USAGE":
+			db := m.db(ctx.selectedDB)
+			if !db.exists(args[0]) {
+				c.WriteNull()
+				return
+			}
+			c.WriteInt(db.keyMemory(args[0]))
+		}
+	})
+}
+
+// writeMemoryStats writes the MEMORY STATS reply. Only the fields which follow
+// from the keys are there, all based on the same estimates as maxmemory.
+func (m *Miniredis) writeMemoryStats(c *server.Peer) {
+	var (
+		ids      []int
+		overhead int
+		keys     int
+	)
+	for _, id := range m.dbIDs() {
+		db := m.dbs[id]
+		if len(db.keys) == 0 {
+			continue
+		}
+		ids = append(ids, id)
+		overhead += len(db.keys)*keyOverhead + len(db.ttl)*elemOverhead
+		keys += len(db.keys)
+	}
+	total := m.usedMemory()
+	dataset := total - overhead
+	if dataset < 0 {
+		dataset = 0
+	}
+
+	c.WriteMapLen(6 + len(ids))
+	c.WriteBulk("total.allocated")
+	c.WriteInt(total)
+	for _, id := range ids {
+		db := m.dbs[id]
+		c.WriteBulk(fmt.Sprintf("db.%d", id))
+		c.WriteMapLen(2)
+		c.WriteBulk("overhead.hashtable.main")
+		c.WriteInt(len(db.keys) * keyOverhead)
+		c.WriteBulk("overhead.hashtable.expires")
+		c.WriteInt(len(db.ttl) * elemOverhead)
+	}
+	c.WriteBulk("overhead.total")
+	c.WriteInt(overhead)
+	c.WriteBulk("keys.count")
+	c.WriteInt(keys)
+	c.WriteBulk("keys.bytes-per-key")
+	if keys > 0 {
+		c.WriteInt(total / keys)
+	} else {
+		c.WriteInt(0)
+	}
+	c.WriteBulk("dataset.bytes")
+	c.WriteInt(dataset)
+	c.WriteBulk("dataset.percentage")
+	if total > 0 {
+		c.WriteFloat(float64(dataset) * 100 / float64(total))
+	} else {
+		c.WriteFloat(0)
+	}
+}
+
+// MONITOR
+func (m *Miniredis) cmdMonitor(c *server.Peer, cmd string, args []string) {
+	if len(args) > 0 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if inTx(ctx) || ctx.origin != "" {
+			c.WriteError(msgMonitorNotAllowed)
+			return
+		}
+		if ctx.monitor {
+			// Redis ignores this, without a reply.
+			return
+		}
+		m.startMonitor(c, ctx)
+		c.WriteOK()
+	})
+}
+
 // TIME
 func (m *Miniredis) cmdTime(c *server.Peer, cmd string, args []string) {
 	if len(args) > 0 {
@@ -99,11 +364,7 @@ func (m *Miniredis) cmdTime(c *server.Peer, cmd string, args []string) {
 	}
 
 	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
-		now := m.now
-		if now.IsZero() {
-			now = time.Now()
-		}
-		nanos := now.UnixNano()
+		nanos := m.effectiveNow().UnixNano()
 		seconds := nanos / 1000000000
 		microseconds := (nanos / 1000) % 1000000
 
@@ -112,3 +373,64 @@ func (m *Miniredis) cmdTime(c *server.Peer, cmd string, args []string) {
 		c.WriteBulk(strconv.FormatInt(microseconds, 10))
 	})
 }
+
+// CONFIG
+func (m *Miniredis) cmdConfig(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := args[0], args[1:]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		switch strings.ToLower(subcmd) {
+		case "get":
+			if len(args) < 1 {
+				c.WriteError(fmt.Sprintf(msgFConfigUsage, "GET"))
+				return
+			}
+			res := m.configGet(args)
+			c.WriteMapLen(len(res) / 2)
+			for _, v := range res {
+				c.WriteBulk(v)
+			}
+
+		case "set":
+			if len(args) < 2 || len(args)%2 != 0 {
+				c.WriteError(fmt.Sprintf(msgFConfigUsage, "SET"))
+				return
+			}
+			if err := m.configSet(args); err != "" {
+				c.WriteError(err)
+				return
+			}
+			c.WriteOK()
+
+		case "resetstat":
+			if len(args) != 0 {
+				c.WriteError(fmt.Sprintf(msgFConfigUsage, "RESETSTAT"))
+				return
+			}
+			m.configResetStat()
+			c.WriteOK()
+
+		case "rewrite":
+			if len(args) != 0 {
+				c.WriteError(fmt.Sprintf(msgFConfigUsage, "REWRITE"))
+				return
+			}
+			c.WriteError(msgNoConfigFile)
+
+		default:
+			c.WriteError(fmt.Sprintf(msgFConfigUsage, strings.ToUpper(subcmd)))
+		}
+	})
+}
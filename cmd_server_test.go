@@ -1,6 +1,10 @@
 package miniredis
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -117,3 +121,373 @@ func TestCmdServerTime(t *testing.T) {
 	_, err = redis.MultiBulk(c.Do("TIME", "FOO"))
 	assert(t, err != nil, "no TIME error")
 }
+
+// Test SAVE, BGSAVE, and LASTSAVE.
+func TestCmdServerSave(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	dir, err := ioutil.TempDir("", "miniredis")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.rdb")
+	s.SetRDBFile(file)
+	s.SetTime(time.Unix(1234, 0))
+	s.Set("aap", "noot")
+
+	{
+		v, err := redis.String(c.Do("SAVE"))
+		ok(t, err)
+		equals(t, "OK", v)
+
+		n, err := redis.Int(c.Do("LASTSAVE"))
+		ok(t, err)
+		equals(t, 1234, n)
+
+		f, err := os.Open(file)
+		ok(t, err)
+		defer f.Close()
+		s2 := NewMiniRedis()
+		ok(t, s2.LoadRDB(f))
+		equals(t, s.Dump(), s2.Dump())
+	}
+
+	{
+		s.SetTime(time.Unix(2345, 0))
+		v, err := redis.String(c.Do("BGSAVE"))
+		ok(t, err)
+		equals(t, "Background saving started", v)
+
+		v, err = redis.String(c.Do("BGSAVE", "SCHEDULE"))
+		ok(t, err)
+		equals(t, "Background saving started", v)
+
+		n, err := redis.Int(c.Do("LASTSAVE"))
+		ok(t, err)
+		equals(t, 2345, n)
+	}
+
+	// Wrong usage
+	{
+		_, err := c.Do("SAVE", "foo")
+		mustFail(t, err, "ERR wrong number of arguments for 'save' command")
+		_, err = c.Do("BGSAVE", "foo")
+		mustFail(t, err, msgSyntaxError)
+		_, err = c.Do("LASTSAVE", "foo")
+		mustFail(t, err, "ERR wrong number of arguments for 'lastsave' command")
+
+		s.SetRDBFile(filepath.Join(dir, "nosuchdir", "test.rdb"))
+		_, err = c.Do("SAVE")
+		assert(t, err != nil, "SAVE error")
+	}
+}
+
+func TestCmdServerBgrewriteaof(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	_, err = c.Do("BGREWRITEAOF")
+	mustFail(t, err, msgAOFNoFile)
+
+	dir, err := ioutil.TempDir("", "miniredis")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.aof")
+	ok(t, s.SetAOFFile(file))
+
+	for i := 0; i < 10; i++ {
+		_, err := c.Do("INCR", "counter")
+		ok(t, err)
+	}
+	v, err := redis.String(c.Do("BGREWRITEAOF"))
+	ok(t, err)
+	equals(t, "Background append only file rewriting started", v)
+
+	// still appending
+	_, err = c.Do("SET", "aap", "noot")
+	ok(t, err)
+
+	b, err := ioutil.ReadFile(file)
+	ok(t, err)
+	equals(t,
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n"+
+			"*3\r\n$3\r\nSET\r\n$7\r\ncounter\r\n$2\r\n10\r\n"+
+			"*3\r\n$3\r\nSET\r\n$3\r\naap\r\n$4\r\nnoot\r\n",
+		string(b),
+	)
+
+	_, err = c.Do("BGREWRITEAOF", "foo")
+	mustFail(t, err, "ERR wrong number of arguments for 'bgrewriteaof' command")
+}
+
+func TestCmdServerInfo(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("aap", "noot")
+	s.Set("mies", "vuur")
+	s.SetTTL("mies", 10*time.Second)
+	s.DB(2).Set("other", "db")
+	_, err = c.Do("SET", "foo", "bar")
+	ok(t, err)
+	_, err = c.Do("GET", "foo")
+	ok(t, err)
+	_, err = c.Do("INCR", "foo")
+	assert(t, err != nil, "INCR error")
+
+	t.Run("default", func(t *testing.T) {
+		v, err := redis.String(c.Do("INFO"))
+		ok(t, err)
+		assert(t, strings.HasPrefix(v, "# Server\r\nredis_version:7.0.0\r\n"), "server first")
+		assert(t, strings.Contains(v, "\r\n\r\n# Keyspace\r\ndb0:keys=3,expires=1,avg_ttl=10000\r\ndb2:keys=1,expires=0,avg_ttl=0\r\n"), "keyspace")
+		assert(t, strings.Contains(v, "connected_clients:1\r\n"), "clients")
+		assert(t, !strings.Contains(v, "# Commandstats"), "no commandstats")
+	})
+
+	t.Run("section", func(t *testing.T) {
+		v, err := redis.String(c.Do("INFO", "KEYSPACE", "clients"))
+		ok(t, err)
+		equals(t, "# Clients\r\nconnected_clients:1\r\nblocked_clients:0\r\n\r\n# Keyspace\r\ndb0:keys=3,expires=1,avg_ttl=10000\r\ndb2:keys=1,expires=0,avg_ttl=0\r\n", v)
+
+		v, err = redis.String(c.Do("INFO", "nosuch"))
+		ok(t, err)
+		equals(t, "", v)
+	})
+
+	t.Run("commandstats", func(t *testing.T) {
+		info := s.Info("commandstats")
+		equals(t, (*InfoServer)(nil), info.Server)
+		equals(t, 1, info.Commandstats["get"].Calls)
+		equals(t, 0, info.Commandstats["get"].FailedCalls)
+		equals(t, 1, info.Commandstats["incr"].FailedCalls)
+
+		v, err := redis.String(c.Do("INFO", "commandstats"))
+		ok(t, err)
+		assert(t, strings.Contains(v, "\r\ncmdstat_incr:calls=1,usec="), "cmdstat")
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		info := s.Info("")
+		equals(t, 1, info.Clients.ConnectedClients)
+		equals(t, InfoKeyspace{Keys: 3, Expires: 1, AvgTTL: 10 * time.Second}, info.Keyspace[0])
+		equals(t, "master", info.Replication.Role)
+		equals(t, 1, info.Persistence.RDBChangesSinceLastSave) // the failed INCR doesn't count
+		equals(t, 1, info.Stats.TotalErrorReplies)
+		equals(t, "ok", info.Persistence.RDBLastBgsaveStatus)
+		equals(t, false, info.Persistence.AOFEnabled)
+
+		s.FastForward(20 * time.Second)
+		info = s.Info("stats")
+		equals(t, 1, info.Stats.ExpiredKeys)
+	})
+}
+
+func TestCmdServerConfig(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("get", func(t *testing.T) {
+		v, err := redis.Strings(c.Do("CONFIG", "GET", "maxmemory*", "databases"))
+		ok(t, err)
+		equals(t, []string{
+			"databases", "16",
+			"maxmemory", "0",
+			"maxmemory-policy", "noeviction",
+			"maxmemory-samples", "5",
+		}, v)
+
+		v, err = redis.Strings(c.Do("CONFIG", "GET", "dbfilename"))
+		ok(t, err)
+		equals(t, []string{"dbfilename", "dump.rdb"}, v)
+
+		v, err = redis.Strings(c.Do("CONFIG", "GET", "nosuch"))
+		ok(t, err)
+		equals(t, []string{}, v)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		_, err := c.Do("CONFIG", "SET", "maxmemory", "1mb", "maxmemory-policy", "allkeys-LRU")
+		ok(t, err)
+		v, err := redis.Strings(c.Do("CONFIG", "GET", "maxmemory", "maxmemory-policy"))
+		ok(t, err)
+		equals(t, []string{"maxmemory", "1048576", "maxmemory-policy", "allkeys-lru"}, v)
+
+		// all or nothing
+		_, err = c.Do("CONFIG", "SET", "maxmemory", "2mb", "maxmemory-samples", "0")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'maxmemory-samples') - argument must be between 1 and 64 inclusive")
+		v, err = redis.Strings(c.Do("CONFIG", "GET", "maxmemory"))
+		ok(t, err)
+		equals(t, []string{"maxmemory", "1048576"}, v)
+
+		_, err = c.Do("CONFIG", "SET", "maxmemory", "foo")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'maxmemory') - argument must be a memory value")
+		_, err = c.Do("CONFIG", "SET", "maxmemory-policy", "foo")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'maxmemory-policy') - argument(s) must be one of the following: volatile-lru, volatile-lfu, volatile-random, volatile-ttl, allkeys-lru, allkeys-lfu, allkeys-random, noeviction")
+		_, err = c.Do("CONFIG", "SET", "databases", "2")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'databases') - can't set immutable config")
+		_, err = c.Do("CONFIG", "SET", "maxmemory", "1", "MAXMEMORY", "2")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'MAXMEMORY') - duplicate parameter")
+		_, err = c.Do("CONFIG", "SET", "maxmemory")
+		mustFail(t, err, "ERR Unknown subcommand or wrong number of arguments for 'SET'. Try CONFIG HELP.")
+		_, err = c.Do("CONFIG", "SET", "dbfilename", "../foo")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'dbfilename') - dbfilename can't be a path, just a filename")
+		_, err = c.Do("CONFIG", "SET", "dir", "/no/such/dir")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'dir') - No such file or directory")
+	})
+
+	t.Run("proto-max-bulk-len", func(t *testing.T) {
+		_, err := c.Do("CONFIG", "SET", "proto-max-bulk-len", "1mb")
+		ok(t, err)
+		v, err := redis.Strings(c.Do("CONFIG", "GET", "proto-max-bulk-len"))
+		ok(t, err)
+		equals(t, []string{"proto-max-bulk-len", "1048576"}, v)
+
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("SET", "big", strings.Repeat("x", 1024*1024+1))
+		mustFail(t, err, "ERR Protocol error: invalid bulk length")
+
+		_, err = c.Do("CONFIG", "SET", "proto-max-bulk-len", "1kb")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'proto-max-bulk-len') - argument must be between 1048576 and 2147483647 inclusive")
+		_, err = c.Do("CONFIG", "SET", "proto-max-bulk-len", "512mb")
+		ok(t, err)
+	})
+
+	t.Run("requirepass", func(t *testing.T) {
+		_, err := c.Do("CONFIG", "SET", "requirepass", "secret")
+		ok(t, err)
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("GET", "foo")
+		mustFail(t, err, "NOAUTH Authentication required.")
+		_, err = c2.Do("AUTH", "secret")
+		ok(t, err)
+		_, err = c2.Do("CONFIG", "SET", "requirepass", "")
+		ok(t, err)
+	})
+
+	t.Run("databases", func(t *testing.T) {
+		// no limit by default
+		_, err := c.Do("SELECT", 1000)
+		ok(t, err)
+		_, err = c.Do("SELECT", 0)
+		ok(t, err)
+
+		s.SetDatabases(16)
+		defer s.SetDatabases(0)
+		_, err = c.Do("SELECT", 16)
+		mustFail(t, err, msgDBIndexOutOfRange)
+		_, err = c.Do("MOVE", "foo", 16)
+		mustFail(t, err, msgDBIndexOutOfRange)
+		_, err = c.Do("SWAPDB", 0, 16)
+		mustFail(t, err, msgDBIndexOutOfRange)
+		_, err = c.Do("SELECT", 15)
+		ok(t, err)
+		_, err = c.Do("SELECT", 0)
+		ok(t, err)
+		v, err := redis.Strings(c.Do("CONFIG", "GET", "databases"))
+		ok(t, err)
+		equals(t, []string{"databases", "16"}, v)
+	})
+
+	t.Run("save", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "miniredis")
+		ok(t, err)
+		defer os.RemoveAll(dir)
+
+		_, err = c.Do("CONFIG", "SET", "dir", dir, "dbfilename", "test.rdb")
+		ok(t, err)
+		_, err = c.Do("SAVE")
+		ok(t, err)
+		_, err = os.Stat(filepath.Join(dir, "test.rdb"))
+		ok(t, err)
+
+		_, err = c.Do("CONFIG", "SET", "appendonly", "yes")
+		ok(t, err)
+		_, err = c.Do("SET", "aap", "noot")
+		ok(t, err)
+		_, err = c.Do("CONFIG", "SET", "appendonly", "no")
+		ok(t, err)
+		b, err := ioutil.ReadFile(filepath.Join(dir, "appendonly.aof"))
+		ok(t, err)
+		assert(t, strings.Contains(string(b), "noot"), "AOF")
+	})
+
+	t.Run("resetstat", func(t *testing.T) {
+		assert(t, s.CommandCount() > 0, "commands")
+		_, err := c.Do("CONFIG", "RESETSTAT")
+		ok(t, err)
+		equals(t, 0, s.CommandCount())
+		equals(t, 0, s.Info("stats").Stats.TotalErrorReplies)
+
+		_, err = c.Do("CONFIG", "REWRITE")
+		mustFail(t, err, msgNoConfigFile)
+	})
+}
+
+func TestCmdServerMemory(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("foo", "bar")
+	s.HSet("hash", "aap", "noot")
+	s.SetTTL("hash", time.Minute)
+
+	n, err := redis.Int(c.Do("MEMORY", "USAGE", "foo"))
+	ok(t, err)
+	equals(t, keyOverhead+6, n)
+	n, err = redis.Int(c.Do("MEMORY", "USAGE", "hash", "SAMPLES", "0"))
+	ok(t, err)
+	equals(t, keyOverhead+4+elemOverhead+7, n)
+	v, err := c.Do("MEMORY", "USAGE", "nosuch")
+	ok(t, err)
+	equals(t, nil, v)
+
+	stats, err := redis.Values(c.Do("MEMORY", "STATS"))
+	ok(t, err)
+	equals(t, 14, len(stats))
+	equals(t, "total.allocated", string(stats[0].([]byte)))
+	equals(t, int64(s.UsedMemory()), stats[1])
+	equals(t, "db.0", string(stats[2].([]byte)))
+	db, err := redis.Int64Map(stats[3], nil)
+	ok(t, err)
+	equals(t, map[string]int64{
+		"overhead.hashtable.main":    2 * keyOverhead,
+		"overhead.hashtable.expires": elemOverhead,
+	}, db)
+	equals(t, "keys.count", string(stats[6].([]byte)))
+	equals(t, int64(2), stats[7])
+
+	_, err = c.Do("MEMORY")
+	mustFail(t, err, "ERR wrong number of arguments for 'memory' command")
+	_, err = c.Do("MEMORY", "USAGE")
+	mustFail(t, err, "ERR wrong number of arguments for 'memory|usage' command")
+	_, err = c.Do("MEMORY", "USAGE", "foo", "SAMPLES")
+	mustFail(t, err, msgSyntaxError)
+	_, err = c.Do("MEMORY", "USAGE", "foo", "SAMPLES", "x")
+	mustFail(t, err, msgInvalidInt)
+	_, err = c.Do("MEMORY", "foo")
+	mustFail(t, err, "ERR unknown subcommand 'foo'. Try MEMORY HELP.")
+}
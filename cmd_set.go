@@ -53,6 +53,9 @@ func (m *Miniredis) cmdSadd(c *server.Peer, cmd string, args []string) {
 		}
 
 		added := db.setAdd(key, elems...)
+		if added > 0 {
+			db.notify(notifySet, "sadd", key)
+		}
 		c.WriteInt(added)
 	})
 }
@@ -116,7 +119,7 @@ func (m *Miniredis) cmdSdiff(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -148,8 +151,10 @@ func (m *Miniredis) cmdSdiffstore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
+		existed := db.exists(dest)
 		db.del(dest, true)
 		db.setSet(dest, set)
+		notifySetStore(db, "sdiffstore", dest, existed, len(set))
 		c.WriteInt(len(set))
 	})
 }
@@ -179,7 +184,7 @@ func (m *Miniredis) cmdSinter(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -211,8 +216,10 @@ func (m *Miniredis) cmdSinterstore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
+		existed := db.exists(dest)
 		db.del(dest, true)
 		db.setSet(dest, set)
+		notifySetStore(db, "sinterstore", dest, existed, len(set))
 		c.WriteInt(len(set))
 	})
 }
@@ -274,7 +281,7 @@ func (m *Miniredis) cmdSmembers(c *server.Peer, cmd string, args []string) {
 		db := m.db(ctx.selectedDB)
 
 		if !db.exists(key) {
-			c.WriteLen(0)
+			c.WriteSetLen(0)
 			return
 		}
 
@@ -285,7 +292,7 @@ func (m *Miniredis) cmdSmembers(c *server.Peer, cmd string, args []string) {
 
 		members := db.setMembers(key)
 
-		c.WriteLen(len(members))
+		c.WriteSetLen(len(members))
 		for _, elem := range members {
 			c.WriteBulk(elem)
 		}
@@ -331,7 +338,12 @@ func (m *Miniredis) cmdSmove(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		db.setRem(src, member)
+		db.notify(notifySet, "srem", src)
+		if !db.exists(src) {
+			db.notify(notifyGeneric, "del", src)
+		}
 		db.setAdd(dst, member)
+		db.notify(notifySet, "sadd", dst)
 		c.WriteInt(1)
 	})
 }
@@ -379,7 +391,7 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 				c.WriteNull()
 				return
 			}
-			c.WriteLen(0)
+			c.WriteSetLen(0)
 			return
 		}
 
@@ -398,6 +410,12 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 			db.setRem(key, member)
 			deleted = append(deleted, member)
 		}
+		if len(deleted) > 0 {
+			db.notify(notifySet, "spop", key)
+			if !db.exists(key) {
+				db.notify(notifyGeneric, "del", key)
+			}
+		}
 		// without `count` return a single value...
 		if !withCount {
 			if len(deleted) == 0 {
@@ -408,7 +426,7 @@ func (m *Miniredis) cmdSpop(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		// ... with `count` return a list
-		c.WriteLen(len(deleted))
+		c.WriteSetLen(len(deleted))
 		for _, v := range deleted {
 			c.WriteBulk(v)
 		}
@@ -518,7 +536,14 @@ func (m *Miniredis) cmdSrem(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteInt(db.setRem(key, fields...))
+		n := db.setRem(key, fields...)
+		if n > 0 {
+			db.notify(notifySet, "srem", key)
+			if !db.exists(key) {
+				db.notify(notifyGeneric, "del", key)
+			}
+		}
+		c.WriteInt(n)
 	})
 }
 
@@ -547,7 +572,7 @@ func (m *Miniredis) cmdSunion(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteLen(len(set))
+		c.WriteSetLen(len(set))
 		for k := range set {
 			c.WriteBulk(k)
 		}
@@ -579,8 +604,10 @@ func (m *Miniredis) cmdSunionstore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
+		existed := db.exists(dest)
 		db.del(dest, true)
 		db.setSet(dest, set)
+		notifySetStore(db, "sunionstore", dest, existed, len(set))
 		c.WriteInt(len(set))
 	})
 }
@@ -672,3 +699,14 @@ func (m *Miniredis) cmdSscan(c *server.Peer, cmd string, args []string) {
 		}
 	})
 }
+
+// notifySetStore sends the keyspace event for SDIFFSTORE and friends. An empty
+// result deletes the destination.
+func notifySetStore(db *RedisDB, event, dest string, existed bool, n int) {
+	switch {
+	case n > 0:
+		db.notify(notifySet, event, dest)
+	case existed:
+		db.notify(notifyGeneric, "del", dest)
+	}
+}
@@ -136,12 +136,14 @@ outer:
 					return
 				}
 				newScore := db.ssetIncrby(key, member, delta)
-				c.WriteBulk(formatFloat(newScore))
+				db.notify(notifyZset, "zincr", key)
+				c.WriteFloat(newScore)
 			}
 			return
 		}
 
 		res := 0
+		changed := false
 		for member, score := range elems {
 			if nx && db.ssetExists(key, member) {
 				continue
@@ -152,13 +154,20 @@ outer:
 			old := db.ssetScore(key, member)
 			if db.ssetAdd(key, score, member) {
 				res++
+				changed = true
 			} else {
+				if old != score {
+					changed = true
+				}
 				if ch && old != score {
 					// if 'CH' is specified, only count changed keys
 					res++
 				}
 			}
 		}
+		if changed {
+			db.notify(notifyZset, "zadd", key)
+		}
 		c.WriteInt(res)
 	})
 }
@@ -274,7 +283,8 @@ func (m *Miniredis) cmdZincrby(c *server.Peer, cmd string, args []string) {
 			return
 		}
 		newScore := db.ssetIncrby(key, member, delta)
-		c.WriteBulk(formatFloat(newScore))
+		db.notify(notifyZset, "zincr", key)
+		c.WriteFloat(newScore)
 	})
 }
 
@@ -406,6 +416,7 @@ func (m *Miniredis) cmdZinterstore(c *server.Peer, cmd string, args []string) {
 			}
 		}
 		db.ssetSet(destination, sset)
+		db.notify(notifyZset, "zinterstore", destination)
 		c.WriteInt(len(sset))
 	})
 }
@@ -853,6 +864,9 @@ func (m *Miniredis) cmdZrem(c *server.Peer, cmd string, args []string) {
 				deleted++
 			}
 		}
+		if deleted > 0 {
+			notifyZsetRem(db, "zrem", key)
+		}
 		c.WriteInt(deleted)
 	})
 }
@@ -906,6 +920,9 @@ func (m *Miniredis) cmdZremrangebylex(c *server.Peer, cmd string, args []string)
 		for _, el := range members {
 			db.ssetRem(key, el)
 		}
+		if len(members) > 0 {
+			notifyZsetRem(db, "zremrangebylex", key)
+		}
 		c.WriteInt(len(members))
 	})
 }
@@ -956,6 +973,9 @@ func (m *Miniredis) cmdZremrangebyrank(c *server.Peer, cmd string, args []string
 		for _, el := range members[rs:re] {
 			db.ssetRem(key, el)
 		}
+		if re > rs {
+			notifyZsetRem(db, "zremrangebyrank", key)
+		}
 		c.WriteInt(re - rs)
 	})
 }
@@ -1007,6 +1027,9 @@ func (m *Miniredis) cmdZremrangebyscore(c *server.Peer, cmd string, args []strin
 		for _, el := range members {
 			db.ssetRem(key, el.member)
 		}
+		if len(members) > 0 {
+			notifyZsetRem(db, "zremrangebyscore", key)
+		}
 		c.WriteInt(len(members))
 	})
 }
@@ -1045,7 +1068,7 @@ func (m *Miniredis) cmdZscore(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		c.WriteBulk(formatFloat(db.ssetScore(key, member)))
+		c.WriteFloat(db.ssetScore(key, member))
 	})
 }
 
@@ -1296,6 +1319,7 @@ func (m *Miniredis) cmdZunionstore(c *server.Peer, cmd string, args []string) {
 			}
 		}
 		db.ssetSet(destination, sset)
+		db.notify(notifyZset, "zunionstore", destination)
 		c.WriteInt(sset.card())
 	})
 }
@@ -1450,6 +1474,22 @@ func (m *Miniredis) cmdZpopmax(reverse bool) server.Cmd {
 				}
 				db.ssetRem(key, el)
 			}
+			if re > rs {
+				event := "zpopmin"
+				if reverse {
+					event = "zpopmax"
+				}
+				notifyZsetRem(db, event, key)
+			}
 		})
 	}
 }
+
+// notifyZsetRem sends the keyspace events for commands which remove members,
+// including a "del" when the sorted set is gone.
+func notifyZsetRem(db *RedisDB, event, key string) {
+	db.notify(notifyZset, event, key)
+	if !db.exists(key) {
+		db.notify(notifyGeneric, "del", key)
+	}
+}
@@ -0,0 +1,1578 @@
+// Commands from https://redis.io/commands#stream
+
+package miniredis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// commandsStream handles all stream operations.
+func commandsStream(m *Miniredis) {
+	m.srv.Register("XACK", m.cmdXack)
+	m.srv.Register("XADD", m.cmdXadd)
+	m.srv.Register("XAUTOCLAIM", m.cmdXautoclaim)
+	m.srv.Register("XCLAIM", m.cmdXclaim)
+	m.srv.Register("XDEL", m.cmdXdel)
+	m.srv.Register("XGROUP", m.cmdXgroup)
+	m.srv.Register("XINFO", m.cmdXinfo)
+	m.srv.Register("XLEN", m.cmdXlen)
+	m.srv.Register("XPENDING", m.cmdXpending)
+	m.srv.Register("XRANGE", m.makeCmdXrange(false))
+	m.srv.Register("XREAD", m.cmdXread)
+	m.srv.Register("XREADGROUP", m.cmdXreadgroup)
+	m.srv.Register("XREVRANGE", m.makeCmdXrange(true))
+	m.srv.Register("XTRIM", m.cmdXtrim)
+}
+
+// streamTrim has the MAXLEN/MINID options of XADD and XTRIM.
+type streamTrim struct {
+	set    bool
+	maxlen int // -1 when MINID is used
+	minID  streamID
+}
+
+// apply trims the stream. Returns the number of deleted entries.
+func (t streamTrim) apply(s *streamKey) int {
+	if !t.set {
+		return 0
+	}
+	if t.maxlen >= 0 {
+		return s.trimMaxlen(t.maxlen)
+	}
+	return s.trimMinID(t.minID)
+}
+
+// parseStreamTrim parses `MAXLEN|MINID [=|~] threshold [LIMIT count]`. The
+// first element of args must be MAXLEN or MINID. Returns the remaining args,
+// or an error message.
+// We always trim exactly, even with '~'.
+func parseStreamTrim(args []string) (streamTrim, []string, string) {
+	t := streamTrim{set: true, maxlen: -1}
+	strategy := strings.ToUpper(args[0])
+	args = args[1:]
+	approx := false
+	if len(args) > 0 && (args[0] == "~" || args[0] == "=") {
+		approx = args[0] == "~"
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return t, nil, msgSyntaxError
+	}
+	switch strategy {
+	case "MAXLEN":
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return t, nil, msgInvalidInt
+		}
+		if n < 0 {
+			return t, nil, msgStreamMaxlenArg
+		}
+		t.maxlen = n
+	case "MINID":
+		id, err := parseStreamID(args[0], 0)
+		if err != nil {
+			return t, nil, err.Error()
+		}
+		t.minID = id
+	}
+	args = args[1:]
+	if len(args) > 0 && strings.ToUpper(args[0]) == "LIMIT" {
+		if len(args) < 2 {
+			return t, nil, msgSyntaxError
+		}
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			return t, nil, msgInvalidInt
+		}
+		if !approx {
+			return t, nil, msgStreamLimitNoApprox
+		}
+		args = args[2:]
+	}
+	return t, args, ""
+}
+
+// XADD
+func (m *Miniredis) cmdXadd(c *server.Peer, cmd string, args []string) {
+	if len(args) < 4 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, args := args[0], args[1:]
+	var (
+		nomkstream = false
+		trim       streamTrim
+	)
+outer:
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "NOMKSTREAM":
+			nomkstream = true
+			args = args[1:]
+		case "MAXLEN", "MINID":
+			var msg string
+			trim, args, msg = parseStreamTrim(args)
+			if msg != "" {
+				setDirty(c)
+				c.WriteError(msg)
+				return
+			}
+		default:
+			break outer
+		}
+	}
+	if len(args) < 3 || len(args)%2 != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	id, values := args[0], args[1:]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if db.exists(key) && db.t(key) != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		if nomkstream && !db.exists(key) {
+			c.WriteNull()
+			return
+		}
+
+		newID, err := db.streamAdd(key, id, values)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		db.notify(notifyStream, "xadd", key)
+		if trim.apply(db.streamKeys[key]) > 0 {
+			db.notify(notifyStream, "xtrim", key)
+		}
+		c.WriteBulk(newID)
+	})
+}
+
+// XLEN
+func (m *Miniredis) cmdXlen(c *server.Peer, cmd string, args []string) {
+	if len(args) != 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key := args[0]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		t, ok := db.keys[key]
+		if !ok {
+			c.WriteInt(0)
+			return
+		}
+		if t != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+
+		c.WriteInt(len(db.streamKeys[key].entries))
+	})
+}
+
+// XRANGE and XREVRANGE
+func (m *Miniredis) makeCmdXrange(reverse bool) server.Cmd {
+	return func(c *server.Peer, cmd string, args []string) {
+		if len(args) != 3 && len(args) != 5 {
+			setDirty(c)
+			c.WriteError(errWrongNumber(cmd))
+			return
+		}
+		if !m.handleAuth(c) {
+			return
+		}
+		if m.checkPubsub(c) {
+			return
+		}
+
+		key, startS, endS := args[0], args[1], args[2]
+		if reverse {
+			startS, endS = endS, startS
+		}
+		start, err := parseStreamRange(startS, false)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+		end, err := parseStreamRange(endS, true)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+		count := -1
+		if len(args) == 5 {
+			if strings.ToUpper(args[3]) != "COUNT" {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			count, err = strconv.Atoi(args[4])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+		}
+
+		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+			db := m.db(ctx.selectedDB)
+
+			t, ok := db.keys[key]
+			if !ok || count == 0 {
+				c.WriteLen(0)
+				return
+			}
+			if t != "stream" {
+				c.WriteError(msgWrongType)
+				return
+			}
+
+			writeStreamEntries(c, db.streamKeys[key].between(start, end, count, reverse))
+		})
+	}
+}
+
+// XDEL
+func (m *Miniredis) cmdXdel(c *server.Peer, cmd string, args []string) {
+	if len(args) < 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, args := args[0], args[1:]
+	var ids []streamID
+	for _, a := range args {
+		id, err := parseStreamID(a, 0)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		t, ok := db.keys[key]
+		if !ok {
+			c.WriteInt(0)
+			return
+		}
+		if t != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+
+		n := db.streamKeys[key].delete(ids)
+		if n > 0 {
+			db.modified(key)
+			db.notify(notifyStream, "xdel", key)
+		}
+		c.WriteInt(n)
+	})
+}
+
+// XTRIM
+func (m *Miniredis) cmdXtrim(c *server.Peer, cmd string, args []string) {
+	if len(args) < 3 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, args := args[0], args[1:]
+	switch strings.ToUpper(args[0]) {
+	case "MAXLEN", "MINID":
+	default:
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+	trim, args, msg := parseStreamTrim(args)
+	if msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return
+	}
+	if len(args) != 0 {
+		setDirty(c)
+		c.WriteError(msgSyntaxError)
+		return
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		t, ok := db.keys[key]
+		if !ok {
+			c.WriteInt(0)
+			return
+		}
+		if t != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+
+		n := trim.apply(db.streamKeys[key])
+		if n > 0 {
+			db.modified(key)
+			db.notify(notifyStream, "xtrim", key)
+		}
+		c.WriteInt(n)
+	})
+}
+
+// xreadOpts has the parsed arguments of XREAD and XREADGROUP.
+type xreadOpts struct {
+	group    string
+	consumer string
+	count    int
+	block    bool
+	timeout  time.Duration
+	noack    bool
+	keys     []string
+	ids      []string
+}
+
+// parseXread parses the arguments of XREAD and XREADGROUP. Returns an error
+// message on failure.
+func parseXread(cmd string, args []string, group bool) (xreadOpts, string) {
+	opts := xreadOpts{}
+	if group {
+		if len(args) < 3 || strings.ToUpper(args[0]) != "GROUP" {
+			return opts, msgSyntaxError
+		}
+		opts.group, opts.consumer, args = args[1], args[2], args[3:]
+	}
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "COUNT":
+			if len(args) < 2 {
+				return opts, msgSyntaxError
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return opts, msgInvalidInt
+			}
+			if n > 0 {
+				opts.count = n
+			}
+			args = args[2:]
+		case "BLOCK":
+			if len(args) < 2 {
+				return opts, msgSyntaxError
+			}
+			ms, err := strconv.Atoi(args[1])
+			if err != nil {
+				return opts, msgInvalidTimeout
+			}
+			if ms < 0 {
+				return opts, msgNegTimeout
+			}
+			opts.block = true
+			opts.timeout = time.Duration(ms) * time.Millisecond
+			args = args[2:]
+		case "NOACK":
+			if !group {
+				return opts, msgSyntaxError
+			}
+			opts.noack = true
+			args = args[1:]
+		case "STREAMS":
+			args = args[1:]
+			if len(args) == 0 || len(args)%2 != 0 {
+				special := "$"
+				if group {
+					special = ">"
+				}
+				return opts, fmt.Sprintf(msgStreamUnbalanced, strings.ToLower(cmd), special)
+			}
+			opts.keys, opts.ids = args[:len(args)/2], args[len(args)/2:]
+			for _, id := range opts.ids {
+				switch id {
+				case "$":
+					if group {
+						return opts, msgXreadgroupDollar
+					}
+				case ">":
+					if !group {
+						return opts, msgXreadGreater
+					}
+				default:
+					if _, err := parseStreamID(id, 0); err != nil {
+						return opts, err.Error()
+					}
+				}
+			}
+			return opts, ""
+		default:
+			return opts, msgSyntaxError
+		}
+	}
+	return opts, msgSyntaxError
+}
+
+// streamResult is a key with the entries read from it.
+type streamResult struct {
+	key     string
+	entries []StreamEntry
+}
+
+// XREAD
+func (m *Miniredis) cmdXread(c *server.Peer, cmd string, args []string) {
+	if len(args) < 3 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	opts, msg := parseXread(cmd, args, false)
+	if msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return
+	}
+
+	var (
+		resolved bool
+		ids      = make([]streamID, len(opts.ids))
+	)
+	read := func(c *server.Peer, ctx *connCtx) bool {
+		db := m.db(ctx.selectedDB)
+
+		for _, key := range opts.keys {
+			if db.exists(key) && db.t(key) != "stream" {
+				c.WriteError(msgWrongType)
+				return true
+			}
+		}
+		if !resolved {
+			// '$' is the last ID at the moment the command started.
+			for i, id := range opts.ids {
+				if id != "$" {
+					ids[i], _ = parseStreamID(id, 0)
+					continue
+				}
+				if s, ok := db.streamKeys[opts.keys[i]]; ok {
+					ids[i] = s.lastID
+				}
+			}
+			resolved = true
+		}
+
+		var res []streamResult
+		for i, key := range opts.keys {
+			s, ok := db.streamKeys[key]
+			if !ok {
+				continue
+			}
+			if entries := s.after(ids[i], opts.count); len(entries) > 0 {
+				res = append(res, streamResult{key, entries})
+			}
+		}
+		if len(res) == 0 {
+			return false
+		}
+		writeStreamResults(c, res)
+		return true
+	}
+
+	if opts.block {
+		blocking(m, c, opts.timeout, read, func(c *server.Peer) {
+			c.WriteNull()
+		})
+		return
+	}
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if !read(c, ctx) {
+			c.WriteNull()
+		}
+	})
+}
+
+// XREADGROUP
+func (m *Miniredis) cmdXreadgroup(c *server.Peer, cmd string, args []string) {
+	if len(args) < 6 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	opts, msg := parseXread(cmd, args, true)
+	if msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return
+	}
+
+	read := func(c *server.Peer, ctx *connCtx) bool {
+		var (
+			db  = m.db(ctx.selectedDB)
+			now = m.effectiveNow()
+		)
+
+		var groups []*streamGroup
+		for _, key := range opts.keys {
+			if db.exists(key) && db.t(key) != "stream" {
+				c.WriteError(msgWrongType)
+				return true
+			}
+			s, ok := db.streamKeys[key]
+			if !ok {
+				c.WriteError(fmt.Sprintf(msgFNoGroupRead, key, opts.group))
+				return true
+			}
+			g, ok := s.groups[opts.group]
+			if !ok {
+				c.WriteError(fmt.Sprintf(msgFNoGroupRead, key, opts.group))
+				return true
+			}
+			groups = append(groups, g)
+		}
+
+		var (
+			res     []streamResult
+			history = false
+		)
+		for i, key := range opts.keys {
+			g := groups[i]
+			if opts.ids[i] != ">" {
+				history = true
+				id, _ := parseStreamID(opts.ids[i], 0)
+				res = append(res, streamResult{key, g.readHistory(opts.consumer, id, opts.count, now)})
+				continue
+			}
+			entries := g.readNew(opts.consumer, opts.count, opts.noack, now)
+			if len(entries) > 0 {
+				db.modified(key)
+				res = append(res, streamResult{key, entries})
+			}
+		}
+		if len(res) == 0 && !history {
+			return false
+		}
+		writeStreamResults(c, res)
+		return true
+	}
+
+	if opts.block {
+		blocking(m, c, opts.timeout, read, func(c *server.Peer) {
+			c.WriteNull()
+		})
+		return
+	}
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		if !read(c, ctx) {
+			c.WriteNull()
+		}
+	})
+}
+
+// XGROUP
+func (m *Miniredis) cmdXgroup(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subcmd {
+	case "CREATE":
+		m.cmdXgroupCreate(c, subcmd, args)
+	case "SETID":
+		m.cmdXgroupSetid(c, subcmd, args)
+	case "DESTROY":
+		m.cmdXgroupDestroy(c, subcmd, args)
+	case "CREATECONSUMER":
+		m.cmdXgroupCreateconsumer(c, subcmd, args)
+	case "DELCONSUMER":
+		m.cmdXgroupDelconsumer(c, subcmd, args)
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXgroupUsage, subcmd))
+	}
+}
+
+// parseEntriesRead parses the optional `ENTRIESREAD n` of XGROUP CREATE and
+// SETID.
+func parseEntriesRead(args []string) (int, bool, string) {
+	if len(args) == 0 {
+		return 0, false, ""
+	}
+	if len(args) != 2 || strings.ToUpper(args[0]) != "ENTRIESREAD" {
+		return 0, false, msgSyntaxError
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, false, msgInvalidInt
+	}
+	return n, true, ""
+}
+
+// XGROUP CREATE
+func (m *Miniredis) cmdXgroupCreate(c *server.Peer, cmd string, args []string) {
+	if len(args) < 3 {
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXgroupUsage, cmd))
+		return
+	}
+
+	key, group, idS, args := args[0], args[1], args[2], args[3:]
+	mkstream := false
+	if len(args) > 0 && strings.ToUpper(args[0]) == "MKSTREAM" {
+		mkstream = true
+		args = args[1:]
+	}
+	entriesRead, withEntriesRead, msg := parseEntriesRead(args)
+	if msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return
+	}
+	var id streamID
+	if idS != "$" {
+		var err error
+		id, err = parseStreamID(idS, 0)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if db.exists(key) && db.t(key) != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		s, ok := db.streamKeys[key]
+		if !ok {
+			if !mkstream {
+				c.WriteError(msgXgroupKeyNotFound)
+				return
+			}
+			s = db.streamCreate(key)
+		}
+		lastID := id
+		if idS == "$" {
+			lastID = s.lastID
+		}
+		if !s.createGroup(group, lastID) {
+			c.WriteError(msgXgroupExists)
+			return
+		}
+		if withEntriesRead {
+			s.groups[group].entriesRead = uint64(entriesRead)
+		}
+		db.modified(key)
+		db.notify(notifyStream, "xgroup-create", key)
+		c.WriteOK()
+	})
+}
+
+// XGROUP SETID
+func (m *Miniredis) cmdXgroupSetid(c *server.Peer, cmd string, args []string) {
+	if len(args) < 3 {
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXgroupUsage, cmd))
+		return
+	}
+
+	key, group, idS, args := args[0], args[1], args[2], args[3:]
+	entriesRead, withEntriesRead, msg := parseEntriesRead(args)
+	if msg != "" {
+		setDirty(c)
+		c.WriteError(msg)
+		return
+	}
+	var id streamID
+	if idS != "$" {
+		var err error
+		id, err = parseStreamID(idS, 0)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		g, msg := streamGroupLookup(db, key, group)
+		if msg != "" {
+			c.WriteError(msg)
+			return
+		}
+		if idS == "$" {
+			id = g.stream.lastID
+		}
+		g.lastID = id
+		if withEntriesRead {
+			g.entriesRead = uint64(entriesRead)
+		}
+		db.modified(key)
+		db.notify(notifyStream, "xgroup-setid", key)
+		c.WriteOK()
+	})
+}
+
+// XGROUP DESTROY
+func (m *Miniredis) cmdXgroupDestroy(c *server.Peer, cmd string, args []string) {
+	if len(args) != 2 {
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXgroupUsage, cmd))
+		return
+	}
+
+	key, group := args[0], args[1]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		t, ok := db.keys[key]
+		if !ok {
+			c.WriteError(msgXgroupKeyNotFound)
+			return
+		}
+		if t != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		s := db.streamKeys[key]
+		if _, ok := s.groups[group]; !ok {
+			c.WriteInt(0)
+			return
+		}
+		delete(s.groups, group)
+		db.modified(key)
+		db.notify(notifyStream, "xgroup-destroy", key)
+		c.WriteInt(1)
+	})
+}
+
+// XGROUP CREATECONSUMER
+func (m *Miniredis) cmdXgroupCreateconsumer(c *server.Peer, cmd string, args []string) {
+	if len(args) != 3 {
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXgroupUsage, cmd))
+		return
+	}
+
+	key, group, consumer := args[0], args[1], args[2]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		g, msg := streamGroupLookup(db, key, group)
+		if msg != "" {
+			c.WriteError(msg)
+			return
+		}
+		if _, ok := g.consumers[consumer]; ok {
+			c.WriteInt(0)
+			return
+		}
+		g.consumer(consumer, m.effectiveNow())
+		db.notify(notifyStream, "xgroup-createconsumer", key)
+		c.WriteInt(1)
+	})
+}
+
+// XGROUP DELCONSUMER
+func (m *Miniredis) cmdXgroupDelconsumer(c *server.Peer, cmd string, args []string) {
+	if len(args) != 3 {
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXgroupUsage, cmd))
+		return
+	}
+
+	key, group, consumer := args[0], args[1], args[2]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		g, msg := streamGroupLookup(db, key, group)
+		if msg != "" {
+			c.WriteError(msg)
+			return
+		}
+		n := g.deleteConsumer(consumer)
+		db.modified(key)
+		db.notify(notifyStream, "xgroup-delconsumer", key)
+		c.WriteInt(n)
+	})
+}
+
+// streamGroupLookup finds a consumer group. Returns an error message if it's
+// not there.
+func streamGroupLookup(db *RedisDB, key, group string) (*streamGroup, string) {
+	t, ok := db.keys[key]
+	if !ok {
+		return nil, msgXgroupKeyNotFound
+	}
+	if t != "stream" {
+		return nil, msgWrongType
+	}
+	g, ok := db.streamKeys[key].groups[group]
+	if !ok {
+		return nil, fmt.Sprintf(msgFNoGroupKey, group, key)
+	}
+	return g, ""
+}
+
+// XACK
+func (m *Miniredis) cmdXack(c *server.Peer, cmd string, args []string) {
+	if len(args) < 3 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, group, args := args[0], args[1], args[2:]
+	var ids []streamID
+	for _, a := range args {
+		id, err := parseStreamID(a, 0)
+		if err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		t, ok := db.keys[key]
+		if !ok {
+			c.WriteInt(0)
+			return
+		}
+		if t != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		g, ok := db.streamKeys[key].groups[group]
+		if !ok {
+			c.WriteInt(0)
+			return
+		}
+		n := g.ack(ids)
+		if n > 0 {
+			db.modified(key)
+		}
+		c.WriteInt(n)
+	})
+}
+
+// XPENDING
+func (m *Miniredis) cmdXpending(c *server.Peer, cmd string, args []string) {
+	if len(args) < 2 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, group, args := args[0], args[1], args[2:]
+	var (
+		summary  = len(args) == 0
+		minIdle  time.Duration
+		start    streamID
+		end      streamID
+		count    int
+		consumer string
+	)
+	if !summary {
+		if strings.ToUpper(args[0]) == "IDLE" {
+			if len(args) < 2 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			ms, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			minIdle = time.Duration(ms) * time.Millisecond
+			args = args[2:]
+		}
+		if len(args) != 3 && len(args) != 4 {
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+		var err error
+		if start, err = parseStreamRange(args[0], false); err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+		if end, err = parseStreamRange(args[1], true); err != nil {
+			setDirty(c)
+			c.WriteError(err.Error())
+			return
+		}
+		if count, err = strconv.Atoi(args[2]); err != nil {
+			setDirty(c)
+			c.WriteError(msgInvalidInt)
+			return
+		}
+		if len(args) == 4 {
+			consumer = args[3]
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if db.exists(key) && db.t(key) != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		s, ok := db.streamKeys[key]
+		if !ok {
+			c.WriteError(fmt.Sprintf(msgFNoGroup, key, group))
+			return
+		}
+		g, ok := s.groups[group]
+		if !ok {
+			c.WriteError(fmt.Sprintf(msgFNoGroup, key, group))
+			return
+		}
+
+		if summary {
+			writeXpendingSummary(c, g)
+			return
+		}
+
+		now := m.effectiveNow()
+		var res []pendingEntry
+		for _, p := range g.pending {
+			if count <= 0 || len(res) >= count {
+				break
+			}
+			if p.id.cmp(start) < 0 || p.id.cmp(end) > 0 {
+				continue
+			}
+			if consumer != "" && p.consumer != consumer {
+				continue
+			}
+			if now.Sub(p.lastDelivery) < minIdle {
+				continue
+			}
+			res = append(res, p)
+		}
+		c.WriteLen(len(res))
+		for _, p := range res {
+			c.WriteLen(4)
+			c.WriteBulk(p.id.String())
+			c.WriteBulk(p.consumer)
+			c.WriteInt(msSince(now, p.lastDelivery))
+			c.WriteInt(p.deliveryCount)
+		}
+	})
+}
+
+func writeXpendingSummary(c *server.Peer, g *streamGroup) {
+	if len(g.pending) == 0 {
+		c.WriteLen(4)
+		c.WriteInt(0)
+		c.WriteNull()
+		c.WriteNull()
+		c.WriteNull()
+		return
+	}
+
+	c.WriteLen(4)
+	c.WriteInt(len(g.pending))
+	c.WriteBulk(g.pending[0].id.String())
+	c.WriteBulk(g.pending[len(g.pending)-1].id.String())
+	counts := map[string]int{}
+	for _, p := range g.pending {
+		counts[p.consumer]++
+	}
+	c.WriteLen(len(counts))
+	for _, name := range g.consumerNames() {
+		if counts[name] == 0 {
+			continue
+		}
+		c.WriteLen(2)
+		c.WriteBulk(name)
+		c.WriteBulk(strconv.Itoa(counts[name]))
+	}
+}
+
+// xclaimOpts has the options of XCLAIM.
+type xclaimOpts struct {
+	idle       *time.Duration
+	time       *time.Time
+	retryCount *int
+	force      bool
+	justID     bool
+}
+
+// XCLAIM
+func (m *Miniredis) cmdXclaim(c *server.Peer, cmd string, args []string) {
+	if len(args) < 5 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, group, consumer, minIdleS, args := args[0], args[1], args[2], args[3], args[4:]
+	minIdleMs, err := strconv.Atoi(minIdleS)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidMinIdle)
+		return
+	}
+	minIdle := time.Duration(minIdleMs) * time.Millisecond
+
+	var ids []streamID
+	for len(args) > 0 {
+		id, err := parseStreamID(args[0], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+		args = args[1:]
+	}
+	if len(ids) == 0 {
+		setDirty(c)
+		c.WriteError(msgInvalidStreamID)
+		return
+	}
+
+	var opts xclaimOpts
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if len(args) < 2 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			if strings.ToUpper(args[0]) == "LASTID" {
+				if _, err := parseStreamID(args[1], 0); err != nil {
+					setDirty(c)
+					c.WriteError(err.Error())
+					return
+				}
+				args = args[2:]
+				continue
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			switch strings.ToUpper(args[0]) {
+			case "IDLE":
+				d := time.Duration(n) * time.Millisecond
+				opts.idle = &d
+			case "TIME":
+				t := time.Unix(int64(n/1000), int64(n%1000)*int64(time.Millisecond))
+				opts.time = &t
+			case "RETRYCOUNT":
+				opts.retryCount = &n
+			}
+			args = args[2:]
+		case "FORCE":
+			opts.force = true
+			args = args[1:]
+		case "JUSTID":
+			opts.justID = true
+			args = args[1:]
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if db.exists(key) && db.t(key) != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		s, ok := db.streamKeys[key]
+		if !ok {
+			c.WriteError(fmt.Sprintf(msgFNoGroup, key, group))
+			return
+		}
+		g, ok := s.groups[group]
+		if !ok {
+			c.WriteError(fmt.Sprintf(msgFNoGroup, key, group))
+			return
+		}
+
+		var (
+			now     = m.effectiveNow()
+			claimed []StreamEntry
+		)
+		for _, id := range ids {
+			if e, ok := g.claim(consumer, id, minIdle, opts, now); ok {
+				claimed = append(claimed, e)
+			}
+		}
+		g.consumer(consumer, now).seenTime = now
+		if len(claimed) > 0 {
+			g.consumers[consumer].activeTime = now
+			db.modified(key)
+		}
+
+		if opts.justID {
+			c.WriteLen(len(claimed))
+			for _, e := range claimed {
+				c.WriteBulk(e.ID)
+			}
+			return
+		}
+		writeStreamEntries(c, claimed)
+	})
+}
+
+// claim moves a single pending entry to the consumer, if it's idle long
+// enough. Entries which are no longer in the stream are removed from the PEL.
+func (g *streamGroup) claim(consumer string, id streamID, minIdle time.Duration, opts xclaimOpts, now time.Time) (StreamEntry, bool) {
+	e, exists := g.stream.get(id)
+	p, pending := g.getPending(id)
+	if !pending {
+		if !opts.force || !exists {
+			return StreamEntry{}, false
+		}
+		g.setPending(pendingEntry{id: id, consumer: consumer, lastDelivery: now})
+		p, _ = g.getPending(id)
+	} else {
+		if !exists {
+			g.ack([]streamID{id})
+			return StreamEntry{}, false
+		}
+		if minIdle > 0 && now.Sub(p.lastDelivery) < minIdle {
+			return StreamEntry{}, false
+		}
+	}
+
+	p.consumer = consumer
+	switch {
+	case opts.idle != nil:
+		p.lastDelivery = now.Add(-*opts.idle)
+	case opts.time != nil:
+		p.lastDelivery = *opts.time
+	default:
+		p.lastDelivery = now
+	}
+	switch {
+	case opts.retryCount != nil:
+		p.deliveryCount = *opts.retryCount
+	case !opts.justID:
+		p.deliveryCount++
+	}
+	return *e, true
+}
+
+// XAUTOCLAIM
+func (m *Miniredis) cmdXautoclaim(c *server.Peer, cmd string, args []string) {
+	if len(args) < 5 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	key, group, consumer, minIdleS, startS, args := args[0], args[1], args[2], args[3], args[4], args[5:]
+	minIdleMs, err := strconv.Atoi(minIdleS)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(msgInvalidMinIdle)
+		return
+	}
+	minIdle := time.Duration(minIdleMs) * time.Millisecond
+	start, err := parseStreamRange(startS, false)
+	if err != nil {
+		setDirty(c)
+		c.WriteError(err.Error())
+		return
+	}
+
+	var (
+		count  = 100
+		justID = false
+	)
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "COUNT":
+			if len(args) < 2 {
+				setDirty(c)
+				c.WriteError(msgSyntaxError)
+				return
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				setDirty(c)
+				c.WriteError(msgInvalidInt)
+				return
+			}
+			if n <= 0 {
+				setDirty(c)
+				c.WriteError(msgXautoclaimCount)
+				return
+			}
+			count = n
+			args = args[2:]
+		case "JUSTID":
+			justID = true
+			args = args[1:]
+		default:
+			setDirty(c)
+			c.WriteError(msgSyntaxError)
+			return
+		}
+	}
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		if db.exists(key) && db.t(key) != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		s, ok := db.streamKeys[key]
+		if !ok {
+			c.WriteError(fmt.Sprintf(msgFNoGroup, key, group))
+			return
+		}
+		g, ok := s.groups[group]
+		if !ok {
+			c.WriteError(fmt.Sprintf(msgFNoGroup, key, group))
+			return
+		}
+
+		var (
+			now     = m.effectiveNow()
+			claimed []StreamEntry
+			deleted []string
+			next    = streamID{}
+			opts    = xclaimOpts{justID: justID}
+		)
+		var candidates []streamID
+		for i := g.searchPending(start); i < len(g.pending); i++ {
+			if len(candidates) == count {
+				next = g.pending[i].id
+				break
+			}
+			candidates = append(candidates, g.pending[i].id)
+		}
+		for _, id := range candidates {
+			if _, ok := s.get(id); !ok {
+				g.ack([]streamID{id})
+				deleted = append(deleted, id.String())
+				continue
+			}
+			if e, ok := g.claim(consumer, id, minIdle, opts, now); ok {
+				claimed = append(claimed, e)
+			}
+		}
+		g.consumer(consumer, now).seenTime = now
+		if len(claimed) > 0 {
+			g.consumers[consumer].activeTime = now
+		}
+		if len(claimed) > 0 || len(deleted) > 0 {
+			db.modified(key)
+		}
+
+		c.WriteLen(3)
+		c.WriteBulk(next.String())
+		if justID {
+			c.WriteLen(len(claimed))
+			for _, e := range claimed {
+				c.WriteBulk(e.ID)
+			}
+		} else {
+			writeStreamEntries(c, claimed)
+		}
+		c.WriteLen(len(deleted))
+		for _, id := range deleted {
+			c.WriteBulk(id)
+		}
+	})
+}
+
+// XINFO
+func (m *Miniredis) cmdXinfo(c *server.Peer, cmd string, args []string) {
+	if len(args) < 1 {
+		setDirty(c)
+		c.WriteError(errWrongNumber(cmd))
+		return
+	}
+	if !m.handleAuth(c) {
+		return
+	}
+	if m.checkPubsub(c) {
+		return
+	}
+
+	subcmd, args := strings.ToUpper(args[0]), args[1:]
+	switch subcmd {
+	case "STREAM":
+		if len(args) != 1 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFXinfoUsage, subcmd))
+			return
+		}
+	case "GROUPS":
+		if len(args) != 1 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFXinfoUsage, subcmd))
+			return
+		}
+	case "CONSUMERS":
+		if len(args) != 2 {
+			setDirty(c)
+			c.WriteError(fmt.Sprintf(msgFXinfoUsage, subcmd))
+			return
+		}
+	default:
+		setDirty(c)
+		c.WriteError(fmt.Sprintf(msgFXinfoUsage, subcmd))
+		return
+	}
+	key := args[0]
+
+	withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+		db := m.db(ctx.selectedDB)
+
+		t, ok := db.keys[key]
+		if !ok {
+			c.WriteError(msgKeyNotFound)
+			return
+		}
+		if t != "stream" {
+			c.WriteError(msgWrongType)
+			return
+		}
+		s := db.streamKeys[key]
+		now := m.effectiveNow()
+
+		switch subcmd {
+		case "STREAM":
+			writeXinfoStream(c, s)
+		case "GROUPS":
+			var names []string
+			for name := range s.groups {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			c.WriteLen(len(names))
+			for _, name := range names {
+				g := s.groups[name]
+				c.WriteLen(12)
+				c.WriteBulk("name")
+				c.WriteBulk(name)
+				c.WriteBulk("consumers")
+				c.WriteInt(len(g.consumers))
+				c.WriteBulk("pending")
+				c.WriteInt(len(g.pending))
+				c.WriteBulk("last-delivered-id")
+				c.WriteBulk(g.lastID.String())
+				c.WriteBulk("entries-read")
+				c.WriteInt(int(g.entriesRead))
+				c.WriteBulk("lag")
+				c.WriteInt(g.lag())
+			}
+		case "CONSUMERS":
+			g, ok := s.groups[args[1]]
+			if !ok {
+				c.WriteError(fmt.Sprintf(msgFNoGroupKey, args[1], key))
+				return
+			}
+			c.WriteLen(len(g.consumers))
+			for _, name := range g.consumerNames() {
+				cons := g.consumers[name]
+				c.WriteLen(8)
+				c.WriteBulk("name")
+				c.WriteBulk(name)
+				c.WriteBulk("pending")
+				c.WriteInt(g.pendingCount(name))
+				c.WriteBulk("idle")
+				c.WriteInt(msSince(now, cons.seenTime))
+				c.WriteBulk("inactive")
+				if cons.activeTime.IsZero() {
+					c.WriteInt(-1)
+				} else {
+					c.WriteInt(msSince(now, cons.activeTime))
+				}
+			}
+		}
+	})
+}
+
+func writeXinfoStream(c *server.Peer, s *streamKey) {
+	c.WriteLen(20)
+	c.WriteBulk("length")
+	c.WriteInt(len(s.entries))
+	c.WriteBulk("radix-tree-keys")
+	c.WriteInt(1)
+	c.WriteBulk("radix-tree-nodes")
+	c.WriteInt(2)
+	c.WriteBulk("last-generated-id")
+	c.WriteBulk(s.lastID.String())
+	c.WriteBulk("max-deleted-entry-id")
+	c.WriteBulk(s.maxDeletedID.String())
+	c.WriteBulk("entries-added")
+	c.WriteInt(int(s.entriesAdded))
+	c.WriteBulk("recorded-first-entry-id")
+	if len(s.entries) == 0 {
+		c.WriteBulk("0-0")
+	} else {
+		c.WriteBulk(s.entries[0].ID)
+	}
+	c.WriteBulk("groups")
+	c.WriteInt(len(s.groups))
+	c.WriteBulk("first-entry")
+	if len(s.entries) == 0 {
+		c.WriteNull()
+	} else {
+		writeStreamEntry(c, s.entries[0])
+	}
+	c.WriteBulk("last-entry")
+	if len(s.entries) == 0 {
+		c.WriteNull()
+	} else {
+		writeStreamEntry(c, s.entries[len(s.entries)-1])
+	}
+}
+
+func writeStreamEntry(c *server.Peer, e StreamEntry) {
+	c.WriteLen(2)
+	c.WriteBulk(e.ID)
+	if e.Values == nil {
+		// pending, but deleted from the stream
+		c.WriteNull()
+		return
+	}
+	c.WriteLen(len(e.Values))
+	for _, v := range e.Values {
+		c.WriteBulk(v)
+	}
+}
+
+func writeStreamEntries(c *server.Peer, entries []StreamEntry) {
+	c.WriteLen(len(entries))
+	for _, e := range entries {
+		writeStreamEntry(c, e)
+	}
+}
+
+func writeStreamResults(c *server.Peer, res []streamResult) {
+	c.WriteLen(len(res))
+	for _, r := range res {
+		c.WriteLen(2)
+		c.WriteBulk(r.key)
+		writeStreamEntries(c, r.entries)
+	}
+}
+
+// msSince gives the time between two moments in milliseconds. Never negative.
+func msSince(now, t time.Time) int {
+	d := now.Sub(t)
+	if d < 0 {
+		return 0
+	}
+	return int(d / time.Millisecond)
+}
@@ -0,0 +1,515 @@
+package miniredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Test XADD / XLEN / XRANGE
+func TestStream(t *testing.T) {
+	s, c, done := setup(t)
+	defer done()
+
+	t.Run("XADD", func(t *testing.T) {
+		id, err := redis.String(c.Do("XADD", "planets", "0-1", "name", "Mercury"))
+		ok(t, err)
+		equals(t, "0-1", id)
+
+		s.SetTime(time.Unix(1, 0))
+		id, err = redis.String(c.Do("XADD", "planets", "*", "name", "Venus"))
+		ok(t, err)
+		equals(t, "1000-0", id)
+		id, err = redis.String(c.Do("XADD", "planets", "*", "name", "Earth"))
+		ok(t, err)
+		equals(t, "1000-1", id)
+
+		id, err = redis.String(c.Do("XADD", "planets", "1000-*", "name", "Mars"))
+		ok(t, err)
+		equals(t, "1000-2", id)
+
+		id, err = redis.String(c.Do("XADD", "planets", "2000", "name", "Jupiter"))
+		ok(t, err)
+		equals(t, "2000-0", id)
+
+		n, err := redis.Int(c.Do("XLEN", "planets"))
+		ok(t, err)
+		equals(t, 5, n)
+
+		typ, err := redis.String(c.Do("TYPE", "planets"))
+		ok(t, err)
+		equals(t, "stream", typ)
+
+		_, err = c.Do("XADD", "planets", "1000-0", "name", "Pluto")
+		mustFail(t, err, msgStreamIDTooSmall)
+		_, err = c.Do("XADD", "other", "0-0", "name", "Pluto")
+		mustFail(t, err, msgStreamIDZero)
+		_, err = c.Do("XADD", "other", "foo", "name", "Pluto")
+		mustFail(t, err, msgInvalidStreamID)
+		equals(t, false, s.Exists("other"))
+		_, err = c.Do("XADD", "planets", "*", "name")
+		mustFail(t, err, "ERR wrong number of arguments for 'xadd' command")
+
+		s.Set("str", "value")
+		_, err = c.Do("XADD", "str", "*", "name", "Pluto")
+		mustFail(t, err, msgWrongType)
+		_, err = c.Do("XLEN", "str")
+		mustFail(t, err, msgWrongType)
+	})
+
+	t.Run("MAXLEN", func(t *testing.T) {
+		for i := 1; i <= 5; i++ {
+			_, err := c.Do("XADD", "capped", "MAXLEN", "~", "3", "*", "i", i)
+			ok(t, err)
+		}
+		n, err := redis.Int(c.Do("XLEN", "capped"))
+		ok(t, err)
+		equals(t, 3, n)
+
+		_, err = c.Do("XADD", "capped", "MAXLEN", "-1", "*", "i", "6")
+		mustFail(t, err, msgStreamMaxlenArg)
+		_, err = c.Do("XADD", "capped", "MAXLEN", "3", "LIMIT", "10", "*", "i", "6")
+		mustFail(t, err, msgStreamLimitNoApprox)
+
+		v, err := c.Do("XADD", "nosuch", "NOMKSTREAM", "*", "i", "1")
+		ok(t, err)
+		equals(t, nil, v)
+		equals(t, false, s.Exists("nosuch"))
+	})
+
+	t.Run("XRANGE", func(t *testing.T) {
+		res, err := redis.Values(c.Do("XRANGE", "planets", "-", "+"))
+		ok(t, err)
+		equals(t, 5, len(res))
+		equals(t, []interface{}{
+			[]byte("0-1"),
+			[]interface{}{[]byte("name"), []byte("Mercury")},
+		}, res[0])
+
+		res, err = redis.Values(c.Do("XRANGE", "planets", "1000", "1000"))
+		ok(t, err)
+		equals(t, 3, len(res))
+
+		res, err = redis.Values(c.Do("XRANGE", "planets", "(1000-0", "+", "COUNT", "2"))
+		ok(t, err)
+		equals(t, 2, len(res))
+		equals(t, []byte("1000-1"), res[0].([]interface{})[0])
+
+		res, err = redis.Values(c.Do("XREVRANGE", "planets", "+", "-", "COUNT", "1"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("2000-0"),
+				[]interface{}{[]byte("name"), []byte("Jupiter")},
+			},
+		}, res)
+
+		res, err = redis.Values(c.Do("XRANGE", "nosuch", "-", "+"))
+		ok(t, err)
+		equals(t, 0, len(res))
+
+		_, err = c.Do("XRANGE", "planets", "foo", "+")
+		mustFail(t, err, msgInvalidStreamID)
+		_, err = c.Do("XRANGE", "planets", "-", "(0-0")
+		mustFail(t, err, msgStreamInvalidEnd)
+		_, err = c.Do("XRANGE", "planets", "-", "+", "COUNT")
+		mustFail(t, err, "ERR wrong number of arguments for 'xrange' command")
+		_, err = c.Do("XRANGE", "str", "-", "+")
+		mustFail(t, err, msgWrongType)
+	})
+
+	t.Run("XDEL and XTRIM", func(t *testing.T) {
+		n, err := redis.Int(c.Do("XDEL", "planets", "1000-1", "1000-1", "9-9"))
+		ok(t, err)
+		equals(t, 1, n)
+
+		n, err = redis.Int(c.Do("XTRIM", "planets", "MINID", "1000-2"))
+		ok(t, err)
+		equals(t, 2, n)
+
+		n, err = redis.Int(c.Do("XTRIM", "planets", "MAXLEN", "1"))
+		ok(t, err)
+		equals(t, 1, n)
+
+		n, err = redis.Int(c.Do("XTRIM", "planets", "MAXLEN", "0"))
+		ok(t, err)
+		equals(t, 1, n)
+		// stream stays, even when empty
+		equals(t, "stream", s.Type("planets"))
+
+		_, err = c.Do("XTRIM", "planets", "FOO", "0")
+		mustFail(t, err, msgSyntaxError)
+		_, err = c.Do("XDEL", "planets", "foo")
+		mustFail(t, err, msgInvalidStreamID)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		id, err := s.XAdd("direct", "5-5", []string{"name", "Saturn"})
+		ok(t, err)
+		equals(t, "5-5", id)
+		_, err = s.XAdd("direct", "", []string{"name", "Uranus"})
+		ok(t, err)
+
+		entries, err := s.Stream("direct")
+		ok(t, err)
+		equals(t, 2, len(entries))
+		equals(t, StreamEntry{ID: "5-5", Values: []string{"name", "Saturn"}}, entries[0])
+
+		_, err = s.XAdd("direct", "1-1", []string{"name", "Neptune"})
+		mustFail(t, err, msgStreamIDTooSmall)
+		_, err = s.Stream("nosuch")
+		equals(t, ErrKeyNotFound, err)
+		_, err = s.Stream("str")
+		equals(t, ErrWrongType, err)
+	})
+}
+
+func TestStreamRead(t *testing.T) {
+	s, c, c2, done := setup2(t)
+	defer done()
+
+	s.XAdd("planets", "0-1", []string{"name", "Mercury"})
+	s.XAdd("planets", "0-2", []string{"name", "Venus"})
+	s.XAdd("moons", "0-1", []string{"name", "Luna"})
+
+	t.Run("XREAD", func(t *testing.T) {
+		res, err := redis.Values(c.Do("XREAD", "COUNT", "1", "STREAMS", "planets", "moons", "0", "0-0"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("planets"),
+				[]interface{}{
+					[]interface{}{[]byte("0-1"), []interface{}{[]byte("name"), []byte("Mercury")}},
+				},
+			},
+			[]interface{}{
+				[]byte("moons"),
+				[]interface{}{
+					[]interface{}{[]byte("0-1"), []interface{}{[]byte("name"), []byte("Luna")}},
+				},
+			},
+		}, res)
+
+		v, err := c.Do("XREAD", "STREAMS", "planets", "$")
+		ok(t, err)
+		equals(t, nil, v)
+
+		_, err = c.Do("XREAD", "STREAMS", "planets", "moons", "0")
+		mustFail(t, err, "ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+		_, err = c.Do("XREAD", "STREAMS", "planets", ">")
+		mustFail(t, err, msgXreadGreater)
+		_, err = c.Do("XREAD", "COUNT", "foo", "STREAMS", "planets", "0")
+		mustFail(t, err, msgInvalidInt)
+	})
+
+	t.Run("XREAD BLOCK", func(t *testing.T) {
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			c2.Do("XADD", "planets", "0-3", "name", "Earth")
+		}()
+		res, err := redis.Values(c.Do("XREAD", "BLOCK", "1000", "STREAMS", "planets", "$"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("planets"),
+				[]interface{}{
+					[]interface{}{[]byte("0-3"), []interface{}{[]byte("name"), []byte("Earth")}},
+				},
+			},
+		}, res)
+
+		v, err := c.Do("XREAD", "BLOCK", "10", "STREAMS", "planets", "$")
+		ok(t, err)
+		equals(t, nil, v)
+	})
+
+	t.Run("XREAD BLOCK direct", func(t *testing.T) {
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			s.XAdd("newstream", "0-1", []string{"name", "Io"})
+		}()
+		res, err := redis.Values(c.Do("XREAD", "BLOCK", "0", "STREAMS", "newstream", "$"))
+		ok(t, err)
+		equals(t, 1, len(res))
+	})
+
+	t.Run("XREAD in MULTI", func(t *testing.T) {
+		_, err := c.Do("MULTI")
+		ok(t, err)
+		_, err = c.Do("XREAD", "BLOCK", "0", "STREAMS", "planets", "$")
+		ok(t, err)
+		res, err := redis.Values(c.Do("EXEC"))
+		ok(t, err)
+		equals(t, []interface{}{nil}, res)
+	})
+}
+
+func TestStreamGroup(t *testing.T) {
+	s, c, c2, done := setup2(t)
+	defer done()
+
+	s.SetTime(time.Unix(100, 0))
+	s.XAdd("planets", "0-1", []string{"name", "Mercury"})
+	s.XAdd("planets", "0-2", []string{"name", "Venus"})
+	s.XAdd("planets", "0-3", []string{"name", "Earth"})
+
+	t.Run("XGROUP", func(t *testing.T) {
+		{
+			v, err := redis.String(c.Do("XGROUP", "CREATE", "planets", "processing", "0"))
+			ok(t, err)
+			equals(t, "OK", v)
+		}
+		_, err := c.Do("XGROUP", "CREATE", "planets", "processing", "$")
+		mustFail(t, err, msgXgroupExists)
+		_, err = c.Do("XGROUP", "CREATE", "nosuch", "processing", "$")
+		mustFail(t, err, msgXgroupKeyNotFound)
+		{
+			v, err := redis.String(c.Do("XGROUP", "CREATE", "empty", "processing", "$", "MKSTREAM"))
+			ok(t, err)
+			equals(t, "OK", v)
+		}
+		equals(t, "stream", s.Type("empty"))
+
+		n, err := redis.Int(c.Do("XGROUP", "CREATECONSUMER", "planets", "processing", "alice"))
+		ok(t, err)
+		equals(t, 1, n)
+		n, err = redis.Int(c.Do("XGROUP", "CREATECONSUMER", "planets", "processing", "alice"))
+		ok(t, err)
+		equals(t, 0, n)
+		n, err = redis.Int(c.Do("XGROUP", "DELCONSUMER", "planets", "processing", "alice"))
+		ok(t, err)
+		equals(t, 0, n)
+
+		n, err = redis.Int(c.Do("XGROUP", "DESTROY", "empty", "processing"))
+		ok(t, err)
+		equals(t, 1, n)
+		n, err = redis.Int(c.Do("XGROUP", "DESTROY", "empty", "processing"))
+		ok(t, err)
+		equals(t, 0, n)
+
+		_, err = c.Do("XGROUP", "SETID", "planets", "nosuch", "0")
+		mustFail(t, err, "NOGROUP No such consumer group 'nosuch' for key name 'planets'")
+		_, err = c.Do("XGROUP", "FOO")
+		mustFail(t, err, "ERR Unknown subcommand or wrong number of arguments for 'FOO'. Try XGROUP HELP.")
+	})
+
+	t.Run("XREADGROUP", func(t *testing.T) {
+		res, err := redis.Values(c.Do("XREADGROUP", "GROUP", "processing", "alice", "COUNT", "2", "STREAMS", "planets", ">"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("planets"),
+				[]interface{}{
+					[]interface{}{[]byte("0-1"), []interface{}{[]byte("name"), []byte("Mercury")}},
+					[]interface{}{[]byte("0-2"), []interface{}{[]byte("name"), []byte("Venus")}},
+				},
+			},
+		}, res)
+
+		res, err = redis.Values(c.Do("XREADGROUP", "GROUP", "processing", "bob", "STREAMS", "planets", ">"))
+		ok(t, err)
+		equals(t, 1, len(res))
+
+		v, err := c.Do("XREADGROUP", "GROUP", "processing", "bob", "STREAMS", "planets", ">")
+		ok(t, err)
+		equals(t, nil, v)
+
+		// history
+		res, err = redis.Values(c.Do("XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", "0"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("planets"),
+				[]interface{}{
+					[]interface{}{[]byte("0-1"), []interface{}{[]byte("name"), []byte("Mercury")}},
+					[]interface{}{[]byte("0-2"), []interface{}{[]byte("name"), []byte("Venus")}},
+				},
+			},
+		}, res)
+
+		_, err = c.Do("XREADGROUP", "GROUP", "nosuch", "alice", "STREAMS", "planets", ">")
+		mustFail(t, err, "NOGROUP No such key 'planets' or consumer group 'nosuch' in XREADGROUP with GROUP option")
+		_, err = c.Do("XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", "$")
+		mustFail(t, err, msgXreadgroupDollar)
+	})
+
+	t.Run("XREADGROUP BLOCK", func(t *testing.T) {
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			c2.Do("XADD", "planets", "0-4", "name", "Mars")
+		}()
+		res, err := redis.Values(c.Do("XREADGROUP", "GROUP", "processing", "carol", "BLOCK", "1000", "STREAMS", "planets", ">"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("planets"),
+				[]interface{}{
+					[]interface{}{[]byte("0-4"), []interface{}{[]byte("name"), []byte("Mars")}},
+				},
+			},
+		}, res)
+	})
+
+	t.Run("XPENDING", func(t *testing.T) {
+		res, err := redis.Values(c.Do("XPENDING", "planets", "processing"))
+		ok(t, err)
+		equals(t, []interface{}{
+			int64(4),
+			[]byte("0-1"),
+			[]byte("0-4"),
+			[]interface{}{
+				[]interface{}{[]byte("alice"), []byte("2")},
+				[]interface{}{[]byte("bob"), []byte("1")},
+				[]interface{}{[]byte("carol"), []byte("1")},
+			},
+		}, res)
+
+		s.SetTime(time.Unix(101, 0))
+		res, err = redis.Values(c.Do("XPENDING", "planets", "processing", "-", "+", "10", "alice"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{[]byte("0-1"), []byte("alice"), int64(1000), int64(1)},
+			[]interface{}{[]byte("0-2"), []byte("alice"), int64(1000), int64(1)},
+		}, res)
+
+		res, err = redis.Values(c.Do("XPENDING", "planets", "processing", "IDLE", "5000", "-", "+", "10"))
+		ok(t, err)
+		equals(t, 0, len(res))
+
+		_, err = c.Do("XPENDING", "planets", "nosuch")
+		mustFail(t, err, "NOGROUP No such key 'planets' or consumer group 'nosuch'")
+	})
+
+	t.Run("XACK", func(t *testing.T) {
+		n, err := redis.Int(c.Do("XACK", "planets", "processing", "0-3", "0-3", "9-9"))
+		ok(t, err)
+		equals(t, 1, n)
+		n, err = redis.Int(c.Do("XACK", "planets", "nosuch", "0-1"))
+		ok(t, err)
+		equals(t, 0, n)
+	})
+
+	t.Run("XCLAIM", func(t *testing.T) {
+		res, err := redis.Values(c.Do("XCLAIM", "planets", "processing", "bob", "5000", "0-1"))
+		ok(t, err)
+		equals(t, 0, len(res)) // not idle for long enough
+
+		res, err = redis.Values(c.Do("XCLAIM", "planets", "processing", "bob", "500", "0-1", "0-2", "JUSTID"))
+		ok(t, err)
+		equals(t, []interface{}{[]byte("0-1"), []byte("0-2")}, res)
+
+		res, err = redis.Values(c.Do("XPENDING", "planets", "processing", "-", "+", "10", "bob"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{[]byte("0-1"), []byte("bob"), int64(0), int64(1)},
+			[]interface{}{[]byte("0-2"), []byte("bob"), int64(0), int64(1)},
+		}, res)
+
+		res, err = redis.Values(c.Do("XCLAIM", "planets", "processing", "alice", "0", "0-1", "RETRYCOUNT", "7"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{[]byte("0-1"), []interface{}{[]byte("name"), []byte("Mercury")}},
+		}, res)
+
+		_, err = c.Do("XCLAIM", "planets", "processing", "alice", "foo", "0-1")
+		mustFail(t, err, msgInvalidMinIdle)
+		_, err = c.Do("XCLAIM", "planets", "nosuch", "alice", "0", "0-1")
+		mustFail(t, err, "NOGROUP No such key 'planets' or consumer group 'nosuch'")
+	})
+
+	t.Run("XAUTOCLAIM", func(t *testing.T) {
+		_, err := c.Do("XDEL", "planets", "0-4")
+		ok(t, err)
+
+		res, err := redis.Values(c.Do("XAUTOCLAIM", "planets", "processing", "dave", "0", "0", "COUNT", "1"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]byte("0-2"),
+			[]interface{}{
+				[]interface{}{[]byte("0-1"), []interface{}{[]byte("name"), []byte("Mercury")}},
+			},
+			[]interface{}{},
+		}, res)
+
+		res, err = redis.Values(c.Do("XAUTOCLAIM", "planets", "processing", "dave", "0", "0-2", "JUSTID"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]byte("0-0"),
+			[]interface{}{[]byte("0-2")},
+			[]interface{}{[]byte("0-4")},
+		}, res)
+
+		_, err = c.Do("XAUTOCLAIM", "planets", "processing", "dave", "0", "0", "COUNT", "0")
+		mustFail(t, err, msgXautoclaimCount)
+	})
+
+	t.Run("XINFO", func(t *testing.T) {
+		res, err := redis.Values(c.Do("XINFO", "STREAM", "planets"))
+		ok(t, err)
+		equals(t, 20, len(res))
+		equals(t, []byte("length"), res[0])
+		equals(t, int64(3), res[1])
+		equals(t, []byte("0-4"), res[7])
+
+		res, err = redis.Values(c.Do("XINFO", "GROUPS", "planets"))
+		ok(t, err)
+		equals(t, []interface{}{
+			[]interface{}{
+				[]byte("name"), []byte("processing"),
+				[]byte("consumers"), int64(4),
+				[]byte("pending"), int64(2),
+				[]byte("last-delivered-id"), []byte("0-4"),
+				[]byte("entries-read"), int64(4),
+				[]byte("lag"), int64(0),
+			},
+		}, res)
+
+		res, err = redis.Values(c.Do("XINFO", "CONSUMERS", "planets", "processing"))
+		ok(t, err)
+		equals(t, 4, len(res))
+		equals(t, []interface{}{
+			[]byte("name"), []byte("alice"),
+			[]byte("pending"), int64(0),
+			[]byte("idle"), int64(0),
+			[]byte("inactive"), int64(0),
+		}, res[0])
+
+		_, err = c.Do("XINFO", "STREAM", "nosuch")
+		mustFail(t, err, msgKeyNotFound)
+		_, err = c.Do("XINFO", "FOO", "planets")
+		mustFail(t, err, "ERR Unknown subcommand or wrong number of arguments for 'FOO'. Try XINFO HELP.")
+	})
+
+	t.Run("rename and move", func(t *testing.T) {
+		{
+			v, err := redis.String(c.Do("RENAME", "planets", "planets2"))
+			ok(t, err)
+			equals(t, "OK", v)
+		}
+		n, err := redis.Int(c.Do("MOVE", "planets2", "3"))
+		ok(t, err)
+		equals(t, 1, n)
+		entries, err := s.DB(3).Stream("planets2")
+		ok(t, err)
+		equals(t, 3, len(entries))
+	})
+}
+
+func TestStreamDump(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+
+	s.XAdd("planets", "0-1", []string{"name", "Mercury", "color", "grey"})
+	s.XAdd("planets", "0-2", []string{"name", "Venus"})
+	if have, want := s.Dump(), `- planets
+   0-1
+      "name": "Mercury"
+      "color": "grey"
+   0-2
+      "name": "Venus"
+`; have != want {
+		t.Errorf("have: %q, want: %q", have, want)
+	}
+}
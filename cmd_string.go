@@ -119,8 +119,10 @@ func (m *Miniredis) cmdSet(c *server.Peer, cmd string, args []string) {
 		db.del(key, true) // be sure to remove existing values of other type keys.
 		// a vanilla SET clears the expire
 		db.stringSet(key, value)
+		db.notify(notifyString, "set", key)
 		if ttl != 0 {
-			db.ttl[key] = ttl
+			db.setTTL(key, ttl)
+			db.notify(notifyGeneric, "expire", key)
 		}
 		c.WriteOK()
 	})
@@ -159,7 +161,9 @@ func (m *Miniredis) cmdSetex(c *server.Peer, cmd string, args []string) {
 
 		db.del(key, true) // Clear any existing keys.
 		db.stringSet(key, value)
-		db.ttl[key] = time.Duration(ttl) * time.Second
+		db.setTTL(key, time.Duration(ttl)*time.Second)
+		db.notify(notifyString, "set", key)
+		db.notify(notifyGeneric, "expire", key)
 		c.WriteOK()
 	})
 }
@@ -197,7 +201,9 @@ func (m *Miniredis) cmdPsetex(c *server.Peer, cmd string, args []string) {
 
 		db.del(key, true) // Clear any existing keys.
 		db.stringSet(key, value)
-		db.ttl[key] = time.Duration(ttl) * time.Millisecond
+		db.setTTL(key, time.Duration(ttl)*time.Millisecond)
+		db.notify(notifyString, "set", key)
+		db.notify(notifyGeneric, "expire", key)
 		c.WriteOK()
 	})
 }
@@ -227,6 +233,7 @@ func (m *Miniredis) cmdSetnx(c *server.Peer, cmd string, args []string) {
 		}
 
 		db.stringSet(key, value)
+		db.notify(notifyString, "set", key)
 		c.WriteInt(1)
 	})
 }
@@ -261,6 +268,7 @@ func (m *Miniredis) cmdMset(c *server.Peer, cmd string, args []string) {
 
 			db.del(key, true) // clear TTL
 			db.stringSet(key, value)
+			db.notify(notifyString, "set", key)
 		}
 		c.WriteOK()
 	})
@@ -308,6 +316,7 @@ func (m *Miniredis) cmdMsetnx(c *server.Peer, cmd string, args []string) {
 			for k, v := range keys {
 				// Nothing to delete. That's the whole point.
 				db.stringSet(k, v)
+				db.notify(notifyString, "set", k)
 			}
 		}
 		c.WriteInt(res)
@@ -374,6 +383,7 @@ func (m *Miniredis) cmdGetset(c *server.Peer, cmd string, args []string) {
 		db.stringSet(key, value)
 		// a GETSET clears the ttl
 		delete(db.ttl, key)
+		db.notify(notifyString, "set", key)
 
 		if !ok {
 			c.WriteNull()
@@ -444,6 +454,7 @@ func (m *Miniredis) cmdIncr(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyString, "incrby", key)
 		// Don't touch TTL
 		c.WriteInt(v)
 	})
@@ -484,6 +495,7 @@ func (m *Miniredis) cmdIncrby(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyString, "incrby", key)
 		// Don't touch TTL
 		c.WriteInt(v)
 	})
@@ -524,6 +536,7 @@ func (m *Miniredis) cmdIncrbyfloat(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyString, "incrbyfloat", key)
 		// Don't touch TTL
 		c.WriteBulk(formatFloat(v))
 	})
@@ -556,6 +569,7 @@ func (m *Miniredis) cmdDecr(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyString, "incrby", key)
 		// Don't touch TTL
 		c.WriteInt(v)
 	})
@@ -596,6 +610,7 @@ func (m *Miniredis) cmdDecrby(c *server.Peer, cmd string, args []string) {
 			c.WriteError(err.Error())
 			return
 		}
+		db.notify(notifyString, "incrby", key)
 		// Don't touch TTL
 		c.WriteInt(v)
 	})
@@ -653,8 +668,14 @@ func (m *Miniredis) cmdAppend(c *server.Peer, cmd string, args []string) {
 			return
 		}
 
-		newValue := db.stringKeys[key] + value
-		db.stringSet(key, newValue)
+		old, exists := db.stringKeys[key]
+		newValue := old + value
+		if exists {
+			db.stringSetRaw(key, newValue)
+		} else {
+			db.stringSet(key, newValue)
+		}
+		db.notify(notifyString, "append", key)
 
 		c.WriteInt(len(newValue))
 	})
@@ -744,7 +765,8 @@ func (m *Miniredis) cmdSetrange(c *server.Peer, cmd string, args []string) {
 			v = newV
 		}
 		copy(v[pos:pos+len(subst)], subst)
-		db.stringSet(key, string(v))
+		db.stringSetRaw(key, string(v))
+		db.notify(notifyString, "setrange", key)
 		c.WriteInt(len(v))
 	})
 }
@@ -859,11 +881,16 @@ func (m *Miniredis) cmdBitop(c *server.Peer, cmd string, args []string) {
 				}[op]
 				res = sliceBinOp(cb, res, []byte(v))
 			}
+			existed := db.exists(target)
 			db.del(target, false) // Keep TTL
 			if len(res) == 0 {
 				db.del(target, true)
+				if existed {
+					db.notify(notifyGeneric, "del", target)
+				}
 			} else {
 				db.stringSet(target, string(res))
+				db.notify(notifyString, "set", target)
 			}
 			c.WriteInt(len(res))
 		case "NOT":
@@ -881,11 +908,16 @@ func (m *Miniredis) cmdBitop(c *server.Peer, cmd string, args []string) {
 			for i := range value {
 				value[i] = ^value[i]
 			}
+			existed := db.exists(target)
 			db.del(target, false) // Keep TTL
 			if len(value) == 0 {
 				db.del(target, true)
+				if existed {
+					db.notify(notifyGeneric, "del", target)
+				}
 			} else {
 				db.stringSet(target, string(value))
+				db.notify(notifyString, "set", target)
 			}
 			c.WriteInt(len(value))
 		default:
@@ -1079,7 +1111,8 @@ func (m *Miniredis) cmdSetbit(c *server.Peer, cmd string, args []string) {
 		} else {
 			value[ourByteNr] |= 1 << uint8(7-ourBitNr)
 		}
-		db.stringSet(key, string(value))
+		db.stringSetRaw(key, string(value))
+		db.notify(notifyString, "setbit", key)
 
 		c.WriteInt(old)
 	})
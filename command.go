@@ -0,0 +1,167 @@
+package miniredis
+
+// Custom commands, see RegisterCommand().
+
+import (
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// CommandHandler handles a command added with RegisterCommand(). args are the
+// arguments, without the command name, and db is the selected database. The
+// reply is written with the methods of c, such as c.WriteBulk(), c.WriteInt(),
+// and c.WriteError().
+//
+// Handlers run with miniredis locked, so they must use db, and not the
+// methods of Miniredis or RedisDB, which would deadlock.
+type CommandHandler func(c *server.Peer, db *LockedDB, args []string)
+
+type customCommand struct {
+	arity   int
+	write   bool
+	handler CommandHandler
+}
+
+// RegisterCommand adds a command, or replaces a built-in one. arity is the
+// number of arguments, including the command name, the same as Redis' COMMAND
+// INFO: -N means N or more. 0 means any number. write tells whether the
+// command can change data: successful write commands are appended to the AOF
+// and sent to replicas, which need the same command registered, and replicas
+// reject them from clients. The usual AUTH, pubsub, and MULTI handling is done
+// before the handler runs. Can be called before and after Start().
+func (m *Miniredis) RegisterCommand(name string, arity int, write bool, h CommandHandler) {
+	m.Lock()
+	defer m.Unlock()
+	name = strings.ToUpper(name)
+	cc := customCommand{arity: arity, write: write, handler: h}
+	m.customCommands[name] = cc
+	if m.srv != nil {
+		m.srv.Override(name, m.cmdCustom(cc))
+	}
+}
+
+// commandsCustom registers the commands from RegisterCommand(). They go
+// last, so they override the built-in commands.
+func commandsCustom(m *Miniredis) {
+	for name, cc := range m.customCommands {
+		m.srv.Override(name, m.cmdCustom(cc))
+	}
+}
+
+func (m *Miniredis) cmdCustom(cc customCommand) server.Cmd {
+	return func(c *server.Peer, cmd string, args []string) {
+		if n := len(args) + 1; (cc.arity > 0 && n != cc.arity) || (cc.arity < 0 && n < -cc.arity) {
+			setDirty(c)
+			c.WriteError(errWrongNumber(cmd))
+			return
+		}
+		if !m.handleAuth(c) {
+			return
+		}
+		if m.checkPubsub(c) {
+			return
+		}
+
+		withTx(m, c, func(c *server.Peer, ctx *connCtx) {
+			cc.handler(c, &LockedDB{db: m.db(ctx.selectedDB)}, args)
+		})
+	}
+}
+
+// LockedDB gives access to a database from within a CommandHandler, while
+// miniredis is locked.
+type LockedDB struct {
+	db *RedisDB
+}
+
+// ID is the number of the database.
+func (l *LockedDB) ID() int {
+	return l.db.id
+}
+
+// Keys returns all keys, sorted.
+func (l *LockedDB) Keys() []string {
+	return l.db.allKeys()
+}
+
+// Exists tells whether a key exists.
+func (l *LockedDB) Exists(k string) bool {
+	return l.db.exists(k)
+}
+
+// Type gives the type of a key, or "".
+func (l *LockedDB) Type(k string) string {
+	return l.db.t(k)
+}
+
+// Get returns a string key.
+func (l *LockedDB) Get(k string) (string, error) {
+	if !l.db.exists(k) {
+		return "", ErrKeyNotFound
+	}
+	if l.db.t(k) != "string" {
+		return "", ErrWrongType
+	}
+	return l.db.stringGet(k), nil
+}
+
+// Set sets a string key. Removes expire.
+func (l *LockedDB) Set(k, v string) error {
+	if l.db.exists(k) && l.db.t(k) != "string" {
+		return ErrWrongType
+	}
+	l.db.del(k, true)
+	l.db.stringSet(k, v)
+	l.db.notify(notifyString, "set", k)
+	return nil
+}
+
+// Incr changes a int string value by delta.
+func (l *LockedDB) Incr(k string, delta int) (int, error) {
+	if l.db.exists(k) && l.db.t(k) != "string" {
+		return 0, ErrWrongType
+	}
+	n, err := l.db.stringIncr(k, delta)
+	if err != nil {
+		return 0, err
+	}
+	l.db.notify(notifyString, "incrby", k)
+	return n, nil
+}
+
+// Del deletes a key and any expiration value. Returns whether there was a key.
+func (l *LockedDB) Del(k string) bool {
+	if !l.db.exists(k) {
+		return false
+	}
+	l.db.del(k, true)
+	l.db.notify(notifyGeneric, "del", k)
+	return true
+}
+
+// TTL is the time to live of a key. 0 if not set.
+func (l *LockedDB) TTL(k string) time.Duration {
+	ttl, _ := l.db.ttlLeft(k)
+	return ttl
+}
+
+// SetTTL sets the time to live of a key.
+func (l *LockedDB) SetTTL(k string, ttl time.Duration) {
+	l.db.setTTL(k, ttl)
+	l.db.modified(k)
+	l.db.notify(notifyGeneric, "expire", k)
+}
+
+// HGet returns a field of a hash key, or "".
+func (l *LockedDB) HGet(k, f string) string {
+	return l.db.hashGet(k, f)
+}
+
+// HSet sets a field of a hash key. If there is another key by the same name
+// it will be gone.
+func (l *LockedDB) HSet(k, f, v string) {
+	l.db.hashSet(k, f, v)
+	l.db.notify(notifyHash, "hset", k)
+}
@@ -0,0 +1,148 @@
+package miniredis
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestRegisterCommand(t *testing.T) {
+	s := NewMiniRedis()
+	// a simple rate limiter: RATELIMIT key max seconds
+	s.RegisterCommand("ratelimit", 4, true, func(c *server.Peer, db *LockedDB, args []string) {
+		max, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.WriteError(msgInvalidInt)
+			return
+		}
+		secs, err := strconv.Atoi(args[2])
+		if err != nil {
+			c.WriteError(msgInvalidInt)
+			return
+		}
+		n, err := db.Incr(args[0], 1)
+		if err != nil {
+			c.WriteError(err.Error())
+			return
+		}
+		if n == 1 {
+			db.SetTTL(args[0], time.Duration(secs)*time.Second)
+		}
+		c.WriteBool(n <= max)
+	})
+	ok(t, s.Start())
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("basic", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			v, err := redis.Bool(c.Do("RATELIMIT", "user:1", 2, 10))
+			ok(t, err)
+			equals(t, true, v)
+		}
+		v, err := redis.Bool(c.Do("RATELIMIT", "user:1", 2, 10))
+		ok(t, err)
+		equals(t, false, v)
+		equals(t, 10*time.Second, s.TTL("user:1"))
+
+		s.FastForward(10 * time.Second)
+		v, err = redis.Bool(c.Do("ratelimit", "user:1", 2, 10))
+		ok(t, err)
+		equals(t, true, v)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("RATELIMIT", "user:1", 2)
+		mustFail(t, err, "ERR wrong number of arguments for 'ratelimit' command")
+		_, err = c.Do("RATELIMIT", "user:1", "foo", 10)
+		mustFail(t, err, msgInvalidInt)
+		s.HSet("hash", "aap", "noot")
+		_, err = c.Do("RATELIMIT", "hash", 2, 10)
+		mustFail(t, err, msgWrongType)
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		_, err := c.Do("MULTI")
+		ok(t, err)
+		v, err := redis.String(c.Do("RATELIMIT", "user:2", 2, 10))
+		ok(t, err)
+		equals(t, "QUEUED", v)
+		vs, err := redis.Values(c.Do("EXEC"))
+		ok(t, err)
+		equals(t, []interface{}{int64(1)}, vs)
+
+		_, err = c.Do("MULTI")
+		ok(t, err)
+		_, err = c.Do("RATELIMIT", "user:2")
+		mustFail(t, err, "ERR wrong number of arguments for 'ratelimit' command")
+		_, err = c.Do("EXEC")
+		mustFail(t, err, "EXECABORT Transaction discarded because of previous errors.")
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		s.RequireAuth("secret")
+		defer s.RequireAuth("")
+		c, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c.Close()
+		_, err = c.Do("RATELIMIT", "user:3", 2, 10)
+		mustFail(t, err, "NOAUTH Authentication required.")
+	})
+
+	t.Run("write", func(t *testing.T) {
+		var buf bytes.Buffer
+		s.SetAOF(&buf)
+		defer s.SetAOF(nil)
+		sub, err := redis.Dial("tcp", s.Addr(), redis.DialReadTimeout(time.Second))
+		ok(t, err)
+		defer sub.Close()
+		ok(t, s.SetNotifyKeyspaceEvents("KEA"))
+		defer s.SetNotifyKeyspaceEvents("")
+		_, err = sub.Do("SUBSCRIBE", "__keyspace@0__:user:4")
+		ok(t, err)
+
+		_, err = c.Do("RATELIMIT", "user:4", 2, 10)
+		ok(t, err)
+		equals(t, "*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n*4\r\n$9\r\nRATELIMIT\r\n$6\r\nuser:4\r\n$1\r\n2\r\n$2\r\n10\r\n", buf.String())
+		for _, event := range []string{"incrby", "expire"} {
+			msg, err := redis.Strings(sub.Receive())
+			ok(t, err)
+			equals(t, []string{"message", "__keyspace@0__:user:4", event}, msg)
+		}
+
+		replica := NewMiniRedis()
+		replica.RegisterCommand("ratelimit", 4, true, func(c *server.Peer, db *LockedDB, args []string) {
+			c.WriteBool(true)
+		})
+		ok(t, replica.Start())
+		defer replica.Close()
+		ok(t, replica.ReplicaOf(s))
+		rc, err := redis.Dial("tcp", replica.Addr())
+		ok(t, err)
+		defer rc.Close()
+		_, err = rc.Do("ratelimit", "user:4", 2, 10)
+		mustFail(t, err, msgReadonly)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		s.Set("foo", "bar")
+		s.RegisterCommand("GET", 2, false, func(c *server.Peer, db *LockedDB, args []string) {
+			v, err := db.Get(args[0])
+			if err != nil {
+				c.WriteNull()
+				return
+			}
+			c.WriteBulk("overridden " + v)
+		})
+		v, err := redis.String(c.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "overridden bar", v)
+	})
+}
@@ -0,0 +1,365 @@
+package miniredis
+
+// CONFIG parameters. Only parameters which miniredis honors are supported.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	redisDatabases          = 16 // what "databases" reports without a limit
+	defaultMaxmemoryPolicy  = "noeviction"
+	defaultMaxmemorySamples = 5
+	defaultDBFilename       = "dump.rdb"
+	defaultAOFFilename      = "appendonly.aof"
+	minProtoMaxBulkLen      = 1024 * 1024
+)
+
+// maxmemoryPolicies are all valid maxmemory-policy values.
+var maxmemoryPolicies = []string{
+	"volatile-lru",
+	"volatile-lfu",
+	"volatile-random",
+	"volatile-ttl",
+	"allkeys-lru",
+	"allkeys-lfu",
+	"allkeys-random",
+	"noeviction",
+}
+
+var errImmutableConfig = errors.New("can't set immutable config")
+
+// configParam is a single CONFIG parameter. set() validates the value and
+// applies it right away, without evicting anything. Immutable parameters have
+// no set(). Both need the lock.
+type configParam struct {
+	get func(m *Miniredis) string
+	set func(m *Miniredis, v string) error
+}
+
+// configParams are all parameters, by name.
+var configParams = map[string]configParam{
+	"appendfilename": {
+		get: func(m *Miniredis) string { return m.aofFilename },
+		set: func(m *Miniredis, v string) error {
+			if v == "" || strings.ContainsAny(v, `/\`) {
+				return errors.New("appendfilename can't be a path, just a filename")
+			}
+			m.aofFilename = v
+			return nil
+		},
+	},
+	"appendonly": {
+		get: func(m *Miniredis) string { return yesNo(m.aof != nil) },
+		set: func(m *Miniredis, v string) error {
+			on, err := parseYesNo(v)
+			if err != nil {
+				return err
+			}
+			if on == (m.aof != nil) {
+				return nil
+			}
+			if !on {
+				m.closeAOF()
+				return nil
+			}
+			return m.openAOFFile(filepath.Join(m.configDir(), m.aofFilename))
+		},
+	},
+	"databases": {
+		get: func(m *Miniredis) string {
+			if m.databases == 0 {
+				return strconv.Itoa(redisDatabases)
+			}
+			return strconv.Itoa(m.databases)
+		},
+	},
+	"dbfilename": {
+		get: func(m *Miniredis) string { return m.dbFilename },
+		set: func(m *Miniredis, v string) error {
+			if v == "" || strings.ContainsAny(v, `/\`) {
+				return errors.New("dbfilename can't be a path, just a filename")
+			}
+			m.dbFilename = v
+			return nil
+		},
+	},
+	"dir": {
+		get: func(m *Miniredis) string { return m.configDir() },
+		set: func(m *Miniredis, v string) error {
+			st, err := os.Stat(v)
+			if err != nil {
+				return errors.New("No such file or directory")
+			}
+			if !st.IsDir() {
+				return errors.New("Not a directory")
+			}
+			m.dir = v
+			return nil
+		},
+	},
+	"hash-max-listpack-entries": encodingParam(func(e *encodingConfig) *int { return &e.hashMaxListpackEntries }, 0),
+	"hash-max-listpack-value":   encodingParam(func(e *encodingConfig) *int { return &e.hashMaxListpackValue }, 0),
+	"list-max-listpack-size":    encodingParam(func(e *encodingConfig) *int { return &e.listMaxListpackSize }, math.MinInt32),
+	"maxmemory": {
+		get: func(m *Miniredis) string { return strconv.FormatUint(m.maxmemory, 10) },
+		set: func(m *Miniredis, v string) error {
+			n, err := parseMemory(v)
+			if err != nil {
+				return err
+			}
+			m.maxmemory = n
+			return nil
+		},
+	},
+	"maxmemory-policy": {
+		get: func(m *Miniredis) string { return m.maxmemoryPolicy },
+		set: func(m *Miniredis, v string) error {
+			v = strings.ToLower(v)
+			for _, p := range maxmemoryPolicies {
+				if p == v {
+					m.maxmemoryPolicy = v
+					return nil
+				}
+			}
+			return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(maxmemoryPolicies, ", "))
+		},
+	},
+	"maxmemory-samples": {
+		get: func(m *Miniredis) string { return strconv.Itoa(m.maxmemorySamples) },
+		set: func(m *Miniredis, v string) error {
+			n, err := parseIntParam(v, 1, 64)
+			if err != nil {
+				return err
+			}
+			m.maxmemorySamples = n
+			return nil
+		},
+	},
+	"notify-keyspace-events": {
+		get: func(m *Miniredis) string { return notifyFlagsString(m.notifyEvents) },
+		set: func(m *Miniredis, v string) error {
+			f, err := parseNotifyFlags(v)
+			if err != nil {
+				return err
+			}
+			m.notifyEvents = f
+			return nil
+		},
+	},
+	"proto-max-bulk-len": {
+		get: func(m *Miniredis) string { return strconv.Itoa(m.protoMaxBulkLen) },
+		set: func(m *Miniredis, v string) error {
+			n, err := parseMemory(v)
+			if err != nil {
+				return err
+			}
+			if n < minProtoMaxBulkLen || n > math.MaxInt32 {
+				return fmt.Errorf("argument must be between %d and %d inclusive", minProtoMaxBulkLen, math.MaxInt32)
+			}
+			m.protoMaxBulkLen = int(n)
+			if m.srv != nil {
+				m.srv.SetMaxBulkLen(m.protoMaxBulkLen)
+			}
+			return nil
+		},
+	},
+	"requirepass": {
+		get: func(m *Miniredis) string { return m.password },
+		set: func(m *Miniredis, v string) error {
+			m.password = v
+			m.users["default"].setPassword(v)
+			return nil
+		},
+	},
+	"set-max-intset-entries":   encodingParam(func(e *encodingConfig) *int { return &e.setMaxIntsetEntries }, 0),
+	"set-max-listpack-entries": encodingParam(func(e *encodingConfig) *int { return &e.setMaxListpackEntries }, 0),
+	"set-max-listpack-value":   encodingParam(func(e *encodingConfig) *int { return &e.setMaxListpackValue }, 0),
+	"unixsocket": {
+		get: func(m *Miniredis) string { return m.unixSocket },
+	},
+	"zset-max-listpack-entries": encodingParam(func(e *encodingConfig) *int { return &e.zsetMaxListpackEntries }, 0),
+	"zset-max-listpack-value":   encodingParam(func(e *encodingConfig) *int { return &e.zsetMaxListpackValue }, 0),
+}
+
+// encodingParam is an integer parameter for OBJECT ENCODING, such as
+// "hash-max-listpack-entries".
+func encodingParam(field func(*encodingConfig) *int, min int) configParam {
+	return configParam{
+		get: func(m *Miniredis) string { return strconv.Itoa(*field(&m.encoding)) },
+		set: func(m *Miniredis, v string) error {
+			n, err := parseIntParam(v, min, math.MaxInt32)
+			if err != nil {
+				return err
+			}
+			*field(&m.encoding) = n
+			return nil
+		},
+	}
+}
+
+// configGet returns all parameter names matching any of the patterns, sorted,
+// with their values.
+func (m *Miniredis) configGet(patterns []string) []string {
+	var names []string
+	for name := range configParams {
+		for _, pat := range patterns {
+			if re := patternRE(strings.ToLower(pat)); re != nil && re.MatchString(name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	var res []string
+	for _, name := range names {
+		res = append(res, name, configParams[name].get(m))
+	}
+	return res
+}
+
+// configSet sets all name/value pairs. If a value is invalid all changes are
+// undone. Keys are only evicted, for a lower maxmemory, once all values are
+// set. Returns the Redis error, if any.
+func (m *Miniredis) configSet(args []string) string {
+	var (
+		seen = map[string]bool{}
+		old  []string // name/value pairs to restore
+	)
+	for i := 0; i+1 < len(args); i += 2 {
+		name := strings.ToLower(args[i])
+		if _, ok := configParams[name]; !ok {
+			return fmt.Sprintf(msgFConfigSetUnknown, args[i])
+		}
+		if seen[name] {
+			return fmt.Sprintf(msgFConfigSetFailed, args[i], "duplicate parameter")
+		}
+		seen[name] = true
+		if configParams[name].set == nil {
+			return fmt.Sprintf(msgFConfigSetFailed, args[i], errImmutableConfig.Error())
+		}
+	}
+
+	for i := 0; i+1 < len(args); i += 2 {
+		p := configParams[strings.ToLower(args[i])]
+		prev := p.get(m)
+		if err := p.set(m, args[i+1]); err != nil {
+			for j := len(old) - 2; j >= 0; j -= 2 {
+				configParams[old[j]].set(m, old[j+1])
+			}
+			return fmt.Sprintf(msgFConfigSetFailed, args[i], err.Error())
+		}
+		old = append(old, strings.ToLower(args[i]), prev)
+	}
+	m.freeMemory()
+	return ""
+}
+
+// configDir is the "dir" parameter. Defaults to the working directory.
+func (m *Miniredis) configDir() string {
+	if m.dir != "" {
+		return m.dir
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// rdbPath is the file SAVE writes to.
+func (m *Miniredis) rdbPath() string {
+	return filepath.Join(m.dir, m.dbFilename)
+}
+
+// configResetStat resets the counters INFO reports.
+func (m *Miniredis) configResetStat() {
+	if m.srv != nil {
+		m.srv.ResetStats()
+	}
+	m.expiredKeys = 0
+	m.evictedKeys = 0
+}
+
+// SetDatabases sets the number of databases SELECT, MOVE, and SWAPDB accept,
+// the same as the "databases" config parameter. The default, 0, is no limit.
+// DB() never has a limit.
+func (m *Miniredis) SetDatabases(n int) {
+	m.Lock()
+	defer m.Unlock()
+	m.databases = n
+}
+
+// SetMaxmemorySamples sets the "maxmemory-samples" config parameter.
+func (m *Miniredis) SetMaxmemorySamples(n int) error {
+	m.Lock()
+	defer m.Unlock()
+	return configParams["maxmemory-samples"].set(m, strconv.Itoa(n))
+}
+
+// validDB is true if id is a valid DB index for commands.
+func (m *Miniredis) validDB(id int) bool {
+	return id >= 0 && (m.databases == 0 || id < m.databases)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func parseYesNo(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return false, errors.New("argument must be 'yes' or 'no'")
+	}
+}
+
+func parseIntParam(v string, min, max int) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New("argument couldn't be parsed into an integer")
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("argument must be between %d and %d inclusive", min, max)
+	}
+	return n, nil
+}
+
+// parseMemory parses a memory value such as "100mb", the same way redis.conf
+// does.
+func parseMemory(v string) (uint64, error) {
+	units := []struct {
+		suffix string
+		mul    uint64
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"gb", 1024 * 1024 * 1024},
+		{"k", 1000},
+		{"m", 1000 * 1000},
+		{"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	s, mul := strings.ToLower(v), uint64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mul = strings.TrimSuffix(s, u.suffix), u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * mul, nil
+}
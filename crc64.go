@@ -0,0 +1,15 @@
+package miniredis
+
+import (
+	"hash/crc64"
+)
+
+// crc64Table is the "Jones" polynomial Redis uses for RDB files and DUMP
+// payloads, in reversed form.
+var crc64Table = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// crc64Update is Redis' crc64(). Go's crc64 inverts the CRC before and after,
+// Redis doesn't.
+func crc64Update(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crc64Table, p)
+}
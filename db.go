@@ -34,7 +34,11 @@ func (db *RedisDB) flush() {
 	db.listKeys = map[string]listKey{}
 	db.setKeys = map[string]setKey{}
 	db.sortedsetKeys = map[string]sortedSet{}
-	db.ttl = map[string]time.Duration{}
+	db.streamKeys = map[string]*streamKey{}
+	db.ttl = map[string]time.Time{}
+	db.access = map[string]*keyAccess{}
+	db.rawStrings = map[string]struct{}{}
+	db.mem = newDBMemory()
 }
 
 // move something to another db. Will return ok. Or not.
@@ -59,13 +63,21 @@ func (db *RedisDB) move(key string, to *RedisDB) bool {
 		to.setKeys[key] = db.setKeys[key]
 	case "zset":
 		to.sortedsetKeys[key] = db.sortedsetKeys[key]
+	case "stream":
+		to.streamKeys[key] = db.streamKeys[key]
 	default:
 		panic("unhandled key type")
 	}
-	to.keyVersion[key]++
+	to.modified(key)
 	if v, ok := db.ttl[key]; ok {
 		to.ttl[key] = v
 	}
+	if a, ok := db.access[key]; ok {
+		to.access[key] = a
+	}
+	if _, ok := db.rawStrings[key]; ok {
+		to.rawStrings[key] = struct{}{}
+	}
 	db.del(key, true)
 	return true
 }
@@ -83,16 +95,32 @@ func (db *RedisDB) rename(from, to string) {
 		db.setKeys[to] = db.setKeys[from]
 	case "zset":
 		db.sortedsetKeys[to] = db.sortedsetKeys[from]
+	case "stream":
+		db.streamKeys[to] = db.streamKeys[from]
 	default:
 		panic("missing case")
 	}
 	db.keys[to] = db.keys[from]
-	db.keyVersion[to]++
+	db.modified(to)
 	if v, ok := db.ttl[from]; ok {
 		db.ttl[to] = v
 	}
+	a, hasAccess := db.access[from]
+	_, raw := db.rawStrings[from]
 
 	db.del(from, true)
+	if hasAccess {
+		db.access[to] = a
+	}
+	if raw {
+		db.rawStrings[to] = struct{}{}
+	}
+}
+
+// modified marks a key as changed, for WATCH and for the memory estimate.
+func (db *RedisDB) modified(k string) {
+	db.keyVersion[k]++
+	db.mem.stale[k] = struct{}{}
 }
 
 func (db *RedisDB) del(k string, delTTL bool) {
@@ -101,10 +129,12 @@ func (db *RedisDB) del(k string, delTTL bool) {
 	}
 	t := db.t(k)
 	delete(db.keys, k)
-	db.keyVersion[k]++
+	db.modified(k)
 	if delTTL {
 		delete(db.ttl, k)
 	}
+	delete(db.access, k)
+	delete(db.rawStrings, k)
 	switch t {
 	case "string":
 		delete(db.stringKeys, k)
@@ -116,6 +146,8 @@ func (db *RedisDB) del(k string, delTTL bool) {
 		delete(db.setKeys, k)
 	case "zset":
 		delete(db.sortedsetKeys, k)
+	case "stream":
+		delete(db.streamKeys, k)
 	default:
 		panic("Unknown key type: " + t)
 	}
@@ -134,7 +166,14 @@ func (db *RedisDB) stringSet(k, v string) {
 	db.del(k, false)
 	db.keys[k] = "string"
 	db.stringKeys[k] = v
-	db.keyVersion[k]++
+	db.modified(k)
+}
+
+// stringSetRaw is stringSet() for a string changed in place, such as with
+// APPEND. Redis doesn't give those a compact encoding anymore.
+func (db *RedisDB) stringSetRaw(k, v string) {
+	db.stringSet(k, v)
+	db.rawStrings[k] = struct{}{}
 }
 
 // change int key value
@@ -175,7 +214,7 @@ func (db *RedisDB) listLpush(k, v string) int {
 	}
 	l = append([]string{v}, l...)
 	db.listKeys[k] = l
-	db.keyVersion[k]++
+	db.modified(k)
 	return len(l)
 }
 
@@ -189,7 +228,7 @@ func (db *RedisDB) listLpop(k string) string {
 	} else {
 		db.listKeys[k] = l
 	}
-	db.keyVersion[k]++
+	db.modified(k)
 	return el
 }
 
@@ -200,7 +239,7 @@ func (db *RedisDB) listPush(k string, v ...string) int {
 	}
 	l = append(l, v...)
 	db.listKeys[k] = l
-	db.keyVersion[k]++
+	db.modified(k)
 	return len(l)
 }
 
@@ -212,7 +251,7 @@ func (db *RedisDB) listPop(k string) string {
 		db.del(k, true)
 	} else {
 		db.listKeys[k] = l
-		db.keyVersion[k]++
+		db.modified(k)
 	}
 	return el
 }
@@ -221,7 +260,7 @@ func (db *RedisDB) listPop(k string) string {
 func (db *RedisDB) setSet(k string, set setKey) {
 	db.keys[k] = "set"
 	db.setKeys[k] = set
-	db.keyVersion[k]++
+	db.modified(k)
 }
 
 // setadd adds members to a set. Returns nr of new keys.
@@ -239,7 +278,7 @@ func (db *RedisDB) setAdd(k string, elems ...string) int {
 		s[e] = struct{}{}
 	}
 	db.setKeys[k] = s
-	db.keyVersion[k]++
+	db.modified(k)
 	return added
 }
 
@@ -261,7 +300,7 @@ func (db *RedisDB) setRem(k string, fields ...string) int {
 	} else {
 		db.setKeys[k] = s
 	}
-	db.keyVersion[k]++
+	db.modified(k)
 	return removed
 }
 
@@ -313,7 +352,7 @@ func (db *RedisDB) hashSet(k, f, v string) bool {
 	}
 	_, ok := db.hashKeys[k][f]
 	db.hashKeys[k][f] = v
-	db.keyVersion[k]++
+	db.modified(k)
 	return ok
 }
 
@@ -360,7 +399,7 @@ func (db *RedisDB) sortedSet(key string) map[string]float64 {
 // ssetSet sets a complete sorted set.
 func (db *RedisDB) ssetSet(key string, sset sortedSet) {
 	db.keys[key] = "zset"
-	db.keyVersion[key]++
+	db.modified(key)
 	db.sortedsetKeys[key] = sset
 }
 
@@ -374,7 +413,7 @@ func (db *RedisDB) ssetAdd(key string, score float64, member string) bool {
 	_, ok = ss[member]
 	ss[member] = score
 	db.sortedsetKeys[key] = ss
-	db.keyVersion[key]++
+	db.modified(key)
 	return !ok
 }
 
@@ -422,13 +461,16 @@ func (db *RedisDB) ssetScore(key, member string) float64 {
 // ssetRem is sorted set key delete.
 func (db *RedisDB) ssetRem(key, member string) bool {
 	ss := db.sortedsetKeys[key]
-	_, ok := ss[member]
+	if _, ok := ss[member]; !ok {
+		return false
+	}
 	delete(ss, member)
+	db.modified(key)
 	if len(ss) == 0 {
 		// Delete key on removal of last member
 		db.del(key, true)
 	}
-	return ok
+	return true
 }
 
 // ssetExists tells if a member exists in a sorted set.
@@ -450,10 +492,169 @@ func (db *RedisDB) ssetIncrby(k, m string, delta float64) float64 {
 	v, _ := ss.get(m)
 	v += delta
 	ss.set(v, m)
-	db.keyVersion[k]++
+	db.modified(k)
 	return v
 }
 
+// streamCreate makes a new, empty, stream.
+func (db *RedisDB) streamCreate(key string) *streamKey {
+	s := newStreamKey()
+	db.keys[key] = "stream"
+	db.streamKeys[key] = s
+	db.modified(key)
+	return s
+}
+
+// streamAdd adds an entry to a stream, creating the stream if needed. id can
+// be "*". Returns the new ID.
+func (db *RedisDB) streamAdd(key, id string, values []string) (string, error) {
+	s, ok := db.streamKeys[key]
+	if !ok {
+		s = newStreamKey()
+	}
+	sid, err := s.generateID(db.master.effectiveNow(), id)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		db.keys[key] = "stream"
+		db.streamKeys[key] = s
+	}
+	s.add(sid, values)
+	db.modified(key)
+	return sid.String(), nil
+}
+
+// hllGet returns the HyperLogLog stored at key, or nil if there is no such
+// key.
+func (db *RedisDB) hllGet(key string) (hyperLogLog, error) {
+	if !db.exists(key) {
+		return nil, nil
+	}
+	if db.t(key) != "string" {
+		return nil, ErrWrongType
+	}
+	v := db.stringKeys[key]
+	if !isHyperLogLog(v) {
+		return nil, errNotValidHll
+	}
+	return hyperLogLog(v), nil
+}
+
+// hllAdd implements PFADD. Returns 1 if the HLL changed.
+func (db *RedisDB) hllAdd(key string, elems []string) (int, error) {
+	h, err := db.hllGet(key)
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	if h == nil {
+		h = newHyperLogLog()
+		updated++
+	}
+	for _, e := range elems {
+		switch h.add(e) {
+		case 1:
+			updated++
+		case -1:
+			return 0, errInvalidHll
+		}
+	}
+	if updated == 0 {
+		return 0, nil
+	}
+	h.invalidateCache()
+	db.stringSet(key, string(h))
+	return 1, nil
+}
+
+// hllCount implements PFCOUNT.
+func (db *RedisDB) hllCount(keys []string) (int, error) {
+	if len(keys) == 1 {
+		key := keys[0]
+		h, err := db.hllGet(key)
+		if err != nil {
+			return 0, err
+		}
+		if h == nil {
+			return 0, nil
+		}
+		if h.validCache() {
+			return int(h.cachedCard()), nil
+		}
+		card, ok := h.count()
+		if !ok {
+			return 0, errInvalidHll
+		}
+		h.setCachedCard(card)
+		db.stringSet(key, string(h))
+		return int(card), nil
+	}
+
+	max := make([]uint8, hllRegisters)
+	for _, key := range keys {
+		h, err := db.hllGet(key)
+		if err != nil {
+			return 0, err
+		}
+		if h == nil {
+			continue
+		}
+		if !h.merge(max) {
+			return 0, errInvalidHll
+		}
+	}
+	return int(hllCountRaw(max)), nil
+}
+
+// hllMerge implements PFMERGE. The destination key is merged as well.
+func (db *RedisDB) hllMerge(dest string, keys []string) error {
+	var (
+		max      = make([]uint8, hllRegisters)
+		useDense = false
+	)
+	for _, key := range append([]string{dest}, keys...) {
+		h, err := db.hllGet(key)
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			continue
+		}
+		if h.encoding() == hllDense {
+			useDense = true
+		}
+		if !h.merge(max) {
+			return errInvalidHll
+		}
+	}
+
+	h, _ := db.hllGet(dest)
+	if h == nil {
+		h = newHyperLogLog()
+	}
+	if useDense && !h.toDense() {
+		return errInvalidHll
+	}
+	for i, v := range max {
+		if v == 0 {
+			continue
+		}
+		var r int
+		if h.encoding() == hllDense {
+			r = denseSet(h[hllHdrSize:], i, v)
+		} else {
+			r = h.sparseSet(i, v)
+		}
+		if r == -1 {
+			return errInvalidHll
+		}
+	}
+	h.invalidateCache()
+	db.stringSet(dest, string(h))
+	return nil
+}
+
 // setDiff implements the logic behind SDIFF*
 func (db *RedisDB) setDiff(keys []string) (setKey, error) {
 	key := keys[0]
@@ -536,18 +737,68 @@ func (db *RedisDB) setUnion(keys []string) (setKey, error) {
 	return s, nil
 }
 
-// fastForward proceeds the current timestamp with duration, works as a time machine
+// fastForward moves all TTL deadlines closer by duration, works as a time
+// machine. Doesn't expire anything, see expireKeys().
 func (db *RedisDB) fastForward(duration time.Duration) {
-	for _, key := range db.allKeys() {
-		if value, ok := db.ttl[key]; ok {
-			db.ttl[key] = value - duration
-			db.checkTTL(key)
+	for key, dl := range db.ttl {
+		db.ttl[key] = dl.Add(-duration)
+	}
+	for _, a := range db.access {
+		a.at = a.at.Add(-duration)
+		a.decay = a.decay.Add(-duration)
+	}
+}
+
+// setTTL makes a key expire after d.
+func (db *RedisDB) setTTL(key string, d time.Duration) {
+	db.ttl[key] = db.master.ttlNow().Add(d)
+	db.mem.stale[key] = struct{}{}
+}
+
+// ttlLeft gives the time to live of a key, and whether it has a TTL at all.
+func (db *RedisDB) ttlLeft(key string) (time.Duration, bool) {
+	dl, ok := db.ttl[key]
+	if !ok {
+		return 0, false
+	}
+	return dl.Sub(db.master.ttlNow()), true
+}
+
+// expireKeys removes all keys with a TTL <= 0.
+func (db *RedisDB) expireKeys() {
+	var (
+		now     = db.master.ttlNow()
+		expired []string
+	)
+	for key, dl := range db.ttl {
+		if !dl.After(now) && db.exists(key) {
+			expired = append(expired, key)
 		}
 	}
+	sort.Strings(expired) // deterministic notifications
+	for _, key := range expired {
+		db.expire(key)
+	}
 }
 
-func (db *RedisDB) checkTTL(key string) {
-	if v, ok := db.ttl[key]; ok && v <= 0 {
-		db.del(key, true)
+// expireKey removes a key if its TTL is <= 0. Used when a key is accessed.
+// Without a clock TTLs only run out with FastForward(), which expires keys
+// itself.
+func (db *RedisDB) expireKey(key string) {
+	if db.master.clock == nil {
+		return
+	}
+	dl, ok := db.ttl[key]
+	if ok && !dl.After(db.master.ttlNow()) && db.exists(key) {
+		db.expire(key)
 	}
 }
+
+// expire removes a key because its TTL is over. The AOF and the replicas get
+// a DEL.
+func (db *RedisDB) expire(key string) {
+	db.del(key, true)
+	db.notify(notifyExpired, "expired", key)
+	db.master.expiredKeys++
+	db.master.written(db.id, "DEL", []string{key}, nil)
+}
@@ -37,6 +37,9 @@ func (m *Miniredis) Keys() []string {
 func (db *RedisDB) Keys() []string {
 	db.master.Lock()
 	defer db.master.Unlock()
+	if db.master.clock != nil {
+		db.expireKeys()
+	}
 
 	return db.allKeys()
 }
@@ -79,6 +82,7 @@ func (m *Miniredis) Get(k string) (string, error) {
 func (db *RedisDB) Get(k string) (string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return "", ErrKeyNotFound
@@ -99,6 +103,7 @@ func (m *Miniredis) Set(k, v string) error {
 func (db *RedisDB) Set(k, v string) error {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "string" {
@@ -118,6 +123,7 @@ func (m *Miniredis) Incr(k string, delta int) (int, error) {
 func (db *RedisDB) Incr(k string, delta int) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "string" {
@@ -142,6 +148,7 @@ func (m *Miniredis) Incrfloat(k string, delta float64) (float64, error) {
 func (db *RedisDB) Incrfloat(k string, delta float64) (float64, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "string" {
@@ -164,6 +171,7 @@ func (m *Miniredis) List(k string) ([]string, error) {
 func (db *RedisDB) List(k string) ([]string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return nil, ErrKeyNotFound
@@ -183,6 +191,7 @@ func (m *Miniredis) Lpush(k, v string) (int, error) {
 func (db *RedisDB) Lpush(k, v string) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "list" {
@@ -200,6 +209,7 @@ func (m *Miniredis) Lpop(k string) (string, error) {
 func (db *RedisDB) Lpop(k string) (string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if !db.exists(k) {
@@ -226,6 +236,7 @@ func (m *Miniredis) Push(k string, v ...string) (int, error) {
 func (db *RedisDB) Push(k string, v ...string) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "list" {
@@ -248,6 +259,7 @@ func (m *Miniredis) Pop(k string) (string, error) {
 func (db *RedisDB) Pop(k string) (string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if !db.exists(k) {
@@ -275,6 +287,7 @@ func (m *Miniredis) SetAdd(k string, elems ...string) (int, error) {
 func (db *RedisDB) SetAdd(k string, elems ...string) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "set" {
@@ -298,6 +311,7 @@ func (m *Miniredis) Members(k string) ([]string, error) {
 func (db *RedisDB) Members(k string) ([]string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return nil, ErrKeyNotFound
@@ -323,6 +337,7 @@ func (m *Miniredis) IsMember(k, v string) (bool, error) {
 func (db *RedisDB) IsMember(k, v string) (bool, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return false, ErrKeyNotFound
@@ -342,6 +357,7 @@ func (m *Miniredis) HKeys(k string) ([]string, error) {
 func (db *RedisDB) HKeys(key string) ([]string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(key)
 
 	if !db.exists(key) {
 		return nil, ErrKeyNotFound
@@ -361,6 +377,7 @@ func (m *Miniredis) Del(k string) bool {
 func (db *RedisDB) Del(k string) bool {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if !db.exists(k) {
@@ -396,8 +413,10 @@ func (m *Miniredis) TTL(k string) time.Duration {
 func (db *RedisDB) TTL(k string) time.Duration {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
-	return db.ttl[k]
+	ttl, _ := db.ttlLeft(k)
+	return ttl
 }
 
 // SetTTL sets the TTL of a key.
@@ -409,10 +428,11 @@ func (m *Miniredis) SetTTL(k string, ttl time.Duration) {
 func (db *RedisDB) SetTTL(k string, ttl time.Duration) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
-	db.ttl[k] = ttl
-	db.keyVersion[k]++
+	db.setTTL(k, ttl)
+	db.modified(k)
 }
 
 // Type gives the type of a key, or ""
@@ -424,6 +444,7 @@ func (m *Miniredis) Type(k string) string {
 func (db *RedisDB) Type(k string) string {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	return db.t(k)
 }
@@ -437,6 +458,7 @@ func (m *Miniredis) Exists(k string) bool {
 func (db *RedisDB) Exists(k string) bool {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	return db.exists(k)
 }
@@ -454,6 +476,7 @@ func (m *Miniredis) HGet(k, f string) string {
 func (db *RedisDB) HGet(k, f string) string {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	h, ok := db.hashKeys[k]
 	if !ok {
@@ -473,6 +496,7 @@ func (m *Miniredis) HSet(k, f, v string) {
 func (db *RedisDB) HSet(k, f, v string) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	db.hashSet(k, f, v)
@@ -487,6 +511,7 @@ func (m *Miniredis) HDel(k, f string) {
 func (db *RedisDB) HDel(k, f string) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	db.hdel(k, f)
@@ -497,7 +522,10 @@ func (db *RedisDB) hdel(k, f string) {
 		return
 	}
 	delete(db.hashKeys[k], f)
-	db.keyVersion[k]++
+	db.modified(k)
+	if len(db.hashKeys[k]) == 0 {
+		db.del(k, true)
+	}
 }
 
 // HIncrBy increases the integer value of a hash field by delta (int).
@@ -514,6 +542,7 @@ func (m *Miniredis) HIncr(k, f string, delta int) (int, error) {
 func (db *RedisDB) HIncr(k, f string, delta int) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	return db.hashIncr(k, f, delta)
@@ -533,6 +562,7 @@ func (m *Miniredis) HIncrfloat(k, f string, delta float64) (float64, error) {
 func (db *RedisDB) HIncrfloat(k, f string, delta float64) (float64, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	return db.hashIncrfloat(k, f, delta)
@@ -547,6 +577,7 @@ func (m *Miniredis) SRem(k string, fields ...string) (int, error) {
 func (db *RedisDB) SRem(k string, fields ...string) (int, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if !db.exists(k) {
@@ -567,6 +598,7 @@ func (m *Miniredis) ZAdd(k string, score float64, member string) (bool, error) {
 func (db *RedisDB) ZAdd(k string, score float64, member string) (bool, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if db.exists(k) && db.t(k) != "zset" {
@@ -584,6 +616,7 @@ func (m *Miniredis) ZMembers(k string) ([]string, error) {
 func (db *RedisDB) ZMembers(k string) ([]string, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return nil, ErrKeyNotFound
@@ -603,6 +636,7 @@ func (m *Miniredis) SortedSet(k string) (map[string]float64, error) {
 func (db *RedisDB) SortedSet(k string) (map[string]float64, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return nil, ErrKeyNotFound
@@ -622,6 +656,7 @@ func (m *Miniredis) ZRem(k, member string) (bool, error) {
 func (db *RedisDB) ZRem(k, member string) (bool, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 	defer db.master.signal.Broadcast()
 
 	if !db.exists(k) {
@@ -642,6 +677,7 @@ func (m *Miniredis) ZScore(k, member string) (float64, error) {
 func (db *RedisDB) ZScore(k, member string) (float64, error) {
 	db.master.Lock()
 	defer db.master.Unlock()
+	db.expireKey(k)
 
 	if !db.exists(k) {
 		return 0, ErrKeyNotFound
@@ -652,6 +688,87 @@ func (db *RedisDB) ZScore(k, member string) (float64, error) {
 	return db.ssetScore(k, member), nil
 }
 
+// XAdd adds an entry to a stream. `id` can be left empty or be '*'.
+// If a value is given normal XADD rules apply. Values should be an even
+// length.
+func (m *Miniredis) XAdd(k string, id string, values []string) (string, error) {
+	return m.DB(m.selectedDB).XAdd(k, id, values)
+}
+
+// XAdd adds an entry to a stream. `id` can be left empty or be '*'.
+// If a value is given normal XADD rules apply. Values should be an even
+// length.
+func (db *RedisDB) XAdd(k string, id string, values []string) (string, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	db.expireKey(k)
+	defer db.master.signal.Broadcast()
+
+	if db.exists(k) && db.t(k) != "stream" {
+		return "", ErrWrongType
+	}
+	if id == "" {
+		id = "*"
+	}
+	return db.streamAdd(k, id, values)
+}
+
+// Stream returns a slice of stream entries. Oldest first.
+func (m *Miniredis) Stream(k string) ([]StreamEntry, error) {
+	return m.DB(m.selectedDB).Stream(k)
+}
+
+// Stream returns a slice of stream entries. Oldest first.
+func (db *RedisDB) Stream(k string) ([]StreamEntry, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	db.expireKey(k)
+
+	if !db.exists(k) {
+		return nil, ErrKeyNotFound
+	}
+	if db.t(k) != "stream" {
+		return nil, ErrWrongType
+	}
+	return append([]StreamEntry(nil), db.streamKeys[k].entries...), nil
+}
+
+// PfAdd adds elements to a HyperLogLog. Returns 1 if the HLL changed.
+func (m *Miniredis) PfAdd(k string, elems ...string) (int, error) {
+	return m.DB(m.selectedDB).PfAdd(k, elems...)
+}
+
+// PfAdd adds elements to a HyperLogLog. Returns 1 if the HLL changed.
+func (db *RedisDB) PfAdd(k string, elems ...string) (int, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	db.expireKey(k)
+	defer db.master.signal.Broadcast()
+
+	return db.hllAdd(k, elems)
+}
+
+// PfCount returns the estimated cardinality of the union of the
+// HyperLogLogs. Non-existing keys count as empty HLLs.
+func (m *Miniredis) PfCount(keys ...string) (int, error) {
+	return m.DB(m.selectedDB).PfCount(keys...)
+}
+
+// PfCount returns the estimated cardinality of the union of the
+// HyperLogLogs. Non-existing keys count as empty HLLs.
+func (db *RedisDB) PfCount(keys ...string) (int, error) {
+	db.master.Lock()
+	defer db.master.Unlock()
+	for _, k := range keys {
+		db.expireKey(k)
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return db.hllCount(keys)
+}
+
 // Publish a message to subscribers. Returns the number of receivers.
 func (m *Miniredis) Publish(channel, message string) int {
 	m.Lock()
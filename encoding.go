@@ -0,0 +1,236 @@
+package miniredis
+
+// The encodings Redis would use for values, as OBJECT ENCODING reports them.
+
+import (
+	"strconv"
+)
+
+const (
+	maxEmbstrLen      = 44    // longer strings are "raw"
+	sharedIntegers    = 10000 // Redis shares the objects of 0-9999
+	sharedRefcount    = 1<<31 - 1
+	listpackOverhead  = 7    // header and end byte
+	minListpackFill   = -5   // the biggest "list-max-listpack-size" size class
+	listpackSizeClass = 4096 // "list-max-listpack-size" -1
+)
+
+// encodingConfig are the config parameters which decide when Redis switches
+// from a compact encoding to a bigger one.
+type encodingConfig struct {
+	hashMaxListpackEntries int // "hash-max-listpack-entries"
+	hashMaxListpackValue   int // "hash-max-listpack-value"
+	listMaxListpackSize    int // "list-max-listpack-size"
+	setMaxIntsetEntries    int // "set-max-intset-entries"
+	setMaxListpackEntries  int // "set-max-listpack-entries"
+	setMaxListpackValue    int // "set-max-listpack-value"
+	zsetMaxListpackEntries int // "zset-max-listpack-entries"
+	zsetMaxListpackValue   int // "zset-max-listpack-value"
+}
+
+// defaultEncodingConfig has the Redis defaults.
+func defaultEncodingConfig() encodingConfig {
+	return encodingConfig{
+		hashMaxListpackEntries: 128,
+		hashMaxListpackValue:   64,
+		listMaxListpackSize:    -2,
+		setMaxIntsetEntries:    512,
+		setMaxListpackEntries:  128,
+		setMaxListpackValue:    64,
+		zsetMaxListpackEntries: 128,
+		zsetMaxListpackValue:   64,
+	}
+}
+
+// encoding is the encoding Redis would use for the value of a key, or "" if
+// there is no such key. Unlike Redis, a value which gets small again gets its
+// compact encoding back. Needs the lock.
+func (db *RedisDB) encoding(k string) string {
+	conf := db.master.encoding
+	switch db.t(k) {
+	case "string":
+		if _, ok := db.rawStrings[k]; ok {
+			return "raw"
+		}
+		return stringEncoding(db.stringKeys[k])
+	case "list":
+		if listpackFits(db.listKeys[k], conf.listMaxListpackSize) {
+			return "listpack"
+		}
+		return "quicklist"
+	case "set":
+		s := db.setKeys[k]
+		if len(s) <= conf.setMaxIntsetEntries && allIntegers(s) {
+			return "intset"
+		}
+		if len(s) <= conf.setMaxListpackEntries && setFits(s, conf.setMaxListpackValue) {
+			return "listpack"
+		}
+		return "hashtable"
+	case "hash":
+		h := db.hashKeys[k]
+		if len(h) <= conf.hashMaxListpackEntries && hashFits(h, conf.hashMaxListpackValue) {
+			return "listpack"
+		}
+		return "hashtable"
+	case "zset":
+		z := db.sortedsetKeys[k]
+		if len(z) <= conf.zsetMaxListpackEntries && zsetFits(z, conf.zsetMaxListpackValue) {
+			return "listpack"
+		}
+		return "skiplist"
+	case "stream":
+		return "stream"
+	default:
+		return ""
+	}
+}
+
+// stringEncoding is "int" for strings which are exactly a 64 bit integer,
+// "embstr" for short strings, and "raw" for everything else.
+func stringEncoding(v string) string {
+	if _, ok := parseStrictInt(v); ok {
+		return "int"
+	}
+	if len(v) <= maxEmbstrLen {
+		return "embstr"
+	}
+	return "raw"
+}
+
+// parseStrictInt parses an integer the way Redis does when it decides whether
+// a value can be stored as a number: no sign, spaces, or leading zeros which
+// would get lost.
+func parseStrictInt(v string) (int64, bool) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != v {
+		return 0, false
+	}
+	return n, true
+}
+
+// refcount is what OBJECT REFCOUNT reports. Small integers are shared objects
+// in Redis, unless an LRU or LFU policy needs the access data of every key.
+// Needs the lock.
+func (db *RedisDB) refcount(k string) int {
+	m := db.master
+	if db.t(k) != "string" || (m.maxmemory != 0 && isLRUOrLFU(m.maxmemoryPolicy)) {
+		return 1
+	}
+	if n, ok := parseStrictInt(db.stringKeys[k]); ok && n >= 0 && n < sharedIntegers {
+		return sharedRefcount
+	}
+	return 1
+}
+
+func isLRUOrLFU(policy string) bool {
+	switch policy {
+	case "allkeys-lru", "allkeys-lfu", "volatile-lru", "volatile-lfu":
+		return true
+	}
+	return false
+}
+
+// listpackFits is true if a list is small enough for a single listpack, given
+// "list-max-listpack-size": a positive fill is the maximum number of
+// elements, a negative one a size class of 4, 8, 16, 32, or 64 KB.
+func listpackFits(l []string, fill int) bool {
+	if fill >= 0 {
+		return len(l) <= fill
+	}
+	if fill < minListpackFill {
+		fill = minListpackFill
+	}
+	max := listpackSizeClass << uint(-fill-1)
+	size := listpackOverhead
+	for _, e := range l {
+		size += listpackEntrySize(e)
+		if size > max {
+			return false
+		}
+	}
+	return true
+}
+
+// listpackEntrySize is the number of bytes an element takes in a listpack.
+func listpackEntrySize(e string) int {
+	var n int
+	if i, ok := parseStrictInt(e); ok {
+		switch {
+		case i >= 0 && i <= 127:
+			n = 1
+		case i >= -4096 && i <= 4095:
+			n = 2
+		case i >= -1<<15 && i < 1<<15:
+			n = 3
+		case i >= -1<<23 && i < 1<<23:
+			n = 4
+		case i >= -1<<31 && i < 1<<31:
+			n = 5
+		default:
+			n = 9
+		}
+	} else {
+		switch l := len(e); {
+		case l < 64:
+			n = 1 + l
+		case l < 4096:
+			n = 2 + l
+		default:
+			n = 5 + l
+		}
+	}
+	// the backlen, 7 bits per byte
+	switch {
+	case n < 1<<7:
+		return n + 1
+	case n < 1<<14:
+		return n + 2
+	case n < 1<<21:
+		return n + 3
+	case n < 1<<28:
+		return n + 4
+	default:
+		return n + 5
+	}
+}
+
+// allIntegers is true if every member of a set fits an intset.
+func allIntegers(s setKey) bool {
+	for e := range s {
+		if _, ok := parseStrictInt(e); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// setFits is true if no member is longer than max.
+func setFits(s setKey, max int) bool {
+	for e := range s {
+		if len(e) > max {
+			return false
+		}
+	}
+	return true
+}
+
+// hashFits is true if no field or value is longer than max.
+func hashFits(h hashKey, max int) bool {
+	for f, v := range h {
+		if len(f) > max || len(v) > max {
+			return false
+		}
+	}
+	return true
+}
+
+// zsetFits is true if no member is longer than max.
+func zsetFits(z sortedSet, max int) bool {
+	for e := range z {
+		if len(e) > max {
+			return false
+		}
+	}
+	return true
+}
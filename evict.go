@@ -0,0 +1,458 @@
+package miniredis
+
+// maxmemory, and evicting keys when there is too much data.
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Memory estimates. They are in the same ballpark as Redis, but only the keys
+// and their values are counted.
+const (
+	keyOverhead  = 48 // every key
+	elemOverhead = 16 // every element of a hash, list, set, sorted set, or stream
+)
+
+// LFU counter parameters, the Redis defaults.
+const (
+	lfuInitVal   = 5           // counter of a new key
+	lfuLogFactor = 10          // "lfu-log-factor"
+	lfuDecayTime = time.Minute // "lfu-decay-time"
+)
+
+// keyAccess is when a key was last used, and how often, for the LRU and LFU
+// policies.
+type keyAccess struct {
+	at    time.Time // last access, against ttlNow()
+	seq   uint64    // to order accesses which happen at the same time
+	freq  int       // logarithmic access counter, 0-255
+	decay time.Time // last time freq was decreased
+}
+
+// denyOOMCommands are the commands which can make the dataset bigger. They
+// get an OOM error when there is too much data and nothing can be evicted.
+var denyOOMCommands = map[string]bool{}
+
+// noTouchCommands don't change the access time and counter of their keys.
+var noTouchCommands = map[string]bool{
+	"EXISTS":  true,
+	"MEMORY":  true,
+	"OBJECT":  true,
+	"PTTL":    true,
+	"RESTORE": true, // sets them itself
+	"TTL":     true,
+	"TYPE":    true,
+}
+
+func init() {
+	for _, c := range []string{
+		"APPEND", "BITOP", "BRPOPLPUSH", "DECR", "DECRBY", "GEOADD",
+		"GEORADIUS", "GETSET", "HINCRBY", "HINCRBYFLOAT", "HMSET", "HSET",
+		"HSETNX", "INCR", "INCRBY", "INCRBYFLOAT", "LINSERT", "LPUSH",
+		"LPUSHX", "LSET", "MSET", "MSETNX", "PFADD", "PFMERGE", "PSETEX",
+		"RESTORE", "RPOPLPUSH", "RPUSH", "RPUSHX", "SADD", "SDIFFSTORE", "SET",
+		"SETBIT", "SETEX", "SETNX", "SETRANGE", "SINTERSTORE", "SUNIONSTORE",
+		"XADD", "XGROUP", "ZADD", "ZINCRBY", "ZINTERSTORE", "ZUNIONSTORE",
+	} {
+		denyOOMCommands[c] = true
+	}
+}
+
+// SetMaxMemory sets both the "maxmemory" and the "maxmemory-policy" config
+// parameters. 0 bytes is no limit. With a limit, keys are evicted before every
+// command, following the policy, once the data is over the limit, and right
+// away if it doesn't fit anymore. Under "noeviction" commands which add data
+// fail with an OOM error instead. An invalid policy changes nothing. See
+// Evicted().
+func (m *Miniredis) SetMaxMemory(bytes uint64, policy string) error {
+	m.Lock()
+	defer m.Unlock()
+	if err := configParams["maxmemory-policy"].set(m, policy); err != nil {
+		return err
+	}
+	m.maxmemory = bytes
+	m.freeMemory()
+	return nil
+}
+
+// Evicted returns all keys which were evicted because of maxmemory, oldest
+// first.
+func (m *Miniredis) Evicted() []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.evicted...)
+}
+
+// UsedMemory is the estimated size of all keys and values, which is what
+// maxmemory limits.
+func (m *Miniredis) UsedMemory() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.usedMemory()
+}
+
+// usedMemory is the estimated size of all DBs. Needs the lock.
+func (m *Miniredis) usedMemory() int {
+	n := 0
+	for _, db := range m.dbs {
+		n += db.memory()
+	}
+	return n
+}
+
+// dbMemory keeps the estimated size of a DB up to date, and the keys to
+// sample eviction candidates from.
+type dbMemory struct {
+	used     int                 // sum of sizes
+	sizes    map[string]int      // keyMemory() of every key
+	stale    map[string]struct{} // keys which changed since the last memory()
+	all      keySet              // all keys
+	volatile keySet              // keys with a TTL
+}
+
+func newDBMemory() dbMemory {
+	return dbMemory{
+		sizes:    map[string]int{},
+		stale:    map[string]struct{}{},
+		all:      newKeySet(),
+		volatile: newKeySet(),
+	}
+}
+
+// memory is the estimated size of all keys in the DB. Only the keys which
+// changed since the last call are measured again. Needs the lock.
+func (db *RedisDB) memory() int {
+	mem := &db.mem
+	if len(mem.stale) == 0 {
+		return mem.used
+	}
+	stale := make([]string, 0, len(mem.stale))
+	for k := range mem.stale {
+		stale = append(stale, k)
+	}
+	sort.Strings(stale) // the key sets have to be the same for the same Seed()
+	for _, k := range stale {
+		mem.used -= mem.sizes[k]
+		if !db.exists(k) {
+			delete(mem.sizes, k)
+			mem.all.remove(k)
+			mem.volatile.remove(k)
+			continue
+		}
+		n := db.keyMemory(k)
+		mem.sizes[k] = n
+		mem.used += n
+		mem.all.add(k)
+		if _, ok := db.ttl[k]; ok {
+			mem.volatile.add(k)
+		} else {
+			mem.volatile.remove(k)
+		}
+	}
+	mem.stale = map[string]struct{}{}
+	return mem.used
+}
+
+// keySet is a set of keys which can give random keys without going over all
+// of them.
+type keySet struct {
+	keys []string
+	pos  map[string]int // index in keys
+}
+
+func newKeySet() keySet {
+	return keySet{pos: map[string]int{}}
+}
+
+func (s *keySet) add(k string) {
+	if _, ok := s.pos[k]; ok {
+		return
+	}
+	s.pos[k] = len(s.keys)
+	s.keys = append(s.keys, k)
+}
+
+func (s *keySet) remove(k string) {
+	i, ok := s.pos[k]
+	if !ok {
+		return
+	}
+	last := len(s.keys) - 1
+	s.keys[i] = s.keys[last]
+	s.pos[s.keys[i]] = i
+	s.keys = s.keys[:last]
+	delete(s.pos, k)
+}
+
+// sample gives n random keys, or all keys if there are no more than n.
+func (s *keySet) sample(m *Miniredis, n int) []string {
+	if len(s.keys) <= n {
+		return append([]string(nil), s.keys...)
+	}
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		keys = append(keys, s.keys[m.randIntn(len(s.keys))])
+	}
+	return keys
+}
+
+// keyMemory estimates the size of a key with its value.
+func (db *RedisDB) keyMemory(k string) int {
+	n := keyOverhead + len(k)
+	switch db.t(k) {
+	case "string":
+		n += len(db.stringKeys[k])
+	case "hash":
+		for f, v := range db.hashKeys[k] {
+			n += elemOverhead + len(f) + len(v)
+		}
+	case "list":
+		for _, e := range db.listKeys[k] {
+			n += elemOverhead + len(e)
+		}
+	case "set":
+		for e := range db.setKeys[k] {
+			n += elemOverhead + len(e)
+		}
+	case "zset":
+		for e := range db.sortedsetKeys[k] {
+			n += elemOverhead + 8 + len(e)
+		}
+	case "stream":
+		s := db.streamKeys[k]
+		for _, e := range s.entries {
+			n += elemOverhead + len(e.ID)
+			for _, v := range e.Values {
+				n += len(v)
+			}
+		}
+		for name, g := range s.groups {
+			n += elemOverhead + len(name) + len(g.pending)*elemOverhead
+		}
+	}
+	return n
+}
+
+// oomCheck evicts keys if there is too much data, the same as Redis does
+// before every command. It returns true if the command has to fail with an
+// OOM error. Needs the lock.
+func (m *Miniredis) oomCheck(ctx *connCtx, cmd string) bool {
+	if m.maxmemory == 0 || m.masterHost != "" {
+		// replicas leave evicting to their master
+		return false
+	}
+	var fits bool
+	switch ctx.origin {
+	case "":
+		fits = m.freeMemory()
+	case "lua":
+		// no evictions halfway a script
+		fits = uint64(m.usedMemory()) <= m.maxmemory
+	default:
+		return false
+	}
+	return !fits && denyOOMCommands[cmd]
+}
+
+// freeMemory evicts keys until the data fits in maxmemory. Returns false if it
+// doesn't. Needs the lock.
+func (m *Miniredis) freeMemory() bool {
+	if m.maxmemory == 0 {
+		return true
+	}
+	for uint64(m.usedMemory()) > m.maxmemory {
+		db, key := m.evictionCandidate()
+		if db == nil {
+			return false
+		}
+		db.del(key, true)
+		db.notify(notifyEvicted, "evicted", key)
+		m.written(db.id, "DEL", []string{key}, nil)
+		m.evicted = append(m.evicted, key)
+		m.evictedKeys++
+	}
+	return true
+}
+
+// evictionCandidate picks the key to evict, from maxmemory-samples random
+// keys of every DB, or nil if there are none. The key sets have to be up to
+// date, see memory(). Needs the lock.
+func (m *Miniredis) evictionCandidate() (*RedisDB, string) {
+	policy := m.maxmemoryPolicy
+	if policy == "noeviction" {
+		return nil, ""
+	}
+	type candidate struct {
+		db  *RedisDB
+		key string
+	}
+	var samples []candidate
+	volatile := strings.HasPrefix(policy, "volatile-")
+	for _, id := range m.dbIDs() {
+		db := m.dbs[id]
+		keys := &db.mem.all
+		if volatile {
+			keys = &db.mem.volatile
+		}
+		for _, k := range keys.sample(m, m.maxmemorySamples) {
+			if _, ok := db.ttl[k]; volatile && !ok {
+				continue
+			}
+			samples = append(samples, candidate{db, k})
+		}
+	}
+	if len(samples) == 0 {
+		return nil, ""
+	}
+
+	if strings.HasSuffix(policy, "-random") {
+		c := samples[m.randIntn(len(samples))]
+		return c.db, c.key
+	}
+
+	less := func(a, b candidate) bool {
+		if policy == "volatile-ttl" {
+			return a.db.ttl[a.key].Before(b.db.ttl[b.key])
+		}
+		aa, ba := a.db.access[a.key], b.db.access[b.key]
+		if strings.HasSuffix(policy, "-lfu") {
+			if af, bf := m.lfuDecay(aa), m.lfuDecay(ba); af != bf {
+				return af < bf
+			}
+		}
+		return lessRecent(aa, ba)
+	}
+	best := samples[0]
+	for _, c := range samples[1:] {
+		if less(c, best) {
+			best = c
+		}
+	}
+	return best.db, best.key
+}
+
+// lessRecent is true if a was used before b. Keys which weren't used by any
+// command yet come first.
+func lessRecent(a, b *keyAccess) bool {
+	switch {
+	case b == nil:
+		return false
+	case a == nil:
+		return true
+	case !a.at.Equal(b.at):
+		return a.at.Before(b.at)
+	default:
+		return a.seq < b.seq
+	}
+}
+
+// dbIDs are the IDs of all DBs, sorted. Needs the lock.
+func (m *Miniredis) dbIDs() []int {
+	ids := make([]int, 0, len(m.dbs))
+	for id := range m.dbs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// touchKeys updates the access time and counter of the keys of a command,
+// after it ran. Needs the lock.
+func (m *Miniredis) touchKeys(db int, cmd string, args []string) {
+	cmd = strings.ToUpper(cmd)
+	if noTouchCommands[cmd] {
+		return
+	}
+	d, ok := m.dbs[db]
+	if !ok {
+		return
+	}
+	for _, k := range commandKeys(cmd, args) {
+		if d.exists(k) {
+			d.touch(k)
+		}
+	}
+}
+
+// touch marks a key as used. New keys start with an LFU counter of
+// lfuInitVal, existing keys get their counter decayed and maybe incremented.
+// Needs the lock.
+func (db *RedisDB) touch(k string) {
+	m := db.master
+	now := m.ttlNow()
+	m.accessSeq++
+	a, ok := db.access[k]
+	if !ok {
+		db.access[k] = &keyAccess{
+			at:    now,
+			seq:   m.accessSeq,
+			freq:  lfuInitVal,
+			decay: now,
+		}
+		return
+	}
+	a.freq = m.lfuDecay(a)
+	a.decay = now
+	a.freq = lfuIncr(a.freq)
+	a.at, a.seq = now, m.accessSeq
+}
+
+// idletime is how long ago a key was last used. Keys which weren't used by any
+// command yet have no idle time. Needs the lock.
+func (db *RedisDB) idletime(k string) time.Duration {
+	a := db.access[k]
+	if a == nil {
+		return 0
+	}
+	if d := db.master.ttlNow().Sub(a.at); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// lfuIncr increments an LFU counter, with a chance which gets smaller the
+// higher it is, the same as Redis. This doesn't use the Seed() source, since
+// it runs for every command.
+func lfuIncr(freq int) int {
+	if freq >= 255 {
+		return 255
+	}
+	base := float64(freq - lfuInitVal)
+	if base < 0 {
+		base = 0
+	}
+	p := 1 / (base*lfuLogFactor + 1)
+	if rand.Float64() < p {
+		freq++
+	}
+	return freq
+}
+
+// lfuDecay is the LFU counter, decreased by one for every lfuDecayTime since
+// the last decrease.
+func (m *Miniredis) lfuDecay(a *keyAccess) int {
+	if a == nil {
+		return lfuInitVal
+	}
+	periods := int(m.ttlNow().Sub(a.decay) / lfuDecayTime)
+	if periods >= a.freq {
+		return 0
+	}
+	return a.freq - periods
+}
+
+// restoreAccess sets the access data of a key made by RESTORE, with its
+// IDLETIME and FREQ options, which are -1 if not given. Needs the lock.
+func (db *RedisDB) restoreAccess(k string, idletime, freq int) {
+	db.touch(k)
+	a := db.access[k]
+	if idletime >= 0 {
+		a.at = a.at.Add(-time.Duration(idletime) * time.Second)
+	}
+	if freq >= 0 {
+		a.freq = freq
+	}
+}
@@ -0,0 +1,266 @@
+package miniredis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMaxmemory(t *testing.T) {
+	setup := func(t *testing.T, policy string) (*Miniredis, redis.Conn) {
+		t.Helper()
+		m, err := Run()
+		ok(t, err)
+		ok(t, m.SetMaxmemorySamples(64))
+		c, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		for _, k := range []string{"k1", "k2", "k3"} {
+			_, err := c.Do("SET", k, "value")
+			ok(t, err)
+		}
+		// room for exactly 3 keys
+		ok(t, m.SetMaxMemory(uint64(m.UsedMemory()), policy))
+		return m, c
+	}
+
+	t.Run("noeviction", func(t *testing.T) {
+		m, c := setup(t, "noeviction")
+		defer m.Close()
+		defer c.Close()
+
+		// one key over the limit is fine: the check is before a command
+		_, err := c.Do("SET", "k4", "value")
+		ok(t, err)
+		_, err = c.Do("SET", "k5", "value")
+		mustFail(t, err, msgOOM)
+		_, err = c.Do("APPEND", "k1", "more")
+		mustFail(t, err, msgOOM)
+		v, err := redis.String(c.Do("GET", "k1"))
+		ok(t, err)
+		equals(t, "value", v)
+		_, err = c.Do("DEL", "k4")
+		ok(t, err)
+		_, err = c.Do("SET", "k5", "value")
+		ok(t, err)
+		equals(t, 0, len(m.Evicted()))
+
+		// a denied command fails the transaction
+		_, err = c.Do("MULTI")
+		ok(t, err)
+		_, err = c.Do("SET", "k6", "value")
+		mustFail(t, err, msgOOM)
+		_, err = c.Do("EXEC")
+		mustFail(t, err, "EXECABORT Transaction discarded because of previous errors.")
+	})
+
+	t.Run("allkeys-lru", func(t *testing.T) {
+		m, c := setup(t, "allkeys-lru")
+		defer m.Close()
+		defer c.Close()
+
+		_, err := c.Do("GET", "k1")
+		ok(t, err)
+		_, err = c.Do("SET", "k4", "value")
+		ok(t, err)
+		_, err = c.Do("PING")
+		ok(t, err)
+		equals(t, []string{"k2"}, m.Evicted())
+		equals(t, []string{"k1", "k3", "k4"}, m.Keys())
+
+		// TYPE doesn't count as a use
+		_, err = c.Do("TYPE", "k3")
+		ok(t, err)
+		_, err = c.Do("SET", "k5", "value")
+		ok(t, err)
+		_, err = c.Do("PING")
+		ok(t, err)
+		equals(t, []string{"k2", "k3"}, m.Evicted())
+	})
+
+	t.Run("allkeys-lfu", func(t *testing.T) {
+		m, c := setup(t, "allkeys-lfu")
+		defer m.Close()
+		defer c.Close()
+
+		// the first use always increments the counter
+		_, err := c.Do("GET", "k1")
+		ok(t, err)
+		_, err = c.Do("GET", "k2")
+		ok(t, err)
+		_, err = c.Do("SET", "k4", "value")
+		ok(t, err)
+		_, err = c.Do("PING")
+		ok(t, err)
+		equals(t, []string{"k3"}, m.Evicted())
+
+		// counters go down over time
+		m.FastForward(time.Hour)
+		_, err = c.Do("GET", "k4")
+		ok(t, err)
+		_, err = c.Do("SET", "k5", "value")
+		ok(t, err)
+		_, err = c.Do("PING")
+		ok(t, err)
+		equals(t, []string{"k3", "k1"}, m.Evicted())
+	})
+
+	t.Run("volatile-ttl", func(t *testing.T) {
+		m, c := setup(t, "volatile-ttl")
+		defer m.Close()
+		defer c.Close()
+
+		_, err := c.Do("EXPIRE", "k1", "100")
+		ok(t, err)
+		_, err = c.Do("EXPIRE", "k2", "50")
+		ok(t, err)
+		_, err = c.Do("SET", "k4", "value")
+		ok(t, err)
+		_, err = c.Do("SET", "k5", "value")
+		ok(t, err)
+		equals(t, []string{"k2"}, m.Evicted())
+		_, err = c.Do("SET", "k6", "value")
+		ok(t, err)
+		equals(t, []string{"k2", "k1"}, m.Evicted())
+
+		// no keys with a TTL left
+		_, err = c.Do("SET", "k7", "value")
+		mustFail(t, err, msgOOM)
+	})
+
+	t.Run("random", func(t *testing.T) {
+		for _, policy := range []string{"allkeys-random", "volatile-random", "volatile-lru", "volatile-lfu"} {
+			m, c := setup(t, policy)
+			m.Seed(42)
+			_, err := c.Do("SETEX", "k4", "100", "value")
+			ok(t, err)
+			_, err = c.Do("PING")
+			ok(t, err)
+			ev := m.Evicted()
+			equals(t, 1, len(ev))
+			if policy != "allkeys-random" {
+				equals(t, []string{"k4"}, ev)
+			}
+			c.Close()
+			m.Close()
+		}
+	})
+
+	t.Run("used memory", func(t *testing.T) {
+		m, err := Run()
+		ok(t, err)
+		defer m.Close()
+		c, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		recount := func() int {
+			m.Lock()
+			defer m.Unlock()
+			n := 0
+			for _, db := range m.dbs {
+				for k := range db.keys {
+					n += db.keyMemory(k)
+				}
+			}
+			return n
+		}
+		for _, cmd := range [][]interface{}{
+			{"SET", "str", "value"},
+			{"APPEND", "str", "more"},
+			{"RPUSH", "list", "a", "b", "c"},
+			{"LPOP", "list"},
+			{"HMSET", "hash", "f", "v", "g", "w"},
+			{"SADD", "set", "a", "b"},
+			{"ZADD", "zset", 1, "one"},
+			{"XADD", "stream", "*", "k", "v"},
+			{"RENAME", "str", "renamed"},
+			{"MOVE", "renamed", 1},
+			{"SWAPDB", 0, 1},
+			{"SWAPDB", 0, 1},
+			{"EXPIRE", "hash", 1},
+			{"DEL", "set"},
+			// removing single members
+			{"HMSET", "h", "a", "1", "b", "2", "c", "3"},
+			{"HDEL", "h", "a"},
+			{"ZADD", "z", 1, "a", 2, "b", 3, "c", 4, "d", 5, "e"},
+			{"ZREM", "z", "a"},
+			{"ZPOPMIN", "z"},
+			{"ZPOPMAX", "z"},
+			{"ZREMRANGEBYSCORE", "z", 3, 3},
+			{"SADD", "s", "a", "b", "c"},
+			{"SREM", "s", "a"},
+			{"SPOP", "s"},
+			{"RPUSH", "l", "a", "b", "a", "c"},
+			{"LREM", "l", 0, "a"},
+			{"RPOP", "l"},
+			{"LTRIM", "l", 0, 0},
+			{"XADD", "x", "1-1", "k", "v"},
+			{"XADD", "x", "1-2", "k", "v"},
+			{"XDEL", "x", "1-1"},
+		} {
+			_, err := c.Do(cmd[0].(string), cmd[1:]...)
+			ok(t, err)
+			equals(t, recount(), m.UsedMemory())
+		}
+		m.HDel("h", "b")
+		equals(t, recount(), m.UsedMemory())
+		m.HDel("h", "c")
+		equals(t, false, m.Exists("h"))
+		equals(t, recount(), m.UsedMemory())
+		_, err = m.ZRem("z", "c")
+		ok(t, err)
+		equals(t, recount(), m.UsedMemory())
+		_, err = m.SRem("s", "b")
+		ok(t, err)
+		equals(t, recount(), m.UsedMemory())
+		m.Set("direct", "value")
+		m.FastForward(2 * time.Second)
+		equals(t, recount(), m.UsedMemory())
+		_, err = c.Do("FLUSHALL")
+		ok(t, err)
+		equals(t, 0, m.UsedMemory())
+	})
+
+	t.Run("config", func(t *testing.T) {
+		m, c := setup(t, "allkeys-lru")
+		defer m.Close()
+		defer c.Close()
+
+		sub, err := redis.Dial("tcp", m.Addr(), redis.DialReadTimeout(time.Second))
+		ok(t, err)
+		defer sub.Close()
+		ok(t, m.SetNotifyKeyspaceEvents("Ee"))
+		_, err = sub.Do("SUBSCRIBE", "__keyevent@0__:evicted")
+		ok(t, err)
+
+		// a failed CONFIG SET evicts nothing
+		_, err = c.Do("CONFIG", "SET", "maxmemory", "60", "maxmemory-policy", "nosuch")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'maxmemory-policy') - argument(s) must be one of the following: volatile-lru, volatile-lfu, volatile-random, volatile-ttl, allkeys-lru, allkeys-lfu, allkeys-random, noeviction")
+		equals(t, []string(nil), m.Evicted())
+		equals(t, 3, len(m.Keys()))
+
+		_, err = c.Do("CONFIG", "SET", "maxmemory", "60")
+		ok(t, err)
+		equals(t, []string{"k1", "k2"}, m.Evicted())
+		for _, k := range []string{"k1", "k2"} {
+			msg, err := redis.Strings(sub.Receive())
+			ok(t, err)
+			equals(t, []string{"message", "__keyevent@0__:evicted", k}, msg)
+		}
+
+		info, err := redis.String(c.Do("INFO", "stats"))
+		ok(t, err)
+		assert(t, strings.Contains(info, "evicted_keys:2\r\n"), "evicted_keys")
+
+		ok(t, m.SetMaxMemory(1, "allkeys-lru"))
+		equals(t, []string{"k1", "k2", "k3"}, m.Evicted())
+		equals(t, 0, len(m.Keys()))
+
+		mustFail(t, m.SetMaxMemory(0, "nosuch"), "argument(s) must be one of the following: volatile-lru, volatile-lfu, volatile-random, volatile-ttl, allkeys-lru, allkeys-lfu, allkeys-random, noeviction")
+		v, err := redis.Strings(c.Do("CONFIG", "GET", "maxmemory"))
+		ok(t, err)
+		equals(t, []string{"maxmemory", "1"}, v)
+	})
+}
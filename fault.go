@@ -0,0 +1,130 @@
+package miniredis
+
+// Fault injection, to test how clients deal with failing servers.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// Some error replies to use in a FaultRule.
+const (
+	FaultLoading  = "LOADING Redis is loading the dataset in memory"
+	FaultReadonly = msgReadonly
+	FaultBusy     = "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSCRIPT."
+)
+
+// FaultMoved is the error reply a cluster node sends for a key in a slot it
+// doesn't have, such as "MOVED 3999 127.0.0.1:6381".
+func FaultMoved(slot int, addr string) string {
+	return fmt.Sprintf("MOVED %d %s", slot, addr)
+}
+
+// FaultRule describes a fault to inject, see InjectFault(). Latency is
+// combined with the other faults. Of the other faults only one is used, in the
+// order Drop, Error, CloseMidReply, and PartialReply.
+type FaultRule struct {
+	Command       string        // command, such as "GET". Empty for all commands.
+	KeyPattern    string        // glob, such as "user:*", matched against the first argument. Empty for all keys.
+	Latency       time.Duration // wait this long before the command runs
+	Error         string        // reply with this error, instead of running the command
+	Drop          bool          // close the connection, instead of running the command
+	CloseMidReply bool          // run the command, send half the reply, and close the connection
+	PartialReply  bool          // run the command, but send only half the reply
+	Times         int           // the rule is removed after this many hits. 0 for no limit.
+}
+
+// faultRule is an active FaultRule.
+type faultRule struct {
+	FaultRule
+	id   int
+	hits int
+	key  *regexp.Regexp // compiled KeyPattern, nil for all keys
+}
+
+// InjectFault adds a fault rule. Rules are checked before every command, in
+// the order they were added; the first matching rule is used. Commands from
+// Lua scripts are never affected. Returns an ID for RemoveFault(), or an error
+// if KeyPattern is not a valid glob.
+func (m *Miniredis) InjectFault(r FaultRule) (int, error) {
+	var key *regexp.Regexp
+	if r.KeyPattern != "" {
+		if key = patternRE(r.KeyPattern); key == nil {
+			return 0, fmt.Errorf("invalid KeyPattern: %q", r.KeyPattern)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.lastFaultID++
+	m.faults = append(m.faults, &faultRule{FaultRule: r, id: m.lastFaultID, key: key})
+	return m.lastFaultID, nil
+}
+
+// RemoveFault removes a rule added with InjectFault(). It's fine if the rule
+// already expired.
+func (m *Miniredis) RemoveFault(id int) {
+	m.Lock()
+	defer m.Unlock()
+	for i, r := range m.faults {
+		if r.id == id {
+			m.faults = append(m.faults[:i], m.faults[i+1:]...)
+			return
+		}
+	}
+}
+
+// ClearFaults removes all rules added with InjectFault().
+func (m *Miniredis) ClearFaults() {
+	m.Lock()
+	defer m.Unlock()
+	m.faults = nil
+}
+
+func (r *faultRule) matches(cmd string, args []string) bool {
+	if r.Command != "" && !strings.EqualFold(r.Command, cmd) {
+		return false
+	}
+	if r.key != nil && (len(args) == 0 || !r.key.MatchString(args[0])) {
+		return false
+	}
+	return true
+}
+
+// faultHook runs before every command, after checkHook(). It returns the
+// fault of the first matching rule, if any.
+func (m *Miniredis) faultHook(c *server.Peer, cmd string, args []string) *server.Fault {
+	m.Lock()
+	defer m.Unlock()
+	ctx := getCtx(c)
+	if ctx.origin != "" {
+		// not for the commands from Lua scripts or the AOF
+		return nil
+	}
+	for i, r := range m.faults {
+		if !r.matches(cmd, args) {
+			continue
+		}
+		r.hits++
+		if r.Times > 0 && r.hits >= r.Times {
+			m.faults = append(m.faults[:i], m.faults[i+1:]...)
+		}
+		f := &server.Fault{Latency: r.Latency}
+		switch {
+		case r.Drop:
+			f.Drop = true
+		case r.Error != "":
+			f.Error = r.Error
+		case r.CloseMidReply:
+			f.CloseMidReply = true
+		case r.PartialReply:
+			f.PartialReply = true
+		}
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package miniredis
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestFault(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("user:1", "aap")
+	s.Set("other", "noot")
+
+	t.Run("error", func(t *testing.T) {
+		_, err := s.InjectFault(FaultRule{Command: "get", KeyPattern: "user:*", Error: FaultLoading, Times: 2})
+		ok(t, err)
+
+		_, err = c.Do("GET", "user:1")
+		mustFail(t, err, FaultLoading)
+		v, err := redis.String(c.Do("GET", "other"))
+		ok(t, err)
+		equals(t, "noot", v)
+		_, err = c.Do("GET", "user:1")
+		mustFail(t, err, FaultLoading)
+		v, err = redis.String(c.Do("GET", "user:1"))
+		ok(t, err)
+		equals(t, "aap", v)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		id, err := s.InjectFault(FaultRule{Command: "SET", Error: FaultMoved(3999, "127.0.0.1:6381")})
+		ok(t, err)
+		_, err = c.Do("SET", "aap", "noot")
+		mustFail(t, err, "MOVED 3999 127.0.0.1:6381")
+		_, err = c.Do("SET", "aap", "noot")
+		mustFail(t, err, "MOVED 3999 127.0.0.1:6381")
+		assert(t, !s.Exists("aap"), "SET did not run")
+
+		s.RemoveFault(id)
+		_, err = c.Do("SET", "aap", "noot")
+		ok(t, err)
+		s.RemoveFault(id)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := s.InjectFault(FaultRule{KeyPattern: "user:\\", Error: FaultBusy})
+		mustFail(t, err, `invalid KeyPattern: "user:\\"`)
+		_, err = c.Do("PING")
+		ok(t, err)
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		_, err := s.InjectFault(FaultRule{Command: "PING", Latency: 50 * time.Millisecond, Times: 1})
+		ok(t, err)
+		start := time.Now()
+		_, err = c.Do("PING")
+		ok(t, err)
+		assert(t, time.Since(start) >= 50*time.Millisecond, "latency")
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		c, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c.Close()
+
+		_, err = s.InjectFault(FaultRule{Drop: true, Times: 1})
+		ok(t, err)
+		_, err = c.Do("PING")
+		assert(t, err != nil, "connection closed")
+
+		c2, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer c2.Close()
+		_, err = c2.Do("PING")
+		ok(t, err)
+	})
+
+	t.Run("close mid reply", func(t *testing.T) {
+		conn, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer conn.Close()
+
+		_, err = s.InjectFault(FaultRule{Command: "GET", CloseMidReply: true, Times: 1})
+		ok(t, err)
+		_, err = conn.Write([]byte("*2\r\n$3\r\nGET\r\n$5\r\nother\r\n"))
+		ok(t, err)
+		b, err := ioutil.ReadAll(conn)
+		ok(t, err)
+		equals(t, "$4\r\nn", string(b))
+	})
+
+	t.Run("partial reply", func(t *testing.T) {
+		conn, err := net.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer conn.Close()
+
+		_, err = s.InjectFault(FaultRule{Command: "GET", PartialReply: true, Times: 1})
+		ok(t, err)
+		_, err = conn.Write([]byte("*2\r\n$3\r\nGET\r\n$5\r\nother\r\n"))
+		ok(t, err)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		b, err := ioutil.ReadAll(conn)
+		assert(t, err != nil, "timeout")
+		equals(t, "$4\r\nn", string(b))
+
+		// the connection is still open
+		conn.SetReadDeadline(time.Time{})
+		_, err = conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+		ok(t, err)
+		buf := make([]byte, 7)
+		_, err = conn.Read(buf)
+		ok(t, err)
+		equals(t, "+PONG\r\n", string(buf))
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		_, err := s.InjectFault(FaultRule{Error: FaultBusy})
+		ok(t, err)
+		_, err = c.Do("PING")
+		mustFail(t, err, FaultBusy)
+		s.ClearFaults()
+		_, err = c.Do("PING")
+		ok(t, err)
+	})
+}
@@ -0,0 +1,570 @@
+package miniredis
+
+// HyperLogLog, using the exact same string representation as Redis. See
+// hyperloglog.c in the Redis source for all the details. Both the "sparse" and
+// the "dense" encodings are supported, and values can be moved between Redis
+// and miniredis with GET and SET.
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	hllP              = 14 // precision
+	hllQ              = 64 - hllP
+	hllRegisters      = 1 << hllP
+	hllPMask          = hllRegisters - 1
+	hllBits           = 6
+	hllRegisterMax    = (1 << hllBits) - 1
+	hllHdrSize        = 16
+	hllDenseSize      = hllHdrSize + (hllRegisters*hllBits+7)/8
+	hllDense          = 0
+	hllSparse         = 1
+	hllAlphaInf       = 0.721347520444481703680 // 0.5/ln(2)
+	hllSparseMaxBytes = 3000                    // Redis' hll-sparse-max-bytes
+
+	hllSparseXzeroBit    = 0x40
+	hllSparseValBit      = 0x80
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXzeroMaxLen = 16384
+)
+
+var (
+	errNotValidHll = errors.New(msgNotValidHll)
+	errInvalidHll  = errors.New(msgInvalidHll)
+)
+
+// hyperLogLog is a HLL in the Redis string format.
+type hyperLogLog []byte
+
+// newHyperLogLog makes an empty sparse HLL, the same as PFADD does.
+func newHyperLogLog() hyperLogLog {
+	h := make(hyperLogLog, hllHdrSize, hllHdrSize+2)
+	copy(h, "HYLL")
+	h[4] = hllSparse
+	for n := hllRegisters; n > 0; n -= hllSparseXzeroMaxLen {
+		l := n
+		if l > hllSparseXzeroMaxLen {
+			l = hllSparseXzeroMaxLen
+		}
+		h = append(h, 0, 0)
+		sparseXzeroSet(h[len(h)-2:], l)
+	}
+	return h
+}
+
+// isHyperLogLog checks the header of a string value.
+func isHyperLogLog(s string) bool {
+	if len(s) < hllHdrSize || s[:4] != "HYLL" {
+		return false
+	}
+	switch s[4] {
+	case hllDense:
+		return len(s) == hllDenseSize
+	case hllSparse:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h hyperLogLog) encoding() byte {
+	return h[4]
+}
+
+func (h hyperLogLog) validCache() bool {
+	return h[15]&(1<<7) == 0
+}
+
+func (h hyperLogLog) invalidateCache() {
+	h[15] |= 1 << 7
+}
+
+func (h hyperLogLog) cachedCard() uint64 {
+	return binary.LittleEndian.Uint64(h[8:16])
+}
+
+func (h hyperLogLog) setCachedCard(card uint64) {
+	binary.LittleEndian.PutUint64(h[8:16], card)
+}
+
+// add adds an element. Returns 1 if a register changed, 0 if not, and -1 if
+// the HLL is corrupted.
+func (h *hyperLogLog) add(ele string) int {
+	index, count := hllPatLen(ele)
+	switch h.encoding() {
+	case hllDense:
+		return denseSet((*h)[hllHdrSize:], index, count)
+	default:
+		return h.sparseSet(index, count)
+	}
+}
+
+// count estimates the cardinality. Returns false if the HLL is corrupted.
+func (h hyperLogLog) count() (uint64, bool) {
+	var histo [64]int
+	switch h.encoding() {
+	case hllDense:
+		regs := h[hllHdrSize:]
+		for i := 0; i < hllRegisters; i++ {
+			histo[denseGet(regs, i)]++
+		}
+	default:
+		if !sparseHisto(h[hllHdrSize:], &histo) {
+			return 0, false
+		}
+	}
+	return hllEstimate(&histo), true
+}
+
+// hllCountRaw estimates the cardinality of registers as given by merge().
+func hllCountRaw(max []uint8) uint64 {
+	var histo [64]int
+	for _, v := range max {
+		histo[v]++
+	}
+	return hllEstimate(&histo)
+}
+
+// merge sets max[i] to the max of max[i] and the registers of h. Returns
+// false if the HLL is corrupted.
+func (h hyperLogLog) merge(max []uint8) bool {
+	if h.encoding() == hllDense {
+		regs := h[hllHdrSize:]
+		for i := 0; i < hllRegisters; i++ {
+			if v := denseGet(regs, i); v > max[i] {
+				max[i] = v
+			}
+		}
+		return true
+	}
+	idx := 0
+	ok := sparseWalk(h[hllHdrSize:], func(val uint8, runlen int) bool {
+		if idx+runlen > hllRegisters {
+			return false
+		}
+		for ; runlen > 0; runlen-- {
+			if val > max[idx] {
+				max[idx] = val
+			}
+			idx++
+		}
+		return true
+	})
+	return ok && idx == hllRegisters
+}
+
+// toDense converts a sparse HLL to the dense representation. A dense HLL is
+// left alone.
+func (h *hyperLogLog) toDense() bool {
+	if h.encoding() == hllDense {
+		return true
+	}
+	dense := make(hyperLogLog, hllDenseSize)
+	copy(dense, (*h)[:hllHdrSize]) // copies the cached cardinality as well
+	dense[4] = hllDense
+	regs := dense[hllHdrSize:]
+	idx := 0
+	ok := sparseWalk((*h)[hllHdrSize:], func(val uint8, runlen int) bool {
+		if idx+runlen > hllRegisters {
+			return false
+		}
+		for ; runlen > 0; runlen-- {
+			if val != 0 {
+				denseSet(regs, idx, val)
+			}
+			idx++
+		}
+		return true
+	})
+	if !ok || idx != hllRegisters {
+		return false
+	}
+	*h = dense
+	return true
+}
+
+// hllPatLen returns the register index and the "000..1" pattern length of an
+// element.
+func hllPatLen(ele string) (int, uint8) {
+	hash := murmurHash64A([]byte(ele), 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	hash |= 1 << hllQ // make sure the loop terminates
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// murmurHash64A is MurmurHash2, 64 bit version, little endian.
+func murmurHash64A(key []byte, seed uint32) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+	h := uint64(seed) ^ (uint64(len(key)) * m)
+	data := key
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+	switch len(data) {
+	case 7:
+		h ^= uint64(data[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(data[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(data[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(data[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(data[0])
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllEstimate is the cardinality estimation from a register histogram. See
+// "New cardinality estimation algorithms for HyperLogLog sketches", Otmar
+// Ertl, arXiv:1702.01284
+func hllEstimate(histo *[64]int) uint64 {
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	var (
+		y = 1.0
+		z = x
+	)
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	var (
+		y = 1.0
+		z = 1 - x
+	)
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// denseGet reads a 6 bit register.
+func denseGet(regs []byte, reg int) uint8 {
+	var (
+		byt = reg * hllBits / 8
+		fb  = uint(reg * hllBits & 7)
+		fb8 = 8 - fb
+		b0  = uint(regs[byt])
+		b1  uint
+	)
+	if byt+1 < len(regs) {
+		b1 = uint(regs[byt+1])
+	}
+	return uint8((b0>>fb | b1<<fb8) & hllRegisterMax)
+}
+
+// denseSet updates a register if count is larger than the current value.
+// Returns 1 if it changed, 0 otherwise.
+func denseSet(regs []byte, reg int, count uint8) int {
+	if count <= denseGet(regs, reg) {
+		return 0
+	}
+	var (
+		byt = reg * hllBits / 8
+		fb  = uint(reg * hllBits & 7)
+		fb8 = 8 - fb
+		v   = uint(count)
+	)
+	regs[byt] &^= byte(hllRegisterMax << fb)
+	regs[byt] |= byte(v << fb)
+	if byt+1 < len(regs) {
+		regs[byt+1] &^= byte(hllRegisterMax >> fb8)
+		regs[byt+1] |= byte(v >> fb8)
+	}
+	return 1
+}
+
+func sparseIsZero(b byte) bool  { return b&0xc0 == 0 }
+func sparseIsXzero(b byte) bool { return b&0xc0 == hllSparseXzeroBit }
+func sparseIsVal(b byte) bool   { return b&hllSparseValBit != 0 }
+func sparseZeroLen(b byte) int  { return int(b&0x3f) + 1 }
+func sparseXzeroLen(p []byte) int {
+	return (int(p[0]&0x3f)<<8 | int(p[1])) + 1
+}
+func sparseValValue(b byte) uint8 { return (b>>2)&0x1f + 1 }
+func sparseValLen(b byte) int     { return int(b&0x3) + 1 }
+
+func sparseValSet(p []byte, val uint8, l int) {
+	p[0] = byte((int(val)-1)<<2|(l-1)) | hllSparseValBit
+}
+
+func sparseZeroSet(p []byte, l int) {
+	p[0] = byte(l - 1)
+}
+
+func sparseXzeroSet(p []byte, l int) {
+	l--
+	p[0] = byte(l>>8) | hllSparseXzeroBit
+	p[1] = byte(l & 0xff)
+}
+
+// sparseWalk calls cb for every opcode, with the register value (0 for
+// (X)ZERO) and the run length. Returns false if the data is corrupted, or cb
+// returned false.
+func sparseWalk(sparse []byte, cb func(val uint8, runlen int) bool) bool {
+	for p := 0; p < len(sparse); {
+		switch b := sparse[p]; {
+		case sparseIsZero(b):
+			if !cb(0, sparseZeroLen(b)) {
+				return false
+			}
+			p++
+		case sparseIsXzero(b):
+			if p+1 >= len(sparse) {
+				return false
+			}
+			if !cb(0, sparseXzeroLen(sparse[p:])) {
+				return false
+			}
+			p += 2
+		default:
+			if !cb(sparseValValue(b), sparseValLen(b)) {
+				return false
+			}
+			p++
+		}
+	}
+	return true
+}
+
+func sparseHisto(sparse []byte, histo *[64]int) bool {
+	idx := 0
+	ok := sparseWalk(sparse, func(val uint8, runlen int) bool {
+		idx += runlen
+		histo[val] += runlen
+		return true
+	})
+	return ok && idx == hllRegisters
+}
+
+// sparseSet sets a register in a sparse HLL, if count is larger than the
+// current value. It promotes the HLL to the dense representation when needed.
+// Returns 1 if something changed, 0 if not, and -1 on a corrupted HLL.
+// This follows hllSparseSet() from Redis exactly, so we end up with the same
+// bytes.
+func (h *hyperLogLog) sparseSet(index int, count uint8) int {
+	if count > hllSparseValMaxValue {
+		return h.promote(index, count)
+	}
+
+	var (
+		sparse        = (*h)[hllHdrSize:]
+		p             = 0
+		prev          = -1
+		first, span   int
+		isZero, isVal bool
+		runlen        int
+	)
+	for p < len(sparse) {
+		oplen := 1
+		switch b := sparse[p]; {
+		case sparseIsZero(b):
+			span = sparseZeroLen(b)
+		case sparseIsVal(b):
+			span = sparseValLen(b)
+		default:
+			if p+1 >= len(sparse) {
+				return -1
+			}
+			span = sparseXzeroLen(sparse[p:])
+			oplen = 2
+		}
+		if index <= first+span-1 {
+			break
+		}
+		prev = p
+		p += oplen
+		first += span
+	}
+	if span == 0 || p >= len(sparse) {
+		return -1
+	}
+
+	switch b := sparse[p]; {
+	case sparseIsZero(b):
+		isZero = true
+		runlen = sparseZeroLen(b)
+	case sparseIsXzero(b):
+		runlen = sparseXzeroLen(sparse[p:])
+	default:
+		isVal = true
+		runlen = sparseValLen(b)
+	}
+
+	updated := false
+	if isVal {
+		oldcount := sparseValValue(sparse[p])
+		if oldcount >= count {
+			return 0
+		}
+		if runlen == 1 {
+			sparseValSet(sparse[p:], count, 1)
+			updated = true
+		}
+	}
+	if !updated && isZero && runlen == 1 {
+		sparseValSet(sparse[p:], count, 1)
+		updated = true
+	}
+
+	if !updated {
+		// General case: split the opcode in up to 3 new ones.
+		var (
+			seq  = make([]byte, 5)
+			n    = 0
+			last = first + span - 1
+		)
+		if !isVal {
+			if index != first {
+				if l := index - first; l > hllSparseZeroMaxLen {
+					sparseXzeroSet(seq[n:], l)
+					n += 2
+				} else {
+					sparseZeroSet(seq[n:], l)
+					n++
+				}
+			}
+			sparseValSet(seq[n:], count, 1)
+			n++
+			if index != last {
+				if l := last - index; l > hllSparseZeroMaxLen {
+					sparseXzeroSet(seq[n:], l)
+					n += 2
+				} else {
+					sparseZeroSet(seq[n:], l)
+					n++
+				}
+			}
+		} else {
+			curval := sparseValValue(sparse[p])
+			if index != first {
+				sparseValSet(seq[n:], curval, index-first)
+				n++
+			}
+			sparseValSet(seq[n:], count, 1)
+			n++
+			if index != last {
+				sparseValSet(seq[n:], curval, last-index)
+				n++
+			}
+		}
+		seq = seq[:n]
+
+		oldlen := 1
+		if !isZero && !isVal {
+			oldlen = 2
+		}
+		if deltalen := len(seq) - oldlen; deltalen > 0 && len(*h)+deltalen > hllSparseMaxBytes {
+			return h.promote(index, count)
+		}
+		var ns []byte
+		ns = append(ns, sparse[:p]...)
+		ns = append(ns, seq...)
+		ns = append(ns, sparse[p+oldlen:]...)
+		*h = append((*h)[:hllHdrSize], ns...)
+		sparse = (*h)[hllHdrSize:]
+	}
+
+	// Merge adjacent VAL opcodes with the same value, if possible.
+	p = prev
+	if p < 0 {
+		p = 0
+	}
+	for scanlen := 5; p < len(sparse) && scanlen > 0; scanlen-- {
+		b := sparse[p]
+		if sparseIsXzero(b) {
+			p += 2
+			continue
+		}
+		if sparseIsZero(b) {
+			p++
+			continue
+		}
+		if p+1 < len(sparse) && sparseIsVal(sparse[p+1]) {
+			v1 := sparseValValue(b)
+			v2 := sparseValValue(sparse[p+1])
+			if v1 == v2 {
+				if l := sparseValLen(b) + sparseValLen(sparse[p+1]); l <= hllSparseValMaxLen {
+					sparseValSet(sparse[p+1:], v1, l)
+					sparse = append(sparse[:p], sparse[p+1:]...)
+					*h = (*h)[:hllHdrSize+len(sparse)]
+					continue
+				}
+			}
+		}
+		p++
+	}
+
+	h.invalidateCache()
+	return 1
+}
+
+// promote converts to dense, and sets the register.
+func (h *hyperLogLog) promote(index int, count uint8) int {
+	if !h.toDense() {
+		return -1
+	}
+	return denseSet((*h)[hllHdrSize:], index, count)
+}
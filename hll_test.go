@@ -0,0 +1,52 @@
+package miniredis
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHllSparse(t *testing.T) {
+	h := newHyperLogLog()
+	equals(t, byte(hllSparse), h.encoding())
+	n, valid := h.count()
+	assert(t, valid, "valid")
+	equals(t, uint64(0), n)
+
+	for i := 0; i < 100; i++ {
+		h.add(strconv.Itoa(i))
+	}
+	equals(t, byte(hllSparse), h.encoding())
+	n, valid = h.count()
+	assert(t, valid, "valid")
+	equals(t, uint64(100), n)
+
+	// converting to dense keeps all registers
+	d := append(hyperLogLog(nil), h...)
+	assert(t, d.toDense(), "toDense")
+	equals(t, byte(hllDense), d.encoding())
+	equals(t, hllDenseSize, len(d))
+	n, valid = d.count()
+	assert(t, valid, "valid")
+	equals(t, uint64(100), n)
+
+	var (
+		sparseMax = make([]uint8, hllRegisters)
+		denseMax  = make([]uint8, hllRegisters)
+	)
+	assert(t, h.merge(sparseMax), "merge")
+	assert(t, d.merge(denseMax), "merge")
+	equals(t, sparseMax, denseMax)
+}
+
+func TestHllEstimate(t *testing.T) {
+	h := newHyperLogLog()
+	for i := 0; i < 100000; i++ {
+		if h.add("element:"+strconv.Itoa(i)) == -1 {
+			t.Fatal("corrupted HLL")
+		}
+	}
+	equals(t, byte(hllDense), h.encoding())
+	n, valid := h.count()
+	assert(t, valid, "valid")
+	assert(t, n > 98000 && n < 102000, "estimate %d", n)
+}
@@ -0,0 +1,419 @@
+package miniredis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// Info has the data INFO replies with. Sections which weren't asked for are
+// nil.
+type Info struct {
+	Server       *InfoServer
+	Clients      *InfoClients
+	Memory       *InfoMemory
+	Persistence  *InfoPersistence
+	Stats        *InfoStats
+	Replication  *InfoReplication
+	CPU          *InfoCPU
+	Commandstats map[string]server.CommandStat // key is the lowercase command
+	Keyspace     map[int]InfoKeyspace          // only DBs with keys
+}
+
+// InfoServer is the "server" section of INFO.
+type InfoServer struct {
+	RedisVersion string
+	RedisMode    string
+	OS           string
+	ArchBits     int
+	ProcessID    int
+	RunID        string
+	TCPPort      int
+	Uptime       time.Duration
+}
+
+// InfoClients is the "clients" section of INFO.
+type InfoClients struct {
+	ConnectedClients int
+	BlockedClients   int
+}
+
+// InfoMemory is the "memory" section of INFO.
+type InfoMemory struct {
+	UsedMemory      uint64
+	Maxmemory       uint64
+	MaxmemoryPolicy string
+}
+
+// InfoPersistence is the "persistence" section of INFO.
+type InfoPersistence struct {
+	RDBChangesSinceLastSave int
+	RDBLastSaveTime         time.Time
+	RDBLastBgsaveStatus     string // "ok" or "err"
+	AOFEnabled              bool
+	AOFLastBgrewriteStatus  string // "ok" or "err"
+}
+
+// InfoStats is the "stats" section of INFO.
+type InfoStats struct {
+	TotalConnectionsReceived int
+	TotalCommandsProcessed   int
+	ExpiredKeys              int
+	EvictedKeys              int
+	PubsubChannels           int
+	PubsubPatterns           int
+	TotalErrorReplies        int
+}
+
+// InfoReplication is the "replication" section of INFO.
+type InfoReplication struct {
+	Role             string
+	MasterHost       string // only for replicas
+	MasterPort       int    // only for replicas
+	MasterLinkStatus string // only for replicas
+	ConnectedSlaves  int
+	MasterReplID     string
+	MasterReplOffset int
+}
+
+// InfoCPU is the "cpu" section of INFO. The values are in seconds.
+type InfoCPU struct {
+	UsedCPUSys  float64
+	UsedCPUUser float64
+}
+
+// InfoKeyspace is a single DB in the "keyspace" section of INFO.
+type InfoKeyspace struct {
+	Keys    int
+	Expires int
+	AvgTTL  time.Duration
+}
+
+// infoSections are all sections, in the order INFO uses.
+var infoSections = []string{
+	"server",
+	"clients",
+	"memory",
+	"persistence",
+	"stats",
+	"replication",
+	"cpu",
+	"commandstats",
+	"keyspace",
+}
+
+// Info returns the data of INFO [section]. Use "" for the default sections,
+// or "all".
+func (m *Miniredis) Info(section string) Info {
+	m.Lock()
+	defer m.Unlock()
+	var sections []string
+	if section != "" {
+		sections = []string{section}
+	}
+	return m.info(sections)
+}
+
+// info collects the asked for sections. No sections means "default". No
+// locks!
+func (m *Miniredis) info(sections []string) Info {
+	want := map[string]bool{}
+	if len(sections) == 0 {
+		sections = []string{"default"}
+	}
+	for _, s := range sections {
+		switch s = strings.ToLower(s); s {
+		case "default":
+			for _, s := range infoSections {
+				want[s] = s != "commandstats"
+			}
+		case "all", "everything":
+			for _, s := range infoSections {
+				want[s] = true
+			}
+		default:
+			want[s] = true
+		}
+	}
+
+	var (
+		info   Info
+		cmds   map[string]server.CommandStat
+		conns  int
+		total  int
+		totalC int
+		errs   int
+	)
+	if m.srv != nil {
+		cmds = m.srv.CommandStats()
+		conns = m.srv.ClientsLen()
+		total = m.srv.TotalCommands()
+		totalC = m.srv.TotalConnections()
+		errs = m.srv.TotalErrors()
+	}
+	if want["server"] {
+		info.Server = &InfoServer{
+			RedisVersion: redisVersion,
+			RedisMode:    "standalone",
+			OS:           runtime.GOOS + " " + runtime.GOARCH,
+			ArchBits:     64,
+			ProcessID:    os.Getpid(),
+			RunID:        m.runID,
+			TCPPort:      m.port,
+		}
+		if up := m.effectiveNow().Sub(m.started); up > 0 && !m.started.IsZero() {
+			info.Server.Uptime = up
+		}
+	}
+	if want["clients"] {
+		info.Clients = &InfoClients{
+			ConnectedClients: conns,
+			BlockedClients:   m.blockedClients,
+		}
+	}
+	if want["memory"] {
+		info.Memory = &InfoMemory{
+			UsedMemory:      uint64(m.usedMemory()),
+			Maxmemory:       m.maxmemory,
+			MaxmemoryPolicy: m.maxmemoryPolicy,
+		}
+	}
+	if want["persistence"] {
+		info.Persistence = &InfoPersistence{
+			RDBChangesSinceLastSave: m.dirty,
+			RDBLastSaveTime:         m.lastSave,
+			RDBLastBgsaveStatus:     infoStatus(m.lastSaveFailed),
+			AOFEnabled:              m.aof != nil,
+			AOFLastBgrewriteStatus:  infoStatus(m.aofRewriteFailed),
+		}
+	}
+	if want["stats"] {
+		subs := m.allSubscribers()
+		info.Stats = &InfoStats{
+			TotalConnectionsReceived: totalC,
+			TotalCommandsProcessed:   total,
+			ExpiredKeys:              m.expiredKeys,
+			EvictedKeys:              m.evictedKeys,
+			PubsubChannels:           len(activeChannels(subs, "")),
+			PubsubPatterns:           countPsubs(subs),
+			TotalErrorReplies:        errs,
+		}
+	}
+	if want["replication"] {
+		info.Replication = &InfoReplication{
+			Role:             "master",
+			ConnectedSlaves:  len(m.replicas),
+			MasterReplID:     m.runID,
+			MasterReplOffset: m.replOffset,
+		}
+		if l := m.masterLink; l != nil {
+			info.Replication.Role = "slave"
+			info.Replication.MasterHost = l.host
+			info.Replication.MasterPort = l.port
+			info.Replication.MasterLinkStatus = "down"
+			if l.state == "connected" {
+				info.Replication.MasterLinkStatus = "up"
+			}
+			info.Replication.MasterReplOffset = l.offset
+		}
+	}
+	if want["cpu"] {
+		sys, user := cpuUsage()
+		info.CPU = &InfoCPU{
+			UsedCPUSys:  sys,
+			UsedCPUUser: user,
+		}
+	}
+	if want["commandstats"] {
+		info.Commandstats = map[string]server.CommandStat{}
+		for cmd, st := range cmds {
+			info.Commandstats[strings.ToLower(cmd)] = st
+		}
+	}
+	if want["keyspace"] {
+		info.Keyspace = map[int]InfoKeyspace{}
+		for id, db := range m.dbs {
+			if len(db.keys) == 0 {
+				continue
+			}
+			ks := InfoKeyspace{Keys: len(db.keys)}
+			var sum time.Duration
+			for k := range db.ttl {
+				if ttl, ok := db.ttlLeft(k); ok {
+					ks.Expires++
+					sum += ttl
+				}
+			}
+			if ks.Expires > 0 {
+				ks.AvgTTL = sum / time.Duration(ks.Expires)
+			}
+			info.Keyspace[id] = ks
+		}
+	}
+	return info
+}
+
+// String formats the sections the same way INFO does.
+func (info Info) String() string {
+	var (
+		b     strings.Builder
+		lines [][2]string
+	)
+	add := func(k string, v interface{}) {
+		lines = append(lines, [2]string{k, fmt.Sprint(v)})
+	}
+	flush := func(title string) {
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", title)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "%s:%s\r\n", l[0], l[1])
+		}
+		lines = nil
+	}
+
+	if s := info.Server; s != nil {
+		add("redis_version", s.RedisVersion)
+		add("redis_mode", s.RedisMode)
+		add("os", s.OS)
+		add("arch_bits", s.ArchBits)
+		add("process_id", s.ProcessID)
+		add("run_id", s.RunID)
+		add("tcp_port", s.TCPPort)
+		add("uptime_in_seconds", int(s.Uptime/time.Second))
+		add("uptime_in_days", int(s.Uptime/(24*time.Hour)))
+		flush("Server")
+	}
+	if s := info.Clients; s != nil {
+		add("connected_clients", s.ConnectedClients)
+		add("blocked_clients", s.BlockedClients)
+		flush("Clients")
+	}
+	if s := info.Memory; s != nil {
+		add("used_memory", s.UsedMemory)
+		add("used_memory_human", bytesToHuman(s.UsedMemory))
+		add("maxmemory", s.Maxmemory)
+		add("maxmemory_human", bytesToHuman(s.Maxmemory))
+		add("maxmemory_policy", s.MaxmemoryPolicy)
+		flush("Memory")
+	}
+	if s := info.Persistence; s != nil {
+		add("loading", 0)
+		add("rdb_changes_since_last_save", s.RDBChangesSinceLastSave)
+		add("rdb_bgsave_in_progress", 0)
+		add("rdb_last_save_time", s.RDBLastSaveTime.Unix())
+		add("rdb_last_bgsave_status", s.RDBLastBgsaveStatus)
+		add("aof_enabled", boolInt(s.AOFEnabled))
+		add("aof_rewrite_in_progress", 0)
+		add("aof_last_bgrewrite_status", s.AOFLastBgrewriteStatus)
+		flush("Persistence")
+	}
+	if s := info.Stats; s != nil {
+		add("total_connections_received", s.TotalConnectionsReceived)
+		add("total_commands_processed", s.TotalCommandsProcessed)
+		add("expired_keys", s.ExpiredKeys)
+		add("evicted_keys", s.EvictedKeys)
+		add("pubsub_channels", s.PubsubChannels)
+		add("pubsub_patterns", s.PubsubPatterns)
+		add("total_error_replies", s.TotalErrorReplies)
+		flush("Stats")
+	}
+	if s := info.Replication; s != nil {
+		add("role", s.Role)
+		if s.Role == "slave" {
+			add("master_host", s.MasterHost)
+			add("master_port", s.MasterPort)
+			add("master_link_status", s.MasterLinkStatus)
+		}
+		add("connected_slaves", s.ConnectedSlaves)
+		add("master_replid", s.MasterReplID)
+		add("master_repl_offset", s.MasterReplOffset)
+		flush("Replication")
+	}
+	if s := info.CPU; s != nil {
+		add("used_cpu_sys", fmt.Sprintf("%.6f", s.UsedCPUSys))
+		add("used_cpu_user", fmt.Sprintf("%.6f", s.UsedCPUUser))
+		flush("CPU")
+	}
+	if info.Commandstats != nil {
+		var cmds []string
+		for cmd := range info.Commandstats {
+			cmds = append(cmds, cmd)
+		}
+		sort.Strings(cmds)
+		for _, cmd := range cmds {
+			st := info.Commandstats[cmd]
+			usec := st.Duration.Microseconds()
+			add("cmdstat_"+cmd, fmt.Sprintf(
+				"calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=0,failed_calls=%d",
+				st.Calls,
+				usec,
+				float64(usec)/float64(st.Calls),
+				st.FailedCalls,
+			))
+		}
+		flush("Commandstats")
+	}
+	if info.Keyspace != nil {
+		var ids []int
+		for id := range info.Keyspace {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			ks := info.Keyspace[id]
+			add(fmt.Sprintf("db%d", id), fmt.Sprintf(
+				"keys=%d,expires=%d,avg_ttl=%d",
+				ks.Keys,
+				ks.Expires,
+				ks.AvgTTL.Milliseconds(),
+			))
+		}
+		flush("Keyspace")
+	}
+	return b.String()
+}
+
+func infoStatus(failed bool) string {
+	if failed {
+		return "err"
+	}
+	return "ok"
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bytesToHuman formats a number of bytes the way INFO does.
+func bytesToHuman(n uint64) string {
+	f := float64(n)
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%dB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.2fK", f/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.2fM", f/(1024*1024))
+	default:
+		return fmt.Sprintf("%.2fG", f/(1024*1024*1024))
+	}
+}
+
+// newRunID makes a random 40 character hex ID.
+func newRunID() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package miniredis
+
+// cpuUsage is not available on this platform.
+func cpuUsage() (float64, float64) {
+	return 0, 0
+}
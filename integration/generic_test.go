@@ -295,3 +295,49 @@ func TestUnlink(t *testing.T) {
 		succSorted("KEYS", "*"),
 	)
 }
+
+func TestDump(t *testing.T) {
+	testCommands(t,
+		succ("SET", "str", "value"),
+		succ("DUMP", "str"),
+		succ("SET", "int", "-12345"),
+		succ("DUMP", "int"),
+		succ("SET", "long", strings.Repeat("compress me! ", 10)),
+		succ("DUMP", "long"),
+		succ("RPUSH", "list", "aap", "noot", "12"),
+		succ("DUMP", "list"),
+		succ("SADD", "intset", 3, 1, -200000),
+		succ("DUMP", "intset"),
+		succ("HSET", "hash", "aap", "noot", "mies", "12"),
+		succ("DUMP", "hash"),
+		succ("ZADD", "zset", 1, "one", 2.5, "two and a half"),
+		succ("DUMP", "zset"),
+		succ("DUMP", "nosuch"),
+		fail("DUMP"),
+		fail("DUMP", "str", "str"),
+	)
+
+	// DUMP of "value"
+	payload := "\x00\x05value\n\x00\x81\xf6\xc18\xc1\xaa\x9bn"
+	testCommands(t,
+		succ("RESTORE", "str", 0, payload),
+		succ("GET", "str"),
+		fail("RESTORE", "str", 0, payload),
+		succ("RESTORE", "str", 0, payload, "REPLACE"),
+		succ("RESTORE", "ttl", 100000, payload),
+		succ("TTL", "ttl"),
+		succ("RESTORE", "abs", 1000, payload, "ABSTTL"),
+		succ("EXISTS", "abs"),
+		succ("RESTORE", "idle", 0, payload, "IDLETIME", 10),
+		succ("RESTORE", "freq", 0, payload, "FREQ", 10),
+		fail("RESTORE", "bad", 0, payload[:len(payload)-1]+"o"),
+		fail("RESTORE", "bad", 0, "foo"),
+		fail("RESTORE", "bad", -1, payload),
+		fail("RESTORE", "bad", "foo", payload),
+		fail("RESTORE", "bad", 0, payload, "FREQ", 300),
+		fail("RESTORE", "bad", 0, payload, "IDLETIME", -1),
+		fail("RESTORE", "bad", 0, payload, "IDLETIME", 1, "FREQ", 1),
+		fail("RESTORE", "bad", 0, payload, "FOO"),
+		fail("RESTORE", "bad", 0),
+	)
+}
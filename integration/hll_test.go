@@ -0,0 +1,40 @@
+// +build int
+
+package main
+
+// HyperLogLog keys.
+
+import (
+	"testing"
+)
+
+func TestHll(t *testing.T) {
+	testCommands(t,
+		succ("PFADD", "hll", "a", "b", "c"),
+		succ("PFADD", "hll", "a", "b"),
+		succ("PFADD", "hll", "d"),
+		succ("PFADD", "empty"),
+		succ("GET", "empty"),
+		succ("PFCOUNT", "hll"),
+		succ("GET", "hll"),
+		succ("PFCOUNT", "hll", "empty", "nosuch"),
+		succ("PFADD", "other", "1", "2", "3", "a"),
+		succ("PFMERGE", "merged", "hll", "other"),
+		succ("PFCOUNT", "merged"),
+		succ("GET", "merged"),
+		succ("PFMERGE", "hll", "other"),
+		succ("PFCOUNT", "hll"),
+		succ("TYPE", "hll"),
+
+		// failure cases
+		fail("PFADD"),
+		fail("PFCOUNT"),
+		fail("PFMERGE"),
+		succ("SET", "str", "value"),
+		fail("PFADD", "str", "a"),
+		fail("PFCOUNT", "str"),
+		fail("PFMERGE", "str", "hll"),
+		succ("HSET", "hash", "aap", "noot"),
+		fail("PFADD", "hash", "a"),
+	)
+}
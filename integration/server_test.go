@@ -36,3 +36,70 @@ func TestServer(t *testing.T) {
 		fail("FLUSHALL", "ASYNC", "foo"),
 	)
 }
+
+func TestConfig(t *testing.T) {
+	testCommands(t,
+		succ("CONFIG", "GET", "databases"),
+		succ("CONFIG", "GET", "maxmemory"),
+		succ("CONFIG", "GET", "maxmemory-policy"),
+		succ("CONFIG", "GET", "maxmemory-samples"),
+		succ("CONFIG", "GET", "nosuch"),
+		succ("CONFIG", "SET", "maxmemory", "100mb"),
+		succ("CONFIG", "GET", "maxmemory"),
+		succ("CONFIG", "SET", "maxmemory-policy", "ALLKEYS-LRU", "maxmemory-samples", "10"),
+		succ("CONFIG", "GET", "maxmemory-policy"),
+		succ("CONFIG", "GET", "maxmemory-samples"),
+		succ("CONFIG", "SET", "maxmemory", "0", "maxmemory-policy", "noeviction", "maxmemory-samples", "5"),
+		succ("CONFIG", "RESETSTAT"),
+
+		fail("CONFIG", "SET", "maxmemory", "foo"),
+		fail("CONFIG", "SET", "maxmemory-policy", "foo"),
+		fail("CONFIG", "SET", "maxmemory-samples", "foo"),
+		fail("CONFIG", "SET", "maxmemory-samples", "0"),
+		fail("CONFIG", "SET", "databases", "2"),
+		fail("CONFIG", "SET", "maxmemory", "1", "maxmemory", "2"),
+		fail("CONFIG", "SET", "maxmemory"),
+		fail("CONFIG", "SET", "nosuch", "1"),
+		fail("CONFIG", "RESETSTAT", "foo"),
+		fail("CONFIG", "GET"),
+		fail("CONFIG", "FOO"),
+		fail("CONFIG"),
+
+		// fail("SELECT", 16), // miniredis has no upperlimit
+		fail("SELECT", -1),
+		// fail("MOVE", "foo", 16), // miniredis has no upperlimit
+	)
+}
+
+func TestClient(t *testing.T) {
+	testCommands(t,
+		succ("CLIENT", "GETNAME"),
+		succ("CLIENT", "SETNAME", "miniredis"),
+		succ("CLIENT", "GETNAME"),
+		succ("CLIENT", "KILL", "ID", 12345),
+		succ("CLIENT", "KILL", "TYPE", "pubsub"),
+		succ("CLIENT", "LIST", "TYPE", "pubsub"),
+		succ("CLIENT", "UNBLOCK", 12345),
+		succ("CLIENT", "PAUSE", 0),
+		succ("CLIENT", "UNPAUSE"),
+
+		fail("CLIENT"),
+		fail("CLIENT", "FOO"),
+		fail("CLIENT", "SETNAME", "foo bar"),
+		fail("CLIENT", "SETNAME"),
+		fail("CLIENT", "GETNAME", "foo"),
+		fail("CLIENT", "ID", "foo"),
+		fail("CLIENT", "KILL", "1.2.3.4:5"),
+		fail("CLIENT", "KILL", "ID", "foo"),
+		fail("CLIENT", "KILL", "TYPE", "foo"),
+		fail("CLIENT", "KILL", "SKIPME", "foo"),
+		fail("CLIENT", "LIST", "TYPE", "foo"),
+		fail("CLIENT", "LIST", "ID", "foo"),
+		fail("CLIENT", "UNBLOCK", 1, "FOO"),
+		fail("CLIENT", "UNBLOCK", "foo"),
+		fail("CLIENT", "PAUSE", "foo"),
+		fail("CLIENT", "PAUSE", -1),
+		fail("CLIENT", "PAUSE", 1, "foo"),
+		fail("CLIENT", "REPLY", "foo"),
+	)
+}
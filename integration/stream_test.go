@@ -0,0 +1,100 @@
+// +build int
+
+package main
+
+// Stream keys.
+
+import (
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	testCommands(t,
+		succ("XADD", "planets", "0-1", "name", "Mercury"),
+		succ("XADD", "planets", "0-2", "name", "Venus", "color", "yellow"),
+		succ("XADD", "planets", "1-*", "name", "Earth"),
+		succ("XADD", "planets", "2", "name", "Mars"),
+		succ("XLEN", "planets"),
+		succ("TYPE", "planets"),
+		succ("XRANGE", "planets", "-", "+"),
+		succ("XRANGE", "planets", "0", "0"),
+		succ("XRANGE", "planets", "(0-1", "+", "COUNT", 2),
+		succ("XREVRANGE", "planets", "+", "-"),
+		succ("XREVRANGE", "planets", "+", "-", "COUNT", 1),
+		succ("XRANGE", "nosuch", "-", "+"),
+		succ("XDEL", "planets", "0-2", "0-2", "9-9"),
+		succ("XRANGE", "planets", "-", "+"),
+		succ("XADD", "planets", "MAXLEN", "2", "3-0", "name", "Jupiter"),
+		succ("XRANGE", "planets", "-", "+"),
+		succ("XTRIM", "planets", "MINID", "3"),
+		succ("XTRIM", "planets", "MAXLEN", "0"),
+		succ("XLEN", "planets"),
+		succ("EXISTS", "planets"),
+		succ("XADD", "nosuch", "NOMKSTREAM", "*", "name", "Pluto"),
+
+		// failure cases
+		fail("XADD", "planets", "1-0", "name", "Pluto"),
+		fail("XADD", "planets", "0-0", "name", "Pluto"),
+		fail("XADD", "planets", "foo", "name", "Pluto"),
+		fail("XADD", "planets", "*", "name"),
+		fail("XADD", "planets", "MAXLEN", "-1", "*", "name", "Pluto"),
+		fail("XRANGE", "planets", "foo", "+"),
+		fail("XRANGE", "planets", "-", "+", "COUNT"),
+		fail("XDEL", "planets", "foo"),
+		fail("XTRIM", "planets", "FOO", "0"),
+		succ("SET", "str", "I am a string"),
+		fail("XADD", "str", "*", "name", "Pluto"),
+		fail("XLEN", "str"),
+		fail("XRANGE", "str", "-", "+"),
+	)
+}
+
+func TestStreamRead(t *testing.T) {
+	testCommands(t,
+		succ("XADD", "planets", "0-1", "name", "Mercury"),
+		succ("XADD", "planets", "0-2", "name", "Venus"),
+		succ("XADD", "moons", "0-1", "name", "Luna"),
+		succ("XREAD", "STREAMS", "planets", "moons", "0", "0"),
+		succ("XREAD", "COUNT", 1, "STREAMS", "planets", "moons", "0-1", "0"),
+		succ("XREAD", "STREAMS", "planets", "$"),
+		succ("XREAD", "BLOCK", 10, "STREAMS", "planets", "$"),
+
+		fail("XREAD", "STREAMS", "planets", "moons", "0"),
+		fail("XREAD", "STREAMS", "planets", ">"),
+		fail("XREAD", "COUNT", "foo", "STREAMS", "planets", "0"),
+	)
+}
+
+func TestStreamGroup(t *testing.T) {
+	testCommands(t,
+		succ("XADD", "planets", "0-1", "name", "Mercury"),
+		succ("XADD", "planets", "0-2", "name", "Venus"),
+		succ("XADD", "planets", "0-3", "name", "Earth"),
+		succ("XGROUP", "CREATE", "planets", "processing", "0"),
+		fail("XGROUP", "CREATE", "planets", "processing", "0"),
+		fail("XGROUP", "CREATE", "nosuch", "processing", "0"),
+		succ("XGROUP", "CREATE", "empty", "processing", "$", "MKSTREAM"),
+		succ("XGROUP", "DESTROY", "empty", "processing"),
+		succ("XGROUP", "CREATECONSUMER", "planets", "processing", "alice"),
+
+		succ("XREADGROUP", "GROUP", "processing", "alice", "COUNT", 2, "STREAMS", "planets", ">"),
+		succ("XREADGROUP", "GROUP", "processing", "bob", "STREAMS", "planets", ">"),
+		succ("XREADGROUP", "GROUP", "processing", "bob", "STREAMS", "planets", ">"),
+		succ("XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", "0"),
+		fail("XREADGROUP", "GROUP", "nosuch", "alice", "STREAMS", "planets", ">"),
+		fail("XREADGROUP", "GROUP", "processing", "alice", "STREAMS", "planets", "$"),
+
+		succ("XPENDING", "planets", "processing"),
+		succ("XACK", "planets", "processing", "0-3", "0-3"),
+		succ("XACK", "planets", "nosuch", "0-1"),
+		succ("XCLAIM", "planets", "processing", "bob", "0", "0-1", "JUSTID"),
+		succ("XCLAIM", "planets", "processing", "bob", "0", "0-2"),
+		succ("XAUTOCLAIM", "planets", "processing", "carol", "0", "0", "COUNT", 1),
+		succ("XGROUP", "DELCONSUMER", "planets", "processing", "carol"),
+		succ("XPENDING", "planets", "processing"),
+
+		fail("XPENDING", "planets", "nosuch"),
+		fail("XCLAIM", "planets", "processing", "bob", "foo", "0-1"),
+		fail("XINFO", "STREAM", "nosuch"),
+	)
+}
@@ -0,0 +1,321 @@
+package miniredis
+
+// The compact encodings Redis uses in RDB files: listpacks, and for loading
+// older files ziplists and intsets.
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+var errInvalidEncoding = errors.New("invalid listpack, ziplist, or intset")
+
+// listpack builds a Redis listpack.
+type listpack struct {
+	buf []byte
+	n   int
+}
+
+// appendString adds a string. Strings which look like integers are stored as
+// integers, the same as Redis does.
+func (lp *listpack) appendString(s string) {
+	if v, ok := strictInt(s); ok {
+		lp.appendInt(v)
+		return
+	}
+	start := len(lp.buf)
+	l := len(s)
+	switch {
+	case l < 64:
+		lp.buf = append(lp.buf, 0x80|byte(l))
+	case l < 4096:
+		lp.buf = append(lp.buf, 0xE0|byte(l>>8), byte(l))
+	default:
+		lp.buf = append(lp.buf, 0xF0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(lp.buf[len(lp.buf)-4:], uint32(l))
+	}
+	lp.buf = append(lp.buf, s...)
+	lp.appendBacklen(len(lp.buf) - start)
+}
+
+// appendInt adds an integer, in the smallest encoding.
+func (lp *listpack) appendInt(v int64) {
+	start := len(lp.buf)
+	switch {
+	case v >= 0 && v <= 127:
+		lp.buf = append(lp.buf, byte(v))
+	case v >= -4096 && v <= 4095:
+		u := uint64(v) & (1<<13 - 1)
+		lp.buf = append(lp.buf, 0xC0|byte(u>>8), byte(u))
+	case v >= -32768 && v <= 32767:
+		lp.buf = append(lp.buf, 0xF1, byte(v), byte(v>>8))
+	case v >= -8388608 && v <= 8388607:
+		lp.buf = append(lp.buf, 0xF2, byte(v), byte(v>>8), byte(v>>16))
+	case v >= -2147483648 && v <= 2147483647:
+		lp.buf = append(lp.buf, 0xF3, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(lp.buf[len(lp.buf)-4:], uint32(v))
+	default:
+		lp.buf = append(lp.buf, 0xF4, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(lp.buf[len(lp.buf)-8:], uint64(v))
+	}
+	lp.appendBacklen(len(lp.buf) - start)
+}
+
+func (lp *listpack) appendBacklen(l int) {
+	switch {
+	case l <= 127:
+		lp.buf = append(lp.buf, byte(l))
+	case l < 16383:
+		lp.buf = append(lp.buf, byte(l>>7), byte(l&127)|128)
+	case l < 2097151:
+		lp.buf = append(lp.buf, byte(l>>14), byte((l>>7)&127)|128, byte(l&127)|128)
+	case l < 268435455:
+		lp.buf = append(lp.buf, byte(l>>21), byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	default:
+		lp.buf = append(lp.buf, byte(l>>28), byte((l>>21)&127)|128, byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	}
+	lp.n++
+}
+
+// size is the size of the complete listpack.
+func (lp *listpack) size() int {
+	return 6 + len(lp.buf) + 1
+}
+
+// bytes gives the complete listpack, with header and end marker.
+func (lp *listpack) bytes() []byte {
+	b := make([]byte, 6, lp.size())
+	binary.LittleEndian.PutUint32(b, uint32(lp.size()))
+	n := lp.n
+	if n > 65535 {
+		n = 65535
+	}
+	binary.LittleEndian.PutUint16(b[4:], uint16(n))
+	b = append(b, lp.buf...)
+	return append(b, 0xFF)
+}
+
+// decodeListpack returns all elements of a listpack. Integers are returned as
+// strings.
+func decodeListpack(b []byte) ([]string, error) {
+	if len(b) < 7 || int(binary.LittleEndian.Uint32(b)) != len(b) {
+		return nil, errInvalidEncoding
+	}
+	var res []string
+	for p := 6; ; {
+		if p >= len(b) {
+			return nil, errInvalidEncoding
+		}
+		e := b[p]
+		if e == 0xFF {
+			return res, nil
+		}
+		var (
+			v    string
+			size int // encoding + data
+		)
+		need := func(n int) bool { return p+n <= len(b) }
+		switch {
+		case e&0x80 == 0:
+			v, size = strconv.Itoa(int(e&0x7f)), 1
+		case e&0xC0 == 0x80:
+			l := int(e & 0x3f)
+			if !need(1 + l) {
+				return nil, errInvalidEncoding
+			}
+			v, size = string(b[p+1:p+1+l]), 1+l
+		case e&0xE0 == 0xC0:
+			if !need(2) {
+				return nil, errInvalidEncoding
+			}
+			u := int(e&0x1f)<<8 | int(b[p+1])
+			if u >= 1<<12 {
+				u -= 1 << 13
+			}
+			v, size = strconv.Itoa(u), 2
+		case e&0xF0 == 0xE0:
+			if !need(2) {
+				return nil, errInvalidEncoding
+			}
+			l := int(e&0x0f)<<8 | int(b[p+1])
+			if !need(2 + l) {
+				return nil, errInvalidEncoding
+			}
+			v, size = string(b[p+2:p+2+l]), 2+l
+		case e == 0xF0:
+			if !need(5) {
+				return nil, errInvalidEncoding
+			}
+			l := int(binary.LittleEndian.Uint32(b[p+1:]))
+			if l < 0 || !need(5+l) {
+				return nil, errInvalidEncoding
+			}
+			v, size = string(b[p+5:p+5+l]), 5+l
+		case e >= 0xF1 && e <= 0xF4:
+			w := map[byte]int{0xF1: 2, 0xF2: 3, 0xF3: 4, 0xF4: 8}[e]
+			if !need(1 + w) {
+				return nil, errInvalidEncoding
+			}
+			v, size = strconv.FormatInt(leInt(b[p+1:p+1+w]), 10), 1+w
+		default:
+			return nil, errInvalidEncoding
+		}
+		res = append(res, v)
+		p += size + backlenSize(size)
+	}
+}
+
+// backlenSize is the number of bytes the backlen of an entry takes.
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// decodeZiplist returns all elements of a ziplist, the encoding listpacks
+// replaced in Redis 7.
+func decodeZiplist(b []byte) ([]string, error) {
+	if len(b) < 11 || int(binary.LittleEndian.Uint32(b)) != len(b) {
+		return nil, errInvalidEncoding
+	}
+	var res []string
+	for p := 10; ; {
+		if p >= len(b) {
+			return nil, errInvalidEncoding
+		}
+		if b[p] == 0xFF {
+			return res, nil
+		}
+		// skip the prevlen
+		if b[p] < 254 {
+			p++
+		} else {
+			p += 5
+		}
+		if p >= len(b) {
+			return nil, errInvalidEncoding
+		}
+		e := b[p]
+		need := func(n int) bool { return p+n <= len(b) }
+		var (
+			v    string
+			size int
+		)
+		switch {
+		case e>>6 == 0:
+			l := int(e & 0x3f)
+			if !need(1 + l) {
+				return nil, errInvalidEncoding
+			}
+			v, size = string(b[p+1:p+1+l]), 1+l
+		case e>>6 == 1:
+			if !need(2) {
+				return nil, errInvalidEncoding
+			}
+			l := int(e&0x3f)<<8 | int(b[p+1])
+			if !need(2 + l) {
+				return nil, errInvalidEncoding
+			}
+			v, size = string(b[p+2:p+2+l]), 2+l
+		case e == 0x80:
+			if !need(5) {
+				return nil, errInvalidEncoding
+			}
+			l := int(binary.BigEndian.Uint32(b[p+1:]))
+			if l < 0 || !need(5+l) {
+				return nil, errInvalidEncoding
+			}
+			v, size = string(b[p+5:p+5+l]), 5+l
+		case e >= 0xF1 && e <= 0xFD:
+			v, size = strconv.Itoa(int(e&0x0f)-1), 1
+		default:
+			w, ok := map[byte]int{0xC0: 2, 0xD0: 4, 0xE0: 8, 0xF0: 3, 0xFE: 1}[e]
+			if !ok || !need(1+w) {
+				return nil, errInvalidEncoding
+			}
+			v, size = strconv.FormatInt(leInt(b[p+1:p+1+w]), 10), 1+w
+		}
+		res = append(res, v)
+		p += size
+	}
+}
+
+// encodeIntset makes an intset with all values.
+func encodeIntset(vs []int64) []byte {
+	sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+	w := 2
+	for _, v := range vs {
+		switch {
+		case v < -2147483648 || v > 2147483647:
+			w = 8
+		case (v < -32768 || v > 32767) && w < 4:
+			w = 4
+		}
+	}
+	b := make([]byte, 8+w*len(vs))
+	binary.LittleEndian.PutUint32(b, uint32(w))
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(vs)))
+	for i, v := range vs {
+		p := b[8+i*w:]
+		switch w {
+		case 2:
+			binary.LittleEndian.PutUint16(p, uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(p, uint32(v))
+		default:
+			binary.LittleEndian.PutUint64(p, uint64(v))
+		}
+	}
+	return b
+}
+
+// decodeIntset returns all values of an intset.
+func decodeIntset(b []byte) ([]string, error) {
+	if len(b) < 8 {
+		return nil, errInvalidEncoding
+	}
+	w := int(binary.LittleEndian.Uint32(b))
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if (w != 2 && w != 4 && w != 8) || n < 0 || len(b) != 8+w*n {
+		return nil, errInvalidEncoding
+	}
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, strconv.FormatInt(leInt(b[8+i*w:8+(i+1)*w]), 10))
+	}
+	return res, nil
+}
+
+// leInt reads a signed little endian integer of 1 to 8 bytes.
+func leInt(b []byte) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	shift := uint(64 - 8*len(b))
+	return int64(u<<shift) >> shift
+}
+
+// strictInt parses s as an int64, but only if that's its canonical form, the
+// same as Redis' string2ll().
+func strictInt(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != s {
+		return 0, false
+	}
+	return v, true
+}
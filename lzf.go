@@ -0,0 +1,222 @@
+package miniredis
+
+// LZF compression, as used for strings in RDB files. This is a port of
+// liblzf's lzf_c.c and lzf_d.c, with the same settings as Redis, so we
+// compress to the exact same bytes.
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	lzfHlog   = 16
+	lzfHsize  = 1 << lzfHlog
+	lzfMaxLit = 1 << 5
+	lzfMaxOff = 1 << 13
+	lzfMaxRef = (1 << 8) + (1 << 3)
+)
+
+var (
+	errLzf = errors.New("invalid LZF data")
+	// hash tables, kept all zero when in the pool
+	lzfTables = sync.Pool{
+		New: func() interface{} { return make([]int, lzfHsize) },
+	}
+)
+
+func lzfIdx(h uint32) uint32 {
+	return ((h >> (3*8 - lzfHlog)) - h*5) & (lzfHsize - 1)
+}
+
+// lzfCompress compresses in. It returns nil if the result would be longer than
+// outLen bytes.
+func lzfCompress(in []byte, outLen int) []byte {
+	inLen := len(in)
+	if inLen == 0 || outLen == 0 {
+		return nil
+	}
+	var (
+		htab    = lzfTables.Get().([]int) // positions + 1, 0 is unset
+		touched []uint32
+		out     = make([]byte, outLen+1)
+		ip      = 0
+		op      = 0
+		lit     = 0
+	)
+	defer func() {
+		for _, slot := range touched {
+			htab[slot] = 0
+		}
+		lzfTables.Put(htab)
+	}()
+	set := func(slot uint32, pos int) {
+		htab[slot] = pos + 1
+		touched = append(touched, slot)
+	}
+	first := func(p int) uint32 { return uint32(in[p])<<8 | uint32(in[p+1]) }
+	next := func(v uint32, p int) uint32 { return v<<8 | uint32(in[p+2]) }
+
+	op++ // start run
+	hval := first(ip)
+	for ip < inLen-2 {
+		hval = next(hval, ip)
+		slot := lzfIdx(hval)
+		ref := htab[slot] - 1
+		set(slot, ip)
+
+		if off := ip - ref - 1; ref > 0 && off < lzfMaxOff &&
+			in[ref+2] == in[ip+2] && in[ref] == in[ip] && in[ref+1] == in[ip+1] {
+			// match found at ref
+			l := 2
+			maxlen := inLen - ip - l
+			if maxlen > lzfMaxRef {
+				maxlen = lzfMaxRef
+			}
+			if op+3+1 >= outLen {
+				lz := 0
+				if lit == 0 {
+					lz = 1
+				}
+				if op-lz+3+1 >= outLen {
+					return nil
+				}
+			}
+
+			out[op-lit-1] = byte(lit - 1) // stop run
+			if lit == 0 {
+				op-- // undo run if length is zero
+			}
+
+			done := false
+			if maxlen > 16 {
+				for i := 0; i < 16; i++ {
+					l++
+					if in[ref+l] != in[ip+l] {
+						done = true
+						break
+					}
+				}
+			}
+			if !done {
+				for {
+					l++
+					if l >= maxlen || in[ref+l] != in[ip+l] {
+						break
+					}
+				}
+			}
+			l -= 2 // l is now #octets - 1
+			ip++
+
+			if l < 7 {
+				out[op] = byte(off>>8 + l<<5)
+				op++
+			} else {
+				out[op] = byte(off>>8 + 7<<5)
+				out[op+1] = byte(l - 7)
+				op += 2
+			}
+			out[op] = byte(off)
+			op++
+
+			lit = 0
+			op++ // start run
+
+			ip += l + 1
+			if ip >= inLen-2 {
+				break
+			}
+
+			ip -= 2
+			hval = first(ip)
+			hval = next(hval, ip)
+			set(lzfIdx(hval), ip)
+			ip++
+			hval = next(hval, ip)
+			set(lzfIdx(hval), ip)
+			ip++
+		} else {
+			// one more literal byte we must copy
+			if op >= outLen {
+				return nil
+			}
+			lit++
+			out[op] = in[ip]
+			op++
+			ip++
+			if lit == lzfMaxLit {
+				out[op-lit-1] = byte(lit - 1) // stop run
+				lit = 0
+				op++ // start run
+			}
+		}
+	}
+
+	if op+3 > outLen { // at most 3 bytes can be missing here
+		return nil
+	}
+
+	for ip < inLen {
+		lit++
+		out[op] = in[ip]
+		op++
+		ip++
+		if lit == lzfMaxLit {
+			out[op-lit-1] = byte(lit - 1) // stop run
+			lit = 0
+			op++ // start run
+		}
+	}
+
+	out[op-lit-1] = byte(lit - 1) // end run
+	if lit == 0 {
+		op-- // undo run if length is zero
+	}
+	return out[:op]
+}
+
+// lzfDecompress decompresses in, which should decompress to outLen bytes.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for ip := 0; ip < len(in); {
+		ctrl := int(in[ip])
+		ip++
+		if ctrl < 1<<5 {
+			// literal run
+			ctrl++
+			if ip+ctrl > len(in) || len(out)+ctrl > outLen {
+				return nil, errLzf
+			}
+			out = append(out, in[ip:ip+ctrl]...)
+			ip += ctrl
+			continue
+		}
+		// back reference
+		l := ctrl >> 5
+		ref := len(out) - ((ctrl & 0x1f) << 8) - 1
+		if l == 7 {
+			if ip >= len(in) {
+				return nil, errLzf
+			}
+			l += int(in[ip])
+			ip++
+		}
+		if ip >= len(in) {
+			return nil, errLzf
+		}
+		ref -= int(in[ip])
+		ip++
+		l += 2
+		if ref < 0 || len(out)+l > outLen {
+			return nil, errLzf
+		}
+		for i := 0; i < l; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLzf
+	}
+	return out, nil
+}
@@ -15,10 +15,14 @@
 package miniredis
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,31 +37,86 @@ type setKey map[string]struct{}
 
 // RedisDB holds a single (numbered) Redis database.
 type RedisDB struct {
-	master        *Miniredis               // pointer to the lock in Miniredis
-	id            int                      // db id
-	keys          map[string]string        // Master map of keys with their type
-	stringKeys    map[string]string        // GET/SET &c. keys
-	hashKeys      map[string]hashKey       // MGET/MSET &c. keys
-	listKeys      map[string]listKey       // LPUSH &c. keys
-	setKeys       map[string]setKey        // SADD &c. keys
-	sortedsetKeys map[string]sortedSet     // ZADD &c. keys
-	ttl           map[string]time.Duration // effective TTL values
-	keyVersion    map[string]uint          // used to watch values
+	master        *Miniredis            // pointer to the lock in Miniredis
+	id            int                   // db id
+	keys          map[string]string     // Master map of keys with their type
+	stringKeys    map[string]string     // GET/SET &c. keys
+	hashKeys      map[string]hashKey    // MGET/MSET &c. keys
+	listKeys      map[string]listKey    // LPUSH &c. keys
+	setKeys       map[string]setKey     // SADD &c. keys
+	sortedsetKeys map[string]sortedSet  // ZADD &c. keys
+	streamKeys    map[string]*streamKey // XADD &c. keys
+	ttl           map[string]time.Time  // TTL deadlines, see Miniredis.ttlNow()
+	keyVersion    map[string]uint       // used to watch values
+	access        map[string]*keyAccess // for the LRU and LFU maxmemory policies
+	rawStrings    map[string]struct{}   // strings changed in place, which stay "raw"
+	mem           dbMemory              // for maxmemory, see memory()
 }
 
 // Miniredis is a Redis server implementation.
 type Miniredis struct {
 	sync.Mutex
-	srv         *server.Server
-	port        int
-	password    string
-	dbs         map[int]*RedisDB
-	selectedDB  int               // DB id used in the direct Get(), Set() &c.
-	scripts     map[string]string // sha1 -> lua src
-	signal      *sync.Cond
-	now         time.Time // used to make a duration from EXPIREAT. time.Now() if not set.
-	subscribers map[*Subscriber]struct{}
-	rand        *rand.Rand
+	srv              *server.Server
+	port             int
+	password         string
+	dbs              map[int]*RedisDB
+	selectedDB       int               // DB id used in the direct Get(), Set() &c.
+	scripts          map[string]string // sha1 -> lua src
+	signal           *sync.Cond
+	now              time.Time // used to make a duration from EXPIREAT. time.Now() if not set.
+	frozenNow        time.Time // TTL base time if there is no clock
+	clock            Clock     // set by SetClock() or EnableActiveExpire()
+	expireInterval   time.Duration
+	expireStop       chan struct{} // stops the active expire sweeper
+	subscribers      map[*Subscriber]struct{}
+	rand             *rand.Rand
+	notifyEvents     int                       // notify-keyspace-events flags
+	databases        int                       // "databases" config
+	maxmemory        uint64                    // "maxmemory" config
+	maxmemoryPolicy  string                    // "maxmemory-policy" config
+	maxmemorySamples int                       // "maxmemory-samples" config
+	encoding         encodingConfig            // "*-max-listpack-*" &c. config
+	dir              string                    // "dir" config. Working dir if empty.
+	dbFilename       string                    // "dbfilename" config
+	aofFilename      string                    // "appendfilename" config
+	lastSave         time.Time                 // last successful SAVE
+	aof              io.Writer                 // write commands get appended here
+	aofFile          *os.File                  // set if we opened the AOF
+	aofDB            int                       // DB last SELECTed in the AOF
+	aofLoading       bool                      // LoadAOF() is running
+	started          time.Time                 // for INFO's uptime
+	runID            string                    // for INFO
+	dirty            int                       // write commands since the last SAVE
+	expiredKeys      int                       // number of keys removed by expire
+	evictedKeys      int                       // number of keys removed by maxmemory
+	evicted          []string                  // evicted keys, see Evicted()
+	accessSeq        uint64                    // last keyAccess.seq
+	blockedClients   int                       // clients waiting in a blocking command
+	pauseDone        chan struct{}             // closed when CLIENT PAUSE ends. Or nil.
+	pauseAll         bool                      // CLIENT PAUSE ALL, otherwise WRITE
+	lastSaveFailed   bool                      // last SAVE failed
+	aofRewriteFailed bool                      // last BGREWRITEAOF failed
+	monitors         map[*server.Peer]struct{} // clients in MONITOR mode
+	onCommand        func(CommandEvent)        // set with OnCommand()
+	recording        []RecordedCommand         // not nil while recording
+	faults           []*faultRule              // see InjectFault()
+	lastFaultID      int
+	customCommands   map[string]customCommand  // see RegisterCommand()
+	cluster          *Cluster                  // set if we're a cluster node
+	clusterNode      int                       // our index in cluster
+	replicas         map[*server.Peer]*replica // replicas connected to us
+	replOffset       int                       // bytes sent to the replicas
+	replDB           int                       // DB last SELECTed in the replication stream
+	masterHost       string                    // set if we're a replica
+	masterPort       int
+	masterLink       *replicaLink        // connection to our master
+	replPause        chan struct{}       // closed when PauseReplication() ends. Or nil.
+	sentinel         *Sentinel           // set if we're a sentinel
+	tlsConfig        *tls.Config         // set by StartTLS()
+	unixSocket       string              // set by StartUnix()
+	protoMaxBulkLen  int                 // "proto-max-bulk-len" config
+	users            map[string]*aclUser // ACL users, by name
+	aclLog           []*aclLogEntry      // ACL LOG, newest first
 }
 
 type txCmd func(*server.Peer, *connCtx)
@@ -72,18 +131,46 @@ type dbKey struct {
 type connCtx struct {
 	selectedDB       int            // selected DB
 	authenticated    bool           // auth enabled and a valid AUTH seen
+	user             string         // ACL user, after AUTH
 	transaction      []txCmd        // transaction callbacks. Or nil.
 	dirtyTransaction bool           // any error during QUEUEing
 	watch            map[dbKey]uint // WATCHed keys
 	subscriber       *Subscriber    // client is in PUBSUB mode if not nil
+	clientName       string         // set with HELLO SETNAME
+	cmd              string         // command being executed
+	args             []string       // arguments of cmd
+	blocked          bool           // waiting in a blocking command
+	unblock          string         // set by CLIENT UNBLOCK and KILL
+	cmdName          string         // cmd, as sent by the client
+	origin           string         // "lua" or "aof" for internal connections
+	monitor          bool           // in MONITOR mode
+	execEvents       []CommandEvent // commands run by the current EXEC
+	asking           bool           // ASKING, for the next command
+	readonly         bool           // READONLY
+	replPort         int            // REPLCONF listening-port
 }
 
 // NewMiniRedis makes a new, non-started, Miniredis object.
 func NewMiniRedis() *Miniredis {
 	m := Miniredis{
-		dbs:         map[int]*RedisDB{},
-		scripts:     map[string]string{},
-		subscribers: map[*Subscriber]struct{}{},
+		dbs:              map[int]*RedisDB{},
+		scripts:          map[string]string{},
+		subscribers:      map[*Subscriber]struct{}{},
+		monitors:         map[*server.Peer]struct{}{},
+		customCommands:   map[string]customCommand{},
+		replicas:         map[*server.Peer]*replica{},
+		users:            map[string]*aclUser{"default": defaultACLUser()},
+		frozenNow:        time.Now().UTC(),
+		maxmemoryPolicy:  defaultMaxmemoryPolicy,
+		maxmemorySamples: defaultMaxmemorySamples,
+		encoding:         defaultEncodingConfig(),
+		dbFilename:       defaultDBFilename,
+		aofFilename:      defaultAOFFilename,
+		lastSave:         time.Now().UTC(),
+		aofDB:            -1,
+		replDB:           -1,
+		protoMaxBulkLen:  server.DefaultMaxBulkLen,
+		runID:            newRunID(),
 	}
 	m.signal = sync.NewCond(&m)
 	return &m
@@ -99,8 +186,12 @@ func newRedisDB(id int, m *Miniredis) RedisDB {
 		listKeys:      map[string]listKey{},
 		setKeys:       map[string]setKey{},
 		sortedsetKeys: map[string]sortedSet{},
-		ttl:           map[string]time.Duration{},
+		streamKeys:    map[string]*streamKey{},
+		ttl:           map[string]time.Time{},
 		keyVersion:    map[string]uint{},
+		access:        map[string]*keyAccess{},
+		rawStrings:    map[string]struct{}{},
+		mem:           newDBMemory(),
 	}
 }
 
@@ -110,6 +201,12 @@ func Run() (*Miniredis, error) {
 	return m, m.Start()
 }
 
+// RunTLS creates and StartTLS()s a Miniredis, on a random port on localhost.
+func RunTLS(cfg *tls.Config) (*Miniredis, error) {
+	m := NewMiniRedis()
+	return m, m.StartTLS("127.0.0.1:0", cfg)
+}
+
 // Start starts a server. It listens on a random port on localhost. See also
 // Addr().
 func (m *Miniredis) Start() error {
@@ -130,13 +227,57 @@ func (m *Miniredis) StartAddr(addr string) error {
 	return m.start(s)
 }
 
+// StartUnix runs miniredis on a unix socket. A socket file left behind by an
+// earlier run is removed first, and the socket file is removed on Close().
+// Addr() is the path of the socket, Host() and Port() are empty.
+func (m *Miniredis) StartUnix(path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	m.unixSocket = path
+	m.Unlock()
+	return m.start(server.NewServerListener(l))
+}
+
+// StartTLS runs miniredis with a given addr, and TLS. Use NewTLSCerts() to
+// make a tls.Config without any files.
+func (m *Miniredis) StartTLS(addr string, cfg *tls.Config) error {
+	s, err := server.NewServerTLS(addr, cfg)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	m.tlsConfig = cfg
+	m.Unlock()
+	return m.start(s)
+}
+
 func (m *Miniredis) start(s *server.Server) error {
 	m.Lock()
 	defer m.Unlock()
 	m.srv = s
-	m.port = s.Addr().Port
+	if a := s.Addr(); a != nil {
+		m.port = a.Port
+	}
+	s.SetPreHook(m.preHook)
+	s.SetPostHook(m.postHook)
+	s.SetCheckHook(m.checkHook)
+	s.SetFaultHook(m.faultHook)
+	s.CaptureReplies(m.recording != nil)
+	s.SetMaxBulkLen(m.protoMaxBulkLen)
+	s.SetNow(clockNow(m.clock))
+	if fc, ok := m.clock.(*FakeClock); ok {
+		fc.use(m, true)
+	}
+	m.started = m.effectiveNow()
 
 	commandsConnection(m)
+	commandsACL(m)
 	commandsGeneric(m)
 	commandsServer(m)
 	commandsString(m)
@@ -148,6 +289,14 @@ func (m *Miniredis) start(s *server.Server) error {
 	commandsTransaction(m)
 	commandsScripting(m)
 	commandsGeo(m)
+	commandsStream(m)
+	commandsHll(m)
+	commandsCluster(m)
+	commandsReplication(m)
+	commandsSentinel(m)
+	commandsCustom(m)
+
+	m.startActiveExpire()
 
 	return nil
 }
@@ -155,6 +304,15 @@ func (m *Miniredis) start(s *server.Server) error {
 // Restart restarts a Close()d server on the same port. Values will be
 // preserved.
 func (m *Miniredis) Restart() error {
+	m.Lock()
+	cfg, socket := m.tlsConfig, m.unixSocket
+	m.Unlock()
+	switch {
+	case socket != "":
+		return m.StartUnix(socket)
+	case cfg != nil:
+		return m.StartTLS(fmt.Sprintf("127.0.0.1:%d", m.port), cfg)
+	}
 	return m.Start()
 }
 
@@ -168,6 +326,12 @@ func (m *Miniredis) Close() {
 	}
 	srv := m.srv
 	m.srv = nil
+	m.stopActiveExpire()
+	m.unpause()
+	m.stopReplication()
+	if fc, ok := m.clock.(*FakeClock); ok {
+		fc.use(m, false)
+	}
 	m.Unlock()
 
 	// the OnDisconnect callbacks can lock m, so run Close() outside the lock.
@@ -176,11 +340,26 @@ func (m *Miniredis) Close() {
 }
 
 // RequireAuth makes every connection need to AUTH first. Disable again by
-// setting an empty string.
+// setting an empty string. This sets the password of the "default" ACL user.
 func (m *Miniredis) RequireAuth(pw string) {
 	m.Lock()
 	defer m.Unlock()
 	m.password = pw
+	m.users["default"].setPassword(pw)
+}
+
+// SetNotifyKeyspaceEvents enables keyspace notifications, the same as the
+// notify-keyspace-events config value. For example "KEA" for all events. An
+// empty string disables notifications.
+func (m *Miniredis) SetNotifyKeyspaceEvents(flags string) error {
+	f, err := parseNotifyFlags(flags)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.notifyEvents = f
+	return nil
 }
 
 // DB returns a DB by ID.
@@ -226,21 +405,29 @@ func (m *Miniredis) swapDB(i, j int) bool {
 func (m *Miniredis) Addr() string {
 	m.Lock()
 	defer m.Unlock()
-	return m.srv.Addr().String()
+	return m.srv.ListenAddr().String()
 }
 
-// Host returns the host part of Addr().
+// Host returns the host part of Addr(). Empty for a unix socket.
 func (m *Miniredis) Host() string {
 	m.Lock()
 	defer m.Unlock()
-	return m.srv.Addr().IP.String()
+	a := m.srv.Addr()
+	if a == nil {
+		return ""
+	}
+	return a.IP.String()
 }
 
-// Port returns the (random) port part of Addr().
+// Port returns the (random) port part of Addr(). Empty for a unix socket.
 func (m *Miniredis) Port() string {
 	m.Lock()
 	defer m.Unlock()
-	return strconv.Itoa(m.srv.Addr().Port)
+	a := m.srv.Addr()
+	if a == nil {
+		return ""
+	}
+	return strconv.Itoa(a.Port)
 }
 
 // CommandCount returns the number of processed commands.
@@ -265,26 +452,47 @@ func (m *Miniredis) TotalConnectionCount() int {
 }
 
 // FastForward decreases all TTLs by the given duration. All TTLs <= 0 will be
-// expired.
+// expired. If a FakeClock is set, that clock is moved forward.
 func (m *Miniredis) FastForward(duration time.Duration) {
 	m.Lock()
-	defer m.Unlock()
-	for _, db := range m.dbs {
-		db.fastForward(duration)
+	switch c := m.clock.(type) {
+	case nil:
+		m.frozenNow = m.frozenNow.Add(duration)
+	case *FakeClock:
+		users := c.add(duration)
+		defer c.moved(users, m)
+	default:
+		for _, db := range m.dbs {
+			db.fastForward(duration)
+		}
 	}
+	m.expireKeys()
+	m.Unlock()
 }
 
 // redigo returns a redigo.Conn, connected using net.Pipe
 func (m *Miniredis) redigo() redigo.Conn {
+	m.Lock()
+	defer m.Unlock()
+	return m.internalConn("")
+}
+
+// internalConn returns an authenticated redigo.Conn, connected using
+// net.Pipe. origin is what MONITOR shows as the client address, such as "lua".
+// It's not limited by any ACL user. Needs the lock.
+func (m *Miniredis) internalConn(origin string) redigo.Conn {
+	return m.internalUserConn(origin, "")
+}
+
+// internalUserConn is internalConn(), but limited to what the ACL user can do.
+// No user means no limits. Needs the lock.
+func (m *Miniredis) internalUserConn(origin, user string) redigo.Conn {
 	c1, c2 := net.Pipe()
-	m.srv.ServeConn(c1)
-	c := redigo.NewConn(c2, 0, 0)
-	if m.password != "" {
-		if _, err := c.Do("AUTH", m.password); err != nil {
-			// ?
-		}
-	}
-	return c
+	ctx := getCtx(m.srv.AddConn(c1))
+	ctx.authenticated = true
+	ctx.user = user
+	ctx.origin = origin
+	return redigo.NewConn(c2, 0, 0)
 }
 
 // Dump returns a text version of the selected DB, usable for debugging.
@@ -328,6 +536,14 @@ func (m *Miniredis) Dump() string {
 			for _, el := range db.ssetElements(k) {
 				r += fmt.Sprintf("%s%f: %s\n", indent, el.score, v(el.member))
 			}
+		case "stream":
+			for _, entry := range db.streamKeys[k].entries {
+				r += fmt.Sprintf("%s%s\n", indent, entry.ID)
+				ev := entry.Values
+				for i := 0; i < len(ev)/2; i++ {
+					r += fmt.Sprintf("%s%s%s: %s\n", indent, indent, v(ev[2*i]), v(ev[2*i+1]))
+				}
+			}
 		default:
 			r += fmt.Sprintf("%s(a %s, fixme!)\n", indent, t)
 		}
@@ -336,24 +552,105 @@ func (m *Miniredis) Dump() string {
 }
 
 // SetTime sets the time against which EXPIREAT values are compared. EXPIREAT
-// will use time.Now() if this is not set.
+// will use time.Now() if this is not set. If a FakeClock is set, that clock is
+// set to t. With the real time, such as after EnableActiveExpire(), the time
+// keeps running from t, without changing the time left of any TTL. Other
+// clocks can't be changed.
 func (m *Miniredis) SetTime(t time.Time) {
+	m.Lock()
+	switch c := m.clock.(type) {
+	case *FakeClock:
+		users := c.set(t)
+		defer c.moved(users, m)
+		m.expireKeys()
+	case wallClock:
+		m.setClock(wallClock{offset: t.Sub(time.Now())})
+	default:
+		m.now = t
+	}
+	m.Unlock()
+}
+
+// effectiveNow returns the time set with SetTime(), or time.Now() if that's
+// not set. If there is a clock it's always the clock time.
+func (m *Miniredis) effectiveNow() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+	if !m.now.IsZero() {
+		return m.now
+	}
+	return time.Now().UTC()
+}
+
+// checkHook runs before every command, before faultHook(). Cluster nodes
+// redirect commands for keys they don't have, replicas reject writes from
+// clients, and commands which add data fail when there is too much data and
+// nothing can be evicted.
+func (m *Miniredis) checkHook(c *server.Peer, cmd string, args []string) string {
 	m.Lock()
 	defer m.Unlock()
-	m.now = t
+	ctx := getCtx(c)
+	if e := m.routeCheck(ctx, cmd, args); e != "" {
+		return e
+	}
+	cmd = strings.ToUpper(cmd)
+	if m.masterHost != "" && m.isWrite(cmd) && ctx.origin != "master" && ctx.origin != "aof" {
+		return msgReadonly
+	}
+	if m.oomCheck(ctx, cmd) {
+		setDirty(c)
+		return msgOOM
+	}
+	return ""
+}
+
+// routeCheck gives the cluster redirect for a command from a client, if any.
+// Needs the lock.
+func (m *Miniredis) routeCheck(ctx *connCtx, cmd string, args []string) string {
+	if ctx.origin != "" {
+		// not for the commands from Lua scripts, the AOF, or our master
+		return ""
+	}
+	return m.clusterRedirect(ctx, cmd, args)
 }
 
-// handleAuth returns false if connection has no access. It sends the reply.
+// preHook runs before every command. It waits while the server is paused by
+// CLIENT PAUSE.
+func (m *Miniredis) preHook(c *server.Peer, cmd string, args []string) {
+	m.Lock()
+	defer m.Unlock()
+	ctx := getCtx(c)
+	ctx.cmdName, ctx.cmd, ctx.args = cmd, strings.ToUpper(cmd), args
+	for m.pausedFor(ctx.cmd) {
+		done := m.pauseDone
+		m.Unlock()
+		<-done
+		m.Lock()
+	}
+}
+
+// handleAuth returns false if connection has no access, either because it
+// needs to AUTH first, or because its ACL user can't run the command. It sends
+// the reply.
 func (m *Miniredis) handleAuth(c *server.Peer) bool {
 	m.Lock()
 	defer m.Unlock()
-	if m.password == "" {
+	ctx := getCtx(c)
+	if ctx.authenticated && ctx.user == "" {
+		// internal connection
 		return true
 	}
-	if !getCtx(c).authenticated {
+	u := m.connUser(ctx)
+	if u == nil {
 		c.WriteError("NOAUTH Authentication required.")
 		return false
 	}
+	if e := m.aclCheck(c, ctx, u); e != "" {
+		setDirty(c)
+		c.WriteError(e)
+		return false
+	}
 	return true
 }
 
@@ -364,7 +661,8 @@ func (m *Miniredis) checkPubsub(c *server.Peer) bool {
 	defer m.Unlock()
 
 	ctx := getCtx(c)
-	if ctx.subscriber == nil {
+	if ctx.subscriber == nil || c.Resp3() {
+		// RESP3 clients can mix subscriptions and commands.
 		return false
 	}
 
@@ -417,8 +715,10 @@ func setDirty(c *server.Peer) {
 	getCtx(c).dirtyTransaction = true
 }
 
-func setAuthenticated(c *server.Peer) {
-	getCtx(c).authenticated = true
+func setAuthenticated(c *server.Peer, user string) {
+	ctx := getCtx(c)
+	ctx.authenticated = true
+	ctx.user = user
 }
 
 func (m *Miniredis) addSubscriber(s *Subscriber) {
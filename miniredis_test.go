@@ -1,6 +1,11 @@
 package miniredis
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -83,6 +88,45 @@ func TestAddr(t *testing.T) {
 	ok(t, err)
 }
 
+// Test a unix socket
+func TestUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "miniredis")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "redis.sock")
+
+	m := NewMiniRedis()
+	ok(t, m.StartUnix(sock))
+	equals(t, sock, m.Addr())
+	equals(t, "", m.Host())
+	equals(t, "", m.Port())
+
+	c, err := redis.Dial("unix", sock)
+	ok(t, err)
+	_, err = c.Do("SET", "foo", "bar")
+	ok(t, err)
+	list, err := redis.String(c.Do("CLIENT", "LIST"))
+	ok(t, err)
+	assert(t, strings.Contains(list, "addr="+sock+":0 laddr="+sock+":0 "), "client list")
+	v, err := redis.Strings(c.Do("CONFIG", "GET", "unixsocket"))
+	ok(t, err)
+	equals(t, []string{"unixsocket", sock}, v)
+	c.Close()
+
+	m.Close()
+	_, err = os.Stat(sock)
+	assert(t, os.IsNotExist(err), "socket file removed")
+
+	ok(t, m.Restart())
+	defer m.Close()
+	c, err = redis.Dial("unix", sock)
+	ok(t, err)
+	defer c.Close()
+	v2, err := redis.String(c.Do("GET", "foo"))
+	ok(t, err)
+	equals(t, "bar", v2)
+}
+
 func TestDump(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
@@ -212,6 +256,91 @@ func TestExpireWithFastForward(t *testing.T) {
 	equals(t, 1, len(s.Keys()))
 }
 
+func TestActiveExpire(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("aap", "noot")
+	s.Set("noot", "mies")
+	s.Set("mies", "vuur")
+	s.SetTTL("aap", 50*time.Millisecond)
+	s.SetTTL("noot", time.Hour)
+	s.EnableActiveExpire(10 * time.Millisecond)
+
+	equals(t, time.Hour, s.TTL("noot").Round(time.Minute))
+	v, err := redis.Int(c.Do("TTL", "noot"))
+	ok(t, err)
+	assert(t, v == 3599 || v == 3600, "TTL counts down")
+
+	t.Run("sweeper", func(t *testing.T) {
+		time.Sleep(100 * time.Millisecond)
+		s.Lock()
+		_, ok := s.dbs[0].keys["aap"]
+		s.Unlock()
+		assert(t, !ok, "aap expired")
+	})
+
+	t.Run("lazy", func(t *testing.T) {
+		s.EnableActiveExpire(0)
+		_, err := c.Do("PEXPIRE", "mies", 10)
+		ok(t, err)
+		s.Set("vuur", "wim")
+		s.SetTTL("vuur", 10*time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		v, err := redis.Int(c.Do("EXISTS", "mies"))
+		ok(t, err)
+		equals(t, 0, v)
+
+		// only the keys a command uses are checked
+		s.Lock()
+		_, found := s.dbs[0].keys["vuur"]
+		s.Unlock()
+		assert(t, found, "vuur not expired yet")
+		keys, err := redis.Strings(c.Do("KEYS", "*"))
+		ok(t, err)
+		equals(t, []string{"noot"}, keys)
+	})
+
+	t.Run("fastforward", func(t *testing.T) {
+		s.FastForward(59 * time.Minute)
+		v, err := redis.Int(c.Do("TTL", "noot"))
+		ok(t, err)
+		assert(t, v == 59 || v == 60, "TTL after FastForward")
+
+		s.FastForward(time.Minute)
+		equals(t, []string{}, s.Keys())
+	})
+
+	t.Run("time", func(t *testing.T) {
+		s.Set("noot", "mies")
+		s.SetTTL("noot", time.Hour)
+		s.SetTime(time.Unix(100, 0))
+		v, err := redis.Strings(c.Do("TIME"))
+		ok(t, err)
+		equals(t, "100", v[0])
+		// TTLs are kept
+		equals(t, time.Hour, s.TTL("noot").Round(time.Minute))
+
+		s.Set("aap", "noot")
+		_, err = c.Do("EXPIREAT", "aap", 100+3600)
+		ok(t, err)
+		equals(t, time.Hour, s.TTL("aap").Round(time.Minute))
+
+		// the time keeps running
+		time.Sleep(20 * time.Millisecond)
+		v, err = redis.Strings(c.Do("TIME"))
+		ok(t, err)
+		equals(t, "100", v[0])
+		us, err := strconv.Atoi(v[1])
+		ok(t, err)
+		assert(t, us >= 20000, "TIME moves")
+	})
+}
+
 func TestRedigo(t *testing.T) {
 	s, err := Run()
 	ok(t, err)
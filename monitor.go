@@ -0,0 +1,224 @@
+package miniredis
+
+// MONITOR and OnCommand(). Commands are passed on after they ran, the same as
+// Redis 7 does, so the commands from a Lua script come before the EVAL, and
+// the commands from a transaction come before the EXEC.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// CommandEvent is a single executed command. See OnCommand().
+type CommandEvent struct {
+	Time    time.Time
+	DB      int      // selected DB after the command
+	Client  string   // client address, or "lua" for commands from a script
+	Command string   // command name, as sent by the client
+	Args    []string // arguments
+}
+
+// String formats the event the same way MONITOR does, without the leading
+// "+".
+func (e CommandEvent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%d %s] %s", e.Time.Unix(), e.Time.Nanosecond()/1000, e.DB, e.Client, quoteArg(e.Command))
+	for _, a := range e.Args {
+		b.WriteString(" ")
+		b.WriteString(quoteArg(a))
+	}
+	return b.String()
+}
+
+// OnCommand makes miniredis call f after every command, including the
+// commands run by Lua scripts and by EXEC, in the order MONITOR shows them.
+// Unlike MONITOR, f also gets the admin commands, and passwords are not
+// redacted. f is called from the goroutine of the client connection, without
+// locks held. Use nil to stop.
+func (m *Miniredis) OnCommand(f func(CommandEvent)) {
+	m.Lock()
+	defer m.Unlock()
+	m.onCommand = f
+}
+
+// adminCommands are not shown by MONITOR, the same as Redis.
+var adminCommands = map[string]bool{
+	"BGREWRITEAOF": true,
+	"BGSAVE":       true,
+	"CONFIG":       true,
+	"DEBUG":        true,
+	"MONITOR":      true,
+	"PSYNC":        true,
+	"REPLCONF":     true,
+	"REPLICAOF":    true,
+	"SAVE":         true,
+	"SHUTDOWN":     true,
+	"SLAVEOF":      true,
+	"SYNC":         true,
+}
+
+// adminSubcommands are the admin subcommands of container commands.
+var adminSubcommands = map[string]map[string]bool{
+	"ACL": {
+		"DELUSER": true,
+		"GETUSER": true,
+		"LIST":    true,
+		"LOG":     true,
+		"SETUSER": true,
+		"USERS":   true,
+	},
+	"CLIENT": {
+		"KILL":     true,
+		"LIST":     true,
+		"NO-EVICT": true,
+		"PAUSE":    true,
+		"UNBLOCK":  true,
+		"UNPAUSE":  true,
+	},
+}
+
+func isAdminCommand(cmd string, args []string) bool {
+	cmd = strings.ToUpper(cmd)
+	if adminCommands[cmd] {
+		return true
+	}
+	return len(args) > 0 && adminSubcommands[cmd][strings.ToUpper(args[0])]
+}
+
+// redact hides the passwords of AUTH and HELLO, the same as Redis does in
+// MONITOR.
+func redact(cmd string, args []string) []string {
+	const hidden = "(redacted)"
+	switch strings.ToUpper(cmd) {
+	case "AUTH":
+		r := make([]string, len(args))
+		for i := range r {
+			r[i] = hidden
+		}
+		return r
+	case "HELLO":
+		r := append([]string(nil), args...)
+		for i := 0; i < len(r); i++ {
+			if strings.ToUpper(r[i]) == "AUTH" {
+				for j := i + 1; j < len(r) && j <= i+2; j++ {
+					r[j] = hidden
+				}
+				i += 2
+			}
+		}
+		return r
+	default:
+		return args
+	}
+}
+
+// quoteArg quotes a string the same way Redis does in MONITOR.
+func quoteArg(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c >= ' ' && c <= '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// commandEvent makes the event of a command which just ran. Needs the lock.
+func (m *Miniredis) commandEvent(c *server.Peer, ctx *connCtx, cmd string, args []string) CommandEvent {
+	client := ctx.origin
+	if client == "" {
+		client = c.Addr()
+	}
+	return CommandEvent{
+		Time:    m.effectiveNow(),
+		DB:      ctx.selectedDB,
+		Client:  client,
+		Command: cmd,
+		Args:    args,
+	}
+}
+
+// execCmd wraps a queued command callback, so EXEC can pass it on to MONITOR
+// and OnCommand().
+func (m *Miniredis) execCmd(cmd string, args []string, cb txCmd) txCmd {
+	return func(c *server.Peer, ctx *connCtx) {
+		cb(c, ctx)
+		ctx.execEvents = append(ctx.execEvents, m.commandEvent(c, ctx, cmd, args))
+	}
+}
+
+// postHook runs after every command. It records the command, and passes it,
+// and the commands of an EXEC, on to the MONITOR clients and OnCommand().
+func (m *Miniredis) postHook(c *server.Peer, cmd string, args []string) {
+	m.Lock()
+	ctx := getCtx(c)
+	m.record(ctx, cmd, args, c.Reply())
+	if ctx.origin == "aof" || (inTx(ctx) && ctx.cmd != "MULTI") {
+		// Queued commands are passed on when EXEC runs them.
+		m.Unlock()
+		return
+	}
+	events := append(ctx.execEvents, m.commandEvent(c, ctx, cmd, args))
+	ctx.execEvents = nil
+	for _, e := range events {
+		m.touchKeys(e.DB, e.Command, e.Args)
+	}
+	f := m.onCommand
+	monitors := make([]*server.Peer, 0, len(m.monitors))
+	for p := range m.monitors {
+		monitors = append(monitors, p)
+	}
+	m.Unlock()
+
+	for _, e := range events {
+		if f != nil {
+			f(e)
+		}
+		if len(monitors) == 0 || isAdminCommand(e.Command, e.Args) {
+			continue
+		}
+		e.Args = redact(e.Command, e.Args)
+		line := e.String()
+		for _, p := range monitors {
+			p.Block(func(w *server.Writer) {
+				w.WriteInline(line)
+				w.Flush()
+			})
+		}
+	}
+}
+
+// startMonitor makes a client get all commands, until it disconnects. Needs
+// the lock.
+func (m *Miniredis) startMonitor(c *server.Peer, ctx *connCtx) {
+	ctx.monitor = true
+	m.monitors[c] = struct{}{}
+	c.OnDisconnect(func() {
+		m.Lock()
+		defer m.Unlock()
+		delete(m.monitors, c)
+	})
+}
@@ -0,0 +1,183 @@
+package miniredis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMonitor(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	s.SetTime(time.Unix(1339518083, 107412000))
+	mon, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer mon.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+	id, err := redis.Int(c.Do("CLIENT", "ID"))
+	ok(t, err)
+	addr := c2addr(t, s, id)
+	monID, err := redis.Int(mon.Do("CLIENT", "ID"))
+	ok(t, err)
+
+	v, err := redis.String(mon.Do("MONITOR"))
+	ok(t, err)
+	equals(t, "OK", v)
+
+	next := func(t *testing.T, want string) {
+		t.Helper()
+		v, err := redis.String(mon.Receive())
+		ok(t, err)
+		equals(t, want, v)
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		_, err := c.Do("SET", "aap", "noot \"mies\"\n\x01")
+		ok(t, err)
+		next(t, `1339518083.107412 [0 `+addr+`] "SET" "aap" "noot \"mies\"\n\x01"`)
+
+		_, err = c.Do("select", "2")
+		ok(t, err)
+		next(t, `1339518083.107412 [2 `+addr+`] "select" "2"`)
+		_, err = c.Do("SELECT", "0")
+		ok(t, err)
+		next(t, `1339518083.107412 [0 `+addr+`] "SELECT" "0"`)
+	})
+
+	t.Run("admin and redacted", func(t *testing.T) {
+		_, err := c.Do("CONFIG", "GET", "dir")
+		ok(t, err)
+		_, err = c.Do("AUTH", "secret")
+		mustFail(t, err, "ERR Client sent AUTH, but no password is set")
+		next(t, `1339518083.107412 [0 `+addr+`] "AUTH" "(redacted)"`)
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		_, err := c.Do("MULTI")
+		ok(t, err)
+		_, err = c.Do("INCR", "counter")
+		ok(t, err)
+		_, err = c.Do("EXEC")
+		ok(t, err)
+		next(t, `1339518083.107412 [0 `+addr+`] "MULTI"`)
+		next(t, `1339518083.107412 [0 `+addr+`] "INCR" "counter"`)
+		next(t, `1339518083.107412 [0 `+addr+`] "EXEC"`)
+	})
+
+	t.Run("lua", func(t *testing.T) {
+		_, err := c.Do("EVAL", `return redis.call("GET", KEYS[1])`, 1, "aap")
+		ok(t, err)
+		next(t, `1339518083.107412 [0 lua] "GET" "aap"`)
+		next(t, `1339518083.107412 [0 `+addr+`] "EVAL" "return redis.call(\"GET\", KEYS[1])" "1" "aap"`)
+	})
+
+	t.Run("client list", func(t *testing.T) {
+		flags := map[int]string{}
+		for _, ci := range s.Clients() {
+			flags[ci.ID] = ci.Flags
+		}
+		equals(t, "O", flags[monID])
+		equals(t, "N", flags[id])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := c.Do("MONITOR", "foo")
+		mustFail(t, err, "ERR wrong number of arguments for 'monitor' command")
+
+		_, err = c.Do("MULTI")
+		ok(t, err)
+		_, err = c.Do("MONITOR")
+		ok(t, err)
+		_, err = redis.Values(c.Do("EXEC"))
+		ok(t, err)
+		next(t, `1339518083.107412 [0 `+addr+`] "MULTI"`)
+		next(t, `1339518083.107412 [0 `+addr+`] "EXEC"`)
+	})
+}
+
+func TestOnCommand(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	id, err := redis.Int(c.Do("CLIENT", "ID"))
+	ok(t, err)
+	addr := c2addr(t, s, id)
+
+	var (
+		mu     sync.Mutex
+		events []CommandEvent
+	)
+	s.OnCommand(func(e CommandEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	commands := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var cmds []string
+		for _, e := range events {
+			cmds = append(cmds, e.Client+" "+e.Command)
+		}
+		events = nil
+		return cmds
+	}
+
+	_, err = c.Do("SET", "aap", "noot")
+	ok(t, err)
+	_, err = c.Do("MULTI")
+	ok(t, err)
+	_, err = c.Do("EVAL", `redis.call("INCR", "counter"); return redis.call("GET", "aap")`, 0)
+	ok(t, err)
+	_, err = c.Do("DEL", "aap")
+	ok(t, err)
+	_, err = c.Do("EXEC")
+	ok(t, err)
+	_, err = c.Do("CONFIG", "GET", "dir")
+	ok(t, err)
+	equals(t,
+		[]string{
+			addr + " SET",
+			addr + " MULTI",
+			"lua INCR",
+			"lua GET",
+			addr + " EVAL",
+			addr + " DEL",
+			addr + " EXEC",
+			addr + " CONFIG",
+		},
+		commands(),
+	)
+
+	t.Run("discard", func(t *testing.T) {
+		_, err = c.Do("MULTI")
+		ok(t, err)
+		_, err = c.Do("SET", "aap", "noot")
+		ok(t, err)
+		_, err = c.Do("DISCARD")
+		ok(t, err)
+		equals(t,
+			[]string{
+				addr + " MULTI",
+				addr + " DISCARD",
+			},
+			commands(),
+		)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		s.OnCommand(nil)
+		_, err = c.Do("PING")
+		ok(t, err)
+		equals(t, []string(nil), commands())
+	})
+}
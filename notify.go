@@ -0,0 +1,137 @@
+package miniredis
+
+// Keyspace notifications. See https://redis.io/topics/notifications
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Keyspace notification classes.
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZset                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m
+	notifyModule               // d
+	notifyNew                  // n
+
+	// A
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet |
+		notifyHash | notifyZset | notifyExpired | notifyEvicted |
+		notifyStream | notifyModule
+)
+
+var errInvalidNotifyFlags = errors.New(msgInvalidNotifyFlags)
+
+// parseNotifyFlags parses a notify-keyspace-events value, such as "KEA".
+func parseNotifyFlags(s string) (int, error) {
+	flags := 0
+	for _, c := range s {
+		switch c {
+		case 'A':
+			flags |= notifyAll
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZset
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 't':
+			flags |= notifyStream
+		case 'm':
+			flags |= notifyKeyMiss
+		case 'd':
+			flags |= notifyModule
+		case 'n':
+			flags |= notifyNew
+		default:
+			return 0, errInvalidNotifyFlags
+		}
+	}
+	return flags, nil
+}
+
+// notifyFlagsString is the reverse of parseNotifyFlags(), in the same order
+// Redis uses.
+func notifyFlagsString(flags int) string {
+	s := ""
+	if flags&notifyAll == notifyAll {
+		s += "A"
+	} else {
+		for _, f := range []struct {
+			flag int
+			c    string
+		}{
+			{notifyGeneric, "g"},
+			{notifyString, "$"},
+			{notifyList, "l"},
+			{notifySet, "s"},
+			{notifyHash, "h"},
+			{notifyZset, "z"},
+			{notifyExpired, "x"},
+			{notifyEvicted, "e"},
+			{notifyStream, "t"},
+			{notifyModule, "d"},
+		} {
+			if flags&f.flag != 0 {
+				s += f.c
+			}
+		}
+	}
+	if flags&notifyKeyspace != 0 {
+		s += "K"
+	}
+	if flags&notifyKeyevent != 0 {
+		s += "E"
+	}
+	if flags&notifyKeyMiss != 0 {
+		s += "m"
+	}
+	if flags&notifyNew != 0 {
+		s += "n"
+	}
+	return s
+}
+
+// notify publishes a keyspace and/or keyevent message, if enabled for the
+// class. Needs the lock.
+func (m *Miniredis) notify(db int, class int, event, key string) {
+	flags := m.notifyEvents
+	if flags&class == 0 {
+		return
+	}
+	if flags&notifyKeyspace != 0 {
+		m.publish(fmt.Sprintf("__keyspace@%d__:%s", db, key), event)
+	}
+	if flags&notifyKeyevent != 0 {
+		m.publish(fmt.Sprintf("__keyevent@%d__:%s", db, event), key)
+	}
+}
+
+// notify publishes a keyspace event for a key in this DB. Needs the lock.
+func (db *RedisDB) notify(class int, event, key string) {
+	db.master.notify(db.id, class, event, key)
+}
@@ -0,0 +1,156 @@
+package miniredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestNotify(t *testing.T) {
+	s, c, done := setup(t)
+	defer done()
+	sub, err := redis.Dial("tcp", s.Addr(), redis.DialReadTimeout(time.Second))
+	ok(t, err)
+	defer sub.Close()
+
+	_, err = sub.Do("PSUBSCRIBE", "__key*__:*")
+	ok(t, err)
+
+	// receive expects the next n pmessages, as channel and payload.
+	receive := func(t *testing.T, want ...string) {
+		t.Helper()
+		var have []string
+		for i := 0; i < len(want)/2; i++ {
+			msg, err := redis.Strings(sub.Receive())
+			ok(t, err)
+			have = append(have, msg[2], msg[3])
+		}
+		equals(t, want, have)
+	}
+
+	t.Run("config", func(t *testing.T) {
+		v, err := redis.Strings(c.Do("CONFIG", "GET", "notify-keyspace-events"))
+		ok(t, err)
+		equals(t, []string{"notify-keyspace-events", ""}, v)
+
+		_, err = c.Do("CONFIG", "SET", "notify-keyspace-events", "KEA")
+		ok(t, err)
+		v, err = redis.Strings(c.Do("CONFIG", "GET", "notify-*"))
+		ok(t, err)
+		equals(t, []string{"notify-keyspace-events", "AKE"}, v)
+
+		ok(t, s.SetNotifyKeyspaceEvents("Elg"))
+		v, err = redis.Strings(c.Do("CONFIG", "GET", "notify-keyspace-events"))
+		ok(t, err)
+		equals(t, []string{"notify-keyspace-events", "glE"}, v)
+
+		_, err = c.Do("CONFIG", "SET", "notify-keyspace-events", "foo")
+		mustFail(t, err, "ERR CONFIG SET failed (possibly related to argument 'notify-keyspace-events') - Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+		mustFail(t, s.SetNotifyKeyspaceEvents("foo"), "Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+		_, err = c.Do("CONFIG", "SET", "nosuch", "foo")
+		mustFail(t, err, "ERR Unknown option or number of arguments for CONFIG SET - 'nosuch'")
+		_, err = c.Do("CONFIG", "GET")
+		mustFail(t, err, "ERR Unknown subcommand or wrong number of arguments for 'GET'. Try CONFIG HELP.")
+	})
+
+	t.Run("string", func(t *testing.T) {
+		ok(t, s.SetNotifyKeyspaceEvents("KEA"))
+		_, err := c.Do("SET", "foo", "bar", "EX", "10")
+		ok(t, err)
+		receive(t,
+			"__keyspace@0__:foo", "set",
+			"__keyevent@0__:set", "foo",
+			"__keyspace@0__:foo", "expire",
+			"__keyevent@0__:expire", "foo",
+		)
+
+		_, err = c.Do("INCR", "counter")
+		ok(t, err)
+		receive(t,
+			"__keyspace@0__:counter", "incrby",
+			"__keyevent@0__:incrby", "counter",
+		)
+	})
+
+	t.Run("classes", func(t *testing.T) {
+		// only keyevents for the generic and list classes
+		ok(t, s.SetNotifyKeyspaceEvents("Egl"))
+
+		_, err := c.Do("SET", "str", "value")
+		ok(t, err)
+		_, err = c.Do("RPUSH", "list", "aap")
+		ok(t, err)
+		receive(t, "__keyevent@0__:rpush", "list")
+		_, err = c.Do("LPOP", "list")
+		ok(t, err)
+		receive(t,
+			"__keyevent@0__:lpop", "list",
+			"__keyevent@0__:del", "list",
+		)
+
+		_, err = c.Do("RENAME", "str", "str2")
+		ok(t, err)
+		receive(t,
+			"__keyevent@0__:rename_from", "str",
+			"__keyevent@0__:rename_to", "str2",
+		)
+
+		_, err = c.Do("DEL", "str2", "nosuch")
+		ok(t, err)
+		receive(t, "__keyevent@0__:del", "str2")
+	})
+
+	t.Run("types", func(t *testing.T) {
+		ok(t, s.SetNotifyKeyspaceEvents("EA"))
+
+		_, err := c.Do("HSET", "hash", "aap", "noot")
+		ok(t, err)
+		receive(t, "__keyevent@0__:hset", "hash")
+
+		_, err = c.Do("SADD", "set", "aap")
+		ok(t, err)
+		receive(t, "__keyevent@0__:sadd", "set")
+
+		_, err = c.Do("ZADD", "zset", "1", "aap")
+		ok(t, err)
+		receive(t, "__keyevent@0__:zadd", "zset")
+		_, err = c.Do("ZREM", "zset", "aap")
+		ok(t, err)
+		receive(t,
+			"__keyevent@0__:zrem", "zset",
+			"__keyevent@0__:del", "zset",
+		)
+
+		_, err = c.Do("XADD", "stream", "*", "aap", "noot")
+		ok(t, err)
+		receive(t, "__keyevent@0__:xadd", "stream")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ok(t, s.SetNotifyKeyspaceEvents("Ex"))
+
+		_, err := c.Do("SET", "foo", "bar", "EX", "10")
+		ok(t, err)
+		s.FastForward(11 * time.Second)
+		receive(t, "__keyevent@0__:expired", "foo")
+	})
+
+	t.Run("other db", func(t *testing.T) {
+		ok(t, s.SetNotifyKeyspaceEvents("KA"))
+
+		_, err := c.Do("SELECT", "3")
+		ok(t, err)
+		_, err = c.Do("SET", "foo", "bar")
+		ok(t, err)
+		receive(t, "__keyspace@3__:foo", "set")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ok(t, s.SetNotifyKeyspaceEvents(""))
+		_, err := c.Do("SET", "foo", "bar")
+		ok(t, err)
+		_, err = sub.Receive()
+		assert(t, err != nil, "no message expected")
+	})
+}
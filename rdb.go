@@ -0,0 +1,1104 @@
+package miniredis
+
+// Reading and writing the Redis RDB format. We write the same as Redis 7.0
+// does with its default config, and we can read what any Redis since 2.6
+// writes, as long as it doesn't use modules.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	rdbVersion = 10
+
+	rdbTypeString          = 0
+	rdbTypeList            = 1
+	rdbTypeSet             = 2
+	rdbTypeZset            = 3
+	rdbTypeHash            = 4
+	rdbTypeZset2           = 5
+	rdbTypeListZiplist     = 10
+	rdbTypeSetIntset       = 11
+	rdbTypeZsetZiplist     = 12
+	rdbTypeHashZiplist     = 13
+	rdbTypeListQuicklist   = 14
+	rdbTypeStreamListpacks = 15
+	rdbTypeHashListpack    = 16
+	rdbTypeZsetListpack    = 17
+	rdbTypeListQuicklist2  = 18
+	rdbTypeStreamListpack2 = 19
+	rdbTypeSetListpack     = 20
+	rdbTypeStreamListpack3 = 21
+
+	rdbOpFunction2    = 245
+	rdbOpModuleAux    = 247
+	rdbOpIdle         = 248
+	rdbOpFreq         = 249
+	rdbOpAux          = 250
+	rdbOpResizeDB     = 251
+	rdbOpExpireTimeMs = 252
+	rdbOpExpireTime   = 253
+	rdbOpSelectDB     = 254
+	rdbOpEOF          = 255
+
+	// limits for the compact encodings, the Redis defaults
+	rdbMaxIntset         = 512
+	rdbMaxListpackLen    = 128
+	rdbMaxListpackValue  = 64
+	rdbMaxQuicklistNode  = 8192
+	rdbStreamMaxBytes    = 4096
+	rdbStreamMaxEntries  = 100
+	rdbStreamSameFields  = 2
+	rdbStreamDeleted     = 1
+	rdbQuicklistPacked   = 2
+	rdbQuicklistPlain    = 1
+	rdbStreamIDSize      = 16
+	rdbEncInt8           = 0
+	rdbEncInt16          = 1
+	rdbEncInt32          = 2
+	rdbEncLZF            = 3
+	rdbCompressMinLength = 20
+)
+
+var (
+	errInvalidRDB  = errors.New("invalid RDB data")
+	errDumpPayload = errors.New("invalid DUMP payload")
+)
+
+// SaveRDB writes all databases in the Redis RDB format.
+func (m *Miniredis) SaveRDB(w io.Writer) error {
+	m.Lock()
+	b := m.encodeRDB()
+	m.Unlock()
+
+	_, err := w.Write(b)
+	return err
+}
+
+// LoadRDB replaces all databases with the content of an RDB file, such as a
+// dump.rdb written by Redis. Keys with a TTL in the past are skipped.
+func (m *Miniredis) LoadRDB(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	defer m.signal.Broadcast()
+	return m.decodeRDB(b)
+}
+
+// SetRDBFile sets the file SAVE and BGSAVE write to. Defaults to "dump.rdb",
+// in the current directory. This sets both the "dir" and the "dbfilename"
+// config parameters.
+func (m *Miniredis) SetRDBFile(filename string) {
+	m.Lock()
+	defer m.Unlock()
+	m.dir, m.dbFilename = filepath.Split(filename)
+	if m.dir != "" {
+		m.dir = filepath.Clean(m.dir)
+	}
+}
+
+// saveRDBFile writes the RDB to the configured file. No locks!
+func (m *Miniredis) saveRDBFile() error {
+	b := m.encodeRDB()
+	tmp := filepath.Join(m.dir, fmt.Sprintf("temp-%d.rdb", os.Getpid()))
+	m.lastSaveFailed = true
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.rdbPath()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	m.lastSave = m.effectiveNow()
+	m.lastSaveFailed = false
+	m.dirty = 0
+	return nil
+}
+
+// encodeRDB makes a complete RDB file. No locks!
+func (m *Miniredis) encodeRDB() []byte {
+	e := &rdbEncoder{}
+	e.raw([]byte(fmt.Sprintf("REDIS%04d", rdbVersion)))
+	e.aux("redis-ver", redisVersion)
+	e.aux("redis-bits", "64")
+	e.aux("ctime", strconv.FormatInt(m.effectiveNow().Unix(), 10))
+	e.aux("used-mem", "0")
+	e.aux("aof-base", "0")
+
+	var ids []int
+	for id := range m.dbs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		db := m.dbs[id]
+		if len(db.keys) == 0 {
+			continue
+		}
+		e.byte(rdbOpSelectDB)
+		e.len(uint64(id))
+		e.byte(rdbOpResizeDB)
+		e.len(uint64(len(db.keys)))
+		expires := 0
+		for k := range db.ttl {
+			if db.exists(k) {
+				expires++
+			}
+		}
+		e.len(uint64(expires))
+
+		for _, k := range db.allKeys() {
+			if ttl, ok := db.ttlLeft(k); ok {
+				e.byte(rdbOpExpireTimeMs)
+				e.ms(m.effectiveNow().Add(ttl))
+			}
+			e.value(db, k)
+		}
+	}
+	e.byte(rdbOpEOF)
+	crc := crc64Update(0, e.buf)
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], crc)
+	return e.buf
+}
+
+// decodeRDB loads a complete RDB file. No locks!
+func (m *Miniredis) decodeRDB(b []byte) error {
+	if len(b) < 9 || string(b[:5]) != "REDIS" {
+		return errInvalidRDB
+	}
+	version, err := strconv.Atoi(string(b[5:9]))
+	if err != nil || version < 1 || version > 12 {
+		return fmt.Errorf("unsupported RDB version: %q", b[5:9])
+	}
+
+	for _, db := range m.dbs {
+		db.flush()
+	}
+	d := &rdbDecoder{buf: b, pos: 9}
+	var (
+		db     = m.db(0)
+		expire time.Time
+	)
+	for d.err == nil {
+		op := d.byte()
+		switch op {
+		case rdbOpEOF:
+			if version >= 5 && d.pos+8 <= len(b) {
+				want := binary.LittleEndian.Uint64(b[d.pos:])
+				if want != 0 && want != crc64Update(0, b[:d.pos]) {
+					return errors.New("RDB checksum mismatch")
+				}
+			}
+			return nil
+		case rdbOpSelectDB:
+			db = m.db(int(d.len()))
+		case rdbOpResizeDB:
+			d.len()
+			d.len()
+		case rdbOpAux:
+			d.string()
+			d.string()
+		case rdbOpExpireTimeMs:
+			expire = d.ms()
+		case rdbOpExpireTime:
+			expire = time.Unix(int64(d.uint32()), 0)
+		case rdbOpIdle:
+			d.len()
+		case rdbOpFreq:
+			d.byte()
+		case rdbOpFunction2:
+			d.string()
+		case rdbOpModuleAux:
+			return errors.New("RDB modules are not supported")
+		default:
+			key := d.string()
+			if d.err != nil {
+				break
+			}
+			db.del(key, true)
+			d.value(db, key, op)
+			if !expire.IsZero() {
+				if ttl := expire.Sub(m.effectiveNow()); ttl > 0 {
+					db.setTTL(key, ttl)
+				} else {
+					db.del(key, true)
+				}
+				expire = time.Time{}
+			}
+		}
+	}
+	return d.err
+}
+
+// rdbEncoder writes RDB data.
+type rdbEncoder struct {
+	buf []byte
+}
+
+func (e *rdbEncoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *rdbEncoder) raw(b []byte) {
+	e.buf = append(e.buf, b...)
+}
+
+func (e *rdbEncoder) len(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.buf = append(e.buf, byte(n))
+	case n < 1<<14:
+		e.buf = append(e.buf, 0x40|byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0x80, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(n))
+	default:
+		e.buf = append(e.buf, 0x81, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], n)
+	}
+}
+
+// string writes a string, as an integer or compressed when possible.
+func (e *rdbEncoder) string(s string) {
+	if len(s) <= 11 {
+		if v, ok := strictInt(s); ok {
+			switch {
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				e.buf = append(e.buf, 0xC0|rdbEncInt8, byte(v))
+				return
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				e.buf = append(e.buf, 0xC0|rdbEncInt16, byte(v), byte(v>>8))
+				return
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				e.buf = append(e.buf, 0xC0|rdbEncInt32, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+				return
+			}
+		}
+	}
+	if len(s) > rdbCompressMinLength {
+		if c := lzfCompress([]byte(s), len(s)-4); c != nil {
+			e.byte(0xC0 | rdbEncLZF)
+			e.len(uint64(len(c)))
+			e.len(uint64(len(s)))
+			e.raw(c)
+			return
+		}
+	}
+	e.len(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *rdbEncoder) aux(k, v string) {
+	e.byte(rdbOpAux)
+	e.string(k)
+	e.string(v)
+}
+
+// ms writes a millisecond timestamp.
+func (e *rdbEncoder) ms(t time.Time) {
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], uint64(t.UnixNano()/int64(time.Millisecond)))
+}
+
+func (e *rdbEncoder) double(f float64) {
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(f))
+}
+
+func (e *rdbEncoder) streamID(id streamID) {
+	e.buf = append(e.buf, make([]byte, rdbStreamIDSize)...)
+	b := e.buf[len(e.buf)-rdbStreamIDSize:]
+	binary.BigEndian.PutUint64(b, id.ms)
+	binary.BigEndian.PutUint64(b[8:], id.seq)
+}
+
+// value writes the type, the key, and the value of a key.
+func (e *rdbEncoder) value(db *RedisDB, k string) {
+	var body rdbEncoder
+	typ := body.object(db, k)
+	e.byte(typ)
+	e.string(k)
+	e.raw(body.buf)
+}
+
+// object writes the value of a key, and returns the RDB type used.
+func (e *rdbEncoder) object(db *RedisDB, k string) byte {
+	switch db.t(k) {
+	case "string":
+		e.string(db.stringKeys[k])
+		return rdbTypeString
+	case "list":
+		e.list(db.listKeys[k])
+		return rdbTypeListQuicklist2
+	case "set":
+		return e.set(db.setKeys[k])
+	case "zset":
+		return e.zset(db.sortedsetKeys[k])
+	case "hash":
+		return e.hash(db.hashKeys[k])
+	case "stream":
+		e.stream(db.streamKeys[k])
+		return rdbTypeStreamListpack2
+	default:
+		panic("unhandled key type")
+	}
+}
+
+// list writes a quicklist, with the same node sizes Redis uses when all
+// elements are added with RPUSH.
+func (e *rdbEncoder) list(l listKey) {
+	var (
+		nodes []*listpack
+		lp    *listpack
+	)
+	for _, v := range l {
+		overhead := 1
+		if len(v) >= 254 {
+			overhead = 5
+		}
+		switch {
+		case len(v) < 64:
+			overhead++
+		case len(v) < 16384:
+			overhead += 2
+		default:
+			overhead += 5
+		}
+		if lp == nil || lp.size()+len(v)+overhead > rdbMaxQuicklistNode {
+			lp = &listpack{}
+			nodes = append(nodes, lp)
+		}
+		lp.appendString(v)
+	}
+	e.len(uint64(len(nodes)))
+	for _, lp := range nodes {
+		e.len(rdbQuicklistPacked)
+		e.string(string(lp.bytes()))
+	}
+}
+
+func (e *rdbEncoder) set(s setKey) byte {
+	members := make([]string, 0, len(s))
+	for k := range s {
+		members = append(members, k)
+	}
+	sort.Strings(members)
+
+	if len(members) <= rdbMaxIntset {
+		var ints []int64
+		for _, k := range members {
+			v, ok := strictInt(k)
+			if !ok {
+				ints = nil
+				break
+			}
+			ints = append(ints, v)
+		}
+		if ints != nil {
+			e.string(string(encodeIntset(ints)))
+			return rdbTypeSetIntset
+		}
+	}
+	e.len(uint64(len(members)))
+	for _, k := range members {
+		e.string(k)
+	}
+	return rdbTypeSet
+}
+
+func (e *rdbEncoder) zset(ss sortedSet) byte {
+	elems := ss.byScore(asc)
+	small := len(elems) <= rdbMaxListpackLen
+	for _, el := range elems {
+		if len(el.member) > rdbMaxListpackValue {
+			small = false
+		}
+	}
+	if small {
+		lp := &listpack{}
+		for _, el := range elems {
+			lp.appendString(el.member)
+			lp.appendString(rdbFormatScore(el.score))
+		}
+		e.string(string(lp.bytes()))
+		return rdbTypeZsetListpack
+	}
+	e.len(uint64(len(elems)))
+	for i := len(elems) - 1; i >= 0; i-- {
+		e.string(elems[i].member)
+		e.double(elems[i].score)
+	}
+	return rdbTypeZset2
+}
+
+func (e *rdbEncoder) hash(h hashKey) byte {
+	fields := make([]string, 0, len(h))
+	small := len(h) <= rdbMaxListpackLen
+	for f, v := range h {
+		fields = append(fields, f)
+		if len(f) > rdbMaxListpackValue || len(v) > rdbMaxListpackValue {
+			small = false
+		}
+	}
+	sort.Strings(fields)
+	if small {
+		lp := &listpack{}
+		for _, f := range fields {
+			lp.appendString(f)
+			lp.appendString(h[f])
+		}
+		e.string(string(lp.bytes()))
+		return rdbTypeHashListpack
+	}
+	e.len(uint64(len(fields)))
+	for _, f := range fields {
+		e.string(f)
+		e.string(h[f])
+	}
+	return rdbTypeHash
+}
+
+// stream writes a stream in the Redis 7.0 format. Entries are split in
+// listpack nodes the same way Redis does when they are added with XADD.
+func (e *rdbEncoder) stream(s *streamKey) {
+	var (
+		nodes []*rdbStreamNode
+		n     *rdbStreamNode
+	)
+	for _, entry := range s.entries {
+		id := mustParseStreamID(entry.ID)
+		var fields []string
+		size := 0
+		for i, v := range entry.Values {
+			if i%2 == 0 {
+				fields = append(fields, v)
+			}
+			size += len(v)
+		}
+		if n == nil || n.lpSize()+size >= rdbStreamMaxBytes || n.count >= rdbStreamMaxEntries {
+			n = &rdbStreamNode{master: id, fields: fields, lp: &listpack{}}
+			nodes = append(nodes, n)
+		}
+		same := len(fields) == len(n.fields)
+		for i := range fields {
+			if same && fields[i] != n.fields[i] {
+				same = false
+			}
+		}
+		flags := int64(0)
+		if same {
+			flags = rdbStreamSameFields
+		}
+		n.lp.appendInt(flags)
+		n.lp.appendInt(int64(id.ms - n.master.ms))
+		n.lp.appendInt(int64(id.seq - n.master.seq))
+		lpCount := int64(len(fields) + 3)
+		if same {
+			for i := 1; i < len(entry.Values); i += 2 {
+				n.lp.appendString(entry.Values[i])
+			}
+		} else {
+			n.lp.appendInt(int64(len(fields)))
+			for _, v := range entry.Values {
+				n.lp.appendString(v)
+			}
+			lpCount += int64(len(fields) + 1)
+		}
+		n.lp.appendInt(lpCount)
+		n.count++
+	}
+
+	e.len(uint64(len(nodes)))
+	for _, n := range nodes {
+		e.streamIDString(n.master)
+		e.string(string(n.listpack().bytes()))
+	}
+	e.len(uint64(len(s.entries)))
+	e.len(s.lastID.ms)
+	e.len(s.lastID.seq)
+	var first streamID
+	if len(s.entries) > 0 {
+		first = mustParseStreamID(s.entries[0].ID)
+	}
+	e.len(first.ms)
+	e.len(first.seq)
+	e.len(s.maxDeletedID.ms)
+	e.len(s.maxDeletedID.seq)
+	e.len(s.entriesAdded)
+
+	var groups []string
+	for name := range s.groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	e.len(uint64(len(groups)))
+	for _, name := range groups {
+		g := s.groups[name]
+		e.string(name)
+		e.len(g.lastID.ms)
+		e.len(g.lastID.seq)
+		e.len(g.entriesRead)
+		e.len(uint64(len(g.pending)))
+		for _, p := range g.pending {
+			e.streamID(p.id)
+			e.ms(p.lastDelivery)
+			e.len(uint64(p.deliveryCount))
+		}
+		names := g.consumerNames()
+		e.len(uint64(len(names)))
+		for _, cn := range names {
+			c := g.consumers[cn]
+			e.string(cn)
+			e.ms(c.seenTime)
+			var ids []streamID
+			for _, p := range g.pending {
+				if p.consumer == cn {
+					ids = append(ids, p.id)
+				}
+			}
+			e.len(uint64(len(ids)))
+			for _, id := range ids {
+				e.streamID(id)
+			}
+		}
+	}
+}
+
+func (e *rdbEncoder) streamIDString(id streamID) {
+	var b rdbEncoder
+	b.streamID(id)
+	e.string(string(b.buf))
+}
+
+// rdbDecoder reads RDB data. After an error all reads return zero values, and
+// the error is in err.
+type rdbDecoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *rdbDecoder) fail() {
+	if d.err == nil {
+		d.err = errInvalidRDB
+	}
+}
+
+func (d *rdbDecoder) raw(n int) []byte {
+	if d.err != nil || n < 0 || d.pos+n > len(d.buf) {
+		d.fail()
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *rdbDecoder) byte() byte {
+	b := d.raw(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *rdbDecoder) uint32() uint32 {
+	b := d.raw(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *rdbDecoder) uint64() uint64 {
+	b := d.raw(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// length reads a length, or the type of a special encoded string.
+func (d *rdbDecoder) length() (uint64, bool) {
+	b := d.byte()
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false
+	case 1:
+		return uint64(b&0x3f)<<8 | uint64(d.byte()), false
+	case 2:
+		switch b {
+		case 0x80:
+			v := d.raw(4)
+			if v == nil {
+				return 0, false
+			}
+			return uint64(binary.BigEndian.Uint32(v)), false
+		case 0x81:
+			v := d.raw(8)
+			if v == nil {
+				return 0, false
+			}
+			return binary.BigEndian.Uint64(v), false
+		}
+		d.fail()
+		return 0, false
+	default:
+		return uint64(b & 0x3f), true
+	}
+}
+
+func (d *rdbDecoder) len() uint64 {
+	n, enc := d.length()
+	if enc {
+		d.fail()
+	}
+	return n
+}
+
+// count reads a length which is used for a number of elements.
+func (d *rdbDecoder) count() int {
+	n := d.len()
+	if n > uint64(len(d.buf)) {
+		// can't be right, every element takes at least a byte
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *rdbDecoder) string() string {
+	n, enc := d.length()
+	if !enc {
+		if n > uint64(len(d.buf)) {
+			d.fail()
+			return ""
+		}
+		return string(d.raw(int(n)))
+	}
+	switch n {
+	case rdbEncInt8:
+		return strconv.FormatInt(leInt(d.raw(1)), 10)
+	case rdbEncInt16:
+		return strconv.FormatInt(leInt(d.raw(2)), 10)
+	case rdbEncInt32:
+		return strconv.FormatInt(leInt(d.raw(4)), 10)
+	case rdbEncLZF:
+		clen := d.count()
+		l := d.len()
+		c := d.raw(clen)
+		if d.err != nil || l > math.MaxInt32 {
+			d.fail()
+			return ""
+		}
+		b, err := lzfDecompress(c, int(l))
+		if err != nil {
+			d.err = err
+			return ""
+		}
+		return string(b)
+	}
+	d.fail()
+	return ""
+}
+
+func (d *rdbDecoder) ms() time.Time {
+	return time.Unix(0, int64(d.uint64())*int64(time.Millisecond))
+}
+
+func (d *rdbDecoder) double() float64 {
+	return math.Float64frombits(d.uint64())
+}
+
+// stringDouble reads a double in the old, ASCII, format.
+func (d *rdbDecoder) stringDouble() float64 {
+	switch l := d.byte(); l {
+	case 253:
+		return math.NaN()
+	case 254:
+		return math.Inf(1)
+	case 255:
+		return math.Inf(-1)
+	default:
+		f, err := strconv.ParseFloat(string(d.raw(int(l))), 64)
+		if err != nil {
+			d.fail()
+		}
+		return f
+	}
+}
+
+func (d *rdbDecoder) streamID() streamID {
+	b := d.raw(rdbStreamIDSize)
+	if b == nil {
+		return streamID{}
+	}
+	return streamID{binary.BigEndian.Uint64(b), binary.BigEndian.Uint64(b[8:])}
+}
+
+// decoded checks the result of a listpack, ziplist, or intset decode.
+func (d *rdbDecoder) decoded(vs []string, err error) []string {
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	return vs
+}
+
+// value reads a value of the given RDB type into the key.
+func (d *rdbDecoder) value(db *RedisDB, k string, typ byte) {
+	switch typ {
+	case rdbTypeString:
+		v := d.string()
+		if d.err == nil {
+			db.stringSet(k, v)
+		}
+	case rdbTypeList:
+		n := d.count()
+		var l []string
+		for i := 0; i < n && d.err == nil; i++ {
+			l = append(l, d.string())
+		}
+		d.setList(db, k, l)
+	case rdbTypeListZiplist:
+		d.setList(db, k, d.decoded(decodeZiplist([]byte(d.string()))))
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		n := d.count()
+		var l []string
+		for i := 0; i < n && d.err == nil; i++ {
+			if typ == rdbTypeListQuicklist {
+				l = append(l, d.decoded(decodeZiplist([]byte(d.string())))...)
+				continue
+			}
+			container := d.len()
+			v := d.string()
+			if container == rdbQuicklistPlain {
+				l = append(l, v)
+				continue
+			}
+			l = append(l, d.decoded(decodeListpack([]byte(v)))...)
+		}
+		d.setList(db, k, l)
+	case rdbTypeSet:
+		n := d.count()
+		var members []string
+		for i := 0; i < n && d.err == nil; i++ {
+			members = append(members, d.string())
+		}
+		d.setSet(db, k, members)
+	case rdbTypeSetIntset:
+		d.setSet(db, k, d.decoded(decodeIntset([]byte(d.string()))))
+	case rdbTypeSetListpack:
+		d.setSet(db, k, d.decoded(decodeListpack([]byte(d.string()))))
+	case rdbTypeZset, rdbTypeZset2:
+		n := d.count()
+		ss := newSortedSet()
+		for i := 0; i < n && d.err == nil; i++ {
+			member := d.string()
+			if typ == rdbTypeZset {
+				ss.set(d.stringDouble(), member)
+			} else {
+				ss.set(d.double(), member)
+			}
+		}
+		if d.err == nil && len(ss) > 0 {
+			db.ssetSet(k, ss)
+		}
+	case rdbTypeZsetZiplist, rdbTypeZsetListpack:
+		var vs []string
+		if typ == rdbTypeZsetZiplist {
+			vs = d.decoded(decodeZiplist([]byte(d.string())))
+		} else {
+			vs = d.decoded(decodeListpack([]byte(d.string())))
+		}
+		if len(vs)%2 != 0 {
+			d.fail()
+		}
+		ss := newSortedSet()
+		for i := 0; i+1 < len(vs) && d.err == nil; i += 2 {
+			score, err := strconv.ParseFloat(vs[i+1], 64)
+			if err != nil {
+				d.fail()
+			}
+			ss.set(score, vs[i])
+		}
+		if d.err == nil && len(ss) > 0 {
+			db.ssetSet(k, ss)
+		}
+	case rdbTypeHash:
+		n := d.count()
+		var vs []string
+		for i := 0; i < n && d.err == nil; i++ {
+			vs = append(vs, d.string(), d.string())
+		}
+		d.setHash(db, k, vs)
+	case rdbTypeHashZiplist:
+		d.setHash(db, k, d.decoded(decodeZiplist([]byte(d.string()))))
+	case rdbTypeHashListpack:
+		d.setHash(db, k, d.decoded(decodeListpack([]byte(d.string()))))
+	case rdbTypeStreamListpacks, rdbTypeStreamListpack2, rdbTypeStreamListpack3:
+		d.stream(db, k, typ)
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unsupported RDB type: %d", typ)
+		}
+	}
+}
+
+func (d *rdbDecoder) setList(db *RedisDB, k string, l []string) {
+	if d.err != nil || len(l) == 0 {
+		return
+	}
+	db.listPush(k, l...)
+}
+
+func (d *rdbDecoder) setSet(db *RedisDB, k string, members []string) {
+	if d.err != nil || len(members) == 0 {
+		return
+	}
+	db.setAdd(k, members...)
+}
+
+func (d *rdbDecoder) setHash(db *RedisDB, k string, vs []string) {
+	if len(vs)%2 != 0 {
+		d.fail()
+	}
+	if d.err != nil {
+		return
+	}
+	for i := 0; i+1 < len(vs); i += 2 {
+		db.hashSet(k, vs[i], vs[i+1])
+	}
+}
+
+func (d *rdbDecoder) stream(db *RedisDB, k string, typ byte) {
+	s := newStreamKey()
+	nodes := d.count()
+	for i := 0; i < nodes && d.err == nil; i++ {
+		key := d.string()
+		vs := d.decoded(decodeListpack([]byte(d.string())))
+		if d.err != nil {
+			return
+		}
+		if len(key) != rdbStreamIDSize {
+			d.fail()
+			return
+		}
+		master := streamID{
+			binary.BigEndian.Uint64([]byte(key)),
+			binary.BigEndian.Uint64([]byte(key[8:])),
+		}
+		entries, err := decodeStreamNode(master, vs)
+		if err != nil {
+			d.err = err
+			return
+		}
+		s.entries = append(s.entries, entries...)
+	}
+
+	d.len() // length
+	s.lastID = streamID{d.len(), d.len()}
+	if typ >= rdbTypeStreamListpack2 {
+		d.len() // first ID
+		d.len()
+		s.maxDeletedID = streamID{d.len(), d.len()}
+		s.entriesAdded = d.len()
+	} else {
+		s.entriesAdded = uint64(len(s.entries))
+	}
+
+	groups := d.count()
+	for i := 0; i < groups && d.err == nil; i++ {
+		name := d.string()
+		lastID := streamID{d.len(), d.len()}
+		s.createGroup(name, lastID)
+		g := s.groups[name]
+		if typ >= rdbTypeStreamListpack2 {
+			g.entriesRead = d.len()
+		} else {
+			g.entriesRead = uint64(s.search(lastID))
+		}
+
+		pending := d.count()
+		for j := 0; j < pending && d.err == nil; j++ {
+			g.pending = append(g.pending, pendingEntry{
+				id:            d.streamID(),
+				lastDelivery:  d.ms(),
+				deliveryCount: int(d.len()),
+			})
+		}
+		consumers := d.count()
+		for j := 0; j < consumers && d.err == nil; j++ {
+			c := g.consumer(d.string(), d.ms())
+			if typ >= rdbTypeStreamListpack3 {
+				c.activeTime = d.ms()
+			}
+			ids := d.count()
+			for n := 0; n < ids && d.err == nil; n++ {
+				if p, ok := g.getPending(d.streamID()); ok {
+					p.consumer = c.name
+				}
+			}
+		}
+	}
+	if d.err == nil {
+		db.del(k, true)
+		db.keys[k] = "stream"
+		db.streamKeys[k] = s
+		db.modified(k)
+	}
+}
+
+// decodeStreamNode returns all live entries from a stream listpack node.
+func decodeStreamNode(master streamID, vs []string) ([]StreamEntry, error) {
+	var (
+		p   = 0
+		err error
+	)
+	next := func() string {
+		if p >= len(vs) {
+			err = errInvalidRDB
+			return ""
+		}
+		p++
+		return vs[p-1]
+	}
+	nextInt := func() int64 {
+		v, e := strconv.ParseInt(next(), 10, 64)
+		if e != nil {
+			err = errInvalidRDB
+		}
+		return v
+	}
+
+	nextInt() // count
+	nextInt() // deleted
+	fields := make([]string, nextInt())
+	for i := range fields {
+		fields[i] = next()
+	}
+	nextInt() // master terminator
+
+	var entries []StreamEntry
+	for p < len(vs) && err == nil {
+		flags := nextInt()
+		id := streamID{
+			master.ms + uint64(nextInt()),
+			master.seq + uint64(nextInt()),
+		}
+		var values []string
+		if flags&rdbStreamSameFields != 0 {
+			for _, f := range fields {
+				values = append(values, f, next())
+			}
+		} else {
+			n := nextInt()
+			for i := int64(0); i < n && err == nil; i++ {
+				values = append(values, next(), next())
+			}
+		}
+		nextInt() // lp-count
+		if flags&rdbStreamDeleted == 0 {
+			entries = append(entries, StreamEntry{ID: id.String(), Values: values})
+		}
+	}
+	return entries, err
+}
+
+// rdbStreamNode is a listpack node of a stream.
+type rdbStreamNode struct {
+	master streamID
+	fields []string
+	lp     *listpack // all entries, without the master entry
+	count  int
+}
+
+// listpack gives the complete listpack, with the master entry.
+func (n *rdbStreamNode) listpack() *listpack {
+	lp := &listpack{}
+	lp.appendInt(int64(n.count))
+	lp.appendInt(0) // deleted
+	lp.appendInt(int64(len(n.fields)))
+	for _, f := range n.fields {
+		lp.appendString(f)
+	}
+	lp.appendInt(0) // master terminator
+	lp.buf = append(lp.buf, n.lp.buf...)
+	lp.n += n.lp.n
+	return lp
+}
+
+func (n *rdbStreamNode) lpSize() int {
+	return n.listpack().size()
+}
+
+// rdbFormatScore formats a sorted set score the way Redis 7.0 does in
+// listpacks.
+func rdbFormatScore(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == 0:
+		if math.Signbit(f) {
+			return "-0"
+		}
+		return "0"
+	case f > -(1<<52-1) && f < 1<<52 && f == math.Trunc(f):
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// dumpValue serializes a key the same way DUMP does: the RDB type and value,
+// followed by the RDB version and a CRC64 checksum.
+func dumpValue(db *RedisDB, k string) string {
+	var body rdbEncoder
+	typ := body.object(db, k)
+	e := &rdbEncoder{}
+	e.byte(typ)
+	e.raw(body.buf)
+	e.buf = append(e.buf, rdbVersion, 0)
+	crc := crc64Update(0, e.buf)
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], crc)
+	return string(e.buf)
+}
+
+// restoreValue decodes a DUMP payload into key k. Use an empty scratch DB,
+// since db can have partial data on errors.
+func restoreValue(db *RedisDB, k string, payload string) error {
+	b := []byte(payload)
+	if len(b) < 10 {
+		return errDumpPayload
+	}
+	footer := b[len(b)-10:]
+	version := binary.LittleEndian.Uint16(footer)
+	if version > 12 || binary.LittleEndian.Uint64(footer[2:]) != crc64Update(0, b[:len(b)-8]) {
+		return errDumpPayload
+	}
+
+	d := &rdbDecoder{buf: b[:len(b)-10]}
+	d.value(db, k, d.byte())
+	if d.err != nil || d.pos != len(d.buf) || !db.exists(k) {
+		return errInvalidRDB
+	}
+	return nil
+}
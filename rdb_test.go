@@ -0,0 +1,260 @@
+package miniredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestRDB(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	s.Set("str", "value")
+	s.Set("int", "-12345")
+	s.Set("long", strings.Repeat("compress me! ", 100))
+	s.SetTTL("str", time.Hour)
+	s.RPush("list", "aap", "noot", "12", "-5000")
+	for i := 0; i < 2000; i++ {
+		s.RPush("biglist", fmt.Sprintf("element %d", i))
+	}
+	s.SAdd("intset", "1", "-2", "300000", "7")
+	s.SAdd("set", "aap", "noot", "1")
+	s.HSet("hash", "aap", "noot")
+	s.HSet("hash", "mies", "100")
+	s.HSet("bighash", "long", strings.Repeat("x", 100))
+	s.ZAdd("zset", 1, "one")
+	s.ZAdd("zset", 1.5, "one and a half")
+	s.ZAdd("zset", math.Inf(-1), "min")
+	for i := 0; i < 200; i++ {
+		s.ZAdd("bigzset", float64(i)/3, fmt.Sprintf("m%d", i))
+	}
+	s.DB(3).Set("other", "db")
+	s.DB(3).SetTTL("other", time.Minute)
+
+	for i := 1; i <= 150; i++ {
+		_, err := c.Do("XADD", "stream", fmt.Sprintf("%d-%d", i/10+1, i), "name", "x", "n", i)
+		ok(t, err)
+	}
+	_, err = c.Do("XADD", "stream", "100-1", "other", "fields")
+	ok(t, err)
+	_, err = c.Do("XGROUP", "CREATE", "stream", "group", "0")
+	ok(t, err)
+	_, err = c.Do("XREADGROUP", "GROUP", "group", "alice", "COUNT", 3, "STREAMS", "stream", ">")
+	ok(t, err)
+	_, err = c.Do("XREADGROUP", "GROUP", "group", "bob", "COUNT", 2, "STREAMS", "stream", ">")
+	ok(t, err)
+
+	var buf bytes.Buffer
+	ok(t, s.SaveRDB(&buf))
+	equals(t, "REDIS0010", string(buf.Bytes()[:9]))
+
+	s2 := NewMiniRedis()
+	ok(t, s2.LoadRDB(bytes.NewReader(buf.Bytes())))
+	equals(t, s.Dump(), s2.Dump())
+	equals(t, s.Keys(), s2.Keys())
+	equals(t, time.Hour, s2.TTL("str").Round(time.Second))
+	equals(t, time.Duration(0), s2.TTL("list"))
+	equals(t, "db", s2.DB(3).stringKeys["other"])
+	equals(t, time.Minute, s2.DB(3).TTL("other").Round(time.Second))
+
+	st, st2 := s.dbs[0].streamKeys["stream"], s2.dbs[0].streamKeys["stream"]
+	equals(t, st.entries, st2.entries)
+	equals(t, st.lastID, st2.lastID)
+	equals(t, st.entriesAdded, st2.entriesAdded)
+	g, g2 := st.groups["group"], st2.groups["group"]
+	equals(t, g.lastID, g2.lastID)
+	equals(t, g.entriesRead, g2.entriesRead)
+	equals(t, g.consumerNames(), g2.consumerNames())
+	equals(t, len(g.pending), len(g2.pending))
+	for i, p := range g.pending {
+		equals(t, p.id, g2.pending[i].id)
+		equals(t, p.consumer, g2.pending[i].consumer)
+		equals(t, p.deliveryCount, g2.pending[i].deliveryCount)
+	}
+
+	t.Run("replaces", func(t *testing.T) {
+		s3 := NewMiniRedis()
+		s3.Set("gone", "soon")
+		ok(t, s3.LoadRDB(bytes.NewReader(buf.Bytes())))
+		equals(t, false, s3.Exists("gone"))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		s3 := NewMiniRedis()
+		s3.SetTime(time.Now().Add(2 * time.Hour))
+		ok(t, s3.LoadRDB(bytes.NewReader(buf.Bytes())))
+		equals(t, false, s3.Exists("str"))
+		equals(t, true, s3.Exists("list"))
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		b := append([]byte{}, buf.Bytes()...)
+		b[len(b)-20]++
+		mustFail(t, NewMiniRedis().LoadRDB(bytes.NewReader(b)), "RDB checksum mismatch")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		mustFail(t, NewMiniRedis().LoadRDB(strings.NewReader("nope")), "invalid RDB data")
+		mustFail(t, NewMiniRedis().LoadRDB(strings.NewReader("REDIS0010")), "invalid RDB data")
+		mustFail(t, NewMiniRedis().LoadRDB(strings.NewReader("REDIS0099")), `unsupported RDB version: "0099"`)
+	})
+}
+
+// testdata/dump.rdb is a Redis 7.2 (RDB version 11) file: the aux fields,
+// listpack, quicklist, and intset encodings, integer and LZF strings, and
+// expire and idle opcodes, laid out the way rdb.c writes them. It was
+// assembled byte by byte, not with rdbEncoder, so the decoder is checked
+// against the format and not against ourselves.
+func TestRDBFile(t *testing.T) {
+	f, err := os.Open("testdata/dump.rdb")
+	ok(t, err)
+	defer f.Close()
+
+	s := NewMiniRedis()
+	ok(t, s.LoadRDB(f))
+	equals(t, []string{"counter", "hash", "idle", "ints", "list", "long", "session", "set", "str", "zset"}, s.Keys())
+	equals(t, "hello", s.dbs[0].stringKeys["str"])
+	equals(t, "1000", s.dbs[0].stringKeys["counter"])
+	equals(t, strings.Repeat("a", 30), s.dbs[0].stringKeys["long"])
+	equals(t, "v", s.dbs[0].stringKeys["idle"])
+	assert(t, s.TTL("session") > 24*time.Hour, "session has a TTL")
+	equals(t, time.Duration(0), s.TTL("str"))
+	equals(t, false, s.Exists("gone"))
+
+	l, err := s.List("list")
+	ok(t, err)
+	equals(t, []string{"a", "b", "12", "-100", "-5000", "100000"}, l)
+	m, err := s.Members("ints")
+	ok(t, err)
+	equals(t, []string{"-2", "300", "7"}, m)
+	m, err = s.Members("set")
+	ok(t, err)
+	equals(t, []string{"1", "aap", "noot"}, m)
+	equals(t, "miniredis", s.HGet("hash", "name"))
+	equals(t, "42", s.HGet("hash", "n"))
+	zs, err := s.SortedSet("zset")
+	ok(t, err)
+	equals(t, map[string]float64{"one": 1, "half": 0.5}, zs)
+
+	equals(t, []string{"other"}, s.DB(1).Keys())
+	equals(t, "db", s.DB(1).stringKeys["other"])
+}
+
+// Older encodings, which Redis 7 doesn't write anymore.
+func TestRDBOldEncodings(t *testing.T) {
+	e := &rdbEncoder{}
+	e.raw([]byte("REDIS0009"))
+	e.byte(rdbOpAux)
+	e.string("redis-ver")
+	e.string("6.2.0")
+
+	ziplist := func(vs ...string) string {
+		var entries []byte
+		prev := 0
+		for _, v := range vs {
+			start := len(entries)
+			entries = append(entries, byte(prev))
+			entries = append(entries, byte(len(v)))
+			entries = append(entries, v...)
+			prev = len(entries) - start
+		}
+		b := make([]byte, 10, 11+len(entries))
+		binary.LittleEndian.PutUint32(b, uint32(11+len(entries)))
+		binary.LittleEndian.PutUint16(b[8:], uint16(len(vs)))
+		b = append(b, entries...)
+		return string(append(b, 0xFF))
+	}
+
+	e.byte(rdbTypeHashZiplist)
+	e.string("hash")
+	e.string(ziplist("aap", "noot", "mies", "vuur"))
+
+	e.byte(rdbTypeZsetZiplist)
+	e.string("zset")
+	e.string(ziplist("one", "1", "two", "2.5"))
+
+	e.byte(rdbTypeListQuicklist)
+	e.string("list")
+	e.len(2)
+	e.string(ziplist("a", "b"))
+	e.string(ziplist("c"))
+
+	e.byte(rdbTypeZset)
+	e.string("oldzset")
+	e.len(2)
+	e.string("inf")
+	e.byte(254)
+	e.string("half")
+	e.byte(3)
+	e.raw([]byte("0.5"))
+
+	e.byte(rdbOpExpireTime)
+	e.raw([]byte{0xff, 0xff, 0xff, 0x7f})
+	e.byte(rdbTypeString)
+	e.string("expires")
+	e.string("later")
+
+	e.byte(rdbOpEOF)
+	e.raw(make([]byte, 8)) // no checksum
+
+	s := NewMiniRedis()
+	ok(t, s.LoadRDB(bytes.NewReader(e.buf)))
+	equals(t, []string{"expires", "hash", "list", "oldzset", "zset"}, s.Keys())
+	equals(t, "noot", s.HGet("hash", "aap"))
+	equals(t, "vuur", s.HGet("hash", "mies"))
+	l, err := s.List("list")
+	ok(t, err)
+	equals(t, []string{"a", "b", "c"}, l)
+	zs, err := s.SortedSet("zset")
+	ok(t, err)
+	equals(t, map[string]float64{"one": 1, "two": 2.5}, zs)
+	zs, err = s.SortedSet("oldzset")
+	ok(t, err)
+	equals(t, map[string]float64{"inf": math.Inf(1), "half": 0.5}, zs)
+	assert(t, s.TTL("expires") > 0, "ttl")
+}
+
+func TestRDBEncoding(t *testing.T) {
+	e := &rdbEncoder{}
+	e.string("12")
+	e.string("-300")
+	e.string("100000")
+	e.string("012")
+	e.string(strings.Repeat("a", 30))
+	equals(t,
+		"\xc0\x0c"+"\xc1\xd4\xfe"+"\xc2\xa0\x86\x01\x00"+"\x03012"+"\xc3\x09\x1e\x01aa\xe0\x11\x00\x01aa",
+		string(e.buf),
+	)
+
+	lp := &listpack{}
+	lp.appendString("aap")
+	lp.appendString("12")
+	lp.appendString("-1000")
+	lp.appendString("100000")
+	lp.appendString(strings.Repeat("b", 100))
+	vs, err := decodeListpack(lp.bytes())
+	ok(t, err)
+	equals(t, []string{"aap", "12", "-1000", "100000", strings.Repeat("b", 100)}, vs)
+	equals(t, "\x0c\x00\x00\x00\x01\x00\x83aap\x04\xff", string((&listpack{buf: []byte("\x83aap\x04"), n: 1}).bytes()))
+
+	vs, err = decodeIntset(encodeIntset([]int64{5, -1, 70000}))
+	ok(t, err)
+	equals(t, []string{"-1", "5", "70000"}, vs)
+
+	equals(t, "3", rdbFormatScore(3))
+	equals(t, "-inf", rdbFormatScore(math.Inf(-1)))
+	equals(t, "1.5", rdbFormatScore(1.5))
+	equals(t, "0.10000000000000001", rdbFormatScore(0.1))
+}
@@ -0,0 +1,114 @@
+package miniredis
+
+// Command recording, and golden files.
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// RecordedCommand is a single command, as recorded by StartRecording().
+type RecordedCommand struct {
+	DB    int      // selected DB after the command
+	Args  []string // command and arguments, as sent by the client
+	Reply string   // reply, in RESP
+	Error string   // error message, if the reply is an error
+}
+
+// String formats a command as a single line, such as:
+//
+//	[0] "SET" "foo" "bar" => "+OK\r\n"
+func (r RecordedCommand) String() string {
+	args := make([]string, len(r.Args))
+	for i, a := range r.Args {
+		args[i] = quoteArg(a)
+	}
+	return fmt.Sprintf("[%d] %s => %s", r.DB, strings.Join(args, " "), quoteArg(r.Reply))
+}
+
+// StartRecording makes miniredis record every command it gets, with its
+// reply. Commands are recorded as they are sent, so commands in a MULTI are
+// recorded with their "QUEUED" reply, and the EXEC has the replies. Commands
+// from Lua scripts are recorded before the EVAL. Starting again clears the
+// recording.
+func (m *Miniredis) StartRecording() {
+	m.Lock()
+	defer m.Unlock()
+	m.recording = []RecordedCommand{}
+	if m.srv != nil {
+		m.srv.CaptureReplies(true)
+	}
+}
+
+// StopRecording stops the recording started with StartRecording(), and
+// returns all commands recorded since.
+func (m *Miniredis) StopRecording() []RecordedCommand {
+	m.Lock()
+	defer m.Unlock()
+	rec := m.recording
+	m.recording = nil
+	if m.srv != nil {
+		m.srv.CaptureReplies(false)
+	}
+	return rec
+}
+
+// record adds a command to the recording, if there is one. Needs the lock.
+func (m *Miniredis) record(ctx *connCtx, cmd string, args []string, reply string) {
+	if m.recording == nil || ctx.origin == "aof" {
+		return
+	}
+	r := RecordedCommand{
+		DB:    ctx.selectedDB,
+		Args:  append([]string{cmd}, args...),
+		Reply: reply,
+	}
+	if strings.HasPrefix(reply, "-") {
+		r.Error = strings.TrimSuffix(reply[1:], "\r\n")
+	}
+	m.recording = append(m.recording, r)
+}
+
+// CheckGolden compares a recording with a golden file, which has a line per
+// command, formatted with RecordedCommand.String(). With update the golden
+// file is (re)written instead. Normal use case is
+// `miniredis.CheckGolden(t, "testdata/login.golden", m.StopRecording(), *update)`,
+// with `update` a flag in your test.
+func CheckGolden(t T, filename string, recording []RecordedCommand, update bool) {
+	var b bytes.Buffer
+	for _, r := range recording {
+		b.WriteString(r.String())
+		b.WriteString("\n")
+	}
+	if update {
+		if err := ioutil.WriteFile(filename, b.Bytes(), 0644); err != nil {
+			lError(t, "golden file %s: %v", filename, err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(filename)
+	if err != nil {
+		lError(t, "golden file %s: %v", filename, err)
+		return
+	}
+	var (
+		want = strings.Split(string(golden), "\n")
+		have = strings.Split(b.String(), "\n")
+	)
+	for i := 0; i < len(want) || i < len(have); i++ {
+		var w, h string
+		if i < len(want) {
+			w = want[i]
+		}
+		if i < len(have) {
+			h = have[i]
+		}
+		if w != h {
+			lError(t, "golden file %s, line %d: Expected %s, got %s", filename, i+1, w, h)
+			return
+		}
+	}
+}
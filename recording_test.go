@@ -0,0 +1,88 @@
+package miniredis
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestRecording(t *testing.T) {
+	s, err := Run()
+	ok(t, err)
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	_, err = c.Do("SET", "before", "recording")
+	ok(t, err)
+
+	s.StartRecording()
+	_, err = c.Do("SET", "aap", "noot")
+	ok(t, err)
+	_, err = c.Do("LPUSH", "aap", "mies")
+	mustFail(t, err, msgWrongType)
+	_, err = c.Do("SELECT", 3)
+	ok(t, err)
+	_, err = c.Do("MULTI")
+	ok(t, err)
+	_, err = c.Do("INCR", "counter")
+	ok(t, err)
+	_, err = c.Do("EXEC")
+	ok(t, err)
+	_, err = c.Do("EVAL", `return redis.call("GET", "aap")`, 0)
+	ok(t, err)
+	rec := s.StopRecording()
+
+	equals(t,
+		[]RecordedCommand{
+			{DB: 0, Args: []string{"SET", "aap", "noot"}, Reply: "+OK\r\n"},
+			{DB: 0, Args: []string{"LPUSH", "aap", "mies"}, Reply: "-" + msgWrongType + "\r\n", Error: msgWrongType},
+			{DB: 3, Args: []string{"SELECT", "3"}, Reply: "+OK\r\n"},
+			{DB: 3, Args: []string{"MULTI"}, Reply: "+OK\r\n"},
+			{DB: 3, Args: []string{"INCR", "counter"}, Reply: "+QUEUED\r\n"},
+			{DB: 3, Args: []string{"EXEC"}, Reply: "*1\r\n:1\r\n"},
+			{DB: 0, Args: []string{"GET", "aap"}, Reply: "$4\r\nnoot\r\n"},
+			{DB: 3, Args: []string{"EVAL", `return redis.call("GET", "aap")`, "0"}, Reply: "$4\r\nnoot\r\n"},
+		},
+		rec,
+	)
+	equals(t, `[3] "EXEC" => "*1\r\n:1\r\n"`, rec[5].String())
+
+	_, err = c.Do("SET", "after", "recording")
+	ok(t, err)
+	equals(t, []RecordedCommand(nil), s.StopRecording())
+
+	t.Run("golden", func(t *testing.T) {
+		golden := filepath.Join(t.TempDir(), "test.golden")
+
+		CheckGolden(t, golden, rec[:2], true)
+		b, err := ioutil.ReadFile(golden)
+		ok(t, err)
+		equals(t,
+			`[0] "SET" "aap" "noot" => "+OK\r\n"`+"\n"+
+				`[0] "LPUSH" "aap" "mies" => "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"`+"\n",
+			string(b),
+		)
+
+		CheckGolden(t, golden, rec[:2], false)
+
+		f := &failT{}
+		CheckGolden(f, golden, rec[:1], false)
+		assert(t, f.failed, "golden file mismatch")
+
+		f = &failT{}
+		CheckGolden(f, golden+".nosuch", rec, false)
+		assert(t, f.failed, "no golden file")
+	})
+}
+
+type failT struct {
+	failed bool
+}
+
+func (f *failT) Fail() {
+	f.failed = true
+}
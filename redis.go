@@ -11,29 +11,107 @@ import (
 )
 
 const (
-	msgWrongType          = "WRONGTYPE Operation against a key holding the wrong kind of value"
-	msgInvalidInt         = "ERR value is not an integer or out of range"
-	msgInvalidFloat       = "ERR value is not a valid float"
-	msgInvalidMinMax      = "ERR min or max is not a float"
-	msgInvalidRangeItem   = "ERR min or max not valid string range item"
-	msgInvalidTimeout     = "ERR timeout is not an integer or out of range"
-	msgSyntaxError        = "ERR syntax error"
-	msgKeyNotFound        = "ERR no such key"
-	msgOutOfRange         = "ERR index out of range"
-	msgInvalidCursor      = "ERR invalid cursor"
-	msgXXandNX            = "ERR XX and NX options at the same time are not compatible"
-	msgNegTimeout         = "ERR timeout is negative"
-	msgInvalidSETime      = "ERR invalid expire time in set"
-	msgInvalidSETEXTime   = "ERR invalid expire time in setex"
-	msgInvalidPSETEXTime  = "ERR invalid expire time in psetex"
-	msgInvalidKeysNumber  = "ERR Number of keys can't be greater than number of args"
-	msgNegativeKeysNumber = "ERR Number of keys can't be negative"
-	msgFScriptUsage       = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try SCRIPT HELP."
-	msgFPubsubUsage       = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP."
-	msgSingleElementPair  = "ERR INCR option supports a single increment-element pair"
-	msgNoScriptFound      = "NOSCRIPT No matching script. Please use EVAL."
+	msgWrongType           = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	msgInvalidInt          = "ERR value is not an integer or out of range"
+	msgInvalidFloat        = "ERR value is not a valid float"
+	msgInvalidMinMax       = "ERR min or max is not a float"
+	msgInvalidRangeItem    = "ERR min or max not valid string range item"
+	msgInvalidTimeout      = "ERR timeout is not an integer or out of range"
+	msgSyntaxError         = "ERR syntax error"
+	msgKeyNotFound         = "ERR no such key"
+	msgOutOfRange          = "ERR index out of range"
+	msgInvalidCursor       = "ERR invalid cursor"
+	msgXXandNX             = "ERR XX and NX options at the same time are not compatible"
+	msgNegTimeout          = "ERR timeout is negative"
+	msgInvalidSETime       = "ERR invalid expire time in set"
+	msgInvalidSETEXTime    = "ERR invalid expire time in setex"
+	msgInvalidPSETEXTime   = "ERR invalid expire time in psetex"
+	msgInvalidKeysNumber   = "ERR Number of keys can't be greater than number of args"
+	msgNegativeKeysNumber  = "ERR Number of keys can't be negative"
+	msgFScriptUsage        = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try SCRIPT HELP."
+	msgFPubsubUsage        = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP."
+	msgSingleElementPair   = "ERR INCR option supports a single increment-element pair"
+	msgNoScriptFound       = "NOSCRIPT No matching script. Please use EVAL."
+	msgInvalidStreamID     = "ERR Invalid stream ID specified as stream command argument"
+	msgStreamIDTooSmall    = "ERR The ID specified in XADD is equal or smaller than the target stream top item"
+	msgStreamIDZero        = "ERR The ID specified in XADD must be greater than 0-0"
+	msgStreamInvalidStart  = "ERR invalid start ID for the interval"
+	msgStreamInvalidEnd    = "ERR invalid end ID for the interval"
+	msgStreamUnbalanced    = "ERR Unbalanced '%s' list of streams: for each stream key an ID or '%s' must be specified."
+	msgStreamMaxlenArg     = "ERR The MAXLEN argument must be >= 0."
+	msgStreamLimitNoApprox = "ERR syntax error, LIMIT cannot be used without the special ~ option"
+	msgXgroupKeyNotFound   = "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+	msgXgroupExists        = "BUSYGROUP Consumer Group name already exists"
+	msgFXgroupUsage        = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try XGROUP HELP."
+	msgFXinfoUsage         = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try XINFO HELP."
+	msgFNoGroup            = "NOGROUP No such key '%s' or consumer group '%s'"
+	msgFNoGroupKey         = "NOGROUP No such consumer group '%s' for key name '%s'"
+	msgFNoGroupRead        = "NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option"
+	msgXreadgroupDollar    = "ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."
+	msgXreadGreater        = "ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option."
+	msgInvalidMinIdle      = "ERR Invalid min-idle-time argument for XCLAIM"
+	msgXautoclaimCount     = "ERR COUNT must be > 0"
+	msgNotValidHll         = "WRONGTYPE Key is not a valid HyperLogLog string value."
+	msgInvalidHll          = "INVALIDOBJ Corrupted HLL object detected"
+	msgProtoVersion        = "ERR Protocol version is not an integer or out of range"
+	msgNoProto             = "NOPROTO unsupported protocol version"
+	msgFHelloSyntax        = "ERR Syntax error in HELLO option '%s'"
+	msgHelloNoAuth         = "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"
+	msgWrongPass           = "WRONGPASS invalid username-password pair or user is disabled."
+	msgInvalidClientName   = "ERR Client names cannot contain spaces, newlines or special characters."
+	msgFConfigUsage        = "ERR Unknown subcommand or wrong number of arguments for '%s'. Try CONFIG HELP."
+	msgFConfigSetUnknown   = "ERR Unknown option or number of arguments for CONFIG SET - '%s'"
+	msgFConfigSetFailed    = "ERR CONFIG SET failed (possibly related to argument '%s') - %s"
+	msgFClientUsage        = "ERR unknown subcommand '%s'. Try CLIENT HELP."
+	msgNoSuchClient        = "ERR No such client"
+	msgClientID            = "ERR client-id should be greater than 0"
+	msgInvalidClientID     = "ERR Invalid client ID"
+	msgFClientType         = "ERR Unknown client type '%s'"
+	msgUnblockReason       = "ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR"
+	msgUnblocked           = "UNBLOCKED client unblocked via CLIENT UNBLOCK"
+	msgNoConfigFile        = "ERR The server is running without a config file"
+	msgDBIndexOutOfRange   = "ERR DB index is out of range"
+	msgFSaveFailed         = "ERR saving failed: %s"
+	msgAOFNoFile           = "ERR the AOF is not written to a file"
+	msgFAOFRewriteFailed   = "ERR AOF rewrite failed: %s"
+	msgBusyKey             = "BUSYKEY Target key name already exists."
+	msgDumpPayload         = "ERR DUMP payload version or checksum are wrong"
+	msgBadDataFormat       = "ERR Bad data format"
+	msgInvalidTTL          = "ERR Invalid TTL value, must be >= 0"
+	msgMonitorNotAllowed   = "ERR MONITOR isn't allowed for DENY BLOCKING client"
+	msgCrossSlot           = "CROSSSLOT Keys in request don't hash to the same slot"
+	msgTryAgain            = "TRYAGAIN Multiple keys request during rehashing of slot"
+	msgClusterDisabled     = "ERR This instance has cluster support disabled"
+	msgInvalidSlot         = "ERR Invalid or out of range slot"
+	msgFClusterUsage       = "ERR unknown subcommand '%s'. Try CLUSTER HELP."
+	msgSelectCluster       = "ERR SELECT is not allowed in cluster mode"
+	msgReadonly            = "READONLY You can't write against a read only replica."
+	msgReplicaofCluster    = "ERR REPLICAOF not allowed in cluster mode."
+	msgWaitReplica         = "ERR WAIT cannot be used with replica instances. Please also note that since Redis 4.0 if a replica is configured to be writable (which is not the default) writes to replicas are just local and are not propagated."
+	msgNoMasterLink        = "NOMASTERLINK Can't SYNC while not connected with my master"
+	msgFReplconfOption     = "ERR Unrecognized REPLCONF option: %s"
+	msgNoSuchMaster        = "ERR No such master with that name"
+	msgNoGoodReplica       = "NOGOODSLAVE No suitable replica to promote"
+	msgFSentinelUsage      = "ERR unknown subcommand '%s'. Try SENTINEL HELP."
+	msgInvalidIdletime     = "ERR Invalid IDLETIME value, must be >= 0"
+	msgInvalidFreq         = "ERR Invalid FREQ value, must be >= 0 and <= 255"
+	msgInvalidNotifyFlags  = "Invalid event class character. Use 'Ag$lshzxeKEtmdn'."
+	msgOOM                 = "OOM command not allowed when used memory > 'maxmemory'."
+	msgFNoPermCommand      = "NOPERM this user has no permissions to run the '%s' command"
+	msgNoPermKey           = "NOPERM this user has no permissions to access one of the keys used as arguments"
+	msgNoPermChannel       = "NOPERM this user has no permissions to access one of the channels used as arguments"
+	msgFACLUsage           = "ERR unknown subcommand '%s'. Try ACL HELP."
+	msgFUnknownCategory    = "ERR Unknown category '%s'"
+	msgDelDefaultUser      = "ERR The 'default' user cannot be removed"
+	msgFObjectUsage        = "ERR unknown subcommand '%s'. Try OBJECT HELP."
+	msgFMemoryUsage        = "ERR unknown subcommand '%s'. Try MEMORY HELP."
+	msgIdletimeLFU         = "ERR An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."
+	msgFreqNotLFU          = "ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."
 )
 
+// redisVersion is what we claim to be in HELLO.
+const redisVersion = "7.0.0"
+
 func errWrongNumber(cmd string) string {
 	return fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
 }
@@ -50,8 +128,9 @@ func withTx(
 	cb txCmd,
 ) {
 	ctx := getCtx(c)
+	cb = m.expireCmd(ctx.cmd, ctx.args, m.writeCmd(ctx.cmd, ctx.args, cb))
 	if inTx(ctx) {
-		addTxCmd(ctx, cb)
+		addTxCmd(ctx, m.execCmd(ctx.cmdName, ctx.args, cb))
 		c.WriteInline("QUEUED")
 		return
 	}
@@ -76,31 +155,50 @@ func blocking(
 ) {
 	var (
 		ctx = getCtx(c)
-		dl  *time.Timer
 		dlc <-chan time.Time
 	)
+	cb = m.expireBlockCmd(ctx.cmd, ctx.args, m.writeBlockCmd(ctx.cmd, ctx.args, cb))
 	if inTx(ctx) {
-		addTxCmd(ctx, func(c *server.Peer, ctx *connCtx) {
+		addTxCmd(ctx, m.execCmd(ctx.cmdName, ctx.args, func(c *server.Peer, ctx *connCtx) {
 			if !cb(c, ctx) {
 				onTimeout(c)
 			}
-		})
+		}))
 		c.WriteInline("QUEUED")
 		return
 	}
-	if timeout != 0 {
-		dl = time.NewTimer(timeout)
-		defer dl.Stop()
-		dlc = dl.C
-	}
 
 	m.Lock()
 	defer m.Unlock()
-	for {
+	if timeout != 0 {
+		var stop func()
+		dlc, stop = m.after(timeout)
+		defer stop()
+	}
+	for i := 0; ; i++ {
 		done := cb(c, ctx)
 		if done {
 			return
 		}
+		if i == 0 {
+			m.blockedClients++
+			ctx.blocked = true
+			defer func() {
+				m.blockedClients--
+				ctx.blocked = false
+				ctx.unblock = ""
+			}()
+		}
+		switch ctx.unblock {
+		case "TIMEOUT":
+			onTimeout(c)
+			return
+		case "ERROR":
+			c.WriteError(msgUnblocked)
+			return
+		case "KILL":
+			return
+		}
 		// there is no cond.WaitTimeout(), so hence the the goroutine to wait
 		// for a timeout
 		var (
@@ -0,0 +1,429 @@
+package miniredis
+
+// Master/replica replication. The same as Redis, a replica connects to its
+// master, gets all data as an RDB, and then gets every write command the master
+// executes. Replicas don't accept writes from clients.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// replicaRetry is how long a replica waits before it connects to its master
+// again.
+const replicaRetry = 100 * time.Millisecond
+
+// replicaBacklog is how many writes can be queued for a replica. A replica
+// which falls further behind gets disconnected, the same as Redis does when a
+// replica hits its client-output-buffer-limit.
+var replicaBacklog = 10000
+
+var errStopped = errors.New("replication stopped")
+
+// replica is a replica connected to us.
+type replica struct {
+	port int         // REPLCONF listening-port
+	ack  int         // offset from the last REPLCONF ACK
+	out  chan string // RESP still to be sent. Closed when the replica is gone.
+}
+
+// send writes everything queued to the replica, until out is closed. It runs
+// in its own goroutine, so a slow replica never blocks the server.
+func (r *replica) send(c *server.Peer) {
+	for s := range r.out {
+		c.Block(func(w *server.Writer) {
+			w.WriteRaw(s)
+		})
+		if len(r.out) == 0 {
+			c.Flush()
+		}
+	}
+}
+
+// replicaLink is the connection of a replica to its master.
+type replicaLink struct {
+	host   string
+	port   int
+	state  string // "connect", "connecting", "sync", or "connected"
+	offset int    // replication offset. -1 before the first sync.
+	conn   net.Conn
+	done   chan struct{} // closed when we stop being a replica
+	synced chan error    // gets the result of the first sync
+	once   sync.Once
+}
+
+// report sends the result of the first sync.
+func (l *replicaLink) report(err error) {
+	l.once.Do(func() {
+		l.synced <- err
+	})
+}
+
+// ReplicaOf makes m a replica of master, the same as REPLICAOF. It waits until
+// m has all the data from master, which replaces all data in m. Use nil to make
+// m a master again.
+// Only commands get replicated, not changes made with the Go API, such as
+// master.Set().
+func (m *Miniredis) ReplicaOf(master *Miniredis) error {
+	if master == nil {
+		m.Lock()
+		defer m.Unlock()
+		m.stopReplication()
+		return nil
+	}
+
+	master.Lock()
+	if master.srv == nil {
+		master.Unlock()
+		return errors.New("master is not running")
+	}
+	addr := master.srv.Addr()
+	master.Unlock()
+	if addr == nil {
+		return errors.New("master doesn't listen on TCP")
+	}
+
+	m.Lock()
+	if m.srv == nil {
+		m.Unlock()
+		return errors.New("miniredis is not running")
+	}
+	l := m.startReplication(addr.IP.String(), addr.Port)
+	m.Unlock()
+
+	if err := <-l.synced; err != nil {
+		m.Lock()
+		if m.masterLink == l {
+			m.stopReplication()
+		}
+		m.Unlock()
+		return err
+	}
+	return nil
+}
+
+// PauseReplication stops a replica from executing the commands from its
+// master, to simulate replication lag. The replica won't acknowledge anything
+// either, so WAIT on the master will time out.
+func (m *Miniredis) PauseReplication() {
+	m.Lock()
+	defer m.Unlock()
+	if m.replPause == nil {
+		m.replPause = make(chan struct{})
+	}
+}
+
+// ResumeReplication undoes PauseReplication().
+func (m *Miniredis) ResumeReplication() {
+	m.Lock()
+	defer m.Unlock()
+	if m.replPause != nil {
+		close(m.replPause)
+		m.replPause = nil
+	}
+}
+
+// startReplication connects to a master, in the background. Needs the lock.
+func (m *Miniredis) startReplication(host string, port int) *replicaLink {
+	m.stopReplication()
+	l := &replicaLink{
+		host:   host,
+		port:   port,
+		state:  "connect",
+		offset: -1,
+		done:   make(chan struct{}),
+		synced: make(chan error, 1),
+	}
+	m.masterHost = host
+	m.masterPort = port
+	m.masterLink = l
+	go m.replicate(l)
+	return l
+}
+
+// stopReplication disconnects from our master, if we have one. Needs the lock.
+func (m *Miniredis) stopReplication() {
+	if l := m.masterLink; l != nil {
+		close(l.done)
+		if l.conn != nil {
+			l.conn.Close()
+		}
+		l.report(errStopped)
+	}
+	m.masterLink = nil
+	m.masterHost = ""
+	m.masterPort = 0
+}
+
+// replicate keeps a replica connected to its master, until the link is
+// stopped.
+func (m *Miniredis) replicate(l *replicaLink) {
+	for {
+		err := m.replicateOnce(l)
+		l.report(err)
+
+		m.Lock()
+		l.state = "connect"
+		m.Unlock()
+		select {
+		case <-l.done:
+			return
+		case <-time.After(replicaRetry):
+		}
+	}
+}
+
+// replicateOnce does a full sync with the master, and then executes the
+// commands the master sends, until the connection breaks.
+func (m *Miniredis) replicateOnce(l *replicaLink) error {
+	m.Lock()
+	l.state = "connecting"
+	m.Unlock()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(l.host, strconv.Itoa(l.port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	m.Lock()
+	if m.masterLink != l {
+		m.Unlock()
+		return errStopped
+	}
+	l.conn = conn
+	myPort := m.port
+	m.Unlock()
+
+	br := bufio.NewReader(conn)
+	for _, cmd := range [][]string{
+		{"PING"},
+		{"REPLCONF", "listening-port", strconv.Itoa(myPort)},
+		{"REPLCONF", "capa", "psync2"},
+	} {
+		if _, err := replicaCommand(conn, br, cmd...); err != nil {
+			return err
+		}
+	}
+	res, err := replicaCommand(conn, br, "PSYNC", "?", "-1")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(res)
+	if len(fields) != 3 || fields[0] != "FULLRESYNC" {
+		return fmt.Errorf("unexpected PSYNC reply: %q", res)
+	}
+	offset, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return fmt.Errorf("unexpected PSYNC reply: %q", res)
+	}
+
+	m.Lock()
+	l.state = "sync"
+	m.Unlock()
+	rdb, err := readRDBTransfer(br)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	if m.masterLink != l {
+		m.Unlock()
+		return errStopped
+	}
+	if err := m.decodeRDB(rdb); err != nil {
+		m.Unlock()
+		return err
+	}
+	l.state = "connected"
+	l.offset = offset
+	apply := m.internalConn("master")
+	m.Unlock()
+	m.signal.Broadcast()
+	defer apply.Close()
+	l.report(nil)
+
+	for {
+		args, err := readAOFCommand(br)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		writeAOFCommand(&buf, args[0], args[1:]...)
+
+		m.Lock()
+		pause := m.replPause
+		m.Unlock()
+		if pause != nil {
+			select {
+			case <-pause:
+			case <-l.done:
+				return nil
+			}
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+		case "REPLCONF":
+			if len(args) > 1 && strings.ToUpper(args[1]) == "GETACK" {
+				m.Lock()
+				ack := l.offset
+				m.Unlock()
+				var b bytes.Buffer
+				writeAOFCommand(&b, "REPLCONF", "ACK", strconv.Itoa(ack))
+				if _, err := conn.Write(b.Bytes()); err != nil {
+					return err
+				}
+			}
+		default:
+			cargs := make([]interface{}, 0, len(args)-1)
+			for _, a := range args[1:] {
+				cargs = append(cargs, a)
+			}
+			// error replies are ignored, the same as Redis does.
+			if _, err := apply.Do(args[0], cargs...); err != nil {
+				if _, ok := err.(redigo.Error); !ok {
+					return err
+				}
+			}
+		}
+
+		m.Lock()
+		l.offset += buf.Len()
+		m.Unlock()
+	}
+}
+
+// replicaCommand sends a command in the replication handshake, and reads the
+// single line reply.
+func replicaCommand(conn net.Conn, br *bufio.Reader, cmd ...string) (string, error) {
+	var buf bytes.Buffer
+	writeAOFCommand(&buf, cmd[0], cmd[1:]...)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return "", err
+	}
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "+") {
+		return "", fmt.Errorf("unexpected reply to %s: %q", cmd[0], line)
+	}
+	return line[1:], nil
+}
+
+// readRDBTransfer reads the RDB a master sends after PSYNC. It's a bulk
+// string, but without the final "\r\n".
+func readRDBTransfer(br *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// newlines are sent to keep the connection alive
+			continue
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("unexpected RDB transfer: %q", line)
+		}
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("unexpected RDB transfer: %q", line)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+// fullSync sends all data to a new replica, and adds it to the replicas which
+// get all write commands. Needs the lock.
+func (m *Miniredis) fullSync(c *server.Peer, psync bool) {
+	var sync string
+	if psync {
+		sync = fmt.Sprintf("+FULLRESYNC %s %d\r\n", m.runID, m.replOffset)
+	}
+	rdb := m.encodeRDB()
+	sync += fmt.Sprintf("$%d\r\n%s", len(rdb), rdb)
+
+	r := &replica{
+		port: getCtx(c).replPort,
+		out:  make(chan string, replicaBacklog),
+	}
+	r.out <- sync
+	m.replicas[c] = r
+	m.replDB = -1
+	go r.send(c)
+	c.OnDisconnect(func() {
+		m.Lock()
+		defer m.Unlock()
+		m.dropReplica(c, r)
+		m.signal.Broadcast()
+	})
+}
+
+// dropReplica stops sending to a replica. Needs the lock.
+func (m *Miniredis) dropReplica(c *server.Peer, r *replica) {
+	if m.replicas[c] != r {
+		return
+	}
+	delete(m.replicas, c)
+	close(r.out)
+}
+
+// propagate sends a write command to all replicas. Needs the lock.
+func (m *Miniredis) propagate(db int, cmd string, args []string) {
+	if len(m.replicas) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if db != m.replDB {
+		writeAOFCommand(&buf, "SELECT", strconv.Itoa(db))
+		m.replDB = db
+	}
+	writeAOFCommand(&buf, cmd, args...)
+	m.sendReplicas(buf.String())
+}
+
+// sendReplicas queues RESP for all replicas, and updates the replication
+// offset. Replicas which are too far behind are disconnected. Needs the lock.
+func (m *Miniredis) sendReplicas(s string) {
+	m.replOffset += len(s)
+	for c, r := range m.replicas {
+		select {
+		case r.out <- s:
+		default:
+			m.dropReplica(c, r)
+			c.Kill()
+		}
+	}
+}
+
+// ackedReplicas counts the replicas which acknowledged at least offset. Needs
+// the lock.
+func (m *Miniredis) ackedReplicas(offset int) int {
+	n := 0
+	for _, r := range m.replicas {
+		if r.ack >= offset {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,233 @@
+package miniredis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestReplication(t *testing.T) {
+	master, err := Run()
+	ok(t, err)
+	defer master.Close()
+	replica, err := Run()
+	ok(t, err)
+	defer replica.Close()
+	master.Set("before", "sync")
+
+	ok(t, replica.ReplicaOf(master))
+	v, err := replica.Get("before")
+	ok(t, err)
+	equals(t, "sync", v)
+
+	mc, err := redis.Dial("tcp", master.Addr())
+	ok(t, err)
+	defer mc.Close()
+	rc, err := redis.Dial("tcp", replica.Addr())
+	ok(t, err)
+	defer rc.Close()
+
+	t.Run("writes", func(t *testing.T) {
+		_, err := mc.Do("SET", "foo", "bar")
+		ok(t, err)
+		_, err = mc.Do("SELECT", "3")
+		ok(t, err)
+		_, err = mc.Do("RPUSH", "list", "a", "b")
+		ok(t, err)
+		id, err := redis.String(mc.Do("XADD", "stream", "*", "k", "v"))
+		ok(t, err)
+		_, err = mc.Do("SELECT", "0")
+		ok(t, err)
+		_, err = mc.Do("EVAL", "return redis.call('SET', KEYS[1], 'lua')", "1", "script")
+		ok(t, err)
+
+		n, err := redis.Int(mc.Do("WAIT", "1", "1000"))
+		ok(t, err)
+		equals(t, 1, n)
+
+		v, err := replica.Get("foo")
+		ok(t, err)
+		equals(t, "bar", v)
+		l, err := replica.DB(3).List("list")
+		ok(t, err)
+		equals(t, []string{"a", "b"}, l)
+		s, err := replica.DB(3).Stream("stream")
+		ok(t, err)
+		equals(t, id, s[0].ID)
+		v, err = replica.Get("script")
+		ok(t, err)
+		equals(t, "lua", v)
+	})
+
+	t.Run("readonly", func(t *testing.T) {
+		_, err := rc.Do("SET", "foo", "baz")
+		mustFail(t, err, msgReadonly)
+		_, err = rc.Do("set", "foo", "baz")
+		mustFail(t, err, msgReadonly)
+		_, err = rc.Do("EVAL", "return redis.call('SET', KEYS[1], 'lua')", "1", "foo")
+		assert(t, err != nil && strings.Contains(err.Error(), "READONLY"), "lua is readonly")
+
+		v, err := redis.String(rc.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+
+		_, err = rc.Do("WAIT", "1", "0")
+		mustFail(t, err, msgWaitReplica)
+	})
+
+	t.Run("replayable", func(t *testing.T) {
+		_, err := mc.Do("SADD", "set", "a", "b", "c", "d", "e")
+		ok(t, err)
+		_, err = mc.Do("SPOP", "set", 2)
+		ok(t, err)
+		_, err = mc.Do("SET", "ttl", "value", "EX", 10)
+		ok(t, err)
+		_, err = mc.Do("SET", "short", "value", "EX", 1)
+		ok(t, err)
+		master.FastForward(2 * time.Second)
+		_, err = mc.Do("WAIT", "1", "1000")
+		ok(t, err)
+
+		want, err := master.Members("set")
+		ok(t, err)
+		have, err := replica.Members("set")
+		ok(t, err)
+		equals(t, want, have)
+		ttl := replica.TTL("ttl")
+		assert(t, ttl > 9*time.Second && ttl <= 10*time.Second, "TTL on the replica: %s", ttl)
+		equals(t, false, replica.Exists("short"))
+	})
+
+	t.Run("role", func(t *testing.T) {
+		v, err := redis.Values(mc.Do("ROLE"))
+		ok(t, err)
+		equals(t, 3, len(v))
+		equals(t, "master", string(v[0].([]byte)))
+		rs := v[2].([]interface{})
+		equals(t, 1, len(rs))
+		r := rs[0].([]interface{})
+		equals(t, "127.0.0.1", string(r[0].([]byte)))
+		equals(t, replica.Port(), string(r[1].([]byte)))
+
+		v, err = redis.Values(rc.Do("ROLE"))
+		ok(t, err)
+		equals(t, 5, len(v))
+		equals(t, "slave", string(v[0].([]byte)))
+		equals(t, "127.0.0.1", string(v[1].([]byte)))
+		equals(t, master.Port(), fmt.Sprint(v[2]))
+		equals(t, "connected", string(v[3].([]byte)))
+
+		info, err := redis.String(rc.Do("INFO", "replication"))
+		ok(t, err)
+		assert(t, strings.Contains(info, "role:slave\r\n"), "role")
+		assert(t, strings.Contains(info, "master_link_status:up\r\n"), "link")
+		info, err = redis.String(mc.Do("INFO", "replication"))
+		ok(t, err)
+		assert(t, strings.Contains(info, "connected_slaves:1\r\n"), "slaves")
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		replica.PauseReplication()
+		_, err := mc.Do("SET", "foo", "paused")
+		ok(t, err)
+		n, err := redis.Int(mc.Do("WAIT", "1", "50"))
+		ok(t, err)
+		equals(t, 0, n)
+		v, err := replica.Get("foo")
+		ok(t, err)
+		equals(t, "bar", v)
+
+		replica.ResumeReplication()
+		n, err = redis.Int(mc.Do("WAIT", "1", "1000"))
+		ok(t, err)
+		equals(t, 1, n)
+		v, err = replica.Get("foo")
+		ok(t, err)
+		equals(t, "paused", v)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := mc.Do("REPLICAOF", "localhost")
+		mustFail(t, err, "ERR wrong number of arguments for 'replicaof' command")
+		_, err = mc.Do("REPLICAOF", "localhost", "port")
+		mustFail(t, err, msgInvalidInt)
+		_, err = mc.Do("WAIT", "1")
+		mustFail(t, err, "ERR wrong number of arguments for 'wait' command")
+		_, err = mc.Do("WAIT", "1", "-1")
+		mustFail(t, err, msgNegTimeout)
+		_, err = mc.Do("REPLCONF", "foo", "bar")
+		mustFail(t, err, "ERR Unrecognized REPLCONF option: foo")
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		_, err := rc.Do("REPLICAOF", "NO", "ONE")
+		ok(t, err)
+		_, err = rc.Do("SET", "foo", "promoted")
+		ok(t, err)
+		v, err := redis.Values(rc.Do("ROLE"))
+		ok(t, err)
+		equals(t, "master", string(v[0].([]byte)))
+
+		// the old master becomes a replica
+		_, err = mc.Do("REPLICAOF", "127.0.0.1", replica.Port())
+		ok(t, err)
+		s, err := redis.String(mc.Do("REPLICAOF", "127.0.0.1", replica.Port()))
+		ok(t, err)
+		equals(t, "OK Already connected to specified master", s)
+		for i := 0; ; i++ {
+			v, err := redis.Values(mc.Do("ROLE"))
+			ok(t, err)
+			if string(v[3].([]byte)) == "connected" {
+				break
+			}
+			assert(t, i < 100, "no sync")
+			time.Sleep(10 * time.Millisecond)
+		}
+		v2, err := master.Get("foo")
+		ok(t, err)
+		equals(t, "promoted", v2)
+	})
+}
+
+func TestReplicationLag(t *testing.T) {
+	defer func(n int) { replicaBacklog = n }(replicaBacklog)
+	replicaBacklog = 10
+
+	m, err := Run()
+	ok(t, err)
+	defer m.Close()
+	c, err := redis.Dial("tcp", m.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	// a replica which never reads anything
+	lag, err := redis.Dial("tcp", m.Addr())
+	ok(t, err)
+	defer lag.Close()
+	ok(t, lag.Send("SYNC"))
+	ok(t, lag.Flush())
+	for i := 0; ; i++ {
+		info, err := redis.String(c.Do("INFO", "replication"))
+		ok(t, err)
+		if strings.Contains(info, "connected_slaves:1\r\n") {
+			break
+		}
+		assert(t, i < 100, "no sync")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	value := strings.Repeat("x", 1<<20)
+	for i := 0; ; i++ {
+		_, err := c.Do("SET", "foo", value)
+		ok(t, err)
+		info, err := redis.String(c.Do("INFO", "replication"))
+		ok(t, err)
+		if strings.Contains(info, "connected_slaves:0\r\n") {
+			break
+		}
+		assert(t, i < 200, "lagging replica is still connected")
+	}
+}
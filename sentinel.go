@@ -0,0 +1,185 @@
+package miniredis
+
+// Redis Sentinel emulation. A Sentinel is a normal Miniredis which knows about
+// some masters and their replicas, and can fail them over.
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SentinelMaster is a master a Sentinel monitors, with its replicas.
+type SentinelMaster struct {
+	Name     string
+	Master   *Miniredis
+	Replicas []*Miniredis
+}
+
+// Sentinel is a Miniredis which acts as a Redis Sentinel, see RunSentinel().
+type Sentinel struct {
+	mu      sync.Mutex
+	m       *Miniredis
+	masters []*sentinelMaster
+}
+
+// sentinelMaster is a monitored master.
+type sentinelMaster struct {
+	name     string
+	master   *Miniredis
+	replicas []*Miniredis
+	epoch    int
+}
+
+var (
+	errNoSuchMaster  = errors.New("no such master")
+	errNoGoodReplica = errors.New("no replica to promote")
+)
+
+// RunSentinel starts a Sentinel which monitors the given masters. The replicas
+// are made replicas of their master, if they aren't already. Clients can
+// connect to Addr(), and ask for the address of a master with SENTINEL
+// GET-MASTER-ADDR-BY-NAME.
+func RunSentinel(masters ...SentinelMaster) (*Sentinel, error) {
+	s := &Sentinel{}
+	for _, sm := range masters {
+		if sm.Master == nil {
+			return nil, fmt.Errorf("no master for %q", sm.Name)
+		}
+		if s.master(sm.Name) != nil {
+			return nil, fmt.Errorf("duplicate master name: %q", sm.Name)
+		}
+		host, port := instanceAddr(sm.Master)
+		for _, r := range sm.Replicas {
+			r.Lock()
+			connected := r.masterHost == host && r.masterPort == port
+			r.Unlock()
+			if connected {
+				continue
+			}
+			if err := r.ReplicaOf(sm.Master); err != nil {
+				return nil, err
+			}
+		}
+		s.masters = append(s.masters, &sentinelMaster{
+			name:     sm.Name,
+			master:   sm.Master,
+			replicas: append([]*Miniredis{}, sm.Replicas...),
+		})
+	}
+
+	m := NewMiniRedis()
+	m.sentinel = s
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	s.m = m
+	return s, nil
+}
+
+// Close stops the Sentinel. The monitored servers keep running.
+func (s *Sentinel) Close() {
+	s.m.Close()
+}
+
+// Addr returns the address of the Sentinel, such as "127.0.0.1:26379".
+func (s *Sentinel) Addr() string {
+	return s.m.Addr()
+}
+
+// Master returns the current master for a name, or nil.
+func (s *Sentinel) Master(name string) *Miniredis {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sm := s.master(name); sm != nil {
+		return sm.master
+	}
+	return nil
+}
+
+// Replicas returns the current replicas for a name.
+func (s *Sentinel) Replicas(name string) []*Miniredis {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sm := s.master(name); sm != nil {
+		return append([]*Miniredis{}, sm.replicas...)
+	}
+	return nil
+}
+
+// Failover promotes the first replica of a master to be the new master, the
+// same as SENTINEL FAILOVER. The other replicas, and the old master if it's
+// still running, become replicas of the new master. Subscribers of the
+// Sentinel get a "+switch-master" message.
+func (s *Sentinel) Failover(name string) error {
+	s.mu.Lock()
+	msg, err := s.failover(name)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.m.Publish("+switch-master", msg)
+	return nil
+}
+
+// master finds a master by name. Needs the lock.
+func (s *Sentinel) master(name string) *sentinelMaster {
+	for _, sm := range s.masters {
+		if sm.name == name {
+			return sm
+		}
+	}
+	return nil
+}
+
+// failover does the failover, and returns the "+switch-master" message. Needs
+// the lock.
+func (s *Sentinel) failover(name string) (string, error) {
+	sm := s.master(name)
+	if sm == nil {
+		return "", errNoSuchMaster
+	}
+	if len(sm.replicas) == 0 {
+		return "", errNoGoodReplica
+	}
+
+	var (
+		old, promoted    = sm.master, sm.replicas[0]
+		oldHost, oldPort = instanceAddr(old)
+		newHost, newPort = instanceAddr(promoted)
+		replicas         = append(append([]*Miniredis{}, sm.replicas[1:]...), old)
+	)
+	promoted.ReplicaOf(nil)
+	for _, r := range replicas {
+		if !instanceRunning(r) {
+			continue
+		}
+		if err := r.ReplicaOf(promoted); err != nil {
+			return "", err
+		}
+	}
+	sm.master = promoted
+	sm.replicas = replicas
+	sm.epoch++
+	return fmt.Sprintf("%s %s %d %s %d", name, oldHost, oldPort, newHost, newPort), nil
+}
+
+// instanceAddr gives the address of a monitored server, also when it's not
+// running.
+func instanceAddr(m *Miniredis) (string, int) {
+	m.Lock()
+	defer m.Unlock()
+	if m.srv != nil {
+		if a := m.srv.Addr(); a != nil {
+			return a.IP.String(), a.Port
+		}
+	}
+	return "127.0.0.1", m.port
+}
+
+// instanceRunning is true if a monitored server is running.
+func instanceRunning(m *Miniredis) bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.srv != nil
+}
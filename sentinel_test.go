@@ -0,0 +1,149 @@
+package miniredis
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestSentinel(t *testing.T) {
+	master, err := Run()
+	ok(t, err)
+	defer master.Close()
+	replica1, err := Run()
+	ok(t, err)
+	defer replica1.Close()
+	replica2, err := Run()
+	ok(t, err)
+	defer replica2.Close()
+
+	s, err := RunSentinel(SentinelMaster{
+		Name:     "mymaster",
+		Master:   master,
+		Replicas: []*Miniredis{replica1, replica2},
+	})
+	ok(t, err)
+	defer s.Close()
+
+	c, err := redis.Dial("tcp", s.Addr())
+	ok(t, err)
+	defer c.Close()
+
+	t.Run("commands", func(t *testing.T) {
+		addr, err := redis.Strings(c.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"))
+		ok(t, err)
+		equals(t, []string{master.Host(), master.Port()}, addr)
+
+		v, err := c.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", "nosuch")
+		ok(t, err)
+		equals(t, nil, v)
+
+		ms, err := redis.Values(c.Do("SENTINEL", "MASTERS"))
+		ok(t, err)
+		equals(t, 1, len(ms))
+		fields, err := redis.StringMap(ms[0], nil)
+		ok(t, err)
+		equals(t, "mymaster", fields["name"])
+		equals(t, master.Port(), fields["port"])
+		equals(t, "master", fields["flags"])
+		equals(t, "2", fields["num-slaves"])
+
+		rs, err := redis.Values(c.Do("SENTINEL", "REPLICAS", "mymaster"))
+		ok(t, err)
+		equals(t, 2, len(rs))
+		fields, err = redis.StringMap(rs[0], nil)
+		ok(t, err)
+		equals(t, replica1.Port(), fields["port"])
+		equals(t, "ok", fields["master-link-status"])
+		equals(t, master.Port(), fields["master-port"])
+
+		ss, err := redis.Values(c.Do("SENTINEL", "SENTINELS", "mymaster"))
+		ok(t, err)
+		equals(t, 0, len(ss))
+
+		role, err := redis.Values(c.Do("ROLE"))
+		ok(t, err)
+		equals(t, "sentinel", string(role[0].([]byte)))
+
+		_, err = c.Do("SENTINEL", "MASTER", "nosuch")
+		mustFail(t, err, msgNoSuchMaster)
+		_, err = c.Do("SENTINEL", "REPLICAS")
+		mustFail(t, err, "ERR wrong number of arguments for 'sentinel|replicas' command")
+		_, err = c.Do("SENTINEL", "FOO")
+		mustFail(t, err, "ERR unknown subcommand 'FOO'. Try SENTINEL HELP.")
+		_, err = c.Do("SENTINEL")
+		mustFail(t, err, "ERR wrong number of arguments for 'sentinel' command")
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		sub, err := redis.Dial("tcp", s.Addr())
+		ok(t, err)
+		defer sub.Close()
+		_, err = sub.Do("SUBSCRIBE", "+switch-master")
+		ok(t, err)
+
+		ok(t, s.Failover("mymaster"))
+		equals(t, replica1, s.Master("mymaster"))
+		equals(t, []*Miniredis{replica2, master}, s.Replicas("mymaster"))
+
+		msg, err := redis.Strings(sub.Receive())
+		ok(t, err)
+		equals(t, []string{
+			"message",
+			"+switch-master",
+			"mymaster " + master.Host() + " " + master.Port() + " " + replica1.Host() + " " + replica1.Port(),
+		}, msg)
+
+		addr, err := redis.Strings(c.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"))
+		ok(t, err)
+		equals(t, []string{replica1.Host(), replica1.Port()}, addr)
+
+		// the new master takes writes, and the others replicate it
+		rc, err := redis.Dial("tcp", replica1.Addr())
+		ok(t, err)
+		defer rc.Close()
+		_, err = rc.Do("SET", "foo", "bar")
+		ok(t, err)
+		n, err := redis.Int(rc.Do("WAIT", "2", "1000"))
+		ok(t, err)
+		equals(t, 2, n)
+		v, err := master.Get("foo")
+		ok(t, err)
+		equals(t, "bar", v)
+
+		// with the master down
+		replica1.Close()
+		_, err = c.Do("SENTINEL", "FAILOVER", "mymaster")
+		ok(t, err)
+		equals(t, replica2, s.Master("mymaster"))
+		msg, err = redis.Strings(sub.Receive())
+		ok(t, err)
+		equals(t, "+switch-master", msg[1])
+		rs, err := redis.Values(c.Do("SENTINEL", "REPLICAS", "mymaster"))
+		ok(t, err)
+		equals(t, 2, len(rs))
+		down, err := redis.StringMap(rs[1], nil)
+		ok(t, err)
+		equals(t, "slave,s_down", down["flags"])
+
+		_, err = c.Do("SENTINEL", "FAILOVER", "nosuch")
+		mustFail(t, err, msgNoSuchMaster)
+	})
+
+	t.Run("no replicas", func(t *testing.T) {
+		m, err := Run()
+		ok(t, err)
+		defer m.Close()
+		s, err := RunSentinel(SentinelMaster{Name: "solo", Master: m})
+		ok(t, err)
+		defer s.Close()
+		mustFail(t, s.Failover("solo"), errNoGoodReplica.Error())
+		mustFail(t, s.Failover("nosuch"), errNoSuchMaster.Error())
+
+		_, err = RunSentinel(
+			SentinelMaster{Name: "solo", Master: m},
+			SentinelMaster{Name: "solo", Master: m},
+		)
+		mustFail(t, err, `duplicate master name: "solo"`)
+	})
+}
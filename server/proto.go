@@ -3,82 +3,214 @@ package server
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"strconv"
+	"strings"
 )
 
-// ErrProtocol is the general error for unexpected input
+// ErrProtocol is the general error for unexpected input. All protocol errors
+// match it with errors.Is().
 var ErrProtocol = errors.New("invalid request")
 
-// client always sends arrays with bulk strings
-func readArray(rd *bufio.Reader) ([]string, error) {
-	line, err := rd.ReadString('\n')
+const (
+	// DefaultMaxBulkLen is the default max length of a single argument, the
+	// same as Redis' "proto-max-bulk-len". See SetMaxBulkLen().
+	DefaultMaxBulkLen = 512 * 1024 * 1024
+	// maxMultibulk is the max number of arguments in a request.
+	maxMultibulk = 1024 * 1024
+	// maxInline is the max length of an inline request.
+	maxInline = 64 * 1024
+)
+
+// protocolError is invalid input from a client. The client gets the error as
+// a reply, and is then disconnected.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "ERR Protocol error: " + string(e)
+}
+
+// Is makes protocol errors match ErrProtocol.
+func (e protocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
+
+// errLineTooBig is returned by readLine() for lines longer than maxInline.
+var errLineTooBig = errors.New("line too big")
+
+// readArray reads a single request. That's an array with bulk strings, or an
+// inline command, such as telnet sends. Empty requests give no arguments.
+func readArray(rd *bufio.Reader, maxBulkLen int) ([]string, error) {
+	line, err := readLine(rd)
+	if err == errLineTooBig {
+		if line[0] == '*' {
+			return nil, protocolError("too big mbulk count string")
+		}
+		return nil, protocolError("too big inline request")
+	}
 	if err != nil {
 		return nil, err
 	}
-	if len(line) < 3 {
-		return nil, ErrProtocol
+
+	if line[0] != '*' {
+		return splitArgs(strings.TrimRight(line, "\r\n"))
 	}
 
-	switch line[0] {
-	default:
-		return nil, ErrProtocol
-	case '*':
-		l, err := strconv.Atoi(line[1 : len(line)-2])
+	l, err := strconv.Atoi(strings.TrimRight(line[1:], "\r\n"))
+	if err != nil || l > maxMultibulk {
+		return nil, protocolError("invalid multibulk length")
+	}
+	// l can be -1
+	var fields []string
+	for ; l > 0; l-- {
+		line, err := readLine(rd)
+		if err == errLineTooBig {
+			return nil, protocolError("too big bulk count string")
+		}
 		if err != nil {
 			return nil, err
 		}
-		// l can be -1
-		var fields []string
-		for ; l > 0; l-- {
-			s, err := readString(rd)
-			if err != nil {
-				return nil, err
+		if line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%c'", line[0]))
+		}
+		length, err := strconv.Atoi(strings.TrimRight(line[1:], "\r\n"))
+		if err != nil || length < 0 || length > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
 			}
-			fields = append(fields, s)
+			return nil, err
+		}
+		if string(buf[length:]) != "\r\n" {
+			return nil, protocolError("expected CRLF after bulk string")
 		}
-		return fields, nil
+		fields = append(fields, string(buf[:length]))
 	}
+	return fields, nil
 }
 
-func readString(rd *bufio.Reader) (string, error) {
-	line, err := rd.ReadString('\n')
-	if err != nil {
-		return "", err
-	}
-	if len(line) < 3 {
-		return "", ErrProtocol
+// readLine reads up to and including the next '\n'. Lines longer than
+// maxInline give errLineTooBig, and what was read so far, without buffering
+// the rest.
+func readLine(rd *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := rd.ReadSlice('\n')
+		line = append(line, b...)
+		if len(line) > maxInline {
+			return string(line), errLineTooBig
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
 	}
+}
 
-	switch line[0] {
-	default:
-		return "", ErrProtocol
-	case '+', '-', ':':
-		// +: simple string
-		// -: errors
-		// :: integer
-		// Simple line based replies.
-		return string(line[1 : len(line)-2]), nil
-	case '$':
-		// bulk strings are: `$5\r\nhello\r\n`
-		length, err := strconv.Atoi(line[1 : len(line)-2])
-		if err != nil {
-			return "", err
+// splitArgs splits an inline request into arguments, with the same quoting
+// rules as Redis' sdssplitargs(): "double quotes" with escapes such as \n and
+// \x41, and 'single quotes' where only \' is special.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args []string
+		i    = 0
+	)
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
 		}
-		if length < 0 {
-			// -1 is a nil response
-			return "", nil
+		if i == len(line) {
+			return args, nil
 		}
+
 		var (
-			buf = make([]byte, length+2)
-			pos = 0
+			arg  []byte
+			inq  = false // in "double quotes"
+			insq = false // in 'single quotes'
+			done = false
 		)
-		for pos < length+2 {
-			n, err := rd.Read(buf[pos:])
-			if err != nil {
-				return "", err
+		for !done {
+			if i == len(line) {
+				if inq || insq {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inq:
+				switch {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					arg = append(arg, byte(b))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					switch e := line[i]; e {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, e)
+					}
+				case c == '"':
+					// closing quote must be followed by a space or nothing
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					arg = append(arg, c)
+				}
+			case insq:
+				switch {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					arg = append(arg, '\'')
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					arg = append(arg, c)
+				}
+			default:
+				switch c {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inq = true
+				case '\'':
+					insq = true
+				default:
+					arg = append(arg, c)
+				}
 			}
-			pos += n
+			i++
 		}
-		return string(buf[:length]), nil
+		args = append(args, string(arg))
 	}
 }
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
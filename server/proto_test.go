@@ -3,7 +3,7 @@ package server
 import (
 	"bufio"
 	"bytes"
-	"fmt"
+	"errors"
 	"io"
 	"reflect"
 	"strings"
@@ -39,8 +39,63 @@ func TestReadArray(t *testing.T) {
 		{
 			payload: "*-1\r\n", // not sure this is legal in a request
 		},
+		{
+			payload: "PING\r\n",
+			res:     []string{"PING"},
+		},
+		{
+			payload: "SET a \"b c\"\n",
+			res:     []string{"SET", "a", "b c"},
+		},
+		{
+			payload: "\r\n",
+		},
+		{
+			payload: "SET a \"b\r\n",
+			err:     protocolError("unbalanced quotes in request"),
+		},
+		{
+			payload: "*x\r\n",
+			err:     protocolError("invalid multibulk length"),
+		},
+		{
+			payload: "*2000000\r\n",
+			err:     protocolError("invalid multibulk length"),
+		},
+		{
+			payload: "*1\r\n+PING\r\n",
+			err:     protocolError("expected '$', got '+'"),
+		},
+		{
+			payload: "*1\r\n$-4\r\n",
+			err:     protocolError("invalid bulk length"),
+		},
+		{
+			payload: "*1\r\n$2000\r\n",
+			err:     protocolError("invalid bulk length"),
+		},
+		{
+			payload: "*1\r\n$4\r\nPI",
+			err:     io.EOF,
+		},
+		{
+			payload: "*1\r\n$4\r\nPINGPONG\r\n",
+			err:     protocolError("expected CRLF after bulk string"),
+		},
+		{
+			payload: "PING " + strings.Repeat("x", maxInline), // no newline needed
+			err:     protocolError("too big inline request"),
+		},
+		{
+			payload: "*" + strings.Repeat("1", maxInline) + "\r\n",
+			err:     protocolError("too big mbulk count string"),
+		},
+		{
+			payload: "*1\r\n$" + strings.Repeat("1", maxInline) + "\r\n",
+			err:     protocolError("too big bulk count string"),
+		},
 	} {
-		res, err := readArray(bufio.NewReader(bytes.NewBufferString(c.payload)))
+		res, err := readArray(bufio.NewReader(bytes.NewBufferString(c.payload)), 1000)
 		if have, want := err, c.err; have != want {
 			t.Errorf("err %d: have %v, want %v", i, have, want)
 			continue
@@ -48,74 +103,74 @@ func TestReadArray(t *testing.T) {
 		if have, want := res, c.res; !reflect.DeepEqual(have, want) {
 			t.Errorf("case %d: have %v, want %v", i, have, want)
 		}
+		if _, ok := c.err.(protocolError); ok && !errors.Is(err, ErrProtocol) {
+			t.Errorf("err %d: not an ErrProtocol", i)
+		}
 	}
 }
 
-func TestReadString(t *testing.T) {
+func TestSplitArgs(t *testing.T) {
 	type cas struct {
-		payload string
-		err     error
-		res     string
+		line string
+		err  error
+		res  []string
 	}
-	bigPayload := strings.Repeat("X", 1<<24)
 	for i, c := range []cas{
 		{
-			payload: "+hello world\r\n",
-			res:     "hello world",
+			line: "",
 		},
 		{
-			payload: "-some error\r\n",
-			res:     "some error",
+			line: "  PING  ",
+			res:  []string{"PING"},
 		},
 		{
-			payload: ":42\r\n",
-			res:     "42",
+			line: "set foo\tbar",
+			res:  []string{"set", "foo", "bar"},
 		},
 		{
-			payload: ":\r\n",
-			res:     "",
+			line: `SET a "b c"`,
+			res:  []string{"SET", "a", "b c"},
 		},
 		{
-			payload: "$4\r\nabcd\r\n",
-			res:     "abcd",
+			line: `SET a "\x41\n\"\\" 'it''s'`,
+			err:  protocolError("unbalanced quotes in request"),
 		},
 		{
-			payload: fmt.Sprintf("$%d\r\n%s\r\n", len(bigPayload), bigPayload),
-			res:     bigPayload,
+			line: `SET a "\x41\n\"\\\q" 'it\'s'`,
+			res:  []string{"SET", "a", "A\n\"\\q", "it's"},
 		},
-
 		{
-			payload: "",
-			err:     io.EOF,
+			line: `SET a "\x4"`,
+			res:  []string{"SET", "a", "x4"},
 		},
 		{
-			payload: ":42",
-			err:     io.EOF,
+			line: `SET a 'b\n'`,
+			res:  []string{"SET", "a", `b\n`},
 		},
 		{
-			payload: "XXX",
-			err:     io.EOF,
+			line: `SET a ""`,
+			res:  []string{"SET", "a", ""},
 		},
 		{
-			payload: "XXXXXX",
-			err:     io.EOF,
+			line: `SET a"b c" d`,
+			res:  []string{"SET", "ab c", "d"},
 		},
 		{
-			payload: "\r\n",
-			err:     ErrProtocol,
+			line: `SET a "b"c`,
+			err:  protocolError("unbalanced quotes in request"),
 		},
 		{
-			payload: "XXXX\r\n",
-			err:     ErrProtocol,
+			line: `SET a 'b`,
+			err:  protocolError("unbalanced quotes in request"),
 		},
 	} {
-		res, err := readString(bufio.NewReader(bytes.NewBufferString(c.payload)))
+		res, err := splitArgs(c.line)
 		if have, want := err, c.err; have != want {
 			t.Errorf("err %d: have %v, want %v", i, have, want)
 			continue
 		}
 		if have, want := res, c.res; !reflect.DeepEqual(have, want) {
-			t.Errorf("case %d: have %#v, want %#v", i, have, want)
+			t.Errorf("case %d: have %q, want %q", i, have, want)
 		}
 	}
 }
@@ -2,10 +2,17 @@ package server
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 )
 
@@ -25,36 +32,93 @@ type Cmd func(c *Peer, cmd string, args []string)
 
 type DisconnectHandler func(c *Peer)
 
+// Hook is called before and after every known command, see SetPreHook() and
+// SetPostHook()
+type Hook func(c *Peer, cmd string, args []string)
+
+// Fault changes how a single command is handled, see SetFaultHook().
+type Fault struct {
+	Latency       time.Duration // wait this long before the command
+	Error         string        // reply with this error, don't run the command
+	Drop          bool          // close the connection, don't run the command
+	PartialReply  bool          // run the command, but write only half the reply
+	CloseMidReply bool          // run the command, write half the reply, and close
+}
+
+// FaultHook is called before every known command. It returns the fault to
+// inject, or nil. See SetFaultHook().
+type FaultHook func(c *Peer, cmd string, args []string) *Fault
+
+// CheckHook is called before every known command. It returns the error to
+// reply with instead of running the command, or "". See SetCheckHook().
+type CheckHook func(c *Peer, cmd string, args []string) string
+
+// CommandStat has the call statistics of a single command
+type CommandStat struct {
+	Calls       int           // number of calls
+	Duration    time.Duration // total time spent
+	FailedCalls int           // calls which replied with an error
+}
+
 // Server is a simple redis server
 type Server struct {
-	l         net.Listener
-	cmds      map[string]Cmd
-	peers     map[net.Conn]struct{}
-	mu        sync.Mutex
-	wg        sync.WaitGroup
-	infoConns int
-	infoCmds  int
+	l          net.Listener
+	cmds       map[string]Cmd
+	peers      map[net.Conn]*Peer
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	lastID     int
+	infoConns  int
+	infoCmds   int
+	infoErrors int
+	cmdStats   map[string]*CommandStat
+	preHook    Hook
+	postHook   Hook
+	faultHook  FaultHook
+	checkHook  CheckHook
+	capture    bool // keep the replies, see CaptureReplies()
+	maxBulkLen int  // see SetMaxBulkLen()
+	nowMu      sync.Mutex
+	now        func() time.Time // see SetNow()
 }
 
 // NewServer makes a server listening on addr. Close with .Close().
 func NewServer(addr string) (*Server, error) {
-	s := Server{
-		cmds:  map[string]Cmd{},
-		peers: map[net.Conn]struct{}{},
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
 	}
+	return NewServerListener(l), nil
+}
 
-	l, err := net.Listen("tcp", addr)
+// NewServerTLS makes a server listening for TLS connections on addr. Close
+// with .Close().
+func NewServerTLS(addr string, cfg *tls.Config) (*Server, error) {
+	l, err := tls.Listen("tcp", addr, cfg)
 	if err != nil {
 		return nil, err
 	}
-	s.l = l
+	return NewServerListener(l), nil
+}
+
+// NewServerListener makes a server which accepts connections from any
+// net.Listener, such as a unix socket. Close with .Close(), which also closes
+// the listener.
+func NewServerListener(l net.Listener) *Server {
+	s := Server{
+		cmds:       map[string]Cmd{},
+		peers:      map[net.Conn]*Peer{},
+		cmdStats:   map[string]*CommandStat{},
+		l:          l,
+		maxBulkLen: DefaultMaxBulkLen,
+	}
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
 		s.serve(l)
 	}()
-	return &s, nil
+	return &s
 }
 
 func (s *Server) serve(l net.Listener) {
@@ -69,31 +133,83 @@ func (s *Server) serve(l net.Listener) {
 
 // ServeConn handles a net.Conn. Nice with net.Pipe()
 func (s *Server) ServeConn(conn net.Conn) {
+	s.AddConn(conn)
+}
+
+// AddConn handles a net.Conn, the same as ServeConn(), and returns the new
+// Peer. Nothing has been read from the connection yet, so the Peer can be
+// set up before the first command.
+func (s *Server) AddConn(conn net.Conn) *Peer {
 	s.wg.Add(1)
+	s.mu.Lock()
+	s.infoConns++
+	s.lastID++
+	peer := newPeer(conn, s.lastID, s.clockNow)
+	s.peers[conn] = peer
+	s.mu.Unlock()
+
 	go func() {
 		defer s.wg.Done()
 		defer conn.Close()
-		s.mu.Lock()
-		s.peers[conn] = struct{}{}
-		s.infoConns++
-		s.mu.Unlock()
 
-		s.servePeer(conn)
+		s.servePeer(conn, peer)
 
 		s.mu.Lock()
 		delete(s.peers, conn)
 		s.mu.Unlock()
 	}()
+	return peer
+}
+
+// SetNow sets the time source for the age and idle time of connections.
+// time.Now() if nil. Connected clients keep their age and idle time.
+func (s *Server) SetNow(now func() time.Time) {
+	old := s.clockNow()
+	s.nowMu.Lock()
+	s.now = now
+	s.nowMu.Unlock()
+	d := s.clockNow().Sub(old)
+
+	s.mu.Lock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		peers = append(peers, p)
+	}
+	s.mu.Unlock()
+	for _, p := range peers {
+		p.mu.Lock()
+		p.created = p.created.Add(d)
+		p.lastActive = p.lastActive.Add(d)
+		p.mu.Unlock()
+	}
 }
 
-// Addr has the net.Addr struct
+// clockNow is the current time, see SetNow().
+func (s *Server) clockNow() time.Time {
+	s.nowMu.Lock()
+	now := s.now
+	s.nowMu.Unlock()
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
+
+// Addr has the net.Addr struct. It's nil if the server doesn't listen on TCP,
+// see ListenAddr().
 func (s *Server) Addr() *net.TCPAddr {
+	a, _ := s.ListenAddr().(*net.TCPAddr)
+	return a
+}
+
+// ListenAddr is the address of the listener, for any kind of listener.
+func (s *Server) ListenAddr() net.Addr {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.l == nil {
 		return nil
 	}
-	return s.l.Addr().(*net.TCPAddr)
+	return s.l.Addr()
 }
 
 // Close a server started with NewServer. It will wait until all clients are
@@ -124,11 +240,33 @@ func (s *Server) Register(cmd string, f Cmd) error {
 	return nil
 }
 
-func (s *Server) servePeer(c net.Conn) {
+// Override registers a command, replacing the existing command by that name,
+// if any. Safe to call on a running server.
+func (s *Server) Override(cmd string, f Cmd) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds[strings.ToUpper(cmd)] = f
+}
+
+// SetPreHook sets a function which is called before every known command, with
+// the command name as sent by the client. Safe to call on a running server.
+func (s *Server) SetPreHook(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preHook = h
+}
+
+// SetPostHook sets a function which is called after every known command is
+// done, with the command name as sent by the client. The reply has not been
+// flushed yet. Safe to call on a running server.
+func (s *Server) SetPostHook(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postHook = h
+}
+
+func (s *Server) servePeer(c net.Conn, peer *Peer) {
 	r := bufio.NewReader(c)
-	peer := &Peer{
-		w: bufio.NewWriter(c),
-	}
 	defer func() {
 		for _, f := range peer.onDisconnect {
 			f()
@@ -136,10 +274,20 @@ func (s *Server) servePeer(c net.Conn) {
 	}()
 
 	for {
-		args, err := readArray(r)
+		s.mu.Lock()
+		maxBulkLen := s.maxBulkLen
+		s.mu.Unlock()
+		args, err := readArray(r, maxBulkLen)
 		if err != nil {
+			if e, ok := err.(protocolError); ok {
+				peer.WriteError(e.Error())
+				peer.Flush()
+			}
 			return
 		}
+		if len(args) == 0 {
+			continue
+		}
 		s.dispatch(peer, args)
 		peer.Flush()
 		s.mu.Lock()
@@ -159,13 +307,72 @@ func (s *Server) dispatch(c *Peer, args []string) {
 	s.mu.Unlock()
 	if !ok {
 		c.WriteError(errUnknownCommand(cmd, args))
+		s.mu.Lock()
+		s.infoErrors++
+		s.mu.Unlock()
 		return
 	}
 
 	s.mu.Lock()
 	s.infoCmds++
+	preHook, postHook, checkHook, faultHook, capture := s.preHook, s.postHook, s.checkHook, s.faultHook, s.capture
 	s.mu.Unlock()
-	cb(c, cmdUp, args)
+	c.startCommand(capture)
+	if preHook != nil {
+		preHook(c, cmd, args)
+	}
+	var fault Fault
+	if checkHook != nil {
+		fault.Error = checkHook(c, cmd, args)
+	}
+	if fault.Error == "" && faultHook != nil {
+		if f := faultHook(c, cmd, args); f != nil {
+			fault = *f
+		}
+	}
+	if fault.Latency > 0 {
+		time.Sleep(fault.Latency)
+	}
+	if fault.Drop {
+		c.endCommand()
+		c.Kill()
+		return
+	}
+	if fault.PartialReply || fault.CloseMidReply {
+		c.holdReply()
+	}
+	var (
+		errs  = c.Errors()
+		start = time.Now()
+	)
+	if fault.Error != "" {
+		c.WriteError(fault.Error)
+	} else {
+		cb(c, cmdUp, args)
+	}
+	took := time.Since(start)
+	c.endCommand()
+	if fault.CloseMidReply {
+		c.Flush()
+		c.Kill()
+	}
+	if postHook != nil {
+		postHook(c, cmd, args)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.cmdStats[cmdUp]
+	if !ok {
+		st = &CommandStat{}
+		s.cmdStats[cmdUp] = st
+	}
+	st.Calls++
+	st.Duration += took
+	if failed := c.Errors() - errs; failed > 0 {
+		st.FailedCalls++
+		s.infoErrors += failed
+	}
 }
 
 // TotalCommands is total (known) commands since this the server started
@@ -175,6 +382,83 @@ func (s *Server) TotalCommands() int {
 	return s.infoCmds
 }
 
+// SetFaultHook sets a function which is called before every known command, after
+// the pre hook, with the command name as sent by the client. Safe to call on a
+// running server.
+func (s *Server) SetFaultHook(h FaultHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faultHook = h
+}
+
+// SetCheckHook sets a function which is called before every known command,
+// after the pre hook and before the fault hook, with the command name as sent
+// by the client. If it returns an error the command doesn't run, and the fault
+// hook isn't called. Safe to call on a running server.
+func (s *Server) SetCheckHook(h CheckHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkHook = h
+}
+
+// CaptureReplies makes the server keep the reply of every command, so the post
+// hook can use Peer.Reply(). Safe to call on a running server.
+func (s *Server) CaptureReplies(b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capture = b
+}
+
+// SetMaxBulkLen sets the max length of a single argument in a request. Longer
+// arguments are a protocol error. Safe to call on a running server.
+func (s *Server) SetMaxBulkLen(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxBulkLen = n
+}
+
+// ResetStats resets the counters of TotalCommands(), TotalConnections(),
+// TotalErrors(), and CommandStats(). Used by CONFIG RESETSTAT.
+func (s *Server) ResetStats() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.infoCmds = 0
+	s.infoConns = 0
+	s.infoErrors = 0
+	s.cmdStats = map[string]*CommandStat{}
+}
+
+// TotalErrors is the total number of error replies since the server started
+func (s *Server) TotalErrors() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.infoErrors
+}
+
+// CommandStats gives the call statistics per (uppercase) command. Only commands
+// which have been called are included.
+func (s *Server) CommandStats() map[string]CommandStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]CommandStat, len(s.cmdStats))
+	for cmd, st := range s.cmdStats {
+		stats[cmd] = *st
+	}
+	return stats
+}
+
+// Peers gives all connected clients, ordered by ID.
+func (s *Server) Peers() []*Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].id < peers[j].id })
+	return peers
+}
+
 // ClientsLen gives the number of connected clients right now
 func (s *Server) ClientsLen() int {
 	s.mu.Lock()
@@ -190,13 +474,88 @@ func (s *Server) TotalConnections() int {
 	return s.infoConns
 }
 
+// ReplyMode is set with CLIENT REPLY
+type ReplyMode int
+
+const (
+	ReplyOn   ReplyMode = iota // normal replies
+	ReplyOff                   // no replies at all
+	ReplySkip                  // no reply for the next command
+)
+
 // Peer is a client connected to the server
 type Peer struct {
 	w            *bufio.Writer
 	closed       bool
-	Ctx          interface{} // anything goes, server won't touch this
-	onDisconnect []func()    // list of callbacks
-	mu           sync.Mutex  // for Block()
+	id           int
+	conn         net.Conn
+	now          func() time.Time
+	created      time.Time
+	lastActive   time.Time    // start of the last command
+	resp3        bool         // set with HELLO
+	errors       int          // number of errors written
+	replyOff     bool         // CLIENT REPLY OFF
+	replySkip    bool         // CLIENT REPLY SKIP, for the next command
+	muted        bool         // nothing is written for the current command
+	capture      bool         // copy the reply of the current command to reply
+	held         bool         // only half the reply of the current command is written
+	reply        bytes.Buffer // the captured reply
+	Ctx          interface{}  // anything goes, server won't touch this
+	onDisconnect []func()     // list of callbacks
+	mu           sync.Mutex   // for Block()
+}
+
+func newPeer(conn net.Conn, id int, now func() time.Time) *Peer {
+	t := now()
+	return &Peer{
+		w:          bufio.NewWriter(conn),
+		id:         id,
+		conn:       conn,
+		now:        now,
+		created:    t,
+		lastActive: t,
+	}
+}
+
+// startCommand is called before every command.
+func (c *Peer) startCommand(capture bool) {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastActive = now
+	c.muted = c.replyOff || c.replySkip
+	c.replySkip = false
+	c.capture = capture
+	c.reply.Reset()
+}
+
+// endCommand is called after every command. It writes half of a held reply.
+func (c *Peer) endCommand() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.held && !c.muted {
+		b := c.reply.Bytes()
+		c.w.Write(b[:len(b)/2])
+	}
+	c.muted = c.replyOff
+	c.capture = false
+	c.held = false
+}
+
+// holdReply keeps the reply of the current command, instead of writing it.
+// endCommand() writes half of it.
+func (c *Peer) holdReply() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.held = true
+}
+
+// Reply is the reply of the last command, in RESP. Only set with
+// Server.CaptureReplies(), and only valid in the post hook.
+func (c *Peer) Reply() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reply.String()
 }
 
 // Flush the write buffer. Called automatically after every redis command
@@ -213,6 +572,84 @@ func (c *Peer) Close() {
 	c.closed = true
 }
 
+// ID is the unique id of this client.
+func (c *Peer) ID() int {
+	return c.id
+}
+
+// Addr is the address of the client.
+func (c *Peer) Addr() string {
+	if _, ok := c.conn.RemoteAddr().(*net.UnixAddr); ok {
+		// the client side of a unix socket has no name, so use the socket,
+		// the same as Redis.
+		return c.conn.LocalAddr().String() + ":0"
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+// LocalAddr is the address the client connected to.
+func (c *Peer) LocalAddr() string {
+	if _, ok := c.conn.LocalAddr().(*net.UnixAddr); ok {
+		return c.conn.LocalAddr().String() + ":0"
+	}
+	return c.conn.LocalAddr().String()
+}
+
+// Age is how long the client is connected.
+func (c *Peer) Age() time.Duration {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Sub(c.created)
+}
+
+// Idle is the time since the client started its last command.
+func (c *Peer) Idle() time.Duration {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Sub(c.lastActive)
+}
+
+// Kill closes the connection right away. Use Close() to close a connection
+// after the current command.
+func (c *Peer) Kill() {
+	c.conn.Close()
+}
+
+// SetReplyMode changes whether the client gets replies, the same as CLIENT
+// REPLY. With ReplyOff and ReplySkip the current command gets no reply either.
+func (c *Peer) SetReplyMode(m ReplyMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch m {
+	case ReplyOn:
+		c.replyOff = false
+		c.muted = false
+	case ReplyOff:
+		c.replyOff = true
+		c.muted = true
+	case ReplySkip:
+		c.replySkip = true
+		c.muted = true
+	}
+}
+
+// Resp3 is true if the client switched to RESP3 with HELLO.
+func (c *Peer) Resp3() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resp3
+}
+
+// SetResp3 switches the protocol version of the client. RESP3 if true, RESP2
+// otherwise.
+func (c *Peer) SetResp3(b bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resp3 = b
+}
+
 // Register a function to execute on disconnect. There can be multiple
 // functions registered.
 func (c *Peer) OnDisconnect(f func()) {
@@ -223,16 +660,38 @@ func (c *Peer) OnDisconnect(f func()) {
 func (c *Peer) Block(f func(*Writer)) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	f(&Writer{c.w})
+	if c.capture || c.held {
+		var out io.Writer = c.w
+		if c.muted || c.held {
+			out = ioutil.Discard
+		}
+		w := bufio.NewWriter(io.MultiWriter(out, &c.reply))
+		f(&Writer{w, c.resp3})
+		w.Flush()
+		return
+	}
+	if c.muted {
+		f(&Writer{bufio.NewWriter(ioutil.Discard), c.resp3})
+		return
+	}
+	f(&Writer{c.w, c.resp3})
 }
 
 // WriteError writes a redis 'Error'
 func (c *Peer) WriteError(e string) {
 	c.Block(func(w *Writer) {
+		c.errors++
 		w.WriteError(e)
 	})
 }
 
+// Errors is the number of errors written with WriteError()
+func (c *Peer) Errors() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.errors
+}
+
 // WriteInline writes a redis inline string
 func (c *Peer) WriteInline(s string) {
 	c.Block(func(w *Writer) {
@@ -273,6 +732,67 @@ func (c *Peer) WriteInt(i int) {
 	})
 }
 
+// WriteMapLen starts a map with the given number of key/value pairs. An array
+// of twice that length in RESP2.
+func (c *Peer) WriteMapLen(n int) {
+	c.Block(func(w *Writer) {
+		w.WriteMapLen(n)
+	})
+}
+
+// WriteSetLen starts a set with the given length. An array in RESP2.
+func (c *Peer) WriteSetLen(n int) {
+	c.Block(func(w *Writer) {
+		w.WriteSetLen(n)
+	})
+}
+
+// WritePushLen starts a push message with the given length. An array in
+// RESP2.
+func (c *Peer) WritePushLen(n int) {
+	c.Block(func(w *Writer) {
+		w.WritePushLen(n)
+	})
+}
+
+// WriteFloat writes a double. A bulk string in RESP2.
+func (c *Peer) WriteFloat(f float64) {
+	c.Block(func(w *Writer) {
+		w.WriteFloat(f)
+	})
+}
+
+// WriteBool writes a boolean. An integer in RESP2.
+func (c *Peer) WriteBool(b bool) {
+	c.Block(func(w *Writer) {
+		w.WriteBool(b)
+	})
+}
+
+// WriteBigNumber writes a big number, given as a decimal string. A bulk
+// string in RESP2.
+func (c *Peer) WriteBigNumber(n string) {
+	c.Block(func(w *Writer) {
+		w.WriteBigNumber(n)
+	})
+}
+
+// WriteVerbatim writes a verbatim string. format is a three letter type such
+// as "txt" or "mkd". A bulk string in RESP2.
+func (c *Peer) WriteVerbatim(format, s string) {
+	c.Block(func(w *Writer) {
+		w.WriteVerbatim(format, s)
+	})
+}
+
+// WriteAttribute writes an attribute map, which applies to the next reply.
+// Nothing is written in RESP2.
+func (c *Peer) WriteAttribute(attrs map[string]string) {
+	c.Block(func(w *Writer) {
+		w.WriteAttribute(attrs)
+	})
+}
+
 func toInline(s string) string {
 	return strings.Map(func(r rune) rune {
 		if unicode.IsSpace(r) {
@@ -284,7 +804,13 @@ func toInline(s string) string {
 
 // A Writer is given to the callback in Block()
 type Writer struct {
-	w *bufio.Writer
+	w     *bufio.Writer
+	resp3 bool
+}
+
+// Resp3 is true if the client uses RESP3.
+func (w *Writer) Resp3() bool {
+	return w.resp3
 }
 
 // WriteError writes a redis 'Error'
@@ -292,10 +818,42 @@ func (w *Writer) WriteError(e string) {
 	fmt.Fprintf(w.w, "-%s\r\n", toInline(e))
 }
 
+// WriteLen starts an array with the given length. -1 is a null array.
 func (w *Writer) WriteLen(n int) {
+	if n < 0 && w.resp3 {
+		fmt.Fprintf(w.w, "_\r\n")
+		return
+	}
 	fmt.Fprintf(w.w, "*%d\r\n", n)
 }
 
+// WriteMapLen starts a map with the given number of key/value pairs
+func (w *Writer) WriteMapLen(n int) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "%%%d\r\n", n)
+		return
+	}
+	w.WriteLen(n * 2)
+}
+
+// WriteSetLen starts a set with the given length
+func (w *Writer) WriteSetLen(n int) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "~%d\r\n", n)
+		return
+	}
+	w.WriteLen(n)
+}
+
+// WritePushLen starts a push message with the given length
+func (w *Writer) WritePushLen(n int) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, ">%d\r\n", n)
+		return
+	}
+	w.WriteLen(n)
+}
+
 // WriteBulk writes a bulk string
 func (w *Writer) WriteBulk(s string) {
 	fmt.Fprintf(w.w, "$%d\r\n%s\r\n", len(s), s)
@@ -308,14 +866,107 @@ func (w *Writer) WriteInt(i int) {
 
 // WriteNull writes a redis Null element
 func (w *Writer) WriteNull() {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "_\r\n")
+		return
+	}
 	fmt.Fprintf(w.w, "$-1\r\n")
 }
 
+// WriteFloat writes a double
+func (w *Writer) WriteFloat(f float64) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, ",%s\r\n", formatFloat(f))
+		return
+	}
+	w.WriteBulk(formatFloat(f))
+}
+
+// WriteBool writes a boolean
+func (w *Writer) WriteBool(b bool) {
+	switch {
+	case w.resp3 && b:
+		fmt.Fprintf(w.w, "#t\r\n")
+	case w.resp3:
+		fmt.Fprintf(w.w, "#f\r\n")
+	case b:
+		w.WriteInt(1)
+	default:
+		w.WriteInt(0)
+	}
+}
+
+// WriteBigNumber writes a big number, given as a decimal string
+func (w *Writer) WriteBigNumber(n string) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "(%s\r\n", n)
+		return
+	}
+	w.WriteBulk(n)
+}
+
+// WriteVerbatim writes a verbatim string. format should be three characters.
+func (w *Writer) WriteVerbatim(format, s string) {
+	if w.resp3 {
+		fmt.Fprintf(w.w, "=%d\r\n%s:%s\r\n", len(s)+4, format, s)
+		return
+	}
+	w.WriteBulk(s)
+}
+
+// WriteAttribute writes an attribute map. Keys are written in sorted order.
+// RESP2 has no attributes, so nothing is written there.
+func (w *Writer) WriteAttribute(attrs map[string]string) {
+	if !w.resp3 {
+		return
+	}
+	var keys []string
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w.w, "|%d\r\n", len(keys))
+	for _, k := range keys {
+		w.WriteBulk(k)
+		w.WriteBulk(attrs[k])
+	}
+}
+
 // WriteInline writes a redis inline string
 func (w *Writer) WriteInline(s string) {
 	fmt.Fprintf(w.w, "+%s\r\n", toInline(s))
 }
 
+// WriteRaw writes s as is. It's up to the caller to make it valid RESP.
+func (w *Writer) WriteRaw(s string) {
+	w.w.WriteString(s)
+}
+
 func (w *Writer) Flush() {
 	w.w.Flush()
 }
+
+// formatFloat formats a float the way redis does (sort-of). This is the same
+// as formatFloat() in miniredis.
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "inf"
+	}
+	if math.IsInf(v, -1) {
+		return "-inf"
+	}
+	sv := fmt.Sprintf("%.12f", v)
+	for strings.Contains(sv, ".") {
+		if sv[len(sv)-1] != '0' {
+			break
+		}
+		// Remove trailing 0s.
+		sv = sv[:len(sv)-1]
+		// Ends with a '.'.
+		if sv[len(sv)-1] == '.' {
+			sv = sv[:len(sv)-1]
+			break
+		}
+	}
+	return sv
+}
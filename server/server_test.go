@@ -1,11 +1,18 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -156,4 +163,160 @@ func Test(t *testing.T) {
 			t.Errorf("have: %s, want: %s", have, want)
 		}
 	}
+
+	{
+		stats := s.CommandStats()
+		if have, want := stats["PING"].Calls, 2; have != want {
+			t.Errorf("have: %d, want: %d", have, want)
+		}
+		if have, want := stats["ECHO"].FailedCalls, 1; have != want {
+			t.Errorf("have: %d, want: %d", have, want)
+		}
+		if _, ok := stats["NOSUCH"]; ok {
+			t.Errorf("unknown command in stats")
+		}
+		if have, want := s.TotalErrors(), 2; have != want {
+			t.Errorf("have: %d, want: %d", have, want)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "test.sock")
+
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServerListener(l)
+	defer s.Close()
+	if s.Addr() != nil {
+		t.Errorf("have %v, want nil", s.Addr())
+	}
+	if have, want := s.ListenAddr().String(), sock; have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+
+	s.Register("PING", func(c *Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	c, err := redis.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	res, err := redis.String(c.Do("PING"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := res, "PONG"; have != want {
+		t.Errorf("have: %s, want: %s", have, want)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	type cas struct {
+		write func(*Writer)
+		resp2 string
+		resp3 string
+	}
+	for i, c := range []cas{
+		{
+			write: func(w *Writer) { w.WriteNull() },
+			resp2: "$-1\r\n",
+			resp3: "_\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteLen(-1) },
+			resp2: "*-1\r\n",
+			resp3: "_\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteMapLen(2) },
+			resp2: "*4\r\n",
+			resp3: "%2\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteSetLen(2) },
+			resp2: "*2\r\n",
+			resp3: "~2\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WritePushLen(3) },
+			resp2: "*3\r\n",
+			resp3: ">3\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteFloat(3.14) },
+			resp2: "$4\r\n3.14\r\n",
+			resp3: ",3.14\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteBool(true) },
+			resp2: ":1\r\n",
+			resp3: "#t\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteBool(false) },
+			resp2: ":0\r\n",
+			resp3: "#f\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteBigNumber("3492890328409238509324850943850943825024385") },
+			resp2: "$43\r\n3492890328409238509324850943850943825024385\r\n",
+			resp3: "(3492890328409238509324850943850943825024385\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteVerbatim("txt", "Some string") },
+			resp2: "$11\r\nSome string\r\n",
+			resp3: "=15\r\ntxt:Some string\r\n",
+		},
+		{
+			write: func(w *Writer) { w.WriteAttribute(map[string]string{"ttl": "3600", "key-popularity": "a"}) },
+			resp2: "",
+			resp3: "|2\r\n$14\r\nkey-popularity\r\n$1\r\na\r\n$3\r\nttl\r\n$4\r\n3600\r\n",
+		},
+	} {
+		for _, resp3 := range []bool{false, true} {
+			var buf bytes.Buffer
+			w := &Writer{bufio.NewWriter(&buf), resp3}
+			c.write(w)
+			w.Flush()
+			want := c.resp2
+			if resp3 {
+				want = c.resp3
+			}
+			if have := buf.String(); have != want {
+				t.Errorf("case %d (resp3: %t): have %q, want %q", i, resp3, have, want)
+			}
+		}
+	}
+}
+
+// Resp3() can be used from other connections, such as for CLIENT LIST.
+func TestPeerResp3(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	p := newPeer(server, 1, time.Now)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.SetResp3(i%2 == 1)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		p.Resp3()
+	}
+	<-done
+	if !p.Resp3() {
+		t.Errorf("want RESP3")
+	}
 }
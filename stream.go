@@ -0,0 +1,503 @@
+package miniredis
+
+// Basic stream implementation. Entries are kept in a plain slice, ordered by
+// ID. We don't care about performance that much.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidStreamID  = errors.New(msgInvalidStreamID)
+	errZeroStreamID     = errors.New(msgStreamIDZero)
+	errStreamIDTooSmall = errors.New(msgStreamIDTooSmall)
+)
+
+// StreamEntry is a single entry in a stream. Values is a flat list of
+// field/value pairs.
+type StreamEntry struct {
+	ID     string
+	Values []string
+}
+
+// streamID is the parsed version of a "<ms>-<seq>" ID.
+type streamID struct {
+	ms  uint64
+	seq uint64
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+// cmp returns -1, 0, or 1.
+func (id streamID) cmp(o streamID) int {
+	switch {
+	case id.ms < o.ms:
+		return -1
+	case id.ms > o.ms:
+		return 1
+	case id.seq < o.seq:
+		return -1
+	case id.seq > o.seq:
+		return 1
+	}
+	return 0
+}
+
+func (id streamID) isZero() bool {
+	return id.ms == 0 && id.seq == 0
+}
+
+// next is the smallest ID larger than id. Returns false on overflow.
+func (id streamID) next() (streamID, bool) {
+	if id.seq == math.MaxUint64 {
+		if id.ms == math.MaxUint64 {
+			return id, false
+		}
+		return streamID{id.ms + 1, 0}, true
+	}
+	return streamID{id.ms, id.seq + 1}, true
+}
+
+// parseStreamID parses a full or partial ("<ms>") ID. A partial ID gets
+// missingSeq as its sequence number.
+func parseStreamID(id string, missingSeq uint64) (streamID, error) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return streamID{}, errInvalidStreamID
+	}
+	if len(parts) == 1 {
+		return streamID{ms, missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return streamID{}, errInvalidStreamID
+	}
+	return streamID{ms, seq}, nil
+}
+
+// mustParseStreamID is for IDs we generated ourselves.
+func mustParseStreamID(id string) streamID {
+	sid, err := parseStreamID(id, 0)
+	if err != nil {
+		panic(err)
+	}
+	return sid
+}
+
+// parseStreamRange parses a XRANGE-like range argument. "-" and "+" are the
+// smallest and largest IDs, "(" makes the ID exclusive.
+func parseStreamRange(id string, end bool) (streamID, error) {
+	switch id {
+	case "-":
+		return streamID{0, 0}, nil
+	case "+":
+		return streamID{math.MaxUint64, math.MaxUint64}, nil
+	}
+	exclusive := false
+	if strings.HasPrefix(id, "(") {
+		exclusive = true
+		id = id[1:]
+	}
+	var missingSeq uint64
+	if end {
+		missingSeq = math.MaxUint64
+	}
+	sid, err := parseStreamID(id, missingSeq)
+	if err != nil {
+		return sid, err
+	}
+	if !exclusive {
+		return sid, nil
+	}
+	if end {
+		if sid.isZero() {
+			return sid, errors.New(msgStreamInvalidEnd)
+		}
+		if sid.seq == 0 {
+			return streamID{sid.ms - 1, math.MaxUint64}, nil
+		}
+		return streamID{sid.ms, sid.seq - 1}, nil
+	}
+	next, ok := sid.next()
+	if !ok {
+		return sid, errors.New(msgStreamInvalidStart)
+	}
+	return next, nil
+}
+
+type streamKey struct {
+	entries      []StreamEntry
+	lastID       streamID // last generated ID, even if the entry is gone
+	maxDeletedID streamID
+	entriesAdded uint64
+	groups       map[string]*streamGroup
+}
+
+type streamGroup struct {
+	stream      *streamKey
+	lastID      streamID
+	entriesRead uint64
+	pending     []pendingEntry // ordered by ID
+	consumers   map[string]*streamConsumer
+}
+
+type streamConsumer struct {
+	name       string
+	seenTime   time.Time // last time we saw this consumer do anything
+	activeTime time.Time // last time this consumer got something delivered
+}
+
+type pendingEntry struct {
+	id            streamID
+	consumer      string
+	deliveryCount int
+	lastDelivery  time.Time
+}
+
+func newStreamKey() *streamKey {
+	return &streamKey{
+		groups: map[string]*streamGroup{},
+	}
+}
+
+// generateID makes a new ID for XADD. id is "*", "<ms>-*", or a full ID.
+func (s *streamKey) generateID(now time.Time, id string) (streamID, error) {
+	if id == "*" {
+		ms := uint64(now.UnixNano() / int64(time.Millisecond))
+		if ms > s.lastID.ms {
+			return streamID{ms, 0}, nil
+		}
+		next, ok := s.lastID.next()
+		if !ok {
+			return next, errStreamIDTooSmall
+		}
+		return next, nil
+	}
+
+	var sid streamID
+	if strings.HasSuffix(id, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(id, "-*"), 10, 64)
+		if err != nil {
+			return sid, errInvalidStreamID
+		}
+		sid = streamID{ms, 0}
+		if ms == s.lastID.ms {
+			if s.lastID.seq == math.MaxUint64 {
+				return sid, errStreamIDTooSmall
+			}
+			sid.seq = s.lastID.seq + 1
+		}
+		if sid.isZero() {
+			sid.seq = 1
+		}
+	} else {
+		var err error
+		sid, err = parseStreamID(id, 0)
+		if err != nil {
+			return sid, err
+		}
+		if sid.isZero() {
+			return sid, errZeroStreamID
+		}
+	}
+	if sid.cmp(s.lastID) <= 0 {
+		return sid, errStreamIDTooSmall
+	}
+	return sid, nil
+}
+
+// add appends an entry. The ID must be valid and new.
+func (s *streamKey) add(id streamID, values []string) {
+	s.entries = append(s.entries, StreamEntry{
+		ID:     id.String(),
+		Values: values,
+	})
+	s.lastID = id
+	s.entriesAdded++
+}
+
+func (s *streamKey) lastEntryID() streamID {
+	if len(s.entries) == 0 {
+		return s.lastID
+	}
+	return mustParseStreamID(s.entries[len(s.entries)-1].ID)
+}
+
+// search returns the index of the first entry with ID >= id.
+func (s *streamKey) search(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return mustParseStreamID(s.entries[i].ID).cmp(id) >= 0
+	})
+}
+
+// get returns the entry with exactly this ID.
+func (s *streamKey) get(id streamID) (*StreamEntry, bool) {
+	i := s.search(id)
+	if i >= len(s.entries) || mustParseStreamID(s.entries[i].ID).cmp(id) != 0 {
+		return nil, false
+	}
+	return &s.entries[i], true
+}
+
+// between returns all entries with start <= ID <= end. count <= 0 means
+// everything.
+func (s *streamKey) between(start, end streamID, count int, reverse bool) []StreamEntry {
+	if start.cmp(end) > 0 {
+		return nil
+	}
+	var res []StreamEntry
+	from, to := s.search(start), len(s.entries)
+	for i := from; i < len(s.entries); i++ {
+		if mustParseStreamID(s.entries[i].ID).cmp(end) > 0 {
+			to = i
+			break
+		}
+	}
+	if reverse {
+		for i := to - 1; i >= from; i-- {
+			if count > 0 && len(res) >= count {
+				break
+			}
+			res = append(res, s.entries[i])
+		}
+		return res
+	}
+	for i := from; i < to; i++ {
+		if count > 0 && len(res) >= count {
+			break
+		}
+		res = append(res, s.entries[i])
+	}
+	return res
+}
+
+// after returns entries with ID > id.
+func (s *streamKey) after(id streamID, count int) []StreamEntry {
+	next, ok := id.next()
+	if !ok {
+		return nil
+	}
+	return s.between(next, streamID{math.MaxUint64, math.MaxUint64}, count, false)
+}
+
+// delete removes entries by ID. Returns the number of deleted entries.
+func (s *streamKey) delete(ids []streamID) int {
+	n := 0
+	for _, id := range ids {
+		i := s.search(id)
+		if i >= len(s.entries) || mustParseStreamID(s.entries[i].ID).cmp(id) != 0 {
+			continue
+		}
+		s.entries = append(s.entries[:i], s.entries[i+1:]...)
+		if id.cmp(s.maxDeletedID) > 0 {
+			s.maxDeletedID = id
+		}
+		n++
+	}
+	return n
+}
+
+// trimMaxlen keeps at most n entries. Returns the number of deleted entries.
+func (s *streamKey) trimMaxlen(n int) int {
+	if n < 0 || len(s.entries) <= n {
+		return 0
+	}
+	del := len(s.entries) - n
+	s.trimmed(s.entries[del-1].ID)
+	s.entries = s.entries[del:]
+	return del
+}
+
+// trimMinID removes all entries with an ID < id. Returns the number of deleted
+// entries.
+func (s *streamKey) trimMinID(id streamID) int {
+	del := s.search(id)
+	if del == 0 {
+		return 0
+	}
+	s.trimmed(s.entries[del-1].ID)
+	s.entries = s.entries[del:]
+	return del
+}
+
+func (s *streamKey) trimmed(lastDeleted string) {
+	if id := mustParseStreamID(lastDeleted); id.cmp(s.maxDeletedID) > 0 {
+		s.maxDeletedID = id
+	}
+}
+
+func (s *streamKey) createGroup(name string, lastID streamID) bool {
+	if _, ok := s.groups[name]; ok {
+		return false
+	}
+	s.groups[name] = &streamGroup{
+		stream:    s,
+		lastID:    lastID,
+		consumers: map[string]*streamConsumer{},
+	}
+	return true
+}
+
+// consumer returns the named consumer, creating it if needed.
+func (g *streamGroup) consumer(name string, now time.Time) *streamConsumer {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &streamConsumer{
+			name:     name,
+			seenTime: now,
+		}
+		g.consumers[name] = c
+	}
+	return c
+}
+
+// consumerNames returns all consumer names, sorted.
+func (g *streamGroup) consumerNames() []string {
+	var names []string
+	for n := range g.consumers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pendingCount is the number of pending entries for a consumer. An empty
+// consumer counts all entries.
+func (g *streamGroup) pendingCount(consumer string) int {
+	if consumer == "" {
+		return len(g.pending)
+	}
+	n := 0
+	for _, p := range g.pending {
+		if p.consumer == consumer {
+			n++
+		}
+	}
+	return n
+}
+
+// readNew delivers entries after the group's last delivered ID to the
+// consumer. They are added to the PEL, unless noack is set.
+func (g *streamGroup) readNew(consumer string, count int, noack bool, now time.Time) []StreamEntry {
+	entries := g.stream.after(g.lastID, count)
+	c := g.consumer(consumer, now)
+	c.seenTime = now
+	if len(entries) == 0 {
+		return nil
+	}
+	c.activeTime = now
+	for _, e := range entries {
+		id := mustParseStreamID(e.ID)
+		g.lastID = id
+		g.entriesRead++
+		if noack {
+			continue
+		}
+		g.setPending(pendingEntry{
+			id:            id,
+			consumer:      consumer,
+			deliveryCount: 1,
+			lastDelivery:  now,
+		})
+	}
+	return entries
+}
+
+// readHistory returns the consumer's pending entries with ID > id. Entries
+// which are pending but deleted from the stream have nil Values.
+func (g *streamGroup) readHistory(consumer string, id streamID, count int, now time.Time) []StreamEntry {
+	g.consumer(consumer, now).seenTime = now
+	var res []StreamEntry
+	for i := range g.pending {
+		p := &g.pending[i]
+		if p.consumer != consumer || p.id.cmp(id) <= 0 {
+			continue
+		}
+		if count > 0 && len(res) >= count {
+			break
+		}
+		e := StreamEntry{ID: p.id.String()}
+		if se, ok := g.stream.get(p.id); ok {
+			e.Values = se.Values
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// setPending adds or replaces a PEL entry.
+func (g *streamGroup) setPending(p pendingEntry) {
+	i := g.searchPending(p.id)
+	if i < len(g.pending) && g.pending[i].id.cmp(p.id) == 0 {
+		g.pending[i] = p
+		return
+	}
+	g.pending = append(g.pending, pendingEntry{})
+	copy(g.pending[i+1:], g.pending[i:])
+	g.pending[i] = p
+}
+
+// searchPending returns the index of the first PEL entry with ID >= id.
+func (g *streamGroup) searchPending(id streamID) int {
+	return sort.Search(len(g.pending), func(i int) bool {
+		return g.pending[i].id.cmp(id) >= 0
+	})
+}
+
+// getPending returns the PEL entry for the ID, if any.
+func (g *streamGroup) getPending(id streamID) (*pendingEntry, bool) {
+	i := g.searchPending(id)
+	if i < len(g.pending) && g.pending[i].id.cmp(id) == 0 {
+		return &g.pending[i], true
+	}
+	return nil, false
+}
+
+// ack removes entries from the PEL. Returns the number of removed entries.
+func (g *streamGroup) ack(ids []streamID) int {
+	n := 0
+	for _, id := range ids {
+		i := g.searchPending(id)
+		if i < len(g.pending) && g.pending[i].id.cmp(id) == 0 {
+			g.pending = append(g.pending[:i], g.pending[i+1:]...)
+			n++
+		}
+	}
+	return n
+}
+
+// deleteConsumer removes a consumer and its pending entries. Returns the
+// number of pending entries it had.
+func (g *streamGroup) deleteConsumer(name string) int {
+	if _, ok := g.consumers[name]; !ok {
+		return 0
+	}
+	delete(g.consumers, name)
+	var (
+		n       = 0
+		pending []pendingEntry
+	)
+	for _, p := range g.pending {
+		if p.consumer == name {
+			n++
+			continue
+		}
+		pending = append(pending, p)
+	}
+	g.pending = pending
+	return n
+}
+
+// lag is the number of entries not yet delivered to the group.
+func (g *streamGroup) lag() int {
+	return len(g.stream.after(g.lastID, 0))
+}
@@ -1,7 +1,12 @@
 package miniredis
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -41,3 +46,68 @@ func mustFail(tb testing.TB, err error, want string) {
 		tb.Errorf("have %q, want %q", have, want)
 	}
 }
+
+// rawConn is a minimal client which returns the replies exactly as sent by
+// the server. Useful for RESP3, which redigo doesn't support.
+type rawConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRawConn(tb testing.TB, addr string) *rawConn {
+	tb.Helper()
+	conn, err := net.Dial("tcp", addr)
+	ok(tb, err)
+	return &rawConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+// Do sends a command and returns the reply as a raw string.
+func (c *rawConn) Do(args ...string) string {
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return c.Read()
+}
+
+// Read reads a single reply, such as a push message. Returns "" on errors.
+func (c *rawConn) Read() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil || len(line) < 3 {
+		return ""
+	}
+	switch line[0] {
+	case '$', '=':
+		n, _ := strconv.Atoi(line[1 : len(line)-2])
+		if n < 0 {
+			return line
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return ""
+		}
+		return line + string(b)
+	case '*', '~', '>', '%', '|':
+		n, _ := strconv.Atoi(line[1 : len(line)-2])
+		if line[0] == '%' || line[0] == '|' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			line += c.Read()
+		}
+		if line[0] == '|' {
+			// attributes are followed by the actual reply
+			line += c.Read()
+		}
+		return line
+	default:
+		return line
+	}
+}
+
+func (c *rawConn) Close() {
+	c.conn.Close()
+}
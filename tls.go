@@ -0,0 +1,135 @@
+package miniredis
+
+// Throwaway certificates, so TLS can be tested without any files.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+)
+
+// TLSCerts are certificates made by NewTLSCerts(). The server and client
+// certificates are signed by CA.
+type TLSCerts struct {
+	CA     *x509.Certificate
+	Pool   *x509.CertPool // has CA
+	Server tls.Certificate
+	Client tls.Certificate
+}
+
+// NewTLSCerts makes a new CA, with a server certificate valid for the given
+// hosts, and a client certificate. Hosts can be names or IPs, and default to
+// "localhost" and "127.0.0.1". The certificates are valid for a day.
+func NewTLSCerts(hosts ...string) (*TLSCerts, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTmpl := certTemplate("miniredis CA")
+	caTmpl.IsCA = true
+	caTmpl.BasicConstraintsValid = true
+	caTmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	ca, err := signCert(caTmpl, caTmpl, caKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serverTmpl := certTemplate("miniredis")
+	serverTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			serverTmpl.IPAddresses = append(serverTmpl.IPAddresses, ip)
+		} else {
+			serverTmpl.DNSNames = append(serverTmpl.DNSNames, h)
+		}
+	}
+	server, err := leafCert(serverTmpl, ca.Leaf, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientTmpl := certTemplate("miniredis client")
+	clientTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	client, err := leafCert(clientTmpl, ca.Leaf, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	return &TLSCerts{
+		CA:     ca.Leaf,
+		Pool:   pool,
+		Server: server,
+		Client: client,
+	}, nil
+}
+
+// ServerConfig is a tls.Config for StartTLS(). With clientAuth set clients
+// need a certificate signed by the CA, such as c.Client.
+func (c *TLSCerts) ServerConfig(clientAuth bool) *tls.Config {
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{c.Server},
+	}
+	if clientAuth {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = c.Pool
+	}
+	return cfg
+}
+
+// ClientConfig is a tls.Config for clients, which trusts the CA and uses the
+// client certificate.
+func (c *TLSCerts) ClientConfig() *tls.Config {
+	return &tls.Config{
+		RootCAs:      c.Pool,
+		Certificates: []tls.Certificate{c.Client},
+	}
+}
+
+func certTemplate(cn string) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+}
+
+// leafCert makes a new key, and a certificate signed by parent.
+func leafCert(tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return signCert(tmpl, parent, key, parentKey)
+}
+
+func signCert(tmpl, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (tls.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
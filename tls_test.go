@@ -0,0 +1,94 @@
+package miniredis
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestTLS(t *testing.T) {
+	certs, err := NewTLSCerts()
+	ok(t, err)
+
+	t.Run("basic", func(t *testing.T) {
+		m, err := RunTLS(certs.ServerConfig(false))
+		ok(t, err)
+		defer m.Close()
+
+		cfg := &tls.Config{
+			RootCAs:    certs.Pool,
+			ServerName: "localhost",
+		}
+		c, err := redis.Dial("tcp", m.Addr(), redis.DialUseTLS(true), redis.DialTLSConfig(cfg))
+		ok(t, err)
+		defer c.Close()
+
+		_, err = c.Do("SET", "foo", "bar")
+		ok(t, err)
+		v, err := redis.String(c.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+
+		// plain connections don't work
+		plain, err := redis.Dial("tcp", m.Addr())
+		ok(t, err)
+		defer plain.Close()
+		_, err = plain.Do("PING")
+		assert(t, err != nil, "plain connection")
+
+		// restart keeps TLS
+		m.Close()
+		ok(t, m.Restart())
+		c2, err := redis.Dial("tcp", m.Addr(), redis.DialUseTLS(true), redis.DialTLSConfig(cfg))
+		ok(t, err)
+		defer c2.Close()
+		v, err = redis.String(c2.Do("GET", "foo"))
+		ok(t, err)
+		equals(t, "bar", v)
+	})
+
+	t.Run("server name", func(t *testing.T) {
+		m, err := RunTLS(certs.ServerConfig(false))
+		ok(t, err)
+		defer m.Close()
+
+		cfg := &tls.Config{
+			RootCAs:    certs.Pool,
+			ServerName: "redis.example.com",
+		}
+		c, err := redis.Dial("tcp", m.Addr(), redis.DialUseTLS(true), redis.DialTLSConfig(cfg))
+		if err == nil {
+			_, err = c.Do("PING")
+			c.Close()
+		}
+		assert(t, err != nil, "wrong server name")
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		m, err := RunTLS(certs.ServerConfig(true))
+		ok(t, err)
+		defer m.Close()
+
+		cfg := certs.ClientConfig()
+		cfg.ServerName = "127.0.0.1"
+		c, err := redis.Dial("tcp", m.Addr(), redis.DialUseTLS(true), redis.DialTLSConfig(cfg))
+		ok(t, err)
+		defer c.Close()
+		v, err := redis.String(c.Do("PING"))
+		ok(t, err)
+		equals(t, "PONG", v)
+
+		// no client certificate
+		cfg = &tls.Config{
+			RootCAs:    certs.Pool,
+			ServerName: "127.0.0.1",
+		}
+		c2, err := redis.Dial("tcp", m.Addr(), redis.DialUseTLS(true), redis.DialTLSConfig(cfg))
+		if err == nil {
+			_, err = c2.Do("PING")
+			c2.Close()
+		}
+		assert(t, err != nil, "no client certificate")
+	})
+}